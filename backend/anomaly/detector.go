@@ -0,0 +1,269 @@
+// Package anomaly 检测投票速度异常
+//
+// 每张投票都会被记录到若干个Redis有序集合中（与SlidingWindowRateLimiter相同的滑动窗口做法）：
+// 投票级、选项级的短窗口和基线窗口，以及投票内按IP前缀、User-Agent划分的短窗口。
+// 短窗口内的票数远超基线，或者短窗口内的票集中来自少数IP前缀/User-Agent时，
+// 该票被标记为可疑，由调用方决定如何处理（隔离等待审核）。
+package anomaly
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"realtime-voting-backend/cache"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// 异常原因
+const (
+	ReasonPollBurst        = "poll_burst"               // 投票整体速度突增
+	ReasonOptionBurst      = "option_burst"             // 单个选项速度突增
+	ReasonPrefixCluster    = "ip_prefix_concentration"  // 短时间内集中来自同一IP前缀
+	ReasonUserAgentCluster = "user_agent_concentration" // 短时间内集中来自同一User-Agent
+)
+
+// Config 异常检测配置
+type Config struct {
+	Enabled        bool
+	ShortWindow    time.Duration // 速度统计窗口
+	BaselineWindow time.Duration // 基线统计窗口
+	BurstFactor    float64       // 短窗口票数超过基线速度的倍数
+	MinBurst       int64         // 短窗口内至少达到的票数，低于此值不判定为突增
+	MinBaseline    int64         // 基线窗口中短窗口之前至少需要的票数，不足时没有可比较的基线，不判定为突增
+	MinSamples     int64         // 计算IP前缀/User-Agent集中度需要的最少样本数
+	PrefixShare    float64       // 同一IP前缀占比阈值
+	UserAgentShare float64       // 同一User-Agent占比阈值
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:        true,
+		ShortWindow:    time.Minute,
+		BaselineWindow: 30 * time.Minute,
+		BurstFactor:    5,
+		MinBurst:       100,
+		MinBaseline:    30,
+		MinSamples:     50,
+		PrefixShare:    0.7,
+		UserAgentShare: 0.9,
+	}
+}
+
+// LoadConfig 从环境变量读取配置，未设置或无效的项使用默认值
+func LoadConfig() Config {
+	cfg := DefaultConfig()
+
+	if os.Getenv("ANOMALY_DETECTION_ENABLED") == "false" {
+		cfg.Enabled = false
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANOMALY_SHORT_WINDOW")); err == nil && d > 0 {
+		cfg.ShortWindow = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANOMALY_BASELINE_WINDOW")); err == nil && d > cfg.ShortWindow {
+		cfg.BaselineWindow = d
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ANOMALY_BURST_FACTOR"), 64); err == nil && v > 1 {
+		cfg.BurstFactor = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ANOMALY_MIN_BURST"), 10, 64); err == nil && v > 0 {
+		cfg.MinBurst = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ANOMALY_MIN_BASELINE"), 10, 64); err == nil && v > 0 {
+		cfg.MinBaseline = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("ANOMALY_MIN_SAMPLES"), 10, 64); err == nil && v > 0 {
+		cfg.MinSamples = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ANOMALY_PREFIX_SHARE"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.PrefixShare = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ANOMALY_UA_SHARE"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.UserAgentShare = v
+	}
+
+	return cfg
+}
+
+// Vote 待检测的一张投票
+type Vote struct {
+	PollID    uint
+	OptionIDs []uint
+	IP        string
+	UserAgent string
+}
+
+// WindowCount 一个统计维度在短窗口和基线窗口内的票数
+type WindowCount struct {
+	Short    int64 `json:"short"`
+	Baseline int64 `json:"baseline"`
+}
+
+// Sample 一次检测用到的全部计数
+type Sample struct {
+	Poll      WindowCount          `json:"poll"`
+	Options   map[uint]WindowCount `json:"options"`
+	Prefix    int64                `json:"prefix"`     // 短窗口内与本票IP前缀相同的票数
+	UserAgent int64                `json:"user_agent"` // 短窗口内与本票User-Agent相同的票数
+}
+
+// Verdict 检测结果
+type Verdict struct {
+	Flagged  bool     `json:"flagged"`
+	Reasons  []string `json:"reasons"`
+	IPPrefix string   `json:"ip_prefix"`
+	Sample   Sample   `json:"sample"`
+}
+
+// Detector 异常检测器
+type Detector struct {
+	redisClient cache.RedisClient
+	cfg         Config
+}
+
+// NewDetector 创建新的异常检测器
+func NewDetector(client cache.RedisClient, cfg Config) *Detector {
+	return &Detector{
+		redisClient: client,
+		cfg:         cfg,
+	}
+}
+
+// Observe 记录一张投票并判断是否异常
+func (d *Detector) Observe(ctx context.Context, vote Vote) (*Verdict, error) {
+	if d.redisClient == nil {
+		return nil, cache.ErrRedisNotAvailable
+	}
+
+	prefix := IPPrefix(vote.IP)
+	base := fmt.Sprintf("anomaly:poll:%d", vote.PollID)
+
+	type counter struct {
+		key    string
+		window time.Duration
+		card   *redis.IntCmd
+	}
+
+	counters := []*counter{
+		{key: base + ":short", window: d.cfg.ShortWindow},
+		{key: base + ":baseline", window: d.cfg.BaselineWindow},
+		{key: base + ":prefix:" + prefix, window: d.cfg.ShortWindow},
+		{key: base + ":ua:" + userAgentHash(vote.UserAgent), window: d.cfg.ShortWindow},
+	}
+	for _, optionID := range vote.OptionIDs {
+		counters = append(counters,
+			&counter{key: fmt.Sprintf("%s:option:%d:short", base, optionID), window: d.cfg.ShortWindow},
+			&counter{key: fmt.Sprintf("%s:option:%d:baseline", base, optionID), window: d.cfg.BaselineWindow},
+		)
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	member := uuid.New().String()
+
+	pipe := d.redisClient.Pipeline()
+	for _, ctr := range counters {
+		windowStart := now - int64(ctr.window/time.Millisecond)
+		pipe.ZAdd(ctx, ctr.key, redis.Z{Score: float64(now), Member: member})
+		pipe.ZRemRangeByScore(ctx, ctr.key, "0", strconv.FormatInt(windowStart, 10))
+		ctr.card = pipe.ZCard(ctx, ctr.key)
+		pipe.Expire(ctx, ctr.key, ctr.window*2) // 设置过期时间，避免集合无限增长
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	sample := Sample{
+		Poll:      WindowCount{Short: counters[0].card.Val(), Baseline: counters[1].card.Val()},
+		Prefix:    counters[2].card.Val(),
+		UserAgent: counters[3].card.Val(),
+		Options:   make(map[uint]WindowCount, len(vote.OptionIDs)),
+	}
+	for i, optionID := range vote.OptionIDs {
+		sample.Options[optionID] = WindowCount{
+			Short:    counters[4+i*2].card.Val(),
+			Baseline: counters[5+i*2].card.Val(),
+		}
+	}
+
+	reasons := Evaluate(d.cfg, sample)
+	return &Verdict{
+		Flagged:  len(reasons) > 0,
+		Reasons:  reasons,
+		IPPrefix: prefix,
+		Sample:   sample,
+	}, nil
+}
+
+// Evaluate 根据计数判断异常，返回异常原因列表（为空表示正常）
+func Evaluate(cfg Config, sample Sample) []string {
+	reasons := []string{}
+
+	if isBurst(cfg, sample.Poll) {
+		reasons = append(reasons, ReasonPollBurst)
+	}
+	for _, count := range sample.Options {
+		if isBurst(cfg, count) {
+			reasons = append(reasons, ReasonOptionBurst)
+			break
+		}
+	}
+
+	if sample.Poll.Short >= cfg.MinSamples && sample.Poll.Short > 0 {
+		total := float64(sample.Poll.Short)
+		if float64(sample.Prefix)/total >= cfg.PrefixShare {
+			reasons = append(reasons, ReasonPrefixCluster)
+		}
+		if float64(sample.UserAgent)/total >= cfg.UserAgentShare {
+			reasons = append(reasons, ReasonUserAgentCluster)
+		}
+	}
+
+	return reasons
+}
+
+// isBurst 判断短窗口票数是否明显偏离基线
+// 基线速度用基线窗口中除去短窗口之外的部分估算，避免突增本身抬高基线
+// 新建的投票或长时间没有投票后，历史票数不足MinBaseline时无法估算基线速度，不做判定
+func isBurst(cfg Config, count WindowCount) bool {
+	if count.Short < cfg.MinBurst {
+		return false
+	}
+
+	history := count.Baseline - count.Short
+	if history < cfg.MinBaseline || history <= 0 {
+		return false
+	}
+	historyWindow := cfg.BaselineWindow - cfg.ShortWindow
+	if historyWindow <= 0 {
+		return false
+	}
+
+	expected := float64(history) * float64(cfg.ShortWindow) / float64(historyWindow)
+	return float64(count.Short) > cfg.BurstFactor*expected
+}
+
+// IPPrefix 返回IP所属的网段：IPv4取/24，IPv6取/48
+func IPPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "unknown"
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// userAgentHash 将User-Agent压缩为定长键
+func userAgentHash(userAgent string) string {
+	sum := sha1.Sum([]byte(userAgent))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,96 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() Config {
+	return Config{
+		Enabled:        true,
+		ShortWindow:    time.Minute,
+		BaselineWindow: 11 * time.Minute,
+		BurstFactor:    5,
+		MinBurst:       20,
+		MinBaseline:    10,
+		MinSamples:     20,
+		PrefixShare:    0.7,
+		UserAgentShare: 0.9,
+	}
+}
+
+func TestEvaluate_SteadyTrafficIsNotFlagged(t *testing.T) {
+	// 10 votes per minute for the last 10 minutes, 25 in the current minute
+	sample := Sample{
+		Poll:      WindowCount{Short: 25, Baseline: 125},
+		Options:   map[uint]WindowCount{1: {Short: 10, Baseline: 50}},
+		Prefix:    3,
+		UserAgent: 5,
+	}
+	assert.Empty(t, Evaluate(testConfig(), sample))
+}
+
+func TestEvaluate_BurstAgainstBaseline(t *testing.T) {
+	sample := Sample{
+		Poll:      WindowCount{Short: 200, Baseline: 300},
+		Options:   map[uint]WindowCount{1: {Short: 190, Baseline: 200}},
+		Prefix:    10,
+		UserAgent: 20,
+	}
+	reasons := Evaluate(testConfig(), sample)
+	assert.Contains(t, reasons, ReasonPollBurst)
+	assert.Contains(t, reasons, ReasonOptionBurst)
+	assert.NotContains(t, reasons, ReasonPrefixCluster)
+}
+
+func TestEvaluate_BelowMinBurstIsIgnored(t *testing.T) {
+	sample := Sample{
+		Poll:    WindowCount{Short: 15, Baseline: 15},
+		Options: map[uint]WindowCount{1: {Short: 15, Baseline: 15}},
+	}
+	assert.Empty(t, Evaluate(testConfig(), sample))
+}
+
+func TestEvaluate_NoBaselineIsNotABurst(t *testing.T) {
+	// A brand-new poll: every vote so far falls inside the short window
+	sample := Sample{
+		Poll:    WindowCount{Short: 200, Baseline: 200},
+		Options: map[uint]WindowCount{1: {Short: 150, Baseline: 150}},
+	}
+	assert.Empty(t, Evaluate(testConfig(), sample))
+
+	// Too little history to estimate a rate from
+	sample = Sample{
+		Poll:    WindowCount{Short: 200, Baseline: 209},
+		Options: map[uint]WindowCount{1: {Short: 150, Baseline: 155}},
+	}
+	assert.Empty(t, Evaluate(testConfig(), sample))
+
+	// Once the baseline has enough votes the same spike is flagged
+	sample = Sample{
+		Poll:    WindowCount{Short: 200, Baseline: 210},
+		Options: map[uint]WindowCount{1: {Short: 150, Baseline: 160}},
+	}
+	reasons := Evaluate(testConfig(), sample)
+	assert.Contains(t, reasons, ReasonPollBurst)
+	assert.Contains(t, reasons, ReasonOptionBurst)
+}
+
+func TestEvaluate_Concentration(t *testing.T) {
+	sample := Sample{
+		Poll:      WindowCount{Short: 40, Baseline: 400},
+		Options:   map[uint]WindowCount{},
+		Prefix:    35,
+		UserAgent: 38,
+	}
+	reasons := Evaluate(testConfig(), sample)
+	assert.Equal(t, []string{ReasonPrefixCluster, ReasonUserAgentCluster}, reasons)
+}
+
+func TestIPPrefix(t *testing.T) {
+	assert.Equal(t, "203.0.113.0/24", IPPrefix("203.0.113.57"))
+	assert.Equal(t, "2001:db8:1::/48", IPPrefix("2001:db8:1:2::5"))
+	assert.Equal(t, "unknown", IPPrefix("not-an-ip"))
+}
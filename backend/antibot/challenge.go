@@ -0,0 +1,174 @@
+package antibot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/cache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrChallengeNotFound 挑战不存在、已过期或已被使用
+	ErrChallengeNotFound = errors.New("挑战不存在、已过期或已被使用")
+
+	// ErrChallengeMismatch 挑战不属于当前投票
+	ErrChallengeMismatch = errors.New("挑战不属于当前投票")
+
+	// ErrInvalidSolution 工作量证明校验失败
+	ErrInvalidSolution = errors.New("工作量证明无效")
+
+	// ErrStoreUnavailable 挑战存储暂时不可用，客户端应稍后重试而不是重新求解
+	ErrStoreUnavailable = errors.New("挑战存储暂时不可用")
+)
+
+// 原子地读取并删除挑战，保证每个挑战只能兑换一次
+const redeemScript = `
+local value = redis.call("GET", KEYS[1])
+if value then
+	redis.call("DEL", KEYS[1])
+end
+return value
+`
+
+// Challenge 下发给客户端的挑战
+type Challenge struct {
+	Nonce      string    `json:"nonce"`
+	Difficulty int       `json:"difficulty"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Redis不可用时使用的进程内挑战存储（仅适用于单实例部署）
+var (
+	memoryChallenges   = make(map[string]memoryChallenge)
+	memoryChallengesMu sync.Mutex
+)
+
+type memoryChallenge struct {
+	pollID     uint
+	difficulty int
+	expiresAt  time.Time
+}
+
+// challengeKey 挑战在Redis中的键
+func challengeKey(nonce string) string {
+	return fmt.Sprintf("pow_challenge:%s", nonce)
+}
+
+// IssueChallenge 为投票生成挑战并保存，client为nil时使用进程内存储
+func IssueChallenge(ctx context.Context, client cache.RedisClient, pollID uint, difficulty int, ttl time.Duration) (*Challenge, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, fmt.Errorf("生成nonce失败: %v", err)
+	}
+
+	challenge := &Challenge{
+		Nonce:      nonce,
+		Difficulty: difficulty,
+		Algorithm:  Algorithm,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+
+	if client == nil {
+		memoryChallengesMu.Lock()
+		defer memoryChallengesMu.Unlock()
+
+		// 顺便清理过期的挑战
+		now := time.Now()
+		for key, stored := range memoryChallenges {
+			if now.After(stored.expiresAt) {
+				delete(memoryChallenges, key)
+			}
+		}
+
+		memoryChallenges[nonce] = memoryChallenge{
+			pollID:     pollID,
+			difficulty: difficulty,
+			expiresAt:  challenge.ExpiresAt,
+		}
+		return challenge, nil
+	}
+
+	value := fmt.Sprintf("%d:%d", pollID, difficulty)
+	if err := client.Set(ctx, challengeKey(nonce), value, ttl).Err(); err != nil {
+		return nil, fmt.Errorf("保存挑战失败: %v", err)
+	}
+
+	return challenge, nil
+}
+
+// RedeemChallenge 兑换挑战并校验solution
+// 无论校验是否通过，挑战都会被消耗，客户端需要重新获取
+func RedeemChallenge(ctx context.Context, client cache.RedisClient, pollID uint, nonce, solution string) error {
+	if nonce == "" || solution == "" {
+		return ErrChallengeNotFound
+	}
+
+	storedPollID, difficulty, err := takeChallenge(ctx, client, nonce)
+	if err != nil {
+		return err
+	}
+
+	if storedPollID != pollID {
+		return ErrChallengeMismatch
+	}
+	if !Verify(nonce, solution, difficulty) {
+		return ErrInvalidSolution
+	}
+
+	return nil
+}
+
+// takeChallenge 取出并删除挑战，返回所属投票ID和难度
+func takeChallenge(ctx context.Context, client cache.RedisClient, nonce string) (uint, int, error) {
+	if client == nil {
+		memoryChallengesMu.Lock()
+		defer memoryChallengesMu.Unlock()
+
+		stored, ok := memoryChallenges[nonce]
+		if !ok {
+			return 0, 0, ErrChallengeNotFound
+		}
+		delete(memoryChallenges, nonce)
+
+		if time.Now().After(stored.expiresAt) {
+			return 0, 0, ErrChallengeNotFound
+		}
+		return stored.pollID, stored.difficulty, nil
+	}
+
+	result, err := client.Eval(ctx, redeemScript, []string{challengeKey(nonce)}).Result()
+	if err != nil && err != redis.Nil {
+		return 0, 0, fmt.Errorf("%w: 读取挑战失败: %v", ErrStoreUnavailable, err)
+	}
+	if err == redis.Nil || result == nil {
+		return 0, 0, ErrChallengeNotFound
+	}
+
+	value, ok := result.(string)
+	if !ok {
+		return 0, 0, ErrChallengeNotFound
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, ErrChallengeNotFound
+	}
+	pollID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, ErrChallengeNotFound
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, ErrChallengeNotFound
+	}
+
+	return uint(pollID), difficulty, nil
+}
@@ -0,0 +1,133 @@
+// Package antibot 实现基于工作量证明（Proof-of-Work）的防刷票机制
+//
+// 客户端先获取挑战（随机nonce和难度），然后寻找一个solution，
+// 使 sha256(nonce + ":" + solution) 的前导零比特数不少于难度值。
+// 服务端只需计算一次哈希即可校验，不依赖任何第三方验证码服务，
+// 可以在离线（内网隔离）环境中使用。
+package antibot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Algorithm 挑战使用的哈希算法，返回给客户端
+const Algorithm = "sha256"
+
+// Config 工作量证明配置
+type Config struct {
+	BaseDifficulty   int           // 正常流量下的难度（前导零比特数）
+	MaxDifficulty    int           // 难度上限
+	VelocityBaseline int64         // 统计窗口内的基线投票数，超过后开始提升难度
+	VelocityWindow   time.Duration // 投票速度统计窗口
+	ChallengeTTL     time.Duration // 挑战有效期
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		BaseDifficulty:   16,
+		MaxDifficulty:    24,
+		VelocityBaseline: 60,
+		VelocityWindow:   time.Minute,
+		ChallengeTTL:     5 * time.Minute,
+	}
+}
+
+// LoadConfig 从环境变量读取配置，未设置或无效的项使用默认值
+//
+//	POW_BASE_DIFFICULTY    基础难度
+//	POW_MAX_DIFFICULTY     最大难度
+//	POW_VELOCITY_BASELINE  每个统计窗口内的基线投票数
+//	POW_VELOCITY_WINDOW    统计窗口，如 1m
+//	POW_CHALLENGE_TTL      挑战有效期，如 5m
+func LoadConfig() Config {
+	cfg := DefaultConfig()
+
+	if v, err := strconv.Atoi(os.Getenv("POW_BASE_DIFFICULTY")); err == nil && v > 0 && v <= 256 {
+		cfg.BaseDifficulty = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("POW_MAX_DIFFICULTY")); err == nil && v > 0 && v <= 256 {
+		cfg.MaxDifficulty = v
+	}
+	if cfg.MaxDifficulty < cfg.BaseDifficulty {
+		cfg.MaxDifficulty = cfg.BaseDifficulty
+	}
+	if v, err := strconv.ParseInt(os.Getenv("POW_VELOCITY_BASELINE"), 10, 64); err == nil && v > 0 {
+		cfg.VelocityBaseline = v
+	}
+	if d, err := time.ParseDuration(os.Getenv("POW_VELOCITY_WINDOW")); err == nil && d > 0 {
+		cfg.VelocityWindow = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("POW_CHALLENGE_TTL")); err == nil && d > 0 {
+		cfg.ChallengeTTL = d
+	}
+
+	return cfg
+}
+
+// Difficulty 根据当前投票速度计算难度
+// 速度不超过基线时使用基础难度；超过后速度每翻一倍难度增加1比特（求解耗时随之翻倍），
+// 直到达到上限
+func (cfg Config) Difficulty(velocity int64) int {
+	if cfg.VelocityBaseline <= 0 || velocity <= cfg.VelocityBaseline {
+		return cfg.BaseDifficulty
+	}
+
+	ratio := float64(velocity) / float64(cfg.VelocityBaseline)
+	difficulty := cfg.BaseDifficulty + int(math.Ceil(math.Log2(ratio)))
+	if difficulty > cfg.MaxDifficulty {
+		difficulty = cfg.MaxDifficulty
+	}
+	return difficulty
+}
+
+// NewNonce 生成随机nonce
+func NewNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// LeadingZeroBits 计算哈希值的前导零比特数
+func LeadingZeroBits(sum []byte) int {
+	count := 0
+	for _, b := range sum {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		count += bits.LeadingZeros8(b)
+		break
+	}
+	return count
+}
+
+// Verify 校验solution是否满足难度要求
+func Verify(nonce, solution string, difficulty int) bool {
+	if nonce == "" || solution == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(nonce + ":" + solution))
+	return LeadingZeroBits(sum[:]) >= difficulty
+}
+
+// Solve 暴力搜索满足难度的solution，供测试和命令行客户端使用
+// 超过maxAttempts次仍未找到时返回false
+func Solve(nonce string, difficulty int, maxAttempts uint64) (string, bool) {
+	for i := uint64(0); i < maxAttempts; i++ {
+		solution := strconv.FormatUint(i, 10)
+		if Verify(nonce, solution, difficulty) {
+			return solution, true
+		}
+	}
+	return "", false
+}
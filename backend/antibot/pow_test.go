@@ -0,0 +1,78 @@
+package antibot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, LeadingZeroBits([]byte{0x80}))
+	assert.Equal(t, 7, LeadingZeroBits([]byte{0x01}))
+	assert.Equal(t, 12, LeadingZeroBits([]byte{0x00, 0x0f}))
+	assert.Equal(t, 16, LeadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func TestSolveAndVerify(t *testing.T) {
+	solution, ok := Solve("test-nonce", 8, 1<<20)
+	require.True(t, ok)
+	assert.True(t, Verify("test-nonce", solution, 8))
+	assert.False(t, Verify("other-nonce", solution, 24))
+	assert.False(t, Verify("test-nonce", "", 0))
+}
+
+func TestDifficulty_ScalesWithVelocity(t *testing.T) {
+	cfg := Config{BaseDifficulty: 16, MaxDifficulty: 20, VelocityBaseline: 100}
+
+	assert.Equal(t, 16, cfg.Difficulty(0))
+	assert.Equal(t, 16, cfg.Difficulty(100))
+	assert.Equal(t, 17, cfg.Difficulty(200))
+	assert.Equal(t, 18, cfg.Difficulty(350))
+	assert.Equal(t, 20, cfg.Difficulty(100000))
+}
+
+func TestRedeemChallenge_OnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	challenge, err := IssueChallenge(ctx, nil, 7, 4, time.Minute)
+	require.NoError(t, err)
+
+	solution, ok := Solve(challenge.Nonce, challenge.Difficulty, 1<<16)
+	require.True(t, ok)
+
+	require.NoError(t, RedeemChallenge(ctx, nil, 7, challenge.Nonce, solution))
+	assert.ErrorIs(t, RedeemChallenge(ctx, nil, 7, challenge.Nonce, solution), ErrChallengeNotFound)
+}
+
+func TestRedeemChallenge_RejectsOtherPollAndExpired(t *testing.T) {
+	ctx := context.Background()
+
+	challenge, err := IssueChallenge(ctx, nil, 1, 0, time.Minute)
+	require.NoError(t, err)
+	assert.ErrorIs(t, RedeemChallenge(ctx, nil, 2, challenge.Nonce, "x"), ErrChallengeMismatch)
+
+	expired, err := IssueChallenge(ctx, nil, 1, 0, -time.Second)
+	require.NoError(t, err)
+	assert.ErrorIs(t, RedeemChallenge(ctx, nil, 1, expired.Nonce, "x"), ErrChallengeNotFound)
+}
+
+func TestRedeemChallenge_RedisErrors(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+
+	challenge, err := IssueChallenge(ctx, client, 3, 0, time.Minute)
+	require.NoError(t, err)
+	assert.ErrorIs(t, RedeemChallenge(ctx, client, 3, "missing", "x"), ErrChallengeNotFound)
+
+	// A Redis outage must not look like a used challenge, or the client would re-solve for nothing
+	server.Close()
+	err = RedeemChallenge(ctx, client, 3, challenge.Nonce, "x")
+	assert.ErrorIs(t, err, ErrStoreUnavailable)
+	assert.NotErrorIs(t, err, ErrChallengeNotFound)
+}
@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// GenesisHash 哈希链第一条记录的PrevHash
+var GenesisHash = strings.Repeat("0", 64)
+
+// 追加记录时的重试次数（多实例并发写入时序号可能冲突）
+const maxAppendRetries = 3
+
+// 同一实例内串行化追加操作
+var appendMu sync.Mutex
+
+// Entry 待写入的审计条目
+type Entry struct {
+	Actor  string
+	Action string
+	Target string
+	Before interface{}
+	After  interface{}
+	IP     string
+}
+
+// DiffEntry 单个字段的变更
+type DiffEntry struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Record 追加一条审计记录，并将其链接到当前链尾
+func Record(db *gorm.DB, entry Entry) (*models.AuditLog, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+
+	before, err := encodeState(entry.Before)
+	if err != nil {
+		return nil, fmt.Errorf("序列化操作前状态失败: %v", err)
+	}
+	after, err := encodeState(entry.After)
+	if err != nil {
+		return nil, fmt.Errorf("序列化操作后状态失败: %v", err)
+	}
+	diff, err := json.Marshal(Diff(entry.Before, entry.After))
+	if err != nil {
+		return nil, fmt.Errorf("序列化变更失败: %v", err)
+	}
+
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	var lastErr error
+	for attempt := 0; attempt < maxAppendRetries; attempt++ {
+		record := &models.AuditLog{
+			Actor:  entry.Actor,
+			Action: entry.Action,
+			Target: entry.Target,
+			Before: before,
+			After:  after,
+			Diff:   string(diff),
+			IP:     entry.IP,
+			// 截断到秒，避免不同数据库的时间精度导致哈希不一致
+			CreatedAt: time.Now().Truncate(time.Second),
+		}
+
+		lastErr = db.Transaction(func(tx *gorm.DB) error {
+			var last models.AuditLog
+			result := tx.Order("seq desc").Limit(1).Find(&last)
+			if result.Error != nil {
+				return fmt.Errorf("读取链尾失败: %v", result.Error)
+			}
+
+			if result.RowsAffected == 0 {
+				record.Seq = 1
+				record.PrevHash = GenesisHash
+			} else {
+				record.Seq = last.Seq + 1
+				record.PrevHash = last.Hash
+			}
+			record.Hash = ComputeHash(record)
+
+			return tx.Create(record).Error
+		})
+
+		if lastErr == nil {
+			return record, nil
+		}
+		log.Printf("写入审计日志失败 (尝试 %d/%d): %v", attempt+1, maxAppendRetries, lastErr)
+	}
+
+	return nil, lastErr
+}
+
+// ComputeHash 计算审计记录的哈希值，覆盖除ID和Hash外的全部字段
+func ComputeHash(record *models.AuditLog) string {
+	canonical := strings.Join([]string{
+		fmt.Sprintf("%d", record.Seq),
+		record.Actor,
+		record.Action,
+		record.Target,
+		record.Before,
+		record.After,
+		record.Diff,
+		record.IP,
+		fmt.Sprintf("%d", record.CreatedAt.Unix()),
+		record.PrevHash,
+	}, "\x1f")
+
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// Diff 比较操作前后的状态，返回发生变化的字段
+// 状态先序列化为JSON对象再逐字段比较，非对象类型整体作为"value"字段比较
+func Diff(before, after interface{}) map[string]DiffEntry {
+	beforeMap := toFieldMap(before)
+	afterMap := toFieldMap(after)
+
+	diff := make(map[string]DiffEntry)
+	for key, oldValue := range beforeMap {
+		newValue, exists := afterMap[key]
+		if !exists {
+			diff[key] = DiffEntry{Before: oldValue, After: nil}
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diff[key] = DiffEntry{Before: oldValue, After: newValue}
+		}
+	}
+	for key, newValue := range afterMap {
+		if _, exists := beforeMap[key]; !exists {
+			diff[key] = DiffEntry{Before: nil, After: newValue}
+		}
+	}
+
+	return diff
+}
+
+// encodeState 将状态序列化为JSON字符串，nil返回空字符串
+func encodeState(state interface{}) (string, error) {
+	if isNil(state) {
+		return "", nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toFieldMap 将任意状态转换为字段映射
+func toFieldMap(state interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if isNil(state) {
+		return fields
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fields
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// 不是JSON对象，整体作为一个字段比较
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err == nil {
+			return map[string]interface{}{"value": value}
+		}
+	}
+
+	return fields
+}
+
+// isNil 判断状态是否为nil（包括持有nil指针的接口）
+func isNil(state interface{}) bool {
+	if state == nil {
+		return true
+	}
+	value := reflect.ValueOf(state)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"testing"
+
+	"realtime-voting-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupAuditDB creates an isolated in-memory database with the audit table migrated.
+func setupAuditDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func recordSampleEntries(t *testing.T, db *gorm.DB, n int) []*models.AuditLog {
+	records := make([]*models.AuditLog, 0, n)
+	for i := 0; i < n; i++ {
+		record, err := Record(db, Entry{
+			Actor:  "admin",
+			Action: "poll.reset",
+			Target: "poll:1",
+			Before: map[string]int{"votes": i + 10},
+			After:  map[string]int{"votes": 0},
+			IP:     "127.0.0.1",
+		})
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRecord_ChainsEntries(t *testing.T) {
+	db := setupAuditDB(t)
+	records := recordSampleEntries(t, db, 3)
+
+	assert.Equal(t, uint64(1), records[0].Seq)
+	assert.Equal(t, GenesisHash, records[0].PrevHash)
+	assert.Equal(t, records[0].Hash, records[1].PrevHash)
+	assert.Equal(t, records[1].Hash, records[2].PrevHash)
+	assert.Contains(t, records[0].Diff, `"votes"`)
+
+	report, err := Verify(db)
+	require.NoError(t, err)
+	assert.True(t, report.Valid)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, uint64(3), report.HeadSeq)
+	assert.Equal(t, records[2].Hash, report.HeadHash)
+}
+
+func TestVerify_DetectsModifiedEntry(t *testing.T) {
+	db := setupAuditDB(t)
+	records := recordSampleEntries(t, db, 3)
+
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("id = ?", records[1].ID).
+		Update("actor", "someone-else").Error)
+
+	report, err := Verify(db)
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, uint64(2), report.Problems[0].Seq)
+}
+
+func TestVerify_DetectsGap(t *testing.T) {
+	db := setupAuditDB(t)
+	records := recordSampleEntries(t, db, 4)
+
+	require.NoError(t, db.Delete(&models.AuditLog{}, records[1].ID).Error)
+
+	report, err := Verify(db)
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+
+	// The third entry reports both the sequence gap and the broken PrevHash link
+	require.Len(t, report.Problems, 2)
+	for _, problem := range report.Problems {
+		assert.Equal(t, uint64(3), problem.Seq)
+	}
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"realtime-voting-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 单次查询最多返回的记录数
+const maxQueryLimit = 500
+
+// 校验时每批读取的记录数
+const verifyBatchSize = 1000
+
+// Filter 审计日志查询条件，零值字段不参与过滤
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// Query 按条件查询审计日志，按序号倒序返回，同时返回匹配总数
+func Query(db *gorm.DB, filter Filter) ([]models.AuditLog, int64, error) {
+	query := db.Model(&models.AuditLog{})
+
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计审计日志失败: %v", err)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxQueryLimit {
+		limit = 50
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("seq desc").Limit(limit).Offset(filter.Offset).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %v", err)
+	}
+
+	return logs, total, nil
+}
+
+// Problem 校验发现的问题
+type Problem struct {
+	Seq     uint64 `json:"seq"`
+	ID      uint   `json:"id"`
+	Problem string `json:"problem"`
+}
+
+// VerifyReport 哈希链校验结果
+type VerifyReport struct {
+	Valid    bool      `json:"valid"`
+	Checked  int       `json:"checked"`
+	HeadSeq  uint64    `json:"head_seq"`
+	HeadHash string    `json:"head_hash"`
+	Problems []Problem `json:"problems"`
+}
+
+// Verify 按序号遍历整条哈希链，检测序号缺失、链接断裂和内容被修改的记录
+// 链尾被截断无法仅凭链本身发现，运维方应定期将HeadSeq和HeadHash保存到外部
+func Verify(db *gorm.DB) (*VerifyReport, error) {
+	report := &VerifyReport{Problems: []Problem{}}
+
+	expectedSeq := uint64(1)
+	prevHash := GenesisHash
+	var lastSeq uint64
+
+	for {
+		var batch []models.AuditLog
+		if err := db.Where("seq > ?", lastSeq).Order("seq asc").Limit(verifyBatchSize).Find(&batch).Error; err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for i := range batch {
+			record := &batch[i]
+			report.Checked++
+
+			if record.Seq != expectedSeq {
+				report.Problems = append(report.Problems, Problem{
+					Seq:     record.Seq,
+					ID:      record.ID,
+					Problem: fmt.Sprintf("序号不连续: 期望 %d，实际 %d（缺失 %d 条记录）", expectedSeq, record.Seq, record.Seq-expectedSeq),
+				})
+			}
+
+			if record.PrevHash != prevHash {
+				report.Problems = append(report.Problems, Problem{
+					Seq:     record.Seq,
+					ID:      record.ID,
+					Problem: "PrevHash与上一条记录的Hash不一致",
+				})
+			}
+
+			if ComputeHash(record) != record.Hash {
+				report.Problems = append(report.Problems, Problem{
+					Seq:     record.Seq,
+					ID:      record.ID,
+					Problem: "记录内容与Hash不匹配，可能已被修改",
+				})
+			}
+
+			expectedSeq = record.Seq + 1
+			prevHash = record.Hash
+			lastSeq = record.Seq
+			report.HeadSeq = record.Seq
+			report.HeadHash = record.Hash
+		}
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report, nil
+}
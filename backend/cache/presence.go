@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 峰值人数键的保留时间，投票结束后自动清理
+const presencePeakTTL = 30 * 24 * time.Hour
+
+// presenceScript 上报本实例的在线人数，返回所有实例的合计人数和峰值
+// KEYS[1] 各实例人数的哈希，字段为实例ID，值为 "人数:上报时间"
+// KEYS[2] 峰值人数
+// ARGV[1] 实例ID，ARGV[2] 人数（为空时只读取），ARGV[3] 当前Unix秒，ARGV[4] 上报过期秒数，ARGV[5] 峰值保留秒数
+// 超过过期时间未上报的实例视为已下线，不计入合计
+const presenceScript = `
+local now = tonumber(ARGV[3])
+local stale = tonumber(ARGV[4])
+if ARGV[2] ~= '' then
+	if tonumber(ARGV[2]) > 0 then
+		redis.call('HSET', KEYS[1], ARGV[1], ARGV[2] .. ':' .. ARGV[3])
+	else
+		redis.call('HDEL', KEYS[1], ARGV[1])
+	end
+end
+local total = 0
+local entries = redis.call('HGETALL', KEYS[1])
+for i = 1, #entries, 2 do
+	local count, at = string.match(entries[i + 1], '^(%d+):(%d+)$')
+	if count and now - tonumber(at) <= stale then
+		total = total + tonumber(count)
+	else
+		redis.call('HDEL', KEYS[1], entries[i])
+	end
+end
+if total > 0 then
+	redis.call('EXPIRE', KEYS[1], stale * 2)
+end
+local peak = tonumber(redis.call('GET', KEYS[2]) or '0')
+if total > peak then
+	peak = total
+	redis.call('SET', KEYS[2], peak, 'EX', tonumber(ARGV[5]))
+end
+return {total, peak}
+`
+
+// Presence 投票的在线人数
+type Presence struct {
+	Viewers int64 `json:"viewers"`      // 当前在线人数
+	Peak    int64 `json:"peak_viewers"` // 峰值人数
+}
+
+// PresenceTracker 汇总各实例上报的投票在线人数
+// Redis可用时合计所有实例，不可用时只统计本实例
+type PresenceTracker struct {
+	staleAfter time.Duration // 实例超过该时间未上报视为下线
+
+	mu    sync.Mutex
+	local map[uint]Presence // 本实例的人数和峰值
+}
+
+// NewPresenceTracker 创建在线人数统计器，各实例需在staleAfter内重新上报
+func NewPresenceTracker(staleAfter time.Duration) *PresenceTracker {
+	return &PresenceTracker{staleAfter: staleAfter, local: make(map[uint]Presence)}
+}
+
+// presenceKeys 在线人数和峰值键
+func presenceKeys(pollID uint) []string {
+	return []string{
+		fmt.Sprintf("poll:%d:viewers", pollID),
+		fmt.Sprintf("poll:%d:viewers_peak", pollID),
+	}
+}
+
+// Report 上报本实例的在线人数，返回所有实例的合计，client为nil或Redis出错时只统计本实例
+func (p *PresenceTracker) Report(ctx context.Context, client RedisClient, instanceID string, pollID uint, viewers int64) Presence {
+	local := p.recordLocal(pollID, viewers)
+	if client == nil {
+		return local
+	}
+
+	presence, err := p.eval(ctx, client, instanceID, pollID, fmt.Sprint(viewers))
+	if err != nil {
+		return local
+	}
+	return presence
+}
+
+// Get 读取投票当前的在线人数，不上报本实例
+func (p *PresenceTracker) Get(ctx context.Context, client RedisClient, pollID uint) Presence {
+	p.mu.Lock()
+	local := p.local[pollID]
+	p.mu.Unlock()
+
+	if client == nil {
+		return local
+	}
+	presence, err := p.eval(ctx, client, "", pollID, "")
+	if err != nil {
+		return local
+	}
+	return presence
+}
+
+func (p *PresenceTracker) eval(ctx context.Context, client RedisClient, instanceID string, pollID uint, viewers string) (Presence, error) {
+	values, err := client.Eval(ctx, presenceScript, presenceKeys(pollID),
+		instanceID, viewers, time.Now().Unix(), int64(p.staleAfter/time.Second), int64(presencePeakTTL/time.Second)).Int64Slice()
+	if err != nil {
+		return Presence{}, err
+	}
+	if len(values) != 2 {
+		return Presence{}, fmt.Errorf("在线人数脚本返回了%d个值", len(values))
+	}
+	return Presence{Viewers: values[0], Peak: values[1]}, nil
+}
+
+// recordLocal 记录本实例的人数和峰值
+func (p *PresenceTracker) recordLocal(pollID uint, viewers int64) Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	presence := p.local[pollID]
+	presence.Viewers = viewers
+	if viewers > presence.Peak {
+		presence.Peak = viewers
+	}
+	p.local[pollID] = presence
+	return presence
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -148,6 +149,7 @@ type UserRateLimiter struct {
 	keyPrefix     string
 	rate          int
 	burst         int
+	mu            sync.Mutex
 	limiters      map[string]RateLimiter
 }
 
@@ -165,6 +167,8 @@ func NewUserRateLimiter(client RedisClient, keyPrefix string, globalRate, global
 
 // GetUserLimiter 获取用户的限流器
 func (l *UserRateLimiter) GetUserLimiter(userID string) RateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if limiter, ok := l.limiters[userID]; ok {
 		return limiter
 	}
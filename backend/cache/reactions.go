@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 表情计数键的保留时间，投票结束后自动清理
+const reactionTTL = 30 * 24 * time.Hour
+
+// ReactionCounter 按投票累计表情数
+// Redis可用时所有实例共用同一组计数，不可用时只统计本实例
+type ReactionCounter struct {
+	mu    sync.Mutex
+	local map[uint]map[string]int64
+}
+
+// NewReactionCounter 创建表情计数器
+func NewReactionCounter() *ReactionCounter {
+	return &ReactionCounter{local: make(map[uint]map[string]int64)}
+}
+
+// reactionKey 投票的表情计数哈希，字段为表情名称
+func reactionKey(pollID uint) string {
+	return fmt.Sprintf("poll:%d:reactions", pollID)
+}
+
+// Add 为投票的某个表情计数加一，client为nil或Redis出错时计入本实例
+func (r *ReactionCounter) Add(ctx context.Context, client RedisClient, pollID uint, reaction string) {
+	if client != nil {
+		key := reactionKey(pollID)
+		if err := client.HIncrBy(ctx, key, reaction, 1).Err(); err == nil {
+			client.Expire(ctx, key, reactionTTL)
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts, ok := r.local[pollID]
+	if !ok {
+		counts = make(map[string]int64)
+		r.local[pollID] = counts
+	}
+	counts[reaction]++
+}
+
+// Counts 读取投票各表情的累计数
+func (r *ReactionCounter) Counts(ctx context.Context, client RedisClient, pollID uint) map[string]int64 {
+	counts := make(map[string]int64)
+
+	if client != nil {
+		if values, err := client.HGetAll(ctx, reactionKey(pollID)).Result(); err == nil {
+			for reaction, value := range values {
+				if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+					counts[reaction] = n
+				}
+			}
+		}
+	}
+
+	// Redis出错期间计入本实例的部分同样计入合计
+	r.mu.Lock()
+	for reaction, n := range r.local[pollID] {
+		counts[reaction] += n
+	}
+	r.mu.Unlock()
+	return counts
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// nextSeqScript 递增序号，且保证不小于本实例已见过的最大序号
+// Redis数据丢失或故障期间本实例降级为本地计数后，序号仍然单调递增
+const nextSeqScript = `
+local v = redis.call('INCR', KEYS[1])
+local floor = tonumber(ARGV[1])
+if v <= floor then
+	v = floor + 1
+	redis.call('SET', KEYS[1], v)
+end
+return v
+`
+
+// PollSequencer 为每个投票的实时更新分配单调递增的序号
+// Redis可用时序号在所有实例之间共享，不可用时退化为本地计数
+type PollSequencer struct {
+	name string // 序号名称，不同的推送通道使用各自独立的序号
+	mu   sync.Mutex
+	last map[uint]uint64 // 本实例分配或见过的最大序号
+}
+
+// NewPollSequencer 创建序号分配器，序号保存在键 poll:<投票ID>:<name> 中
+func NewPollSequencer(name string) *PollSequencer {
+	return &PollSequencer{name: name, last: make(map[uint]uint64)}
+}
+
+// sequenceKey 投票更新序号键
+func (s *PollSequencer) sequenceKey(pollID uint) string {
+	return fmt.Sprintf("poll:%d:%s", pollID, s.name)
+}
+
+// Next 分配下一个序号，client为nil或Redis出错时使用本地计数
+func (s *PollSequencer) Next(ctx context.Context, client RedisClient, pollID uint) uint64 {
+	floor := s.Current(pollID)
+
+	if client != nil {
+		seq, err := client.Eval(ctx, nextSeqScript, []string{s.sequenceKey(pollID)}, floor).Uint64()
+		if err == nil {
+			s.Observe(pollID, seq)
+			return seq
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[pollID]++
+	return s.last[pollID]
+}
+
+// Observe 记录从其他实例收到的序号
+func (s *PollSequencer) Observe(pollID uint, seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq > s.last[pollID] {
+		s.last[pollID] = seq
+	}
+}
+
+// Current 返回本实例已知的最大序号
+func (s *PollSequencer) Current(pollID uint) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last[pollID]
+}
+
+// Sync 从Redis读取投票当前的序号并合并到本地，用于刚启动还没有收到更新的实例
+func (s *PollSequencer) Sync(ctx context.Context, client RedisClient, pollID uint) uint64 {
+	if client != nil {
+		seq, err := client.Get(ctx, s.sequenceKey(pollID)).Uint64()
+		if err == nil {
+			s.Observe(pollID, seq)
+		} else if err != redis.Nil {
+			return s.Current(pollID)
+		}
+	}
+	return s.Current(pollID)
+}
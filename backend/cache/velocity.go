@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// VoteVelocityTracker 投票速度统计器，使用有序集合记录滑动窗口内的投票
+type VoteVelocityTracker struct {
+	redisClient RedisClient
+	window      time.Duration
+}
+
+// NewVoteVelocityTracker 创建新的投票速度统计器
+func NewVoteVelocityTracker(client RedisClient, window time.Duration) *VoteVelocityTracker {
+	return &VoteVelocityTracker{
+		redisClient: client,
+		window:      window,
+	}
+}
+
+// velocityKey 投票速度统计键
+func velocityKey(pollID uint) string {
+	return fmt.Sprintf("vote_velocity:poll:%d", pollID)
+}
+
+// Record 记录一次投票
+func (t *VoteVelocityTracker) Record(ctx context.Context, pollID uint) error {
+	if t.redisClient == nil {
+		return ErrRedisNotAvailable
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	windowStart := now - int64(t.window/time.Millisecond)
+	key := velocityKey(pollID)
+
+	pipe := t.redisClient.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now), Member: uuid.New().String()})
+	pipe.ZRemRangeByScore(ctx, key, "0", strconv.FormatInt(windowStart, 10))
+	pipe.Expire(ctx, key, t.window*2) // 设置过期时间，避免无人投票时键长期残留
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Count 返回当前窗口内的投票数
+func (t *VoteVelocityTracker) Count(ctx context.Context, pollID uint) (int64, error) {
+	if t.redisClient == nil {
+		return 0, ErrRedisNotAvailable
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	windowStart := now - int64(t.window/time.Millisecond)
+	key := velocityKey(pollID)
+
+	pipe := t.redisClient.Pipeline()
+	pipe.ZRemRangeByScore(ctx, key, "0", strconv.FormatInt(windowStart, 10))
+	pipe.ZCard(ctx, key)
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return cmds[1].(*redis.IntCmd).Val(), nil
+}
@@ -0,0 +1,74 @@
+// auditverify 校验审计日志哈希链的完整性
+//
+// 用法:
+//
+//	go run ./cmd/auditverify [-expect-seq N -expect-hash H]
+//
+// 数据库连接参数与服务端相同（DB_HOST、DB_PORT等环境变量）。
+// 发现序号缺失、链接断裂或内容被修改的记录时以非零状态码退出。
+// 传入上次保存的链尾序号和哈希，可以同时检测链尾被截断或改写的情况。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"realtime-voting-backend/audit"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+)
+
+func main() {
+	expectSeq := flag.Uint64("expect-seq", 0, "之前记录的链尾序号，用于检测链尾截断")
+	expectHash := flag.String("expect-hash", "", "之前记录的链尾序号对应的哈希")
+	flag.Parse()
+
+	if err := database.ConnectDB(); err != nil {
+		log.Fatalf("无法连接数据库: %v", err)
+	}
+	defer database.CloseDB()
+
+	report, err := audit.Verify(database.DB)
+	if err != nil {
+		log.Fatalf("校验审计日志失败: %v", err)
+	}
+
+	// 与外部保存的锚点比对
+	if *expectSeq > 0 {
+		var anchor models.AuditLog
+		result := database.DB.Where("seq = ?", *expectSeq).Limit(1).Find(&anchor)
+		switch {
+		case result.Error != nil:
+			log.Fatalf("读取锚点记录失败: %v", result.Error)
+		case result.RowsAffected == 0:
+			report.Problems = append(report.Problems, audit.Problem{
+				Seq:     *expectSeq,
+				Problem: "锚点记录不存在，链尾可能已被截断",
+			})
+		case *expectHash != "" && anchor.Hash != *expectHash:
+			report.Problems = append(report.Problems, audit.Problem{
+				Seq:     anchor.Seq,
+				ID:      anchor.ID,
+				Problem: "锚点记录的哈希与保存的值不一致",
+			})
+		}
+		report.Valid = len(report.Problems) == 0
+	}
+
+	fmt.Printf("已校验 %d 条审计记录\n", report.Checked)
+	fmt.Printf("链尾序号: %d\n", report.HeadSeq)
+	fmt.Printf("链尾哈希: %s\n", report.HeadHash)
+
+	if report.Valid {
+		fmt.Println("审计日志哈希链完整")
+		return
+	}
+
+	fmt.Printf("发现 %d 个问题:\n", len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Printf("  seq=%d id=%d: %s\n", problem.Seq, problem.ID, problem.Problem)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,88 @@
+// tallyverify 独立校验可验证投票的计票结果
+//
+// 用法:
+//
+//	go run ./cmd/tallyverify -file poll-3-ballots.json [-root 公布的树根] [-receipt 自己的收据]
+//
+// 导出文件由 GET /api/polls/{id}/tally/export 获取。工具会逐张重算选票收据，
+// 重建Merkle树并重新统计票数，与文件中公布的树根和票数比对。
+// 通过 -root 传入从其他渠道获得的树根，可以确认导出文件与公布结果一致；
+// 通过 -receipt 可以确认自己的选票包含在内。发现问题时以非零状态码退出。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"realtime-voting-backend/tally"
+)
+
+func main() {
+	file := flag.String("file", "", "选票导出文件路径")
+	expectedRoot := flag.String("root", "", "从其他渠道获得的公布树根（可选）")
+	receipt := flag.String("receipt", "", "需要确认包含在内的选票收据（可选）")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("读取导出文件失败: %v", err)
+	}
+
+	var export tally.Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		log.Fatalf("解析导出文件失败: %v", err)
+	}
+
+	problems := tally.VerifyExport(&export)
+
+	if *expectedRoot != "" && *expectedRoot != export.MerkleRoot {
+		problems = append(problems, fmt.Sprintf("导出文件的树根 %s 与给定的树根 %s 不一致", export.MerkleRoot, *expectedRoot))
+	}
+
+	if *receipt != "" {
+		found := false
+		for _, ballot := range export.Ballots {
+			if ballot.Receipt == *receipt {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("收据 %s 不在导出的选票中", *receipt))
+		}
+	}
+
+	fmt.Printf("投票ID: %d\n", export.PollID)
+	fmt.Printf("选票数: %d\n", len(export.Ballots))
+	fmt.Printf("树根:   %s\n", export.MerkleRoot)
+
+	counts := tally.Count(export.Ballots)
+	optionIDs := make([]uint, 0, len(counts))
+	for optionID := range counts {
+		optionIDs = append(optionIDs, optionID)
+	}
+	sort.Slice(optionIDs, func(i, j int) bool { return optionIDs[i] < optionIDs[j] })
+	for _, optionID := range optionIDs {
+		fmt.Printf("  选项 %d: %d 票\n", optionID, counts[optionID])
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("校验通过：选票、树根与公布的票数一致")
+		return
+	}
+
+	fmt.Printf("发现 %d 个问题:\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,110 @@
+// Package comments 投票旁的评论与表情互动
+//
+// 评论在入库前规范化并做简单的内容审核：命中屏蔽词或包含链接的评论被标记，
+// 由调用方决定是否暂缓公开（等待管理员审核）。表情只允许固定的几种，按投票累计计数。
+package comments
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength 评论的最大字符数
+const MaxLength = 280
+
+// 审核标记原因
+const (
+	FlagBlockedWord = "blocked_word" // 包含屏蔽词
+	FlagLink        = "link"         // 包含链接
+)
+
+var (
+	ErrEmpty   = errors.New("评论内容不能为空")
+	ErrTooLong = errors.New("评论内容过长")
+)
+
+// Reactions 允许的表情，键为接口中使用的名称
+var Reactions = map[string]string{
+	"like":  "👍",
+	"clap":  "👏",
+	"heart": "❤️",
+	"laugh": "😂",
+	"wow":   "😮",
+	"party": "🎉",
+}
+
+// ValidReaction 判断表情名称是否允许
+func ValidReaction(name string) bool {
+	_, ok := Reactions[name]
+	return ok
+}
+
+// ReactionNames 按名称排序的全部表情
+func ReactionNames() []string {
+	names := make([]string, 0, len(Reactions))
+	for name := range Reactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Normalize 去除首尾空白和控制字符，并检查长度
+func Normalize(content string) (string, error) {
+	content = strings.Map(func(r rune) rune {
+		if r == '\n' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, content)
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return "", ErrEmpty
+	}
+	if utf8.RuneCountInString(content) > MaxLength {
+		return "", ErrTooLong
+	}
+	return content, nil
+}
+
+// linkPattern 常见的链接写法
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|cn|io|me|xyz|top)\b`)
+
+// Moderator 评论内容审核
+type Moderator struct {
+	blocked []string // 小写的屏蔽词
+}
+
+// NewModerator 创建审核器，屏蔽词不区分大小写
+func NewModerator(blockedWords []string) *Moderator {
+	m := &Moderator{}
+	for _, word := range blockedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			m.blocked = append(m.blocked, word)
+		}
+	}
+	return m
+}
+
+// Check 返回评论命中的审核标记，没有命中时返回nil
+func (m *Moderator) Check(content string) []string {
+	var flags []string
+
+	lower := strings.ToLower(content)
+	for _, word := range m.blocked {
+		if strings.Contains(lower, word) {
+			flags = append(flags, FlagBlockedWord)
+			break
+		}
+	}
+
+	if linkPattern.MatchString(content) {
+		flags = append(flags, FlagLink)
+	}
+	return flags
+}
@@ -0,0 +1,45 @@
+package comments
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	content, err := Normalize("  Great question!\x07\n ")
+	require.NoError(t, err)
+	assert.Equal(t, "Great question!", content)
+
+	content, err = Normalize("第一行\n第二行")
+	require.NoError(t, err)
+	assert.Equal(t, "第一行\n第二行", content)
+
+	_, err = Normalize(" \t\x00 ")
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// The limit counts characters, not bytes
+	_, err = Normalize(strings.Repeat("投", MaxLength))
+	assert.NoError(t, err)
+	_, err = Normalize(strings.Repeat("投", MaxLength+1))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestModerator_Check(t *testing.T) {
+	m := NewModerator([]string{" Spam ", "", "广告"})
+
+	assert.Nil(t, m.Check("Looking forward to the results"))
+	assert.Equal(t, []string{FlagBlockedWord}, m.Check("no SPAM please"))
+	assert.Equal(t, []string{FlagBlockedWord}, m.Check("点击看广告"))
+	assert.Equal(t, []string{FlagLink}, m.Check("see https://example.com/x"))
+	assert.Equal(t, []string{FlagLink}, m.Check("visit cheap-votes.xyz now"))
+	assert.Equal(t, []string{FlagBlockedWord, FlagLink}, m.Check("spam at www.example.org"))
+}
+
+func TestReactions(t *testing.T) {
+	assert.True(t, ValidReaction("clap"))
+	assert.False(t, ValidReaction("👏"))
+	assert.Equal(t, []string{"clap", "heart", "laugh", "like", "party", "wow"}, ReactionNames())
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -18,8 +19,36 @@ import (
 // DB 是全局数据库连接
 var DB *gorm.DB
 
+// IncrementVote 返回的错误，消息队列据此判断是否需要重试
+var (
+	ErrInvalidVote    = errors.New("无效的投票ID")
+	ErrPollNotFound   = errors.New("找不到投票")
+	ErrOptionNotFound = errors.New("找不到选项")
+	ErrPollClosed     = errors.New("投票已关闭")
+)
+
 // InitDB 初始化数据库连接
 func InitDB() error {
+	if err := ConnectDB(); err != nil {
+		return err
+	}
+
+	// 自动迁移模型
+	if err := DB.AutoMigrate(&models.Poll{}, &models.PollOption{}, &models.AuditLog{}, &models.QuarantinedVote{}, &models.IPRule{}, &models.Ballot{}, &models.TallyPublication{}, &models.Comment{}, &models.WebhookSubscription{}); err != nil {
+		return fmt.Errorf("迁移模型失败: %v", err)
+	}
+
+	// 添加一些示例数据（仅在开发模式下）
+	if getEnv("ENVIRONMENT", "development") == "development" {
+		createSampleData()
+	}
+
+	log.Println("数据库连接和迁移成功")
+	return nil
+}
+
+// ConnectDB 只建立数据库连接，不执行迁移和示例数据创建，供命令行工具使用
+func ConnectDB() error {
 	// 配置GORM
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
@@ -54,17 +83,6 @@ func InitDB() error {
 		return fmt.Errorf("连接数据库失败: %v", err)
 	}
 
-	// 自动迁移模型
-	if err := DB.AutoMigrate(&models.Poll{}, &models.PollOption{}); err != nil {
-		return fmt.Errorf("迁移模型失败: %v", err)
-	}
-
-	// 添加一些示例数据（仅在开发模式下）
-	if getEnv("ENVIRONMENT", "development") == "development" {
-		createSampleData()
-	}
-
-	log.Println("数据库连接和迁移成功")
 	return nil
 }
 
@@ -116,12 +134,12 @@ func IncrementVote(pollIDStr string, optionIDStr string) error {
 	// 将字符串ID转换为uint
 	pollID, err := strconv.ParseUint(pollIDStr, 10, 32)
 	if err != nil {
-		return fmt.Errorf("解析投票ID失败: %v", err)
+		return fmt.Errorf("%w: 解析投票ID失败: %v", ErrInvalidVote, err)
 	}
 
 	optionID, err := strconv.ParseUint(optionIDStr, 10, 32)
 	if err != nil {
-		return fmt.Errorf("解析选项ID失败: %v", err)
+		return fmt.Errorf("%w: 解析选项ID失败: %v", ErrInvalidVote, err)
 	}
 
 	// 开始事务
@@ -134,20 +152,26 @@ func IncrementVote(pollIDStr string, optionIDStr string) error {
 	var poll models.Poll
 	if err := tx.First(&poll, uint(pollID)).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("找不到投票: %v", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", ErrPollNotFound, pollID)
+		}
+		return fmt.Errorf("查询投票失败: %v", err)
 	}
 
 	// 检查投票是否活跃
 	if !poll.IsActive {
 		tx.Rollback()
-		return fmt.Errorf("投票已关闭")
+		return ErrPollClosed
 	}
 
 	// 验证选项存在
 	var option models.PollOption
 	if err := tx.Where("id = ? AND poll_id = ?", uint(optionID), uint(pollID)).First(&option).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("找不到选项: %v", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", ErrOptionNotFound, optionID)
+		}
+		return fmt.Errorf("查询选项失败: %v", err)
 	}
 
 	// 原子增加投票计数
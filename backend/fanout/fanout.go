@@ -0,0 +1,237 @@
+package fanout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ChannelPrefix 每个投票对应的Redis频道前缀，完整频道为 poll_updates:<投票ID>
+const ChannelPrefix = "poll_updates:"
+
+// 消息类型，对应本地的WebSocket和SSE两套推送，以及同时推送给两者的在线人数、评论和表情
+const (
+	KindWebSocket      = "ws"
+	KindSSE            = "sse"
+	KindPresence       = "presence"
+	KindComment        = "comment"
+	KindCommentDeleted = "comment_deleted"
+	KindReactions      = "reactions"
+)
+
+// Envelope 跨实例广播的消息信封
+type Envelope struct {
+	ID      string          `json:"id"`     // 消息ID，用于去重
+	Origin  string          `json:"origin"` // 发布消息的实例ID
+	Kind    string          `json:"kind"`
+	PollID  uint            `json:"poll_id"`
+	Seq     uint64          `json:"seq,omitempty"` // 投票更新序号，没有序号的消息为0
+	Payload json.RawMessage `json:"payload"`
+}
+
+// DeliverFunc 将收到的消息投递给本实例的客户端
+type DeliverFunc func(env *Envelope)
+
+// Channel 返回投票对应的频道名
+func Channel(pollID uint) string {
+	return ChannelPrefix + strconv.FormatUint(uint64(pollID), 10)
+}
+
+// NewMessageID 生成随机消息ID
+func NewMessageID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// InstanceID 返回本实例的ID，优先使用INSTANCE_ID环境变量，否则为主机名加随机后缀
+func InstanceID() string {
+	if id := strings.TrimSpace(os.Getenv("INSTANCE_ID")); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "instance"
+	}
+	return host + "-" + NewMessageID()[:8]
+}
+
+// Stats 广播层的运行统计
+type Stats struct {
+	Published       int64 `json:"published"`
+	PublishFailures int64 `json:"publish_failures"`
+	Relayed         int64 `json:"relayed"`
+	Duplicates      int64 `json:"duplicates"`
+	OwnMessages     int64 `json:"own_messages"`
+	Connected       bool  `json:"connected"`
+}
+
+// Relay 通过Redis发布订阅在多个实例之间转发广播消息
+// client为nil时只做本地投递
+type Relay struct {
+	client     *redis.Client
+	instanceID string
+	deliver    DeliverFunc
+	seen       *SeenCache
+
+	published       int64
+	publishFailures int64
+	relayed         int64
+	duplicates      int64
+	ownMessages     int64
+	connected       int32
+
+	// 发布失败日志节流
+	logMu        sync.Mutex
+	lastErrorLog time.Time
+}
+
+// NewRelay 创建转发器，deliver负责把消息推送给本实例的客户端
+func NewRelay(client *redis.Client, instanceID string, deliver DeliverFunc) *Relay {
+	return &Relay{
+		client:     client,
+		instanceID: instanceID,
+		deliver:    deliver,
+		seen:       NewSeenCache(10000, 2*time.Minute),
+	}
+}
+
+// InstanceID 返回本实例的ID
+func (r *Relay) InstanceID() string {
+	return r.instanceID
+}
+
+// Broadcast 先投递给本实例的客户端，再发布给其他实例
+// Redis不可用时只完成本地投递
+func (r *Relay) Broadcast(ctx context.Context, kind string, pollID uint, seq uint64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化广播消息失败: %v", err)
+	}
+
+	env := &Envelope{
+		ID:      NewMessageID(),
+		Origin:  r.instanceID,
+		Kind:    kind,
+		PollID:  pollID,
+		Seq:     seq,
+		Payload: data,
+	}
+
+	// 记录消息ID，订阅收到自己的消息时直接忽略
+	r.seen.Add(env.ID)
+	r.deliver(env)
+
+	return r.publish(ctx, env)
+}
+
+// publish 将消息发布到投票频道
+func (r *Relay) publish(ctx context.Context, env *Envelope) error {
+	if r.client == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.Publish(ctx, Channel(env.PollID), data).Err(); err != nil {
+		atomic.AddInt64(&r.publishFailures, 1)
+		r.logPublishError(err)
+		return err
+	}
+	atomic.AddInt64(&r.published, 1)
+	return nil
+}
+
+// logPublishError 发布失败时每分钟最多记录一次日志，避免Redis宕机时刷屏
+func (r *Relay) logPublishError(err error) {
+	r.logMu.Lock()
+	defer r.logMu.Unlock()
+	if time.Since(r.lastErrorLog) < time.Minute {
+		return
+	}
+	r.lastErrorLog = time.Now()
+	log.Printf("跨实例广播发布失败，降级为仅本地推送: %v", err)
+}
+
+// Run 订阅所有投票频道并转发其他实例的消息，直到ctx取消
+// 连接断开后go-redis会自动重连并恢复订阅
+func (r *Relay) Run(ctx context.Context) {
+	if r.client == nil {
+		return
+	}
+
+	pubsub := r.client.PSubscribe(ctx, ChannelPrefix+"*")
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("订阅广播频道失败，将在连接恢复后重试: %v", err)
+	} else {
+		atomic.StoreInt32(&r.connected, 1)
+		log.Printf("跨实例广播已启动: 实例ID=%s", r.instanceID)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&r.connected, 0)
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				atomic.StoreInt32(&r.connected, 0)
+				return
+			}
+			atomic.StoreInt32(&r.connected, 1)
+			r.handle(msg.Payload)
+		}
+	}
+}
+
+// handle 处理订阅收到的一条消息
+func (r *Relay) handle(raw string) {
+	var env Envelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		log.Printf("解析跨实例广播消息失败: %v", err)
+		return
+	}
+
+	if env.Origin == r.instanceID {
+		atomic.AddInt64(&r.ownMessages, 1)
+		return
+	}
+	if !r.seen.Add(env.ID) {
+		atomic.AddInt64(&r.duplicates, 1)
+		return
+	}
+
+	atomic.AddInt64(&r.relayed, 1)
+	r.deliver(&env)
+}
+
+// Stats 返回运行统计
+func (r *Relay) Stats() Stats {
+	return Stats{
+		Published:       atomic.LoadInt64(&r.published),
+		PublishFailures: atomic.LoadInt64(&r.publishFailures),
+		Relayed:         atomic.LoadInt64(&r.relayed),
+		Duplicates:      atomic.LoadInt64(&r.duplicates),
+		OwnMessages:     atomic.LoadInt64(&r.ownMessages),
+		Connected:       atomic.LoadInt32(&r.connected) == 1,
+	}
+}
@@ -0,0 +1,92 @@
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeenCache_Dedupe(t *testing.T) {
+	seen := NewSeenCache(10, time.Minute)
+
+	assert.True(t, seen.Add("a"))
+	assert.False(t, seen.Add("a"))
+	assert.True(t, seen.Add("b"))
+	assert.Equal(t, 2, seen.Len())
+}
+
+func TestSeenCache_CapacityAndTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	seen := NewSeenCache(2, time.Minute)
+	seen.now = func() time.Time { return now }
+
+	seen.Add("a")
+	seen.Add("b")
+	seen.Add("c") // evicts "a"
+	assert.Equal(t, 2, seen.Len())
+	assert.True(t, seen.Add("a"))
+
+	// Everything older than the TTL is forgotten
+	now = now.Add(2 * time.Minute)
+	assert.True(t, seen.Add("c"))
+	assert.Equal(t, 1, seen.Len())
+}
+
+func envelopeJSON(t *testing.T, env Envelope) string {
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRelay_HandleSkipsOwnAndDuplicateMessages(t *testing.T) {
+	var delivered []*Envelope
+	relay := NewRelay(nil, "instance-a", func(env *Envelope) {
+		delivered = append(delivered, env)
+	})
+
+	remote := Envelope{ID: "m1", Origin: "instance-b", Kind: KindWebSocket, PollID: 3, Seq: 7, Payload: json.RawMessage(`{"x":1}`)}
+	relay.handle(envelopeJSON(t, remote))
+	relay.handle(envelopeJSON(t, remote))
+
+	own := Envelope{ID: "m2", Origin: "instance-a", Kind: KindSSE, PollID: 3, Payload: json.RawMessage(`{}`)}
+	relay.handle(envelopeJSON(t, own))
+	relay.handle("not json")
+
+	require.Len(t, delivered, 1)
+	assert.Equal(t, "m1", delivered[0].ID)
+	assert.Equal(t, uint(3), delivered[0].PollID)
+	assert.Equal(t, uint64(7), delivered[0].Seq)
+	assert.JSONEq(t, `{"x":1}`, string(delivered[0].Payload))
+
+	stats := relay.Stats()
+	assert.Equal(t, int64(1), stats.Relayed)
+	assert.Equal(t, int64(1), stats.Duplicates)
+	assert.Equal(t, int64(1), stats.OwnMessages)
+}
+
+func TestRelay_BroadcastWithoutRedisDeliversLocally(t *testing.T) {
+	var delivered []*Envelope
+	relay := NewRelay(nil, "instance-a", func(env *Envelope) {
+		delivered = append(delivered, env)
+	})
+
+	err := relay.Broadcast(context.Background(), KindSSE, 9, 0, map[string]int{"votes": 4})
+	require.NoError(t, err)
+	require.Len(t, delivered, 1)
+	assert.Equal(t, KindSSE, delivered[0].Kind)
+	assert.Equal(t, "instance-a", delivered[0].Origin)
+	assert.JSONEq(t, `{"votes":4}`, string(delivered[0].Payload))
+
+	// The echo of our own message from Redis would be ignored
+	relay.handle(envelopeJSON(t, *delivered[0]))
+	assert.Len(t, delivered, 1)
+	assert.Equal(t, int64(0), relay.Stats().Published)
+}
+
+func TestChannel(t *testing.T) {
+	assert.Equal(t, "poll_updates:42", Channel(42))
+}
@@ -0,0 +1,74 @@
+package fanout
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// SeenCache 记录最近处理过的消息ID，容量和保留时间都有上限
+type SeenCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List               // 按加入时间排序，队首最旧
+	entries  map[string]*list.Element // 消息ID -> 链表节点
+	now      func() time.Time
+}
+
+type seenEntry struct {
+	id     string
+	seenAt time.Time
+}
+
+// NewSeenCache 创建消息ID去重缓存
+func NewSeenCache(capacity int, ttl time.Duration) *SeenCache {
+	return &SeenCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Add 记录消息ID，返回false表示该ID已经处理过
+func (s *SeenCache) Add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evict(now)
+
+	if _, ok := s.entries[id]; ok {
+		return false
+	}
+
+	s.entries[id] = s.order.PushBack(&seenEntry{id: id, seenAt: now})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Front())
+	}
+	return true
+}
+
+// Len 当前记录的消息ID数量
+func (s *SeenCache) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// evict 清理超过保留时间的记录
+func (s *SeenCache) evict(now time.Time) {
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		if now.Sub(front.Value.(*seenEntry).seenAt) < s.ttl {
+			return
+		}
+		s.remove(front)
+	}
+}
+
+func (s *SeenCache) remove(elem *list.Element) {
+	delete(s.entries, elem.Value.(*seenEntry).id)
+	s.order.Remove(elem)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// AdminHub 管理员告警通道，向所有已连接的管理员推送告警
+type AdminHub struct {
+	clients map[*adminClient]bool
+	mu      sync.RWMutex
+}
+
+// adminClient 管理员WebSocket连接
+type adminClient struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// GlobalAdminHub 全局管理员告警通道
+var GlobalAdminHub = &AdminHub{
+	clients: make(map[*adminClient]bool),
+}
+
+// Broadcast 向所有管理员推送一条告警，发送缓冲区已满的连接会被断开
+func (h *AdminHub) Broadcast(alertType string, data interface{}) {
+	message, err := json.Marshal(map[string]interface{}{
+		"type":      alertType,
+		"data":      data,
+		"timestamp": time.Now().UnixNano(),
+	})
+	if err != nil {
+		log.Printf("序列化管理员告警失败: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		select {
+		case client.send <- message:
+		default:
+			delete(h.clients, client)
+			close(client.send)
+			log.Printf("管理员告警连接缓冲区已满，已断开")
+		}
+	}
+}
+
+// count 当前连接的管理员数量
+func (h *AdminHub) count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+func (h *AdminHub) add(client *adminClient) {
+	h.mu.Lock()
+	h.clients[client] = true
+	h.mu.Unlock()
+}
+
+func (h *AdminHub) remove(client *adminClient) {
+	h.mu.Lock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+	}
+	h.mu.Unlock()
+}
+
+// HandleAdminWebSocket 管理员告警WebSocket，需要管理员密钥
+func HandleAdminWebSocket(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("升级管理员WebSocket连接失败: %v", err)
+		return
+	}
+
+	client := &adminClient{
+		conn: conn,
+		send: make(chan []byte, 64),
+	}
+	GlobalAdminHub.add(client)
+	log.Printf("管理员告警通道已连接 [来源: %s, 连接数: %d]", c.ClientIP(), GlobalAdminHub.count())
+
+	if welcome, err := json.Marshal(map[string]interface{}{
+		"type":    "CONNECT_SUCCESS",
+		"message": "已连接管理员告警通道",
+	}); err == nil {
+		client.send <- welcome
+	}
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// readPump 读取循环，仅用于检测连接断开和处理pong
+func (c *adminClient) readPump() {
+	defer func() {
+		GlobalAdminHub.remove(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(512)
+	c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+		return nil
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump 写入循环，定期发送ping保持连接
+func (c *adminClient) writePump() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
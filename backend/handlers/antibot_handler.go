@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"realtime-voting-backend/antibot"
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 工作量证明配置，启动时从环境变量读取
+var powConfig = antibot.LoadConfig()
+
+// ProofOfWork 投票请求中携带的工作量证明
+type ProofOfWork struct {
+	Nonce    string `json:"pow_nonce,omitempty"`
+	Solution string `json:"pow_solution,omitempty"`
+}
+
+// getVelocityTracker 获取投票速度统计器，Redis不可用时返回nil
+func getVelocityTracker() *cache.VoteVelocityTracker {
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		return nil
+	}
+	return cache.NewVoteVelocityTracker(redisClient, powConfig.VelocityWindow)
+}
+
+// recordVoteVelocity 记录一次成功的投票，用于计算投票速度
+func recordVoteVelocity(pollID uint) {
+	tracker := getVelocityTracker()
+	if tracker == nil {
+		return
+	}
+	if err := tracker.Record(context.Background(), pollID); err != nil {
+		log.Printf("记录投票速度失败: 投票ID=%d, 错误: %v", pollID, err)
+	}
+}
+
+// currentPowDifficulty 根据投票当前的速度计算挑战难度
+func currentPowDifficulty(ctx context.Context, pollID uint) (int, int64) {
+	tracker := getVelocityTracker()
+	if tracker == nil {
+		// Redis不可用时无法统计速度，使用基础难度
+		return powConfig.BaseDifficulty, 0
+	}
+
+	velocity, err := tracker.Count(ctx, pollID)
+	if err != nil {
+		log.Printf("读取投票速度失败: 投票ID=%d, 错误: %v", pollID, err)
+		return powConfig.BaseDifficulty, 0
+	}
+
+	return powConfig.Difficulty(velocity), velocity
+}
+
+// powStoreClient 挑战存储使用的Redis客户端，不可用时返回nil（使用进程内存储）
+func powStoreClient() cache.RedisClient {
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		return nil
+	}
+	return redisClient
+}
+
+// GetPollChallenge 为启用了防机器人模式的投票下发工作量证明挑战
+func GetPollChallenge(c *gin.Context) {
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+		return
+	}
+
+	var poll models.Poll
+	if err := database.DB.First(&poll, uint(pollID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投票未找到"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取投票数据失败"})
+		}
+		return
+	}
+
+	if !poll.AntiBotEnabled {
+		c.JSON(http.StatusOK, gin.H{"required": false})
+		return
+	}
+
+	ctx := context.Background()
+	difficulty, velocity := currentPowDifficulty(ctx, poll.ID)
+
+	challenge, err := antibot.IssueChallenge(ctx, powStoreClient(), poll.ID, difficulty, powConfig.ChallengeTTL)
+	if err != nil {
+		log.Printf("生成工作量证明挑战失败: 投票ID=%d, 错误: %v", poll.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成挑战失败"})
+		return
+	}
+
+	if difficulty > powConfig.BaseDifficulty {
+		log.Printf("投票 %d 速度过高 (%d/%v)，挑战难度提升至 %d", poll.ID, velocity, powConfig.VelocityWindow, difficulty)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"required":    true,
+		"nonce":       challenge.Nonce,
+		"difficulty":  challenge.Difficulty,
+		"algorithm":   challenge.Algorithm,
+		"expires_at":  challenge.ExpiresAt,
+		"ttl_seconds": int(powConfig.ChallengeTTL.Seconds()),
+	})
+}
+
+// checkProofOfWork 对启用了防机器人模式的投票校验工作量证明
+// 校验失败时写入错误响应并返回false
+func checkProofOfWork(c *gin.Context, pollID uint, proof ProofOfWork) bool {
+	if status, errBody := proofOfWorkError(pollID, c.ClientIP(), proof); errBody != nil {
+		c.JSON(status, errBody)
+		return false
+	}
+	return true
+}
+
+// proofOfWorkError 校验工作量证明，通过时返回nil，否则返回状态码和响应内容
+// 挑战存储不可用时返回503，客户端应稍后重试同一个解而不是重新求解
+func proofOfWorkError(pollID uint, clientIP string, proof ProofOfWork) (int, gin.H) {
+	var poll models.Poll
+	if err := database.DB.Select("id", "anti_bot_enabled").First(&poll, pollID).Error; err != nil {
+		// 投票不存在等情况交给后续流程处理
+		return 0, nil
+	}
+	if !poll.AntiBotEnabled {
+		return 0, nil
+	}
+
+	if proof.Nonce == "" || proof.Solution == "" {
+		return http.StatusForbidden, gin.H{"error": "此投票需要工作量证明，请先获取挑战", "pow_required": true}
+	}
+
+	err := antibot.RedeemChallenge(context.Background(), powStoreClient(), pollID, proof.Nonce, proof.Solution)
+	if err != nil {
+		log.Printf("工作量证明校验失败: 投票ID=%d, IP=%s, 错误: %v", pollID, clientIP, err)
+		if errors.Is(err, antibot.ErrStoreUnavailable) {
+			return http.StatusServiceUnavailable, gin.H{"error": "暂时无法校验工作量证明，请稍后重试"}
+		}
+		return http.StatusForbidden, gin.H{"error": err.Error(), "pow_required": true}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"realtime-voting-backend/audit"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计动作常量
+const (
+	AuditActionPollUpdate      = "poll.update"
+	AuditActionPollDelete      = "poll.delete"
+	AuditActionPollReset       = "poll.reset"
+	AuditActionCacheCleanup    = "cache.cleanup"
+	AuditActionRateLimitUpdate = "ratelimit.update"
+)
+
+// checkAdminKey 校验请求头X-Admin-Key或查询参数admin_key中的管理员密钥
+func checkAdminKey(c *gin.Context) bool {
+	key := c.GetHeader("X-Admin-Key")
+	if key == "" {
+		key = c.Query("admin_key")
+	}
+	return key == "admin123"
+}
+
+// auditActor 获取操作者标识，优先使用X-Admin-User，其次X-User-ID
+func auditActor(c *gin.Context) string {
+	if actor := c.GetHeader("X-Admin-User"); actor != "" {
+		return actor
+	}
+	if actor := c.GetHeader("X-User-ID"); actor != "" {
+		return actor
+	}
+	return "admin"
+}
+
+// pollAuditSnapshot 投票在审计日志中的状态快照
+type pollAuditSnapshot struct {
+	Question    string            `json:"question"`
+	Description string            `json:"description"`
+	PollType    models.PollType   `json:"poll_type"`
+	IsActive    bool              `json:"is_active"`
+	EndTime     *time.Time        `json:"end_time"`
+	AntiBot     bool              `json:"anti_bot_enabled"`
+	Verifiable  bool              `json:"verifiable"`
+	Options     map[string]string `json:"options"` // 选项ID -> 文本
+	Votes       map[string]int64  `json:"votes"`   // 选项ID -> 票数
+}
+
+// loadPollAuditSnapshot 从数据库读取投票快照，失败时返回nil
+func loadPollAuditSnapshot(pollID uint) *pollAuditSnapshot {
+	var poll models.Poll
+	if err := database.DB.Preload("Options").First(&poll, pollID).Error; err != nil {
+		log.Printf("读取投票审计快照失败: 投票ID=%d, 错误: %v", pollID, err)
+		return nil
+	}
+
+	snapshot := &pollAuditSnapshot{
+		Question:    poll.Question,
+		Description: poll.Description,
+		PollType:    poll.PollType,
+		IsActive:    poll.IsActive,
+		EndTime:     poll.EndTime,
+		AntiBot:     poll.AntiBotEnabled,
+		Verifiable:  poll.Verifiable,
+		Options:     make(map[string]string, len(poll.Options)),
+		Votes:       make(map[string]int64, len(poll.Options)),
+	}
+	for _, opt := range poll.Options {
+		optionID := strconv.FormatUint(uint64(opt.ID), 10)
+		snapshot.Options[optionID] = opt.Text
+		snapshot.Votes[optionID] = opt.Votes
+	}
+
+	return snapshot
+}
+
+// pollAuditTarget 投票的审计目标标识
+func pollAuditTarget(pollID uint) string {
+	return "poll:" + strconv.FormatUint(uint64(pollID), 10)
+}
+
+// recordAudit 记录一条审计日志，写入失败只记录错误日志，不影响业务请求
+func recordAudit(c *gin.Context, action string, target string, before interface{}, after interface{}) {
+	recordAuditAs(auditActor(c), c.ClientIP(), action, target, before, after)
+}
+
+// recordAuditAs 以指定的操作者和IP记录审计日志，供不经过Gin的调用方（如gRPC）使用
+func recordAuditAs(actor string, clientIP string, action string, target string, before interface{}, after interface{}) {
+	entry := audit.Entry{
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+		IP:     clientIP,
+	}
+
+	record, err := audit.Record(database.DB, entry)
+	if err != nil {
+		log.Printf("写入审计日志失败: action=%s, target=%s, 错误: %v", action, target, err)
+		return
+	}
+
+	log.Printf("审计日志已记录: seq=%d, actor=%s, action=%s, target=%s", record.Seq, record.Actor, action, target)
+}
+
+// GetAuditLogs 按条件查询审计日志
+// 支持的查询参数: actor, action, target, from, to (RFC3339), limit, offset
+func GetAuditLogs(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	filter := audit.Filter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的from时间格式，应为RFC3339"})
+			return
+		}
+		filter.From = &from
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的to时间格式，应为RFC3339"})
+			return
+		}
+		filter.To = &to
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的offset参数"})
+			return
+		}
+		filter.Offset = offset
+	}
+
+	logs, total, err := audit.Query(database.DB, filter)
+	if err != nil {
+		log.Printf("查询审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"logs":  logs,
+	})
+}
+
+// VerifyAuditLog 校验审计日志哈希链的完整性
+func VerifyAuditLog(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	report, err := audit.Verify(database.DB)
+	if err != nil {
+		log.Printf("校验审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"realtime-voting-backend/livefeed"
+)
+
+// pollBroadcaster 按投票合并结果广播，投票高峰期每个间隔最多查询和广播一次
+var pollBroadcaster = livefeed.NewCoalescer(broadcastInterval(), emitPollBroadcast)
+
+// broadcastInterval 从环境变量BROADCAST_INTERVAL读取广播合并间隔，默认100毫秒，设为0时不合并
+func broadcastInterval() time.Duration {
+	value := os.Getenv("BROADCAST_INTERVAL")
+	if value == "" {
+		return 100 * time.Millisecond
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("无效的BROADCAST_INTERVAL: %q，使用默认值100ms", value)
+		return 100 * time.Millisecond
+	}
+	return d
+}
+
+// SchedulePollBroadcast 请求向WebSocket和SSE客户端广播投票的最新结果
+// 短时间内的多次请求会合并为一次广播，广播时重新读取最新结果
+func SchedulePollBroadcast(pollID uint) {
+	pollBroadcaster.Trigger(pollID)
+}
+
+// FlushPollBroadcasts 等待已安排的结果广播全部完成，用于关闭数据库之前
+func FlushPollBroadcasts() {
+	pollBroadcaster.Flush()
+}
+
+// BroadcastCoalescerStats 返回广播合并的运行统计
+func BroadcastCoalescerStats() livefeed.CoalescerStats {
+	return pollBroadcaster.Stats()
+}
+
+// emitPollBroadcast 读取投票最新结果并广播
+func emitPollBroadcast(pollID uint) {
+	results, err := GetCurrentPollResults(pollID)
+	if err != nil {
+		log.Printf("获取投票结果失败，跳过本次广播: 投票ID=%d, 错误: %v", pollID, err)
+		return
+	}
+	BroadcastPollUpdate(pollID, results)
+	BroadcastSSEUpdate(pollID, results)
+	checkVoteThresholds(pollID, results)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/fanout"
+)
+
+// 发布到Redis的超时时间，Redis响应缓慢时不阻塞投票请求
+const fanoutPublishTimeout = 500 * time.Millisecond
+
+// broadcastRelay 跨实例广播转发器，未启动订阅前只做本地投递
+var broadcastRelay = fanout.NewRelay(nil, fanout.InstanceID(), deliverFanoutEnvelope)
+
+// StartBroadcastRelay 启动跨实例广播，需在Redis初始化之后、接收请求之前调用
+// Redis不可用时保持仅本地推送
+func StartBroadcastRelay(ctx context.Context) {
+	client, err := cache.GetClient()
+	if err != nil || client == nil {
+		log.Printf("Redis不可用，WebSocket/SSE广播仅推送给本实例的客户端")
+		return
+	}
+
+	broadcastRelay = fanout.NewRelay(client, broadcastRelay.InstanceID(), deliverFanoutEnvelope)
+	go broadcastRelay.Run(ctx)
+}
+
+// BroadcastStats 返回跨实例广播的运行统计
+func BroadcastStats() fanout.Stats {
+	return broadcastRelay.Stats()
+}
+
+// publishBroadcast 投递给本实例客户端并发布给其他实例
+func publishBroadcast(kind string, pollID uint, seq uint64, payload interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutPublishTimeout)
+	defer cancel()
+
+	// 发布失败时本地投递已经完成，错误由转发器节流记录
+	_ = broadcastRelay.Broadcast(ctx, kind, pollID, seq, payload)
+}
+
+// deliverFanoutEnvelope 将广播消息推送给本实例的客户端
+func deliverFanoutEnvelope(env *fanout.Envelope) {
+	switch env.Kind {
+	case fanout.KindWebSocket:
+		deliverLocalPollUpdate(env.PollID, env.Seq, env.Payload)
+	case fanout.KindSSE:
+		deliverLocalSSEUpdate(env.PollID, env.Seq, env.Payload)
+	case fanout.KindPresence:
+		deliverLocalPresence(env.PollID, env.Payload)
+	case fanout.KindComment, fanout.KindCommentDeleted, fanout.KindReactions:
+		deliverLocalEngagement(env.Kind, env.PollID, env.Payload)
+	default:
+		log.Printf("未知的广播消息类型: %s", env.Kind)
+	}
+}
+
+// deliverLocalTransient 向本实例观看投票的WebSocket和SSE客户端推送不带序号的消息
+// 这类消息不写入历史，断线重连后不补发
+func deliverLocalTransient(pollID uint, wsMessage interface{}, sseEvent string, sseData interface{}) {
+	GlobalHub.broadcast <- &BroadcastMessage{
+		PollID:    pollID,
+		Transient: true,
+		Results:   wsMessage,
+	}
+
+	sseClientsMutex <- true // 获取锁
+	clients := append([]*SSEClient(nil), sseClients[pollID]...)
+	<-sseClientsMutex // 释放锁
+
+	frame := formatSSEEvent(0, sseEvent, sseData)
+	for _, client := range clients {
+		writeSSEFrame(client, 0, frame)
+	}
+}
@@ -76,6 +76,10 @@ func CleanupRedisCache(c *gin.Context) {
 
 	log.Printf("缓存清理完成，总共删除了 %d 个键", totalDeleted)
 
+	recordAudit(c, AuditActionCacheCleanup, "cache",
+		gin.H{"patterns": input.Patterns},
+		gin.H{"patterns": input.Patterns, "total_deleted": totalDeleted, "errors": errors})
+
 	// 返回结果
 	result := gin.H{
 		"success":       len(errors) == 0,
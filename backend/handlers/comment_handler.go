@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/comments"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/fanout"
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 评论的审计动作
+const (
+	AuditActionCommentApprove = "comment.approve"
+	AuditActionCommentDelete  = "comment.delete"
+)
+
+// 未填写昵称时显示的作者
+const anonymousAuthor = "匿名"
+
+var (
+	// 评论内容审核，屏蔽词通过COMMENT_BLOCKED_WORDS配置
+	commentModerator = comments.NewModerator(strings.Split(os.Getenv("COMMENT_BLOCKED_WORDS"), ","))
+
+	// 表情累计数
+	reactionCounter = cache.NewReactionCounter()
+
+	// 按投票节流表情推送，现场集中刷表情时每个间隔最多推送一次累计数
+	reactionNotifier = livefeed.NewCoalescer(reactionInterval(), emitReactions)
+)
+
+// reactionInterval 从环境变量REACTION_INTERVAL读取表情推送的最小间隔，默认1秒
+func reactionInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REACTION_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+// commentView 公开的评论内容，不包含IP和审核信息
+type commentView struct {
+	ID        uint      `json:"id"`
+	PollID    uint      `json:"poll_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newCommentView 生成评论的公开内容
+func newCommentView(comment models.Comment) commentView {
+	return commentView{
+		ID:        comment.ID,
+		PollID:    comment.PollID,
+		Author:    comment.Author,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+// commentDeletion 评论删除消息
+type commentDeletion struct {
+	PollID    uint `json:"poll_id"`
+	CommentID uint `json:"comment_id"`
+}
+
+// reactionUpdate 表情累计数消息
+type reactionUpdate struct {
+	PollID    uint             `json:"poll_id"`
+	Counts    map[string]int64 `json:"counts"`
+	Timestamp int64            `json:"timestamp"`
+}
+
+// CreateCommentInput 发表评论的输入
+type CreateCommentInput struct {
+	Author  string `json:"author" binding:"max=64"`
+	Content string `json:"content" binding:"required"`
+}
+
+// ReactionInput 发送表情的输入
+type ReactionInput struct {
+	Reaction string `json:"reaction" binding:"required"`
+}
+
+// parsePollIDParam 解析路径中的投票ID并确认投票存在，失败时已写入响应
+func parsePollIDParam(c *gin.Context) (uint, bool) {
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+		return 0, false
+	}
+	if !pollExists(uint(pollID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return 0, false
+	}
+	return uint(pollID), true
+}
+
+// engagementRedis 评论和表情使用的Redis客户端，不可用时返回nil
+func engagementRedis() cache.RedisClient {
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		return nil
+	}
+	return redisClient
+}
+
+// CreateComment 在投票旁发表评论
+// 命中屏蔽词或包含链接的评论暂不公开，等待管理员审核
+func CreateComment(c *gin.Context) {
+	pollID, ok := parsePollIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input CreateCommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := comments.Normalize(input.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	author := strings.TrimSpace(input.Author)
+	if author == "" {
+		author = anonymousAuthor
+	}
+
+	comment := models.Comment{
+		PollID:  pollID,
+		Author:  author,
+		Content: content,
+		IP:      c.ClientIP(),
+		Status:  models.CommentStatusVisible,
+	}
+	if flags := commentModerator.Check(author + "\n" + content); len(flags) > 0 {
+		comment.Status = models.CommentStatusFlagged
+		comment.FlagReasons = strings.Join(flags, ",")
+	}
+
+	if err := database.DB.Create(&comment).Error; err != nil {
+		log.Printf("保存评论失败: 投票ID=%d, 错误: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发表评论失败"})
+		return
+	}
+
+	if comment.Status == models.CommentStatusFlagged {
+		log.Printf("评论被内容审核标记: 评论ID=%d, 投票ID=%d, 原因=%s", comment.ID, pollID, comment.FlagReasons)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "评论已提交，审核通过后显示",
+			"comment_id": comment.ID,
+			"status":     comment.Status,
+		})
+		return
+	}
+
+	view := newCommentView(comment)
+	publishBroadcast(fanout.KindComment, pollID, 0, view)
+	c.JSON(http.StatusCreated, view)
+}
+
+// GetPollComments 查询投票的公开评论，按时间从新到旧
+// 支持的查询参数: before（只返回ID小于该值的评论，用于翻页）, limit（默认50，最多200）
+func GetPollComments(c *gin.Context) {
+	pollID, ok := parsePollIDParam(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.Where("poll_id = ? AND status = ?", pollID, models.CommentStatusVisible)
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		before, err := strconv.ParseUint(beforeStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的before参数"})
+			return
+		}
+		query = query.Where("id < ?", before)
+	}
+
+	var records []models.Comment
+	if err := query.Order("id desc").Limit(limit).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询评论失败"})
+		return
+	}
+
+	views := make([]commentView, len(records))
+	for i, record := range records {
+		views[i] = newCommentView(record)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":  views,
+		"reactions": reactionCounter.Counts(context.Background(), engagementRedis(), pollID),
+	})
+}
+
+// AddReaction 为投票发送一个表情
+func AddReaction(c *gin.Context) {
+	pollID, ok := parsePollIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input ReactionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !comments.ValidReaction(input.Reaction) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "不支持的表情",
+			"reactions": comments.ReactionNames(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), fanoutPublishTimeout)
+	defer cancel()
+	reactionCounter.Add(ctx, engagementRedis(), pollID, input.Reaction)
+	reactionNotifier.Trigger(pollID)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "已收到"})
+}
+
+// GetPollReactions 查询投票各表情的累计数
+func GetPollReactions(c *gin.Context) {
+	pollID, ok := parsePollIDParam(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id": pollID,
+		"counts":  reactionCounter.Counts(c.Request.Context(), engagementRedis(), pollID),
+	})
+}
+
+// emitReactions 推送投票最新的表情累计数
+func emitReactions(pollID uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutPublishTimeout)
+	defer cancel()
+
+	publishBroadcast(fanout.KindReactions, pollID, 0, reactionUpdate{
+		PollID:    pollID,
+		Counts:    reactionCounter.Counts(ctx, engagementRedis(), pollID),
+		Timestamp: time.Now().UnixNano(),
+	})
+}
+
+// deliverLocalEngagement 向本实例观看投票的WebSocket和SSE客户端推送评论和表情
+func deliverLocalEngagement(kind string, pollID uint, payload json.RawMessage) {
+	var err error
+	switch kind {
+	case fanout.KindComment:
+		var view commentView
+		if err = json.Unmarshal(payload, &view); err == nil {
+			deliverLocalTransient(pollID, &wsCommentMessage{Type: WSTypeComment, Data: view}, SSEEventComment, payload)
+		}
+	case fanout.KindCommentDeleted:
+		var deletion commentDeletion
+		if err = json.Unmarshal(payload, &deletion); err == nil {
+			deliverLocalTransient(pollID, &wsCommentDeletedMessage{Type: WSTypeCommentDeleted, Data: deletion}, SSEEventCommentDeleted, payload)
+		}
+	case fanout.KindReactions:
+		var update reactionUpdate
+		if err = json.Unmarshal(payload, &update); err == nil {
+			deliverLocalTransient(pollID, &wsReactionsMessage{Type: WSTypeReactions, Data: update}, SSEEventReactions, payload)
+		}
+	}
+	if err != nil {
+		log.Printf("解析%s消息失败，投票ID %d: %v", kind, pollID, err)
+	}
+}
+
+// GetComments 管理员查询评论，包含未公开和已删除的评论
+// 支持的查询参数: poll_id, status（默认flagged，all表示全部）, limit, offset
+func GetComments(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	query := database.DB.Model(&models.Comment{})
+
+	if pollIDStr := c.Query("poll_id"); pollIDStr != "" {
+		pollID, err := strconv.ParseUint(pollIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+			return
+		}
+		query = query.Where("poll_id = ?", pollID)
+	}
+
+	status := c.DefaultQuery("status", models.CommentStatusFlagged)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询评论失败"})
+		return
+	}
+
+	var records []models.Comment
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询评论失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":    total,
+		"comments": records,
+	})
+}
+
+// ApproveComment 公开被内容审核标记的评论
+func ApproveComment(c *gin.Context) {
+	moderateComment(c, models.CommentStatusVisible)
+}
+
+// DeleteComment 删除评论，已公开的评论会从所有客户端实时移除
+func DeleteComment(c *gin.Context) {
+	moderateComment(c, models.CommentStatusDeleted)
+}
+
+// errCommentModerated 评论状态已被其他请求修改
+var errCommentModerated = errors.New("评论状态已变更，请刷新后重试")
+
+// moderateComment 修改评论状态
+// 被标记的评论可以公开或删除，已公开的评论只能删除，已删除的评论不能再修改
+func moderateComment(c *gin.Context, status string) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的评论ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "评论未找到"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取评论失败"})
+		}
+		return
+	}
+	before := comment
+
+	allowedFrom := []string{models.CommentStatusFlagged}
+	updates := map[string]interface{}{"status": status}
+	if status == models.CommentStatusDeleted {
+		allowedFrom = append(allowedFrom, models.CommentStatusVisible)
+		deletedAt := time.Now()
+		comment.DeletedBy = auditActor(c)
+		comment.DeletedAt = &deletedAt
+		updates["deleted_by"] = comment.DeletedBy
+		updates["deleted_at"] = deletedAt
+	}
+
+	// 条件更新保证并发处理时只有一个请求生效
+	result := database.DB.Model(&models.Comment{}).
+		Where("id = ? AND status IN ?", comment.ID, allowedFrom).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("修改评论状态失败: 评论ID=%d, 错误: %v", comment.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改评论状态失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errCommentModerated.Error()})
+		return
+	}
+	comment.Status = status
+
+	action := AuditActionCommentDelete
+	if status == models.CommentStatusVisible {
+		action = AuditActionCommentApprove
+	}
+	recordAudit(c, action, "comment:"+strconv.FormatUint(uint64(comment.ID), 10), before, comment)
+
+	// 公开的评论推送给观众；删除只需通知已经看到该评论的观众
+	switch {
+	case status == models.CommentStatusVisible:
+		publishBroadcast(fanout.KindComment, comment.PollID, 0, newCommentView(comment))
+	case before.Status == models.CommentStatusVisible:
+		publishBroadcast(fanout.KindCommentDeleted, comment.PollID, 0, commentDeletion{
+			PollID:    comment.PollID,
+			CommentID: comment.ID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "处理完成", "comment": comment})
+}
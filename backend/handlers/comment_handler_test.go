@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// readEngagement reads the next comment or reaction message, skipping results and presence updates.
+func readEngagement(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	return readWSFrames(t, conn, 1, func(msg map[string]interface{}) bool {
+		switch msg["type"] {
+		case "COMMENT", "COMMENT_DELETED", "REACTIONS":
+			return true
+		}
+		return false
+	})[0]
+}
+
+func TestComments_LiveModeration(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.Comment{})
+
+	poll := models.Poll{Question: "Town hall?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws%s/api/polls/%d/ws", strings.TrimPrefix(server.URL, "http"), poll.ID), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	commentsPath := fmt.Sprintf("/api/polls/%d/comments", poll.ID)
+
+	// A clean comment is published immediately
+	w := performJSON(router, "POST", commentsPath, gin.H{"author": "Ann", "content": "  When is the next meeting? "})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created commentView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "When is the next meeting?", created.Content)
+
+	msg := readEngagement(t, conn)
+	assert.Equal(t, "COMMENT", msg["type"])
+	assert.Equal(t, float64(created.ID), msg["data"].(map[string]interface{})["id"])
+	assert.NotContains(t, msg["data"], "ip")
+
+	// A comment with a link is held for review and not broadcast
+	w = performJSON(router, "POST", commentsPath, gin.H{"content": "details at https://example.com"})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var held map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &held))
+	heldID := uint(held["comment_id"].(float64))
+
+	w = performJSON(router, "POST", commentsPath, gin.H{"content": " "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/admin/comments?admin_key=admin123&poll_id=%d", poll.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var flagged struct {
+		Total    int64            `json:"total"`
+		Comments []models.Comment `json:"comments"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flagged))
+	require.Equal(t, int64(1), flagged.Total)
+	assert.Equal(t, heldID, flagged.Comments[0].ID)
+	assert.Equal(t, "link", flagged.Comments[0].FlagReasons)
+
+	// Approving publishes it; approving twice conflicts
+	w = performJSON(router, "POST", fmt.Sprintf("/api/admin/comments/%d/approve?admin_key=admin123", heldID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	msg = readEngagement(t, conn)
+	assert.Equal(t, "COMMENT", msg["type"])
+	assert.Equal(t, float64(heldID), msg["data"].(map[string]interface{})["id"])
+
+	w = performJSON(router, "POST", fmt.Sprintf("/api/admin/comments/%d/approve?admin_key=admin123", heldID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Deleting a visible comment propagates live and hides it from the list
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/admin/comments/%d", created.ID), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/admin/comments/%d?admin_key=admin123", created.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	msg = readEngagement(t, conn)
+	assert.Equal(t, "COMMENT_DELETED", msg["type"])
+	assert.Equal(t, float64(created.ID), msg["data"].(map[string]interface{})["comment_id"])
+
+	w = performJSON(router, "GET", commentsPath, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Comments []commentView `json:"comments"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Comments, 1)
+	assert.Equal(t, heldID, listed.Comments[0].ID)
+
+	w = performJSON(router, "POST", "/api/polls/999999/comments", gin.H{"content": "hi"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReactions_ThrottledCounts(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Applause?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+
+	// Poll IDs restart with the in-memory database, so drop counts from earlier runs
+	reactionCounter = cache.NewReactionCounter()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws%s/api/polls/%d/ws", strings.TrimPrefix(server.URL, "http"), poll.ID), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reactionsPath := fmt.Sprintf("/api/polls/%d/reactions", poll.ID)
+	for i := 0; i < 5; i++ {
+		w := performJSON(router, "POST", reactionsPath, gin.H{"reaction": "clap"})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	}
+	w := performJSON(router, "POST", reactionsPath, gin.H{"reaction": "💩"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The burst is coalesced; the trailing push always carries the final totals
+	var counts map[string]interface{}
+	for pushes := 0; counts["clap"] != float64(5); pushes++ {
+		require.Less(t, pushes, 5, "reaction totals never reached 5")
+		msg := readEngagement(t, conn)
+		require.Equal(t, "REACTIONS", msg["type"])
+		counts = msg["data"].(map[string]interface{})["counts"].(map[string]interface{})
+	}
+
+	w = performJSON(router, "GET", reactionsPath, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"poll_id":%d,"counts":{"clap":5}}`, poll.ID), w.Body.String())
+}
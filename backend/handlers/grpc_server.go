@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/votingpb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// gRPC metadata中的管理员密钥、操作者和访问令牌，与HTTP请求头对应
+const (
+	grpcAdminKeyHeader  = "x-admin-key"
+	grpcAdminUserHeader = "x-admin-user"
+	grpcUserIDHeader    = "x-user-id"
+	grpcAuthHeader      = "authorization"
+)
+
+// grpcWatchers 本实例等待更新的WatchPoll流，由Hub写入WebSocket历史时唤醒
+var grpcWatchers = livefeed.NewWaiters(grpcMaxWatchStreams())
+
+// grpcMaxWatchStreams 从环境变量GRPC_MAX_WATCH_STREAMS读取每个实例最多同时订阅的WatchPoll流数，默认1000
+func grpcMaxWatchStreams() int {
+	if n, err := strconv.Atoi(os.Getenv("GRPC_MAX_WATCH_STREAMS")); err == nil && n > 0 {
+		return n
+	}
+	return 1000
+}
+
+// grpcVotingServer 实现votingpb.VotingServiceServer，校验和业务逻辑与Gin处理函数共用
+type grpcVotingServer struct {
+	votingpb.UnimplementedVotingServiceServer
+}
+
+// NewGRPCServer 创建注册了投票服务的gRPC服务器
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcRecoveryUnary, grpcRateLimitUnary),
+		grpc.ChainStreamInterceptor(grpcRecoveryStream),
+	)
+	votingpb.RegisterVotingServiceServer(server, &grpcVotingServer{})
+	return server
+}
+
+// grpcRecoveryUnary 处理函数panic时返回Internal，与Gin的Recovery中间件对应
+func grpcRecoveryUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("gRPC调用 %s 发生panic: %v", info.FullMethod, r)
+			err = status.Error(codes.Internal, "服务器内部错误")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// grpcRateLimitUnary 与HTTP接口的RateLimitMiddleware共用限流器，按客户端IP限流，超限时返回ResourceExhausted
+func grpcRateLimitUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if message := checkRateLimit(ctx, rateLimitIPKey(grpcClientIP(ctx))); message != "" {
+		return nil, status.Error(codes.ResourceExhausted, message)
+	}
+	return handler(ctx, req)
+}
+
+// grpcRecoveryStream 流式调用的panic恢复
+func grpcRecoveryStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("gRPC调用 %s 发生panic: %v", info.FullMethod, r)
+			err = status.Error(codes.Internal, "服务器内部错误")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// grpcError 将HTTP处理逻辑返回的状态码和错误响应转换为gRPC错误
+func grpcError(httpStatus int, body gin.H) error {
+	message, _ := body["error"].(string)
+	if message == "" {
+		message = http.StatusText(httpStatus)
+	}
+
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, message)
+}
+
+// grpcMetadata 读取metadata中第一个值
+func grpcMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcClientIP 调用方的IP，用于IP规则、防机器人校验和审计日志
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// grpcAuditActor 操作者标识，与auditActor的请求头顺序相同
+func grpcAuditActor(ctx context.Context) string {
+	if actor := grpcMetadata(ctx, grpcAdminUserHeader); actor != "" {
+		return actor
+	}
+	if actor := grpcMetadata(ctx, grpcUserIDHeader); actor != "" {
+		return actor
+	}
+	return "admin"
+}
+
+// grpcStreamToken 从authorization metadata中读取实时连接访问令牌
+func grpcStreamToken(ctx context.Context) string {
+	auth := grpcMetadata(ctx, grpcAuthHeader)
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// toProtoTime 转换可选的时间
+func toProtoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// toProtoOptions 转换带百分比的选项结果
+func toProtoOptions(results []OptionResult) []*votingpb.Option {
+	options := make([]*votingpb.Option, len(results))
+	for i, result := range results {
+		options[i] = &votingpb.Option{
+			Id:         uint32(result.ID),
+			Text:       result.Text,
+			Votes:      result.Votes,
+			Percentage: result.Percentage,
+		}
+	}
+	return options
+}
+
+// toProtoResults 转换投票后的当前结果
+func toProtoResults(results []PollOptionResult) []*votingpb.Option {
+	converted := make([]OptionResult, len(results))
+	for i, result := range results {
+		converted[i] = OptionResult(result)
+	}
+	return toProtoOptions(converted)
+}
+
+// toProtoPoll 转换数据库中的投票
+func toProtoPoll(poll *models.Poll) *votingpb.Poll {
+	return &votingpb.Poll{
+		Id:          uint32(poll.ID),
+		Question:    poll.Question,
+		Description: poll.Description,
+		PollType:    votingpb.PollType(poll.PollType),
+		IsActive:    poll.IsActive,
+		Options:     toProtoOptions(calculatePercentages(poll.Options)),
+		EndTime:     toProtoTime(poll.EndTime),
+		CreatedAt:   timestamppb.New(poll.CreatedAt),
+		UpdatedAt:   timestamppb.New(poll.UpdatedAt),
+	}
+}
+
+// CreatePoll 创建投票，使用与HTTP请求体相同的binding校验
+func (s *grpcVotingServer) CreatePoll(ctx context.Context, req *votingpb.CreatePollRequest) (*votingpb.Poll, error) {
+	input := CreatePollInput{
+		Question:    req.GetQuestion(),
+		Description: req.GetDescription(),
+		PollType:    models.PollType(req.GetPollType()),
+		AntiBot:     req.GetAntiBotEnabled(),
+		Verifiable:  req.GetVerifiable(),
+	}
+	for _, text := range req.GetOptions() {
+		input.Options = append(input.Options, CreateOptionInput{Text: text})
+	}
+	if req.GetEndTime() != nil {
+		endTime := req.GetEndTime().AsTime()
+		input.EndTime = &endTime
+	}
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	poll, httpStatus, errBody := createPoll(input)
+	if errBody != nil {
+		return nil, grpcError(httpStatus, errBody)
+	}
+	return toProtoPoll(poll), nil
+}
+
+// GetPoll 获取投票详情，已过期的投票标记为未开启
+func (s *grpcVotingServer) GetPoll(ctx context.Context, req *votingpb.GetPollRequest) (*votingpb.Poll, error) {
+	detail, httpStatus, errBody := loadPollDetail(uint(req.GetPollId()))
+	if errBody != nil {
+		return nil, grpcError(httpStatus, errBody)
+	}
+	return &votingpb.Poll{
+		Id:          uint32(detail.ID),
+		Question:    detail.Question,
+		Description: detail.Description,
+		PollType:    votingpb.PollType(detail.PollType),
+		IsActive:    detail.IsActive,
+		Options:     toProtoOptions(detail.Options),
+		EndTime:     toProtoTime(detail.EndTime),
+		CreatedAt:   timestamppb.New(detail.CreatedAt),
+		UpdatedAt:   timestamppb.New(detail.UpdatedAt),
+	}, nil
+}
+
+// ListPolls 获取全部投票
+func (s *grpcVotingServer) ListPolls(ctx context.Context, req *votingpb.ListPollsRequest) (*votingpb.ListPollsResponse, error) {
+	polls, err := listPolls()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to retrieve polls")
+	}
+	response := &votingpb.ListPollsResponse{Polls: make([]*votingpb.Poll, len(polls))}
+	for i := range polls {
+		response.Polls[i] = toProtoPoll(&polls[i])
+	}
+	return response, nil
+}
+
+// SubmitVote 提交投票，IP规则、防机器人、异常隔离和计票与增强版投票接口相同
+func (s *grpcVotingServer) SubmitVote(ctx context.Context, req *votingpb.SubmitVoteRequest) (*votingpb.SubmitVoteResponse, error) {
+	pollID := uint(req.GetPollId())
+	clientIP := grpcClientIP(ctx)
+	if !ipAllowed(clientIP, pollID) {
+		return nil, status.Error(codes.PermissionDenied, ipDeniedMessage)
+	}
+
+	input := EnhancedVoteInput{
+		MessageID:   req.GetMessageId(),
+		ProofOfWork: ProofOfWork{Nonce: req.GetPowNonce(), Solution: req.GetPowSolution()},
+	}
+	for _, optionID := range req.GetOptionIds() {
+		input.OptionIDs = append(input.OptionIDs, uint(optionID))
+	}
+
+	userAgent := grpcMetadata(ctx, "user-agent")
+	httpStatus, body := applyEnhancedVote(pollID, input, clientIP, userAgent)
+	if httpStatus >= http.StatusBadRequest {
+		return nil, grpcError(httpStatus, body)
+	}
+
+	response := &votingpb.SubmitVoteResponse{}
+	response.Message, _ = body["message"].(string)
+	if results, ok := body["current_results"].([]PollOptionResult); ok {
+		response.Results = toProtoResults(results)
+	}
+	response.Quarantined, _ = body["quarantined"].(bool)
+	if quarantineID, ok := body["quarantine_id"].(uint); ok {
+		response.QuarantineId = uint32(quarantineID)
+	}
+	response.Receipt, _ = body["receipt"].(string)
+	response.ReceiptSalt, _ = body["receipt_salt"].(string)
+	return response, nil
+}
+
+// ResetPoll 重置投票数据，需要在metadata中携带管理员密钥
+func (s *grpcVotingServer) ResetPoll(ctx context.Context, req *votingpb.ResetPollRequest) (*votingpb.ResetPollResponse, error) {
+	if grpcMetadata(ctx, grpcAdminKeyHeader) != "admin123" {
+		return nil, status.Error(codes.Unauthenticated, "无效的管理员密钥")
+	}
+	pollID := uint(req.GetPollId())
+	if !pollExists(pollID) {
+		return nil, status.Error(codes.NotFound, "投票未找到")
+	}
+
+	httpStatus, body := resetPoll(pollID, grpcAuditActor(ctx), grpcClientIP(ctx))
+	if httpStatus >= http.StatusBadRequest {
+		return nil, grpcError(httpStatus, body)
+	}
+
+	response := &votingpb.ResetPollResponse{PollId: uint32(pollID)}
+	if results, err := GetCurrentPollResults(pollID); err == nil {
+		response.Results = toProtoResults(results)
+	}
+	return response, nil
+}
+
+// WatchPoll 推送投票结果的更新，与长轮询一样从WebSocket的消息历史读取
+// 不带since时先推送当前快照；错过的更新已无法补发时重新推送快照
+func (s *grpcVotingServer) WatchPoll(req *votingpb.WatchPollRequest, stream votingpb.VotingService_WatchPollServer) error {
+	ctx := stream.Context()
+	pollID := uint(req.GetPollId())
+	if !pollExists(pollID) {
+		return status.Error(codes.NotFound, "投票未找到")
+	}
+
+	claims, err := verifyStreamToken(grpcStreamToken(ctx))
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !claimsCanView(claims, pollID) {
+		return status.Error(codes.PermissionDenied, "无权查看该投票")
+	}
+
+	// 令牌过期时结束订阅，客户端需使用新令牌重新订阅
+	var expired <-chan time.Time
+	if claims != nil {
+		expiry := time.NewTimer(time.Until(claims.Expiry()))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	var since uint64
+	if req.Since == nil {
+		if since, err = sendWatchSnapshot(stream, pollID); err != nil {
+			return err
+		}
+	} else {
+		since = req.GetSince()
+	}
+
+	for {
+		// 先登记再检查历史，检查之后到达的更新会唤醒本订阅
+		waiter, err := grpcWatchers.Park(pollID)
+		if errors.Is(err, livefeed.ErrTooManyWaiters) {
+			return status.Error(codes.ResourceExhausted, "订阅过多，请稍后重试")
+		}
+
+		entries, ok := GlobalHub.history.Since(pollID, since)
+		if !ok && since != currentPollSeq(pollID) {
+			waiter.Release()
+			if since, err = sendWatchSnapshot(stream, pollID); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(entries) > 0 {
+			waiter.Release()
+			for _, entry := range entries {
+				if update := decodeWatchUpdate(entry.Data); update != nil {
+					if err := stream.Send(update); err != nil {
+						return err
+					}
+				}
+				since = entry.Seq
+			}
+			continue
+		}
+
+		select {
+		case <-waiter.C:
+			// 有新的更新，重新检查历史
+		case <-expired:
+			waiter.Release()
+			return status.Error(codes.Unauthenticated, "访问令牌已过期")
+		case <-ctx.Done():
+			waiter.Release()
+			return ctx.Err()
+		}
+	}
+}
+
+// sendWatchSnapshot 推送投票当前结果的快照，返回快照的序号
+func sendWatchSnapshot(stream votingpb.VotingService_WatchPollServer, pollID uint) (uint64, error) {
+	seq, snapshot, err := buildPollSnapshot(pollID)
+	if err != nil {
+		log.Printf("生成gRPC订阅快照失败: %v", err)
+		return 0, status.Error(codes.Internal, "获取投票结果失败")
+	}
+	if update := decodeWatchUpdate(snapshot); update != nil {
+		if err := stream.Send(update); err != nil {
+			return 0, err
+		}
+	}
+	return seq, nil
+}
+
+// decodeWatchUpdate 将历史中的VOTE_UPDATE或SNAPSHOT消息转换为PollUpdate，其他消息返回nil
+func decodeWatchUpdate(data []byte) *votingpb.PollUpdate {
+	decoded, err := decodeWSMessage(data)
+	if err != nil {
+		log.Printf("解析gRPC订阅消息失败: %v", err)
+		return nil
+	}
+	message, ok := decoded.(*wsResultsMessage)
+	if !ok {
+		return nil
+	}
+
+	options := make([]models.PollOption, len(message.Data.Options))
+	for i, option := range message.Data.Options {
+		options[i] = models.PollOption{Text: option.Text, Votes: option.Votes}
+		options[i].ID = option.ID
+	}
+	return &votingpb.PollUpdate{
+		PollId:    uint32(message.Data.PollID),
+		Seq:       message.Seq,
+		Snapshot:  message.Type == WSTypeSnapshot,
+		Options:   toProtoOptions(calculatePercentages(options)),
+		Timestamp: timestamppb.New(time.Unix(0, message.Data.Timestamp)),
+	}
+}
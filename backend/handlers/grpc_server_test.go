@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/votingpb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// startTestGRPCServer serves the voting service on a loopback port and returns a connected client.
+func startTestGRPCServer(t *testing.T) votingpb.VotingServiceClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return votingpb.NewVotingServiceClient(conn)
+}
+
+func TestGRPC_PollLifecycle(t *testing.T) {
+	_, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	client := startTestGRPCServer(t)
+	ctx := context.Background()
+
+	// Validation is shared with the HTTP handler
+	_, err := client.CreatePoll(ctx, &votingpb.CreatePollRequest{Question: "Too few?", Options: []string{"A"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	poll, err := client.CreatePoll(ctx, &votingpb.CreatePollRequest{
+		Question: "Favourite transport?",
+		PollType: votingpb.PollType_POLL_TYPE_MULTIPLE_CHOICE,
+		Options:  []string{"HTTP", "gRPC"},
+	})
+	require.NoError(t, err)
+	require.Len(t, poll.Options, 2)
+	assert.True(t, poll.IsActive)
+	assert.Equal(t, votingpb.PollType_POLL_TYPE_MULTIPLE_CHOICE, poll.PollType)
+
+	got, err := client.GetPoll(ctx, &votingpb.GetPollRequest{PollId: poll.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "Favourite transport?", got.Question)
+	_, err = client.GetPoll(ctx, &votingpb.GetPollRequest{PollId: poll.Id + 1000})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListPolls(ctx, &votingpb.ListPollsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Polls, 1)
+	assert.Equal(t, poll.Id, list.Polls[0].Id)
+
+	vote, err := client.SubmitVote(ctx, &votingpb.SubmitVoteRequest{PollId: poll.Id, OptionIds: []uint32{poll.Options[1].Id}})
+	require.NoError(t, err)
+	require.Len(t, vote.Results, 2)
+	for _, option := range vote.Results {
+		if option.Id == poll.Options[1].Id {
+			assert.Equal(t, int64(1), option.Votes)
+			assert.Equal(t, float64(100), option.Percentage)
+		}
+	}
+	_, err = client.SubmitVote(ctx, &votingpb.SubmitVoteRequest{PollId: poll.Id, OptionIds: []uint32{9999}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Resetting requires the admin key in the metadata
+	_, err = client.ResetPoll(ctx, &votingpb.ResetPollRequest{PollId: poll.Id})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	adminCtx := metadata.AppendToOutgoingContext(ctx, "x-admin-key", "admin123", "x-admin-user", "grpc-admin")
+	reset, err := client.ResetPoll(adminCtx, &votingpb.ResetPollRequest{PollId: poll.Id})
+	require.NoError(t, err)
+	for _, option := range reset.Results {
+		assert.Zero(t, option.Votes)
+	}
+
+	var entry models.AuditLog
+	require.NoError(t, db.Where("action = ?", AuditActionPollReset).Last(&entry).Error)
+	assert.Equal(t, "grpc-admin", entry.Actor)
+}
+
+func TestGRPC_WatchPoll(t *testing.T) {
+	_, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	client := startTestGRPCServer(t)
+
+	poll := models.Poll{Question: "Streaming?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "Yes"}
+	require.NoError(t, db.Create(&option).Error)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without since the stream starts with a snapshot
+	stream, err := client.WatchPoll(ctx, &votingpb.WatchPollRequest{PollId: uint32(poll.ID)})
+	require.NoError(t, err)
+	snapshot, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, snapshot.Snapshot)
+	require.Len(t, snapshot.Options, 1)
+
+	// Updates come from the same broadcast pipeline as the WebSocket hub
+	require.Eventually(t, func() bool { return grpcWatchers.Len() > 0 }, 2*time.Second, 10*time.Millisecond)
+	BroadcastPollUpdate(poll.ID, []PollOptionResult{{ID: option.ID, Text: "Yes", Votes: 3}})
+	update, err := stream.Recv()
+	require.NoError(t, err)
+	assert.False(t, update.Snapshot)
+	assert.Greater(t, update.Seq, snapshot.Seq)
+	require.Len(t, update.Options, 1)
+	assert.Equal(t, int64(3), update.Options[0].Votes)
+	assert.Equal(t, float64(100), update.Options[0].Percentage)
+
+	// Resuming from the snapshot sequence replays the missed update from history
+	resumed, err := client.WatchPoll(ctx, &votingpb.WatchPollRequest{PollId: uint32(poll.ID), Since: &snapshot.Seq})
+	require.NoError(t, err)
+	replayed, err := resumed.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, update.Seq, replayed.Seq)
+
+	missing, err := client.WatchPoll(ctx, &votingpb.WatchPollRequest{PollId: uint32(poll.ID) + 1000})
+	require.NoError(t, err)
+	_, err = missing.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPC_SubmitVoteRateLimited(t *testing.T) {
+	_, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	enableTestRateLimit(t)
+	client := startTestGRPCServer(t)
+	ctx := context.Background()
+
+	poll := models.Poll{Question: "Rate limited?", IsActive: true, PollType: models.MultiChoice}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+
+	// The bucket refills at most once while these are sent, so at least one vote is rejected
+	var err error
+	for i := 0; i < 3 && status.Code(err) != codes.ResourceExhausted; i++ {
+		_, err = client.SubmitVote(ctx, &votingpb.SubmitVoteRequest{PollId: uint32(poll.ID), OptionIds: []uint32{uint32(option.ID)}})
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	var stored models.PollOption
+	require.NoError(t, db.First(&stored, option.ID).Error)
+	assert.Less(t, stored.Votes, int64(3))
+}
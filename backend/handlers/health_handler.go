@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"realtime-voting-backend/database"
+	"realtime-voting-backend/fanout"
+	"realtime-voting-backend/mq"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,15 +16,17 @@ import (
 
 // SystemInfo contains basic system metrics and information
 type SystemInfo struct {
-	Status       string    `json:"status"`
-	Version      string    `json:"version"`
-	Uptime       string    `json:"uptime"`
-	StartTime    time.Time `json:"start_time"`
-	CurrentTime  time.Time `json:"current_time"`
-	GoVersion    string    `json:"go_version"`
-	NumGoroutine int       `json:"num_goroutine"`
-	NumCPU       int       `json:"num_cpu"`
-	DBStatus     string    `json:"db_status"`
+	Status       string       `json:"status"`
+	Version      string       `json:"version"`
+	Uptime       string       `json:"uptime"`
+	StartTime    time.Time    `json:"start_time"`
+	CurrentTime  time.Time    `json:"current_time"`
+	GoVersion    string       `json:"go_version"`
+	NumGoroutine int          `json:"num_goroutine"`
+	NumCPU       int          `json:"num_cpu"`
+	DBStatus     string       `json:"db_status"`
+	InstanceID   string       `json:"instance_id"`
+	Broadcast    fanout.Stats `json:"broadcast"` // 跨实例广播统计
 }
 
 var (
@@ -55,6 +61,8 @@ func SystemStatus(c *gin.Context) {
 		NumGoroutine: runtime.NumGoroutine(),
 		NumCPU:       runtime.NumCPU(),
 		DBStatus:     dbStatus,
+		InstanceID:   broadcastRelay.InstanceID(),
+		Broadcast:    BroadcastStats(),
 	}
 
 	c.JSON(http.StatusOK, info)
@@ -88,5 +96,133 @@ poll_votes_total{poll_id="3"} 18
 # TYPE system_goroutines gauge
 system_goroutines %d
 `
-	c.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(fmt.Sprintf(metrics, runtime.NumGoroutine())))
+	c.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(fmt.Sprintf(metrics, runtime.NumGoroutine())+broadcastMetrics()+websocketMetrics()+longPollMetrics()+grpcMetrics()+voteQueueMetrics()))
+}
+
+// broadcastMetrics 实时推送相关的指标
+func broadcastMetrics() string {
+	coalescer := BroadcastCoalescerStats()
+	relay := BroadcastStats()
+
+	connected := 0
+	if relay.Connected {
+		connected = 1
+	}
+
+	return fmt.Sprintf(`
+# HELP broadcast_triggers_total Poll broadcast requests received by the coalescer
+# TYPE broadcast_triggers_total counter
+broadcast_triggers_total %d
+
+# HELP broadcast_emits_total Poll broadcasts actually sent after coalescing
+# TYPE broadcast_emits_total counter
+broadcast_emits_total %d
+
+# HELP broadcast_saved_total Poll broadcasts saved by coalescing
+# TYPE broadcast_saved_total counter
+broadcast_saved_total %d
+
+# HELP broadcast_emit_rate Poll broadcasts per second averaged over the last minute
+# TYPE broadcast_emit_rate gauge
+broadcast_emit_rate %.3f
+
+# HELP broadcast_relay_published_total Updates published to other instances
+# TYPE broadcast_relay_published_total counter
+broadcast_relay_published_total %d
+
+# HELP broadcast_relay_publish_failures_total Updates that could not be published to other instances
+# TYPE broadcast_relay_publish_failures_total counter
+broadcast_relay_publish_failures_total %d
+
+# HELP broadcast_relay_relayed_total Updates received from other instances
+# TYPE broadcast_relay_relayed_total counter
+broadcast_relay_relayed_total %d
+
+# HELP broadcast_relay_connected Whether the cross-instance subscription is connected
+# TYPE broadcast_relay_connected gauge
+broadcast_relay_connected %d
+`, coalescer.Triggers, coalescer.Emits, coalescer.Saved, coalescer.EmitRate,
+		relay.Published, relay.PublishFailures, relay.Relayed, connected)
+}
+
+// websocketMetrics WebSocket发送队列和慢消费者相关的指标
+func websocketMetrics() string {
+	stats := GlobalHub.Stats()
+
+	return fmt.Sprintf(`
+# HELP ws_connections Current WebSocket connections
+# TYPE ws_connections gauge
+ws_connections %d
+
+# HELP ws_slow_consumer_disconnects_total Clients disconnected because their send queue was full
+# TYPE ws_slow_consumer_disconnects_total counter
+ws_slow_consumer_disconnects_total{policy="%s"} %d
+
+# HELP ws_dropped_messages_total Queued messages dropped by the drop_oldest policy
+# TYPE ws_dropped_messages_total counter
+ws_dropped_messages_total %d
+
+# HELP ws_send_blocked_seconds_total Time broadcasts spent waiting for slow clients under the block policy
+# TYPE ws_send_blocked_seconds_total counter
+ws_send_blocked_seconds_total %.3f
+
+# HELP ws_client_pending_max Largest number of messages waiting in a single client's send queue
+# TYPE ws_client_pending_max gauge
+ws_client_pending_max %d
+
+# HELP ws_client_lag_seconds_max Longest time the oldest queued message of a single client has been waiting
+# TYPE ws_client_lag_seconds_max gauge
+ws_client_lag_seconds_max %.3f
+`, stats.Connections, stats.Policy, stats.SlowDisconnects, stats.DroppedMessages,
+		stats.BlockedMs/1000, stats.MaxPending, stats.MaxLagMs/1000)
+}
+
+// longPollMetrics 长轮询挂起请求相关的指标
+func longPollMetrics() string {
+	return fmt.Sprintf(`
+# HELP longpoll_parked_requests Long-poll requests currently waiting for an update
+# TYPE longpoll_parked_requests gauge
+longpoll_parked_requests %d
+
+# HELP longpoll_rejected_total Long-poll requests rejected because the parked limit was reached
+# TYPE longpoll_rejected_total counter
+longpoll_rejected_total %d
+`, longPollWaiters.Len(), longPollWaiters.Rejected())
+}
+
+// grpcMetrics gRPC订阅相关的指标
+func grpcMetrics() string {
+	return fmt.Sprintf(`
+# HELP grpc_watch_streams WatchPoll streams currently waiting for an update
+# TYPE grpc_watch_streams gauge
+grpc_watch_streams %d
+
+# HELP grpc_watch_rejected_total WatchPoll streams rejected because the stream limit was reached
+# TYPE grpc_watch_rejected_total counter
+grpc_watch_rejected_total %d
+`, grpcWatchers.Len(), grpcWatchers.Rejected())
+}
+
+// voteQueueMetrics 投票消息队列排队和处理耗时的直方图，后端不支持时为空
+func voteQueueMetrics() string {
+	reporter, ok := mqAdapter.Queue().(mq.LatencyReporter)
+	if !ok {
+		return ""
+	}
+	latency := reporter.Latency()
+	return histogramMetric("vote_queue_wait_seconds", "Time vote messages waited between being enqueued and being handled", latency.Wait) +
+		histogramMetric("vote_queue_processing_seconds", "Time the vote handler took per message", latency.Processing)
+}
+
+// histogramMetric 以Prometheus文本格式输出直方图
+func histogramMetric(name, help string, h mq.HistogramSnapshot) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.Buckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.Counts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(&b, "%s_sum %.6f\n", name, h.Sum)
+	fmt.Fprintf(&b, "%s_count %d\n", name, h.Count)
+	return b.String()
 }
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/ipfilter"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IP规则的审计动作
+const (
+	AuditActionIPRuleCreate = "iprule.create"
+	AuditActionIPRuleDelete = "iprule.delete"
+)
+
+// 全局IP规则缓存，多实例部署时其他实例的修改在刷新间隔后生效
+var ipRuleCache = ipfilter.NewCache(loadIPRules, ipRuleRefreshInterval())
+
+// ipRuleRefreshInterval 从环境变量IP_RULES_REFRESH读取规则刷新间隔，默认30秒
+func ipRuleRefreshInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IP_RULES_REFRESH")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// loadIPRules 从数据库读取全部IP规则
+func loadIPRules() ([]models.IPRule, error) {
+	if database.DB == nil {
+		return nil, errors.New("数据库未初始化")
+	}
+	var rules []models.IPRule
+	if err := database.DB.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// IPFilterMiddleware 投票路由前的IP访问控制中间件
+// 客户端IP由c.ClientIP()推导，只有来自可信代理的转发头才会被采纳
+func IPFilterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pollID uint
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 32); err == nil {
+			pollID = uint(id)
+		}
+
+		if !ipAllowed(c.ClientIP(), pollID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ipDeniedMessage})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// IP访问控制拒绝时返回给客户端的错误信息
+const ipDeniedMessage = "您所在的网络不允许参与此投票"
+
+// ipAllowed 判断客户端IP是否允许参与投票
+func ipAllowed(clientIP string, pollID uint) bool {
+	rules, err := ipRuleCache.Get()
+	if err != nil {
+		// 规则无法加载时放行，避免数据库抖动导致所有投票失败
+		log.Printf("加载IP规则失败，跳过IP访问控制: %v", err)
+		return true
+	}
+
+	decision := rules.Decide(clientIP, pollID)
+	if !decision.Allowed {
+		log.Printf("IP访问控制拒绝: IP=%s, 投票ID=%d, 原因=%s, 规则ID=%d", clientIP, pollID, decision.Reason, decision.RuleID)
+		return false
+	}
+	return true
+}
+
+// CreateIPRuleInput 创建IP规则的输入
+type CreateIPRuleInput struct {
+	PollID *uint  `json:"poll_id"` // 为空表示全局规则
+	CIDR   string `json:"cidr" binding:"required"`
+	Action string `json:"action" binding:"required,oneof=allow deny"`
+	Note   string `json:"note"`
+}
+
+// GetIPRules 查询IP规则
+// 支持的查询参数: poll_id（指定投票）, scope=global（只看全局规则）
+func GetIPRules(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	query := database.DB.Model(&models.IPRule{})
+	if pollIDStr := c.Query("poll_id"); pollIDStr != "" {
+		pollID, err := strconv.ParseUint(pollIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+			return
+		}
+		query = query.Where("poll_id = ?", pollID)
+	} else if c.Query("scope") == "global" {
+		query = query.Where("poll_id IS NULL")
+	}
+
+	var rules []models.IPRule
+	if err := query.Order("id asc").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询IP规则失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateIPRule 创建IP规则
+func CreateIPRule(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	var input CreateIPRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	network, err := ipfilter.ParseCIDR(input.CIDR)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.PollID != nil {
+		var count int64
+		if err := database.DB.Model(&models.Poll{}).Where("id = ?", *input.PollID).Count(&count).Error; err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投票未找到"})
+			return
+		}
+	}
+
+	rule := models.IPRule{
+		PollID:    input.PollID,
+		CIDR:      network.String(),
+		Action:    input.Action,
+		Note:      input.Note,
+		CreatedBy: auditActor(c),
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		log.Printf("创建IP规则失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建IP规则失败"})
+		return
+	}
+
+	ipRuleCache.Invalidate()
+	recordAudit(c, AuditActionIPRuleCreate, ipRuleAuditTarget(rule.ID), nil, rule)
+	log.Printf("IP规则已创建: ID=%d, CIDR=%s, 动作=%s, 投票ID=%v", rule.ID, rule.CIDR, rule.Action, rule.PollID)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// DeleteIPRule 删除IP规则
+func DeleteIPRule(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的规则ID"})
+		return
+	}
+
+	var rule models.IPRule
+	if err := database.DB.First(&rule, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "IP规则未找到"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取IP规则失败"})
+		}
+		return
+	}
+
+	if err := database.DB.Delete(&rule).Error; err != nil {
+		log.Printf("删除IP规则失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除IP规则失败"})
+		return
+	}
+
+	ipRuleCache.Invalidate()
+	recordAudit(c, AuditActionIPRuleDelete, ipRuleAuditTarget(rule.ID), rule, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP规则已删除"})
+}
+
+// CheckIPRule 检查指定IP对某个投票的判定结果，便于排查规则配置
+// 查询参数: ip（默认为请求方IP）, poll_id
+func CheckIPRule(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	ip := c.DefaultQuery("ip", c.ClientIP())
+	var pollID uint
+	if pollIDStr := c.Query("poll_id"); pollIDStr != "" {
+		id, err := strconv.ParseUint(pollIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+			return
+		}
+		pollID = uint(id)
+	}
+
+	rules, err := ipRuleCache.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加载IP规则失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip":       ip,
+		"poll_id":  pollID,
+		"decision": rules.Decide(ip, pollID),
+	})
+}
+
+// ipRuleAuditTarget IP规则的审计目标标识
+func ipRuleAuditTarget(id uint) string {
+	return "iprule:" + strconv.FormatUint(uint64(id), 10)
+}
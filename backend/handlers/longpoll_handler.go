@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"realtime-voting-backend/livefeed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 挂起的请求已达上限时建议客户端的重试间隔
+const longPollRetryAfter = 2 * time.Second
+
+// longPollWaiters 本实例挂起的长轮询请求，由Hub写入WebSocket历史时唤醒
+var longPollWaiters = livefeed.NewWaiters(longPollMaxParked())
+
+// longPollMaxParked 从环境变量LONGPOLL_MAX_PARKED读取每个实例最多挂起的长轮询请求数，默认1000
+func longPollMaxParked() int {
+	if n, err := strconv.Atoi(os.Getenv("LONGPOLL_MAX_PARKED")); err == nil && n > 0 {
+		return n
+	}
+	return 1000
+}
+
+// longPollTimeout 从环境变量LONGPOLL_TIMEOUT读取长轮询最长的等待时间，默认25秒
+// 需小于代理的空闲超时，否则请求会在返回前被代理断开
+func longPollTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("LONGPOLL_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 25 * time.Second
+}
+
+// longPollResponse 长轮询的响应，messages与WebSocket消息格式相同
+type longPollResponse struct {
+	PollID   uint              `json:"poll_id"`
+	Seq      uint64            `json:"seq"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// HandleLongPoll 处理长轮询请求，供WebSocket和SSE都无法使用的客户端获取实时更新
+// 不带since时立即返回当前结果快照；带since时等待序号大于since的更新，超时返回空消息列表
+// 支持的查询参数: since（已收到的最大序号）, timeout（最长等待秒数，不超过LONGPOLL_TIMEOUT）
+func HandleLongPoll(c *gin.Context) {
+	pollID, ok := parsePollIDParam(c)
+	if !ok {
+		return
+	}
+	if _, ok := authorizeStream(c, sseStreamToken(c), pollID); !ok {
+		return
+	}
+
+	timeout := longPollTimeout()
+	if timeoutStr := c.Query("timeout"); timeoutStr != "" {
+		seconds, err := strconv.Atoi(timeoutStr)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的timeout参数"})
+			return
+		}
+		if d := time.Duration(seconds) * time.Second; d < timeout {
+			timeout = d
+		}
+	}
+
+	sinceStr := c.Query("since")
+	if sinceStr == "" {
+		respondLongPollSnapshot(c, pollID)
+		return
+	}
+	since, err := strconv.ParseUint(sinceStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的since参数"})
+		return
+	}
+
+	expiry := time.NewTimer(timeout)
+	defer expiry.Stop()
+
+	for {
+		// 先登记再检查历史，检查之后到达的更新会唤醒本请求
+		waiter, err := longPollWaiters.Park(pollID)
+		if errors.Is(err, livefeed.ErrTooManyWaiters) {
+			c.Header("Retry-After", fmt.Sprintf("%.0f", longPollRetryAfter.Seconds()))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "长轮询请求过多，请稍后重试"})
+			return
+		}
+
+		entries, ok := GlobalHub.history.Since(pollID, since)
+		if !ok && since != currentPollSeq(pollID) {
+			// 错过的更新已无法补发，或since超出已知范围，改为返回快照
+			waiter.Release()
+			respondLongPollSnapshot(c, pollID)
+			return
+		}
+		if len(entries) > 0 {
+			waiter.Release()
+			response := longPollResponse{PollID: pollID, Seq: entries[len(entries)-1].Seq}
+			for _, entry := range entries {
+				response.Messages = append(response.Messages, entry.Data)
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		select {
+		case <-waiter.C:
+			// 有新的更新，重新检查历史
+		case <-expiry.C:
+			waiter.Release()
+			c.JSON(http.StatusOK, longPollResponse{PollID: pollID, Seq: since, Messages: []json.RawMessage{}})
+			return
+		case <-c.Request.Context().Done():
+			waiter.Release()
+			return
+		}
+	}
+}
+
+// respondLongPollSnapshot 返回投票当前结果的SNAPSHOT消息
+func respondLongPollSnapshot(c *gin.Context, pollID uint) {
+	seq, snapshot, err := buildPollSnapshot(pollID)
+	if err != nil {
+		log.Printf("生成长轮询快照失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取投票结果失败"})
+		return
+	}
+	c.JSON(http.StatusOK, longPollResponse{PollID: pollID, Seq: seq, Messages: []json.RawMessage{snapshot}})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type longPollResult struct {
+	Seq      uint64                   `json:"seq"`
+	Messages []map[string]interface{} `json:"messages"`
+}
+
+func longPoll(t *testing.T, router *gin.Engine, path string) (int, longPollResult) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var result longPollResult
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result), w.Body.String())
+	}
+	return w.Code, result
+}
+
+func TestLongPoll_WaitsForNextUpdate(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Behind a proxy?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+	path := fmt.Sprintf("/api/polls/%d/poll", poll.ID)
+
+	// The first request returns a snapshot in the WebSocket message format
+	code, first := longPoll(t, router, path)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, first.Messages, 1)
+	assert.Equal(t, "SNAPSHOT", first.Messages[0]["type"])
+	assert.Equal(t, float64(first.Seq), first.Messages[0]["seq"])
+
+	// A follow-up request is parked until the next broadcast
+	type reply struct {
+		code   int
+		result longPollResult
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		code, result := longPoll(t, router, fmt.Sprintf("%s?since=%d&timeout=5", path, first.Seq))
+		replies <- reply{code, result}
+	}()
+	require.Eventually(t, func() bool { return longPollWaiters.Len() > 0 }, 2*time.Second, 10*time.Millisecond)
+
+	BroadcastPollUpdate(poll.ID, []PollOptionResult{{ID: option.ID, Text: "A", Votes: 3}})
+
+	var next reply
+	select {
+	case next = <-replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll was not woken by the broadcast")
+	}
+	require.Equal(t, http.StatusOK, next.code)
+	require.Len(t, next.result.Messages, 1)
+	assert.Equal(t, "VOTE_UPDATE", next.result.Messages[0]["type"])
+	assert.Equal(t, float64(next.result.Seq), next.result.Messages[0]["seq"])
+	assert.Greater(t, next.result.Seq, first.Seq)
+	assert.Equal(t, 0, longPollWaiters.Len())
+
+	// Nothing newer before the timeout yields an empty batch at the same sequence
+	code, idle := longPoll(t, router, fmt.Sprintf("%s?since=%d&timeout=0", path, next.result.Seq))
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, idle.Messages)
+	assert.Equal(t, next.result.Seq, idle.Seq)
+
+	// A sequence the server cannot account for falls back to a snapshot
+	code, stale := longPoll(t, router, fmt.Sprintf("%s?since=%d", path, next.result.Seq+100))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, stale.Messages, 1)
+	assert.Equal(t, "SNAPSHOT", stale.Messages[0]["type"])
+
+	code, _ = longPoll(t, router, path+"?since=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = longPoll(t, router, "/api/polls/999999/poll")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestLongPoll_ParkedLimit(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Full?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+
+	previous := longPollWaiters
+	longPollWaiters = livefeed.NewWaiters(0)
+	defer func() { longPollWaiters = previous }()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/polls/%d/poll?since=0", poll.ID), nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
@@ -14,6 +14,7 @@ import (
 	"realtime-voting-backend/database"
 	"realtime-voting-backend/models"
 	"realtime-voting-backend/mq"
+	"realtime-voting-backend/webhook"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -34,9 +35,11 @@ type CreatePollInput struct {
 	Description string              `json:"description,Description,omitempty"`                // 添加Description字段
 	PollType    models.PollType     `json:"poll_type,PollType" binding:"omitempty,oneof=0 1"` // 支持poll_type和PollType两种格式
 	Options     []CreateOptionInput `json:"options,Options" binding:"required,min=2,dive"`
-	EndTime     *time.Time          `json:"end_time,omitempty"`    // Optional end time
-	MinOptions  *int                `json:"min_options,omitempty"` // For multiple choice polls
-	MaxOptions  *int                `json:"max_options,omitempty"` // For multiple choice polls
+	EndTime     *time.Time          `json:"end_time,omitempty"`         // Optional end time
+	MinOptions  *int                `json:"min_options,omitempty"`      // For multiple choice polls
+	MaxOptions  *int                `json:"max_options,omitempty"`      // For multiple choice polls
+	AntiBot     bool                `json:"anti_bot_enabled,omitempty"` // 是否启用防机器人工作量证明
+	Verifiable  bool                `json:"verifiable,omitempty"`       // 是否启用可验证计票（只能在创建时开启）
 }
 
 // CreateOptionInput defines the structure for options when creating a poll
@@ -52,19 +55,28 @@ func CreatePoll(c *gin.Context) {
 		return
 	}
 
+	poll, status, errBody := createPoll(input)
+	if errBody != nil {
+		c.JSON(status, errBody)
+		return
+	}
+	c.JSON(status, poll)
+}
+
+// createPoll 校验并创建投票，返回创建的投票和HTTP状态码，失败时返回错误响应
+// HTTP接口和gRPC的CreatePoll共用这里的校验和创建逻辑，input需已通过binding标签校验
+func createPoll(input CreatePollInput) (*models.Poll, int, gin.H) {
 	// 记录请求数据
 	log.Printf("收到创建投票请求: Question=%s, PollType=%d", input.Question, input.PollType)
 
 	// Basic validation: Ensure at least two options are provided
 	if len(input.Options) < 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "A poll must have at least two options"})
-		return
+		return nil, http.StatusBadRequest, gin.H{"error": "A poll must have at least two options"}
 	}
 
 	// Validate end time if provided
 	if input.EndTime != nil && input.EndTime.Before(time.Now()) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be in the future"})
-		return
+		return nil, http.StatusBadRequest, gin.H{"error": "End time must be in the future"}
 	}
 
 	poll := models.Poll{
@@ -73,6 +85,9 @@ func CreatePoll(c *gin.Context) {
 		PollType:    input.PollType,
 		IsActive:    true, // Default to active
 		EndTime:     input.EndTime,
+
+		AntiBotEnabled: input.AntiBot,
+		Verifiable:     input.Verifiable,
 	}
 
 	log.Printf("准备创建投票: Question=%s, PollType=%d", poll.Question, poll.PollType)
@@ -80,15 +95,13 @@ func CreatePoll(c *gin.Context) {
 	// Use a transaction to ensure atomicity
 	tx := database.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"}
 	}
 
 	// Create the poll record
 	if err := tx.Create(&poll).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
-		return
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to create poll"}
 	}
 
 	log.Printf("投票创建成功: ID=%d, Question=%s, PollType=%d", poll.ID, poll.Question, poll.PollType)
@@ -104,15 +117,13 @@ func CreatePoll(c *gin.Context) {
 
 	if err := tx.Create(&options).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll options"})
-		return
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to create poll options"}
 	}
 
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"}
 	}
 
 	// Reload the poll with options to return the full object
@@ -120,27 +131,48 @@ func CreatePoll(c *gin.Context) {
 	if err := database.DB.Preload("Options").First(&createdPoll, poll.ID).Error; err != nil {
 		// Log the error but return the basic poll info if reload fails
 		log.Printf("Warning: Failed to reload poll with options after creation: %v", err)
-		c.JSON(http.StatusCreated, poll)
-		return
+		return &poll, http.StatusCreated, nil
 	}
 
 	// 记录重新加载后的投票类型
 	log.Printf("重新加载后的投票: ID=%d, Question=%s, PollType=%d", createdPoll.ID, createdPoll.Question, createdPoll.PollType)
 
-	c.JSON(http.StatusCreated, createdPoll)
+	emitWebhookEvent(webhook.EventPollCreated, createdPoll.ID, newWebhookPollData(createdPoll))
+
+	return &createdPoll, http.StatusCreated, nil
 }
 
 // GetPolls retrieves a list of all polls (consider pagination for large datasets)
 func GetPolls(c *gin.Context) {
-	var polls []models.Poll
-	// Preload options to include them in the response
-	if err := database.DB.Preload("Options").Order("created_at desc").Find(&polls).Error; err != nil {
+	polls, err := listPolls()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve polls"})
 		return
 	}
 	c.JSON(http.StatusOK, polls)
 }
 
+// listPolls 获取全部投票及其选项，最新的在前
+func listPolls() ([]models.Poll, error) {
+	var polls []models.Poll
+	// Preload options to include them in the response
+	err := database.DB.Preload("Options").Order("created_at desc").Find(&polls).Error
+	return polls, err
+}
+
+// pollDetail 投票详情，选项带有百分比
+type pollDetail struct {
+	ID          uint            `json:"id"`
+	Question    string          `json:"question"`
+	Description string          `json:"description"`
+	PollType    models.PollType `json:"poll_type"`
+	IsActive    bool            `json:"is_active"`
+	Options     []OptionResult  `json:"options"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	EndTime     *time.Time      `json:"end_time"`
+}
+
 // GetPoll handles retrieving a single poll by ID
 func GetPoll(c *gin.Context) {
 	// Get ID from the URL parameter
@@ -150,50 +182,32 @@ func GetPoll(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID format"})
 		return
 	}
-	pollUintID := uint(pollID)
 
+	detail, status, errBody := loadPollDetail(uint(pollID))
+	if errBody != nil {
+		c.JSON(status, errBody)
+		return
+	}
+
+	// Return the poll with calculated percentages
+	c.JSON(http.StatusOK, detail)
+}
+
+// loadPollDetail 读取投票详情并计算百分比，失败时返回HTTP状态码和错误响应
+// HTTP接口和gRPC的GetPoll共用
+func loadPollDetail(pollID uint) (*pollDetail, int, gin.H) {
 	// Find the poll in the database
 	var poll models.Poll
-	if err := database.DB.Preload("Options").First(&poll, pollUintID).Error; err != nil {
+	if err := database.DB.Preload("Options").First(&poll, pollID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve poll"})
+			return nil, http.StatusNotFound, gin.H{"error": "Poll not found"}
 		}
-		return
+		return nil, http.StatusInternalServerError, gin.H{"error": "Failed to retrieve poll"}
 	}
 
 	// 记录从数据库读取到的投票类型
 	log.Printf("从数据库读取投票: ID=%d, Question=%s, PollType=%d", poll.ID, poll.Question, poll.PollType)
 
-	// Calculate the total votes and percentages
-	var totalVotes int64 = 0
-	for _, option := range poll.Options {
-		totalVotes += option.Votes
-	}
-
-	// Create response with options including vote percentages
-	type OptionWithPercentage struct {
-		ID         uint    `json:"id"`
-		Text       string  `json:"text"`
-		Votes      int64   `json:"votes"`
-		Percentage float64 `json:"percentage"`
-	}
-
-	options := make([]OptionWithPercentage, len(poll.Options))
-	for i, option := range poll.Options {
-		percentage := 0.0
-		if totalVotes > 0 {
-			percentage = float64(option.Votes) / float64(totalVotes) * 100
-		}
-		options[i] = OptionWithPercentage{
-			ID:         option.ID,
-			Text:       option.Text,
-			Votes:      option.Votes,
-			Percentage: percentage,
-		}
-	}
-
 	// Check if the poll is expired but still marked as active
 	var isActive bool = poll.IsActive
 	if poll.EndTime != nil && time.Now().After(*poll.EndTime) && poll.IsActive {
@@ -201,18 +215,17 @@ func GetPoll(c *gin.Context) {
 		// 不自动更新数据库，只在响应中标记为非活动
 	}
 
-	// Return the poll with calculated percentages
-	c.JSON(http.StatusOK, gin.H{
-		"id":          poll.ID,
-		"question":    poll.Question,
-		"description": poll.Description, // 在GetPoll响应中添加Description字段
-		"poll_type":   poll.PollType,
-		"is_active":   isActive,
-		"options":     options,
-		"created_at":  poll.CreatedAt,
-		"updated_at":  poll.UpdatedAt,
-		"end_time":    poll.EndTime,
-	})
+	return &pollDetail{
+		ID:          poll.ID,
+		Question:    poll.Question,
+		Description: poll.Description, // 在GetPoll响应中添加Description字段
+		PollType:    poll.PollType,
+		IsActive:    isActive,
+		Options:     calculatePercentages(poll.Options),
+		CreatedAt:   poll.CreatedAt,
+		UpdatedAt:   poll.UpdatedAt,
+		EndTime:     poll.EndTime,
+	}, http.StatusOK, nil
 }
 
 // UpdatePollInput defines the expected input structure for updating a poll
@@ -223,7 +236,8 @@ type UpdatePollInput struct {
 	IsActive    *bool               `json:"is_active,IsActive"`
 	Description *string             `json:"Description,description,omitempty"`
 	EndTime     *time.Time          `json:"end_time,EndTime,omitempty"`
-	Options     []UpdateOptionInput `json:"Options,options,omitempty"` // 支持更新选项
+	Options     []UpdateOptionInput `json:"Options,options,omitempty"`  // 支持更新选项
+	AntiBot     *bool               `json:"anti_bot_enabled,omitempty"` // 是否启用防机器人工作量证明
 }
 
 // UpdateOptionInput 定义选项更新的结构
@@ -269,6 +283,9 @@ func UpdatePoll(c *gin.Context) {
 	log.Printf("当前投票信息: ID:%d, Question:%s, PollType:%d, IsActive:%v",
 		poll.ID, poll.Question, poll.PollType, poll.IsActive)
 
+	// 保存修改前的快照用于审计
+	beforeSnapshot := loadPollAuditSnapshot(poll.ID)
+
 	// 直接更新字段而非使用map
 	needsUpdate := false
 
@@ -285,7 +302,12 @@ func UpdatePoll(c *gin.Context) {
 		log.Printf("更新poll_type: %d -> %d", oldPollType, *input.PollType)
 	}
 
+	wasActive := poll.IsActive
 	if input.IsActive != nil {
+		if *input.IsActive && !poll.IsActive && poll.Verifiable && isTallyPublished(database.DB, poll.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "已公布计票结果的可验证投票不能重新开启"})
+			return
+		}
 		poll.IsActive = *input.IsActive
 		needsUpdate = true
 		log.Printf("更新活动状态: %v", *input.IsActive)
@@ -297,6 +319,12 @@ func UpdatePoll(c *gin.Context) {
 		log.Printf("更新描述信息: %s", *input.Description)
 	}
 
+	if input.AntiBot != nil {
+		poll.AntiBotEnabled = *input.AntiBot
+		needsUpdate = true
+		log.Printf("更新防机器人模式: %v", *input.AntiBot)
+	}
+
 	if input.EndTime != nil {
 		poll.EndTime = input.EndTime
 		needsUpdate = true
@@ -405,6 +433,22 @@ func UpdatePoll(c *gin.Context) {
 
 	log.Printf("返回更新后的投票: ID:%d, Question:%s, PollType:%d, IsActive:%v, 选项数量: %d",
 		updatedPoll.ID, updatedPoll.Question, updatedPoll.PollType, updatedPoll.IsActive, len(updatedPoll.Options))
+
+	recordAudit(c, AuditActionPollUpdate, pollAuditTarget(poll.ID), beforeSnapshot, loadPollAuditSnapshot(poll.ID))
+
+	if wasActive && !updatedPoll.IsActive {
+		// 可验证投票关闭时公布Merkle树根和最终票数
+		if updatedPoll.Verifiable {
+			if _, err := publishTally(updatedPoll.ID); err != nil {
+				log.Printf("公布可验证投票 %d 的计票结果失败: %v", updatedPoll.ID, err)
+			}
+		}
+		BroadcastSSEClosed(updatedPoll.ID)
+		emitPollClosedWebhook(updatedPoll.ID, "manual")
+	} else if !wasActive && updatedPoll.IsActive {
+		emitWebhookEvent(webhook.EventPollOpened, updatedPoll.ID, newWebhookPollData(updatedPoll))
+	}
+
 	c.JSON(http.StatusOK, updatedPoll)
 }
 
@@ -417,6 +461,9 @@ func DeletePoll(c *gin.Context) {
 		return
 	}
 
+	// 保存删除前的快照用于审计
+	beforeSnapshot := loadPollAuditSnapshot(uint(id))
+
 	// Use a transaction to ensure atomicity
 	tx := database.DB.Begin()
 	if tx.Error != nil {
@@ -453,6 +500,8 @@ func DeletePoll(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, AuditActionPollDelete, pollAuditTarget(uint(id)), beforeSnapshot, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Poll deleted successfully"})
 }
 
@@ -462,6 +511,7 @@ func DeletePoll(c *gin.Context) {
 type VoteInput struct {
 	OptionID  uint   `json:"option_id,OptionID"`   // 单选选项ID，支持大小写
 	OptionIDs []uint `json:"option_ids,OptionIDs"` // 多选选项IDs，支持大小写
+	ProofOfWork
 }
 
 // SubmitVote handles the submission of a vote on a poll option.
@@ -509,6 +559,11 @@ func SubmitVote(c *gin.Context) {
 		return
 	}
 
+	// 启用防机器人模式的投票需要先通过工作量证明，避免无效请求占用IP投票锁
+	if !checkProofOfWork(c, pollUintID, input.ProofOfWork) {
+		return
+	}
+
 	// 获取Redis客户端并检查是否可用
 	redisClient, err := cache.GetClient()
 	redisAvailable := redisClient != nil && err == nil
@@ -584,21 +639,38 @@ func SubmitVote(c *gin.Context) {
 		return
 	}
 
-	// 4. 高效投票处理：为每个选项增加票数
-	for _, optionID := range validOptionIDs {
-		updateSQL := "UPDATE poll_options SET votes = votes + 1 WHERE id = ? AND poll_id = ?"
-		result := database.DB.Exec(updateSQL, optionID, pollUintID)
+	// 异常检测：可疑投票进入隔离区，审核通过前不计票
+	if quarantineIfAnomalous(c, pollUintID, validOptionIDs) {
+		return
+	}
 
-		if result.Error != nil {
-			log.Printf("更新选项 %d 的投票数据失败: %v", optionID, result.Error)
-			// 继续处理其他选项
-		} else if result.RowsAffected == 0 {
-			log.Printf("选项 %d 的投票更新失败: 可能已被删除", optionID)
-			// 继续处理其他选项
-		} else {
-			log.Printf("成功为选项 %d 投票", optionID)
+	// 4. 高效投票处理：为每个选项增加票数
+	var ballot *models.Ballot
+	if poll.Verifiable {
+		// 可验证投票：计票和写入选票在同一事务中完成，保证票数与选票一致
+		ballot, err = recordVerifiableVote(pollUintID, validOptionIDs)
+		if err != nil {
+			log.Printf("记录可验证投票失败: %v", err)
+			c.JSON(ballotErrorResponse(err))
+			return
+		}
+	} else {
+		for _, optionID := range validOptionIDs {
+			updateSQL := "UPDATE poll_options SET votes = votes + 1 WHERE id = ? AND poll_id = ?"
+			result := database.DB.Exec(updateSQL, optionID, pollUintID)
+
+			if result.Error != nil {
+				log.Printf("更新选项 %d 的投票数据失败: %v", optionID, result.Error)
+				// 继续处理其他选项
+			} else if result.RowsAffected == 0 {
+				log.Printf("选项 %d 的投票更新失败: 可能已被删除", optionID)
+				// 继续处理其他选项
+			} else {
+				log.Printf("成功为选项 %d 投票", optionID)
+			}
 		}
 	}
+	recordVoteVelocity(pollUintID)
 
 	// 5. 清理缓存，确保下次读取能获取最新数据
 	if redisAvailable {
@@ -614,20 +686,17 @@ func SubmitVote(c *gin.Context) {
 	var updatedOptions []models.PollOption
 	if err := database.DB.Where("poll_id = ?", pollUintID).Find(&updatedOptions).Error; err != nil {
 		log.Printf("获取更新后的选项失败: %v", err)
-		c.JSON(http.StatusOK, gin.H{"message": "投票提交成功，但无法获取最新结果"})
+		c.JSON(http.StatusOK, withBallotReceipt(gin.H{"message": "投票提交成功，但无法获取最新结果"}, ballot))
 		return
 	}
 
 	// 7. 计算结果百分比
 	results := calculatePercentages(updatedOptions)
 
-	// 8. 异步广播更新
-	go func() {
-		BroadcastPollUpdate(pollUintID, updatedOptions)
-		BroadcastSSEUpdate(pollUintID, updatedOptions)
-	}()
+	// 8. 广播更新，短时间内的多次投票合并为一次广播
+	SchedulePollBroadcast(pollUintID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "投票提交成功", "current_results": results})
+	c.JSON(http.StatusOK, withBallotReceipt(gin.H{"message": "投票提交成功", "current_results": results}, ballot))
 }
 
 // OptionResult 表示带有百分比的投票选项结果
@@ -761,10 +830,7 @@ func processPollVote(pollID uint, optionID uint, redisAvailable bool) ([]OptionR
 	// 步骤5: 构建带有百分比的结果
 	results := calculatePercentages(updatedOptions)
 
-	go func() {
-		BroadcastPollUpdate(pollID, updatedOptions)
-		BroadcastSSEUpdate(pollID, updatedOptions)
-	}()
+	SchedulePollBroadcast(pollID)
 
 	return results, nil
 }
@@ -904,18 +970,35 @@ func CheckAndCloseExpiredPolls() {
 	log.Printf("检查过期投票，当前时间: %v", now)
 
 	// 查找状态为活跃但已过期的投票
-	result := database.DB.Model(&models.Poll{}).
+	var expiredIDs []uint
+	if err := database.DB.Model(&models.Poll{}).
 		Where("is_active = ? AND end_time IS NOT NULL AND end_time < ?", true, now).
-		Update("is_active", false)
-
-	if result.Error != nil {
-		log.Printf("更新过期投票状态失败: %v", result.Error)
+		Pluck("id", &expiredIDs).Error; err != nil {
+		log.Printf("查询过期投票失败: %v", err)
 		return
 	}
 
-	if result.RowsAffected > 0 {
+	if len(expiredIDs) > 0 {
+		result := database.DB.Model(&models.Poll{}).
+			Where("id IN ? AND is_active = ?", expiredIDs, true).
+			Update("is_active", false)
+
+		if result.Error != nil {
+			log.Printf("更新过期投票状态失败: %v", result.Error)
+			return
+		}
+
 		log.Printf("已关闭 %d 个过期投票", result.RowsAffected)
+
+		// 通知SSE客户端投票已关闭
+		for _, pollID := range expiredIDs {
+			BroadcastSSEClosed(pollID)
+			emitPollClosedWebhook(pollID, "expired")
+		}
 	}
+
+	// 为刚关闭（或之前公布失败）的可验证投票公布计票结果
+	publishClosedVerifiablePolls()
 }
 
 // --- WebSocket Handler will go here ---
@@ -924,6 +1007,7 @@ func CheckAndCloseExpiredPolls() {
 type EnhancedVoteInput struct {
 	OptionIDs []uint `json:"option_ids" binding:"required,min=1"` // 选择的选项ID数组
 	MessageID string `json:"message_id,omitempty"`                // 可选的消息ID，用于幂等性控制
+	ProofOfWork
 }
 
 // SubmitEnhancedVote 处理带有幂等性保证的投票提交
@@ -934,7 +1018,6 @@ func SubmitEnhancedVote(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
 		return
 	}
-	pollUintID := uint(pollID) // 转换为GORM使用的uint类型
 
 	var input EnhancedVoteInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -942,33 +1025,34 @@ func SubmitEnhancedVote(c *gin.Context) {
 		return
 	}
 
+	c.JSON(applyEnhancedVote(uint(pollID), input, c.ClientIP(), c.Request.UserAgent()))
+}
+
+// applyEnhancedVote 校验并记录一次投票，返回HTTP状态码和响应内容
+// HTTP接口和WebSocket的VOTE消息共用这里的校验、防机器人、异常隔离和计票逻辑
+func applyEnhancedVote(pollUintID uint, input EnhancedVoteInput, clientIP string, userAgent string) (int, gin.H) {
 	// 1. 获取投票及其选项
 	var poll models.Poll
 	if err := database.DB.Preload("Options").First(&poll, pollUintID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "投票未找到"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取投票数据"})
+			return http.StatusNotFound, gin.H{"error": "投票未找到"}
 		}
-		return
+		return http.StatusInternalServerError, gin.H{"error": "无法获取投票数据"}
 	}
 
 	// 2. 检查投票是否活跃
 	if !poll.IsActive {
-		c.JSON(http.StatusForbidden, gin.H{"error": "此投票已关闭"})
-		return
+		return http.StatusForbidden, gin.H{"error": "此投票已关闭"}
 	}
 
 	// 检查结束时间
 	if poll.EndTime != nil && time.Now().After(*poll.EndTime) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "投票期已结束"})
-		return
+		return http.StatusForbidden, gin.H{"error": "投票期已结束"}
 	}
 
 	// 3. 验证提交的OptionIDs
 	if len(input.OptionIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "必须至少选择一个选项"})
-		return
+		return http.StatusBadRequest, gin.H{"error": "必须至少选择一个选项"}
 	}
 
 	validOptionIDs := make(map[uint]bool)
@@ -978,21 +1062,29 @@ func SubmitEnhancedVote(c *gin.Context) {
 
 	for _, submittedID := range input.OptionIDs {
 		if !validOptionIDs[submittedID] {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("提交了无效的选项ID %d", submittedID)})
-			return
+			return http.StatusBadRequest, gin.H{"error": fmt.Sprintf("提交了无效的选项ID %d", submittedID)}
 		}
 	}
 
 	// 4. 检查投票类型约束
 	if poll.PollType == models.SingleChoice && len(input.OptionIDs) > 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "单选投票只允许选择一个选项"})
-		return
+		return http.StatusBadRequest, gin.H{"error": "单选投票只允许选择一个选项"}
+	}
+
+	// 5. 防机器人模式下校验工作量证明
+	if poll.AntiBotEnabled {
+		if status, errBody := proofOfWorkError(pollUintID, clientIP, input.ProofOfWork); errBody != nil {
+			return status, errBody
+		}
 	}
 
-	// 获取客户端IP地址用于防重复提交
-	clientIP := c.ClientIP()
 	log.Printf("收到来自 %s 的投票: 投票ID=%d, 选项=%v", clientIP, pollUintID, input.OptionIDs)
 
+	// 6. 异常检测：可疑投票进入隔离区，审核通过前不计票
+	if record := quarantineAnomalousVote(pollUintID, input.OptionIDs, clientIP, userAgent); record != nil {
+		return http.StatusAccepted, quarantinedResponse(record)
+	}
+
 	// 获取Redis客户端
 	redisClient, err := cache.GetClient()
 	redisAvailable := redisClient != nil && err == nil
@@ -1010,9 +1102,9 @@ func SubmitEnhancedVote(c *gin.Context) {
 		// 删除相关的缓存键
 		ctx := context.Background()
 		cacheKeys := []string{
-			fmt.Sprintf("poll:%d:results", pollID),
-			fmt.Sprintf("poll:%d:data", pollID),
-			fmt.Sprintf("poll:%d:options", pollID),
+			fmt.Sprintf("poll:%d:results", pollUintID),
+			fmt.Sprintf("poll:%d:data", pollUintID),
+			fmt.Sprintf("poll:%d:options", pollUintID),
 		}
 
 		for _, key := range cacheKeys {
@@ -1027,8 +1119,16 @@ func SubmitEnhancedVote(c *gin.Context) {
 	// 步骤2: 更新数据库
 	tx := database.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法开始事务"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "无法开始事务"}
+	}
+
+	// 可验证投票先锁定投票行，已关闭或已公布计票结果时不再写入选票
+	if poll.Verifiable {
+		if err := lockPollForBallot(tx, pollUintID); err != nil {
+			tx.Rollback()
+			log.Printf("锁定可验证投票失败: %v", err)
+			return ballotErrorResponse(err)
+		}
 	}
 
 	for _, optionID := range input.OptionIDs {
@@ -1039,23 +1139,32 @@ func SubmitEnhancedVote(c *gin.Context) {
 		if result.Error != nil {
 			tx.Rollback()
 			log.Printf("更新选项 %d 票数失败: %v", optionID, result.Error)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "记录投票失败"})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "记录投票失败"}
 		}
 		if result.RowsAffected == 0 {
 			tx.Rollback()
 			log.Printf("投票更新失败: 选项ID %d 未找到或不属于投票 %d", optionID, pollUintID)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "由于状态不一致，记录投票失败"})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "由于状态不一致，记录投票失败"}
+		}
+	}
+
+	// 可验证投票：选票与计票在同一事务中写入
+	var ballot *models.Ballot
+	if poll.Verifiable {
+		ballot, err = castBallot(tx, pollUintID, input.OptionIDs)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("写入可验证选票失败: %v", err)
+			return http.StatusInternalServerError, gin.H{"error": "记录投票失败"}
 		}
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		log.Printf("提交投票事务失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "完成投票失败"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "完成投票失败"}
 	}
+	recordVoteVelocity(pollUintID)
 
 	// 步骤3: 等待一段时间（允许其他可能的读操作完成）
 	time.Sleep(10 * time.Millisecond)
@@ -1064,9 +1173,9 @@ func SubmitEnhancedVote(c *gin.Context) {
 	if redisAvailable {
 		ctx := context.Background()
 		cacheKeys := []string{
-			fmt.Sprintf("poll:%d:results", pollID),
-			fmt.Sprintf("poll:%d:data", pollID),
-			fmt.Sprintf("poll:%d:options", pollID),
+			fmt.Sprintf("poll:%d:results", pollUintID),
+			fmt.Sprintf("poll:%d:data", pollUintID),
+			fmt.Sprintf("poll:%d:options", pollUintID),
 		}
 
 		for _, key := range cacheKeys {
@@ -1082,8 +1191,7 @@ func SubmitEnhancedVote(c *gin.Context) {
 	updatedResults, err := GetCurrentPollResults(pollUintID)
 	if err != nil {
 		log.Printf("获取更新后的投票结果失败: %v", err)
-		c.JSON(http.StatusOK, gin.H{"message": "投票提交成功但无法获取最新结果"})
-		return
+		return http.StatusOK, withBallotReceipt(gin.H{"message": "投票提交成功但无法获取最新结果"}, ballot)
 	}
 
 	// 如果Redis可用，更新Redis中的计数
@@ -1092,14 +1200,14 @@ func SubmitEnhancedVote(c *gin.Context) {
 		// 将最新数据写入缓存
 		for _, option := range updatedResults {
 			// 设置投票计数
-			cacheKey := fmt.Sprintf("poll:%s:votes:%d", pollIDStr, option.ID)
+			cacheKey := fmt.Sprintf("poll:%d:votes:%d", pollUintID, option.ID)
 			if err := redisClient.Set(ctx, cacheKey, option.Votes, 1*time.Hour).Err(); err != nil {
 				log.Printf("更新Redis缓存失败: %s, 错误: %v", cacheKey, err)
 			}
 		}
 
 		// 写入总结果缓存，提高后续查询效率
-		resultsCacheKey := fmt.Sprintf("poll:%s:results", pollIDStr)
+		resultsCacheKey := fmt.Sprintf("poll:%d:results", pollUintID)
 		if resultsData, err := json.Marshal(updatedResults); err == nil {
 			if err := redisClient.Set(ctx, resultsCacheKey, resultsData, 1*time.Hour).Err(); err != nil {
 				log.Printf("缓存投票结果失败: %s, 错误: %v", resultsCacheKey, err)
@@ -1109,39 +1217,10 @@ func SubmitEnhancedVote(c *gin.Context) {
 		}
 	}
 
-	// 异步广播更新，但增加稳定性和防丢失机制
-	go func() {
-		// 延迟一小段时间再广播，确保数据库事务完全提交
-		time.Sleep(50 * time.Millisecond)
-
-		// 在广播前再次验证数据正确性
-		verifiedResults, err := GetCurrentPollResults(pollUintID)
-		if err != nil {
-			log.Printf("广播前验证结果失败，使用之前的结果: %v", err)
-			verifiedResults = updatedResults
-		}
-
-		// 广播消息重试和备份机制
-		maxBroadcastRetries := 3
-		for i := 0; i < maxBroadcastRetries; i++ {
-			if i > 0 {
-				time.Sleep(time.Duration(100*i) * time.Millisecond)
-				log.Printf("重试广播投票结果 (尝试 %d/%d)：Poll ID=%d", i+1, maxBroadcastRetries, pollUintID)
-			}
-
-			BroadcastPollUpdate(pollUintID, verifiedResults)
-
-			// 不管WebSocket是否成功，也通过SSE发送更新消息
-			BroadcastSSEUpdate(pollUintID, verifiedResults)
-
-			// 在高并发测试时（例如超过20请求/秒）不要马上退出，确保广播完成
-			if i == 0 {
-				time.Sleep(30 * time.Millisecond)
-			}
-		}
-	}()
+	// 广播更新，合并器保证高峰期最后一次投票后的结果一定会被广播
+	SchedulePollBroadcast(pollUintID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "投票提交成功", "current_results": updatedResults})
+	return http.StatusOK, withBallotReceipt(gin.H{"message": "投票提交成功", "current_results": updatedResults}, ballot)
 }
 
 // ResetPollVotesInput 定义重置投票的输入结构
@@ -1179,15 +1258,24 @@ func ResetPollVotes(c *gin.Context) {
 		return
 	}
 
+	c.JSON(resetPoll(pollUintID, auditActor(c), c.ClientIP()))
+}
+
+// resetPoll 清空投票的缓存、选票和票数，返回HTTP状态码和响应内容
+// HTTP接口和gRPC的ResetPoll共用，调用方负责校验管理员权限；actor和clientIP用于审计日志
+func resetPoll(pollUintID uint, actor string, clientIP string) (int, gin.H) {
+	// 保存重置前的快照用于审计
+	beforeSnapshot := loadPollAuditSnapshot(pollUintID)
+
 	// 先从Redis缓存中删除所有与此投票相关的键
 	redisClient, err := cache.GetClient()
 	if err == nil && redisClient != nil {
 		// 删除所有可能的缓存键模式
 		cacheKeyPatterns := []string{
-			fmt.Sprintf("poll:%d:*", pollID),
-			fmt.Sprintf("vote_lock:*:%d", pollID),
-			fmt.Sprintf("poll_data:%d", pollID),
-			fmt.Sprintf("poll_results:%d", pollID),
+			fmt.Sprintf("poll:%d:*", pollUintID),
+			fmt.Sprintf("vote_lock:*:%d", pollUintID),
+			fmt.Sprintf("poll_data:%d", pollUintID),
+			fmt.Sprintf("poll_results:%d", pollUintID),
 		}
 
 		ctx := context.Background()
@@ -1210,7 +1298,7 @@ func ResetPollVotes(c *gin.Context) {
 
 		// 额外检查单票投票的键
 		for _, opt := range []string{"votes", "percentage", "data", "options", "results", "voted"} {
-			pattern := fmt.Sprintf("poll:%s:%s:*", pollIDStr, opt)
+			pattern := fmt.Sprintf("poll:%d:%s:*", pollUintID, opt)
 			keys, err := redisClient.Keys(ctx, pattern).Result()
 			if err != nil {
 				log.Printf("获取键模式 %s 失败: %v", pattern, err)
@@ -1227,26 +1315,34 @@ func ResetPollVotes(c *gin.Context) {
 		}
 	}
 
+	// 已公布计票结果的可验证投票不允许重置
+	if isTallyPublished(database.DB, pollUintID) {
+		return http.StatusConflict, gin.H{"error": errTallyPublished.Error()}
+	}
+
 	// 在数据库中重置投票计数
 	tx := database.DB.Begin()
 	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法开始事务"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "无法开始事务"}
+	}
+
+	// 可验证投票的选票随计数一起清空
+	if err := tx.Where("poll_id = ?", pollUintID).Delete(&models.Ballot{}).Error; err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, gin.H{"error": "重置投票失败: " + err.Error()}
 	}
 
 	// 更新所有选项的投票计数为0
 	if err := tx.Model(&models.PollOption{}).Where("poll_id = ?", pollUintID).
 		UpdateColumn("votes", 0).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置投票失败: " + err.Error()})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "重置投票失败: " + err.Error()}
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败: " + err.Error()})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "提交事务失败: " + err.Error()}
 	}
 
 	// 获取重置后的投票结果
@@ -1257,32 +1353,17 @@ func ResetPollVotes(c *gin.Context) {
 		log.Printf("投票已重置: 投票ID=%d，选项数=%d", pollUintID, len(updatedResults))
 	}
 
-	// 使用相同的广播机制通知所有客户端
-	go func() {
-		// 延迟一小段时间，确保数据库更新完全提交和客户端准备好接收
-		time.Sleep(100 * time.Millisecond)
+	recordAuditAs(actor, clientIP, AuditActionPollReset, pollAuditTarget(pollUintID), beforeSnapshot, loadPollAuditSnapshot(pollUintID))
 
-		// 重置后立即重试多次广播，确保所有客户端收到更新
-		for i := 0; i < 3; i++ {
-			BroadcastPollUpdate(pollUintID, updatedResults)
-			BroadcastSSEUpdate(pollUintID, updatedResults)
+	// 重置后票数从0开始，各个阈值可以再次通知
+	resetVoteThresholds(pollUintID)
+	emitWebhookEvent(webhook.EventPollReset, pollUintID, gin.H{"reset_by": actor})
 
-			// 测试模式下等待更长时间，确保完全更新
-			waitTime := 150 * time.Millisecond
-			if i < 2 {
-				time.Sleep(waitTime)
-			}
-		}
+	// 通知所有客户端
+	SchedulePollBroadcast(pollUintID)
 
-		// 在高并发测试结束后，确保前端有足够时间更新
-		// 这对于测试特别重要，让所有客户端能看到最终状态
-		time.Sleep(500 * time.Millisecond)
-
-		log.Printf("投票重置广播完成: 投票ID=%d", pollUintID)
-	}()
-
-	c.JSON(http.StatusOK, gin.H{
+	return http.StatusOK, gin.H{
 		"message": "投票已成功重置",
-		"poll_id": pollID,
-	})
+		"poll_id": pollUintID,
+	}
 }
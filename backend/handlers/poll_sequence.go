@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/livefeed"
+)
+
+// 投票实时更新的序号分配器，Redis可用时在所有实例之间共享
+// WebSocket和SSE的事件不同，各自使用独立的序号
+var (
+	pollSequencer = cache.NewPollSequencer("seq")
+	sseSequencer  = cache.NewPollSequencer("sse_seq")
+)
+
+// nextSeq 分配下一个序号
+func nextSeq(sequencer *cache.PollSequencer, pollID uint) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutPublishTimeout)
+	defer cancel()
+
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		redisClient = nil
+	}
+	return sequencer.Next(ctx, redisClient, pollID)
+}
+
+// currentSeq 返回投票当前的序号，取Redis、本地计数和历史中的最大值
+func currentSeq(sequencer *cache.PollSequencer, history *livefeed.History, pollID uint) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutPublishTimeout)
+	defer cancel()
+
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		redisClient = nil
+	}
+	seq := sequencer.Sync(ctx, redisClient, pollID)
+	if latest := history.LatestSeq(pollID); latest > seq {
+		seq = latest
+	}
+	return seq
+}
+
+// nextPollSeq 分配投票的下一个WebSocket更新序号
+func nextPollSeq(pollID uint) uint64 {
+	return nextSeq(pollSequencer, pollID)
+}
+
+// currentPollSeq 返回投票当前的WebSocket更新序号
+func currentPollSeq(pollID uint) uint64 {
+	return currentSeq(pollSequencer, GlobalHub.history, pollID)
+}
+
+// buildPollSnapshot 生成投票的完整快照消息，返回快照对应的序号
+// 先取序号再读结果，快照可能已包含之后的更新，更新消息携带的是完整票数，重复应用不影响结果
+func buildPollSnapshot(pollID uint) (uint64, []byte, error) {
+	seq := currentPollSeq(pollID)
+
+	results, err := GetCurrentPollResults(pollID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data, err := json.Marshal(wsResultsMessage{
+		Type: WSTypeSnapshot,
+		Seq:  seq,
+		Data: wsResultsData{
+			PollID:    pollID,
+			Options:   formatPollResults(results),
+			Timestamp: time.Now().UnixNano(),
+		},
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return seq, data, nil
+}
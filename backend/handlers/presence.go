@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/fanout"
+	"realtime-voting-backend/livefeed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 实例超过presenceStaleAfter未上报时，其人数不再计入合计
+// 有观众的投票每presenceRefresh重新上报一次
+const (
+	presenceStaleAfter = 30 * time.Second
+	presenceRefresh    = 10 * time.Second
+)
+
+var (
+	// 汇总所有实例的在线人数
+	presenceTracker = cache.NewPresenceTracker(presenceStaleAfter)
+
+	// 按投票节流在线人数推送，观众频繁进出时每个间隔最多推送一次
+	presenceNotifier = livefeed.NewCoalescer(presenceInterval(), emitPresence)
+
+	// 每个投票最近一次推送的在线人数，人数不变时不重复推送
+	// 有新观众加入时即使人数不变也推送，让新观众尽快看到当前人数
+	presenceMu     sync.Mutex
+	presenceLast   = make(map[uint]int64)
+	presenceJoined = make(map[uint]bool)
+)
+
+// presenceUpdate 在线人数消息
+type presenceUpdate struct {
+	PollID    uint  `json:"poll_id"`
+	Viewers   int64 `json:"viewers"`
+	Peak      int64 `json:"peak_viewers"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// presenceInterval 从环境变量PRESENCE_INTERVAL读取在线人数推送的最小间隔，默认2秒
+func presenceInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PRESENCE_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 2 * time.Second
+}
+
+// presenceChanged 本实例某个投票的观众数发生变化
+func presenceChanged(pollID uint) {
+	presenceNotifier.Trigger(pollID)
+}
+
+// presenceJoinedBy 本实例某个投票有新观众加入
+func presenceJoinedBy(pollID uint) {
+	presenceMu.Lock()
+	presenceJoined[pollID] = true
+	presenceMu.Unlock()
+	presenceNotifier.Trigger(pollID)
+}
+
+// localViewerCount 本实例观看投票的WebSocket和SSE连接数
+func localViewerCount(pollID uint) int64 {
+	count := GlobalHub.pollConnectionCount(pollID)
+
+	sseClientsMutex <- true // 获取锁
+	count += len(sseClients[pollID])
+	<-sseClientsMutex // 释放锁
+
+	return int64(count)
+}
+
+// reportPresence 上报本实例的观众数并返回所有实例的合计
+func reportPresence(pollID uint) cache.Presence {
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutPublishTimeout)
+	defer cancel()
+
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		redisClient = nil
+	}
+	return presenceTracker.Report(ctx, redisClient, broadcastRelay.InstanceID(), pollID, localViewerCount(pollID))
+}
+
+// emitPresence 上报观众数，合计人数变化时推送给所有实例的客户端
+func emitPresence(pollID uint) {
+	presence := reportPresence(pollID)
+
+	presenceMu.Lock()
+	changed := presenceLast[pollID] != presence.Viewers || presenceJoined[pollID]
+	delete(presenceJoined, pollID)
+	presenceMu.Unlock()
+	if !changed {
+		return
+	}
+
+	publishBroadcast(fanout.KindPresence, pollID, 0, presenceUpdate{
+		PollID:    pollID,
+		Viewers:   presence.Viewers,
+		Peak:      presence.Peak,
+		Timestamp: time.Now().UnixNano(),
+	})
+}
+
+// deliverLocalPresence 向本实例观看投票的WebSocket和SSE客户端推送在线人数
+func deliverLocalPresence(pollID uint, payload json.RawMessage) {
+	var update presenceUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		log.Printf("解析在线人数消息失败，投票ID %d: %v", pollID, err)
+		return
+	}
+
+	presenceMu.Lock()
+	if update.Viewers == 0 {
+		delete(presenceLast, pollID)
+	} else {
+		presenceLast[pollID] = update.Viewers
+	}
+	presenceMu.Unlock()
+
+	deliverLocalTransient(pollID, &wsPresenceMessage{
+		Type: WSTypePresence,
+		Data: update,
+	}, SSEEventPresence, payload)
+}
+
+// watchedPolls 本实例有观众或最近推送过人数的投票
+func watchedPolls() []uint {
+	seen := make(map[uint]bool)
+
+	GlobalHub.mu.RLock()
+	for pollID := range GlobalHub.clients {
+		seen[pollID] = true
+	}
+	GlobalHub.mu.RUnlock()
+
+	sseClientsMutex <- true // 获取锁
+	for pollID := range sseClients {
+		seen[pollID] = true
+	}
+	<-sseClientsMutex // 释放锁
+
+	presenceMu.Lock()
+	for pollID := range presenceLast {
+		seen[pollID] = true
+	}
+	presenceMu.Unlock()
+
+	pollIDs := make([]uint, 0, len(seen))
+	for pollID := range seen {
+		pollIDs = append(pollIDs, pollID)
+	}
+	return pollIDs
+}
+
+// GetPollPresence 查询投票当前和峰值在线人数
+func GetPollPresence(c *gin.Context) {
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+		return
+	}
+	if !pollExists(uint(pollID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在"})
+		return
+	}
+
+	presence := reportPresence(uint(pollID))
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id":      pollID,
+		"viewers":      presence.Viewers,
+		"peak_viewers": presence.Peak,
+	})
+}
+
+// 定期重新上报在线人数，保持本实例的上报不过期，同时发现其他实例下线导致的人数变化
+func init() {
+	go func() {
+		for {
+			time.Sleep(presenceRefresh)
+			for _, pollID := range watchedPolls() {
+				presenceChanged(pollID)
+			}
+		}
+	}()
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/anomaly"
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 隔离审核的审计动作
+const (
+	AuditActionQuarantineApprove = "quarantine.approve"
+	AuditActionQuarantineDiscard = "quarantine.discard"
+)
+
+// 同一投票两次异常告警之间的最小间隔，期间的告警会合并计数
+const anomalyAlertInterval = 10 * time.Second
+
+var (
+	// 异常检测配置，启动时从环境变量读取
+	anomalyConfig = anomaly.LoadConfig()
+
+	// 告警节流状态
+	anomalyAlertMu       sync.Mutex
+	anomalyLastAlert     = make(map[uint]time.Time)
+	anomalySuppressedCnt = make(map[uint]int)
+)
+
+// quarantineIfAnomalous 对投票做异常检测，可疑投票写入隔离区并返回202
+// 返回true表示投票已被隔离，调用方不应再计票
+func quarantineIfAnomalous(c *gin.Context, pollID uint, optionIDs []uint) bool {
+	record := quarantineAnomalousVote(pollID, optionIDs, c.ClientIP(), c.Request.UserAgent())
+	if record == nil {
+		return false
+	}
+	c.JSON(http.StatusAccepted, quarantinedResponse(record))
+	return true
+}
+
+// quarantineAnomalousVote 对投票做异常检测，可疑投票写入隔离区并返回隔离记录
+// 返回nil表示投票正常，调用方继续计票
+func quarantineAnomalousVote(pollID uint, optionIDs []uint, clientIP string, userAgent string) *models.QuarantinedVote {
+	if !anomalyConfig.Enabled {
+		return nil
+	}
+
+	redisClient, err := cache.GetRedisClient()
+	if err != nil {
+		// Redis不可用时无法统计速度，跳过检测
+		return nil
+	}
+
+	vote := anomaly.Vote{
+		PollID:    pollID,
+		OptionIDs: optionIDs,
+		IP:        clientIP,
+		UserAgent: userAgent,
+	}
+
+	verdict, err := anomaly.NewDetector(redisClient, anomalyConfig).Observe(context.Background(), vote)
+	if err != nil {
+		log.Printf("异常检测失败: 投票ID=%d, 错误: %v", pollID, err)
+		return nil
+	}
+	if !verdict.Flagged {
+		return nil
+	}
+
+	record := models.QuarantinedVote{
+		PollID:    pollID,
+		OptionIDs: joinOptionIDs(optionIDs),
+		IP:        vote.IP,
+		IPPrefix:  verdict.IPPrefix,
+		UserAgent: vote.UserAgent,
+		Reasons:   strings.Join(verdict.Reasons, ","),
+		Status:    models.QuarantineStatusPending,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		// 写入隔离区失败时按正常投票处理，避免丢票
+		log.Printf("写入隔离投票失败: 投票ID=%d, 错误: %v", pollID, err)
+		return nil
+	}
+
+	log.Printf("投票被隔离: 隔离ID=%d, 投票ID=%d, IP=%s, 原因=%v", record.ID, pollID, vote.IP, verdict.Reasons)
+	sendAnomalyAlert(&record, verdict)
+
+	return &record
+}
+
+// quarantinedResponse 投票被隔离时的响应内容
+func quarantinedResponse(record *models.QuarantinedVote) gin.H {
+	return gin.H{
+		"message":       "投票已收到，正在审核中",
+		"quarantined":   true,
+		"quarantine_id": record.ID,
+	}
+}
+
+// sendAnomalyAlert 向管理员告警通道推送异常，同一投票的告警按间隔节流
+func sendAnomalyAlert(record *models.QuarantinedVote, verdict *anomaly.Verdict) {
+	anomalyAlertMu.Lock()
+	now := time.Now()
+	if last, ok := anomalyLastAlert[record.PollID]; ok && now.Sub(last) < anomalyAlertInterval {
+		anomalySuppressedCnt[record.PollID]++
+		anomalyAlertMu.Unlock()
+		return
+	}
+	suppressed := anomalySuppressedCnt[record.PollID]
+	anomalyLastAlert[record.PollID] = now
+	delete(anomalySuppressedCnt, record.PollID)
+	anomalyAlertMu.Unlock()
+
+	GlobalAdminHub.Broadcast("ANOMALY_ALERT", map[string]interface{}{
+		"poll_id":       record.PollID,
+		"quarantine_id": record.ID,
+		"option_ids":    record.OptionIDs,
+		"reasons":       verdict.Reasons,
+		"ip_prefix":     verdict.IPPrefix,
+		"sample":        verdict.Sample,
+		"suppressed":    suppressed, // 上次告警之后被合并的隔离投票数
+	})
+}
+
+// joinOptionIDs 将选项ID列表转换为逗号分隔的字符串
+func joinOptionIDs(optionIDs []uint) string {
+	parts := make([]string, len(optionIDs))
+	for i, id := range optionIDs {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitOptionIDs 解析逗号分隔的选项ID
+func splitOptionIDs(value string) []uint {
+	optionIDs := []uint{}
+	for _, part := range strings.Split(value, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32); err == nil {
+			optionIDs = append(optionIDs, uint(id))
+		}
+	}
+	return optionIDs
+}
+
+// GetQuarantinedVotes 查询隔离区中的投票
+// 支持的查询参数: poll_id, status（默认pending）, limit, offset
+func GetQuarantinedVotes(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	query := database.DB.Model(&models.QuarantinedVote{})
+
+	if pollIDStr := c.Query("poll_id"); pollIDStr != "" {
+		pollID, err := strconv.ParseUint(pollIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+			return
+		}
+		query = query.Where("poll_id = ?", pollID)
+	}
+
+	status := c.DefaultQuery("status", models.QuarantineStatusPending)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询隔离投票失败"})
+		return
+	}
+
+	var votes []models.QuarantinedVote
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&votes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询隔离投票失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"votes": votes,
+	})
+}
+
+// ApproveQuarantinedVote 审核通过隔离投票，将其计入票数
+func ApproveQuarantinedVote(c *gin.Context) {
+	reviewQuarantinedVote(c, models.QuarantineStatusApproved)
+}
+
+// DiscardQuarantinedVote 丢弃隔离投票
+func DiscardQuarantinedVote(c *gin.Context) {
+	reviewQuarantinedVote(c, models.QuarantineStatusDiscarded)
+}
+
+// errQuarantineReviewed 隔离投票已被审核过
+var errQuarantineReviewed = errors.New("该投票已被审核")
+
+// reviewQuarantinedVote 审核隔离投票，状态只能从pending变更一次
+func reviewQuarantinedVote(c *gin.Context, status string) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隔离投票ID"})
+		return
+	}
+
+	var record models.QuarantinedVote
+	if err := database.DB.First(&record, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "隔离投票未找到"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取隔离投票失败"})
+		}
+		return
+	}
+	before := record
+
+	reviewer := auditActor(c)
+	reviewedAt := time.Now()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发审核时只有一个请求生效
+		result := tx.Model(&models.QuarantinedVote{}).
+			Where("id = ? AND status = ?", record.ID, models.QuarantineStatusPending).
+			Updates(map[string]interface{}{
+				"status":      status,
+				"reviewed_by": reviewer,
+				"reviewed_at": reviewedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errQuarantineReviewed
+		}
+
+		if status != models.QuarantineStatusApproved {
+			return nil
+		}
+
+		var poll models.Poll
+		// 锁定投票行，避免补写的选票与公布计票结果并发
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "verifiable").First(&poll, record.PollID).Error; err != nil {
+			return fmt.Errorf("获取投票失败: %v", err)
+		}
+		if poll.Verifiable && isTallyPublished(tx, poll.ID) {
+			return errTallyPublished
+		}
+
+		optionIDs := splitOptionIDs(record.OptionIDs)
+		for _, optionID := range optionIDs {
+			result := tx.Model(&models.PollOption{}).Where("id = ? AND poll_id = ?", optionID, record.PollID).
+				UpdateColumn("votes", gorm.Expr("votes + ?", 1))
+			if result.Error != nil {
+				return fmt.Errorf("更新选项 %d 票数失败: %v", optionID, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				// 选项可能已被删除，跳过
+				log.Printf("审核通过的隔离投票选项不存在: 隔离ID=%d, 选项ID=%d", record.ID, optionID)
+			}
+		}
+
+		// 可验证投票审核通过时补写选票，保证公布的票数与选票一致
+		if poll.Verifiable {
+			if _, err := castBallot(tx, poll.ID, optionIDs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, errQuarantineReviewed) || errors.Is(err, errTallyPublished) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("审核隔离投票失败: 隔离ID=%d, 错误: %v", record.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核隔离投票失败"})
+		return
+	}
+
+	record.Status = status
+	record.ReviewedBy = reviewer
+	record.ReviewedAt = &reviewedAt
+
+	action := AuditActionQuarantineDiscard
+	if status == models.QuarantineStatusApproved {
+		action = AuditActionQuarantineApprove
+	}
+	recordAudit(c, action, "quarantine:"+strconv.FormatUint(uint64(record.ID), 10), before, record)
+
+	if status == models.QuarantineStatusApproved {
+		refreshPollAfterApproval(record.PollID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "审核完成", "vote": record})
+}
+
+// refreshPollAfterApproval 审核通过后清理结果缓存并广播最新结果
+func refreshPollAfterApproval(pollID uint) {
+	if redisClient, err := cache.GetClient(); err == nil && redisClient != nil {
+		ctx := context.Background()
+		cacheKeys := []string{
+			fmt.Sprintf("poll:%d:results", pollID),
+			fmt.Sprintf("poll:%d:data", pollID),
+			fmt.Sprintf("poll:%d:options", pollID),
+		}
+		if err := redisClient.Del(ctx, cacheKeys...).Err(); err != nil {
+			log.Printf("删除缓存键失败: %v, 错误: %v", cacheKeys, err)
+		}
+	}
+
+	SchedulePollBroadcast(pollID)
+}
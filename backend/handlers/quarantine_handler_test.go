@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"realtime-voting-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// quarantineVote stores a pending quarantined vote for the given options.
+func quarantineVote(t *testing.T, db *gorm.DB, pollID uint, optionIDs ...uint) models.QuarantinedVote {
+	record := models.QuarantinedVote{
+		PollID:    pollID,
+		OptionIDs: joinOptionIDs(optionIDs),
+		IP:        "203.0.113.7",
+		IPPrefix:  "203.0.113.0/24",
+		Reasons:   "poll_burst",
+		Status:    models.QuarantineStatusPending,
+	}
+	require.NoError(t, db.Create(&record).Error)
+	return record
+}
+
+func optionVotes(t *testing.T, db *gorm.DB, optionID uint) int64 {
+	var option models.PollOption
+	require.NoError(t, db.First(&option, optionID).Error)
+	return option.Votes
+}
+
+func TestQuarantineReview_ApproveAndDiscard(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.QuarantinedVote{})
+
+	poll := models.Poll{Question: "Held for review?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	optionA := models.PollOption{PollID: poll.ID, Text: "A"}
+	optionB := models.PollOption{PollID: poll.ID, Text: "B"}
+	require.NoError(t, db.Create(&optionA).Error)
+	require.NoError(t, db.Create(&optionB).Error)
+
+	approved := quarantineVote(t, db, poll.ID, optionA.ID)
+	discarded := quarantineVote(t, db, poll.ID, optionB.ID)
+
+	reviewPath := func(id uint, action string) string {
+		return fmt.Sprintf("/api/admin/quarantine/%d/%s?admin_key=admin123", id, action)
+	}
+
+	w := performJSON(router, "POST", fmt.Sprintf("/api/admin/quarantine/%d/approve", approved.ID), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Quarantined votes are not counted until approved
+	assert.EqualValues(t, 0, optionVotes(t, db, optionA.ID))
+
+	w = performJSON(router, "POST", reviewPath(approved.ID, "approve"), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Vote models.QuarantinedVote `json:"vote"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.QuarantineStatusApproved, resp.Vote.Status)
+	assert.NotNil(t, resp.Vote.ReviewedAt)
+	assert.EqualValues(t, 1, optionVotes(t, db, optionA.ID))
+
+	// Discarding leaves the option untouched
+	w = performJSON(router, "POST", reviewPath(discarded.ID, "discard"), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var stored models.QuarantinedVote
+	require.NoError(t, db.First(&stored, discarded.ID).Error)
+	assert.Equal(t, models.QuarantineStatusDiscarded, stored.Status)
+	assert.EqualValues(t, 0, optionVotes(t, db, optionB.ID))
+
+	// A vote can only be reviewed once, whichever way the second review goes
+	for _, tc := range []struct {
+		id     uint
+		action string
+	}{
+		{approved.ID, "approve"},
+		{approved.ID, "discard"},
+		{discarded.ID, "approve"},
+		{discarded.ID, "discard"},
+	} {
+		w = performJSON(router, "POST", reviewPath(tc.id, tc.action), nil)
+		assert.Equal(t, http.StatusConflict, w.Code, "%s %d: %s", tc.action, tc.id, w.Body.String())
+	}
+	assert.EqualValues(t, 1, optionVotes(t, db, optionA.ID))
+	assert.EqualValues(t, 0, optionVotes(t, db, optionB.ID))
+
+	var stillApproved models.QuarantinedVote
+	require.NoError(t, db.First(&stillApproved, approved.ID).Error)
+	assert.Equal(t, models.QuarantineStatusApproved, stillApproved.Status)
+
+	w = performJSON(router, "POST", reviewPath(999999, "approve"), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
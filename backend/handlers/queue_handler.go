@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"realtime-voting-backend/mq"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVoteQueue 获取投票消息队列的统计、排队和处理耗时、各消费者的未确认消息数和最近的死信
+func GetVoteQueue(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+	queue := mqAdapter.Queue()
+	if queue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "消息队列未初始化"})
+		return
+	}
+
+	limit := 20
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+
+	ctx := c.Request.Context()
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		log.Printf("获取消息队列统计失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息队列统计失败"})
+		return
+	}
+	deadLetters, err := queue.DeadLetters(ctx, limit)
+	if err != nil {
+		log.Printf("获取消息队列死信失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息队列死信失败"})
+		return
+	}
+
+	resp := gin.H{"stats": stats, "dead_letters": deadLetters}
+	if reporter, ok := queue.(mq.LatencyReporter); ok {
+		resp["latency"] = reporter.Latency()
+	}
+	if inspector, ok := queue.(mq.PendingInspector); ok {
+		consumers, err := inspector.ConsumerPending(ctx)
+		if err != nil {
+			log.Printf("获取消费者未确认消息失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消费者未确认消息失败"})
+			return
+		}
+		resp["consumers"] = consumers
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetVoteQueuePending 列出已读取但未确认的投票消息，可按consumer过滤
+func GetVoteQueuePending(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+	queue := mqAdapter.Queue()
+	if queue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "消息队列未初始化"})
+		return
+	}
+	inspector, ok := queue.(mq.PendingInspector)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "当前消息队列后端不支持查看未确认消息"})
+		return
+	}
+
+	count := int64(100)
+	if v, err := strconv.ParseInt(c.Query("count"), 10, 64); err == nil && v > 0 && v <= 1000 {
+		count = v
+	}
+	messages, err := inspector.PendingMessages(c.Request.Context(), c.Query("consumer"), count)
+	if err != nil {
+		log.Printf("获取未确认消息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取未确认消息失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(messages), "pending": messages})
+}
+
+// RetryVoteQueueDeadLetters 将投票消息队列的全部死信重新入队
+func RetryVoteQueueDeadLetters(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+	if !mqAdapter.IsInitialized() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "消息队列未初始化"})
+		return
+	}
+	if _, ok := mqAdapter.Queue().(mq.DeadLetterRetrier); !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "当前消息队列后端不支持重试死信"})
+		return
+	}
+
+	moved, err := mqAdapter.RetryDeadLetters()
+	if err != nil {
+		log.Printf("重试投票消息死信失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重试投票消息死信失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"retried": moved})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/mq"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestQueue installs an initialized adapter for the given backend as the handlers' queue.
+func useTestQueue(t *testing.T, backend string) *mq.MQAdapter {
+	t.Setenv("MQ_BACKEND", backend)
+	t.Setenv("MQ_MEMORY_FALLBACK", "false")
+	t.Setenv("MQ_MEMORY_AOF", "")
+	t.Setenv("MQ_MAX_RETRIES", "0")
+	t.Setenv("MQ_RETRY_DELAY", "10ms")
+	if backend == mq.BackendRedisStream {
+		t.Setenv("REDIS_ADDR", miniredis.RunT(t).Addr())
+		t.Setenv("MQ_STREAM_CONSUMER", "api-1")
+	}
+
+	adapter := mq.NewMQAdapter()
+	require.NoError(t, adapter.Initialize())
+	previous := mqAdapter
+	mqAdapter = adapter
+	t.Cleanup(func() {
+		mqAdapter = previous
+		adapter.Close()
+	})
+	return adapter
+}
+
+func queueRequest(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("X-Admin-Key", "admin123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestVoteQueueAdmin_RedisStream(t *testing.T) {
+	router, _ := SetupTestEnvironment(t)
+	adapter := useTestQueue(t, mq.BackendRedisStream)
+
+	require.NoError(t, adapter.RegisterHandler(func(pollID, optionID string) error {
+		if optionID == "bad" {
+			return errors.New("handler failure")
+		}
+		return nil
+	}))
+	require.NoError(t, adapter.SendVoteMessageWithID("1", "bad", "msg-bad"))
+	require.Eventually(t, func() bool {
+		dead, err := adapter.DeadLetters(context.Background(), 0)
+		return err == nil && len(dead) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	w := queueRequest(router, "GET", "/api/admin/queue?limit=5")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var overview struct {
+		Stats       mq.VoteQueueStats    `json:"stats"`
+		DeadLetters []mq.VoteMessage     `json:"dead_letters"`
+		Consumers   []mq.ConsumerPending `json:"consumers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &overview))
+	assert.Equal(t, mq.BackendRedisStream, overview.Stats.Backend)
+	assert.Equal(t, int64(1), overview.Stats.DeadLetters)
+	require.Len(t, overview.DeadLetters, 1)
+	assert.Equal(t, "msg-bad", overview.DeadLetters[0].MessageID)
+	require.Len(t, overview.Consumers, 1)
+	assert.Equal(t, "api-1", overview.Consumers[0].Name)
+	assert.Zero(t, overview.Consumers[0].Pending)
+
+	w = queueRequest(router, "GET", "/api/admin/queue/pending?consumer=api-1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"total":0,"pending":[]}`, w.Body.String())
+
+	w = queueRequest(router, "POST", "/api/admin/queue/dead-letters/retry")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"retried":1}`, w.Body.String())
+}
+
+func TestVoteQueueAdmin_MemoryAndAuth(t *testing.T) {
+	router, _ := SetupTestEnvironment(t)
+	useTestQueue(t, mq.BackendMemory)
+
+	req, _ := http.NewRequest("GET", "/api/admin/queue", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = queueRequest(router, "GET", "/api/admin/queue")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), `"consumers"`)
+
+	// The memory queue has no per-consumer ownership
+	w = queueRequest(router, "GET", "/api/admin/queue/pending")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -122,62 +123,64 @@ func resetRateLimiters() {
 // RateLimitMiddleware 限流中间件
 func RateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 如果限流未启用，直接通过
-		if !rateLimitEnabled || globalLimiter == nil {
-			c.Next()
+		// 如果有用户ID，同时进行用户级别限流
+		var userKey string
+		if userID := c.GetHeader("X-User-ID"); userID != "" {
+			userKey = "user:" + userID
+		}
+		if message := checkRateLimit(c, userKey); message != "" {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
+
+// checkRateLimit 按当前限流配置检查一次请求，HTTP中间件、WebSocket和gRPC投票共用
+// userKey为空时只做全局限流，否则同时按userKey限流；放行时返回空字符串，否则返回提示信息
+func checkRateLimit(ctx context.Context, userKey string) string {
+	// 如果限流未启用，直接通过
+	if !rateLimitEnabled || globalLimiter == nil {
+		return ""
+	}
 
-		// 更新统计信息
+	// 更新统计信息
+	limitStatsLock.Lock()
+	limitStatistics["total"]++
+	limitStatsLock.Unlock()
+
+	// 全局限流检查
+	allowed, err := globalLimiter.Allow(ctx)
+	if err != nil || !allowed {
 		limitStatsLock.Lock()
-		limitStatistics["total"]++
+		limitStatistics["rejected"]++
 		limitStatsLock.Unlock()
+		return "请求频率过高，请稍后再试"
+	}
 
-		// 全局限流检查
-		allowed, err := globalLimiter.Allow(c)
+	if userKey != "" && userLimiter != nil {
+		allowed, err := userLimiter.AllowUser(ctx, userKey)
 		if err != nil || !allowed {
+			// 更新用户级别统计信息
 			limitStatsLock.Lock()
 			limitStatistics["rejected"]++
+			limitStatistics[userKey]++
 			limitStatsLock.Unlock()
-
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "请求频率过高，请稍后再试",
-			})
-			c.Abort()
-			return
-		}
-
-		// 如果有用户ID，进行用户级别限流
-		userID := c.GetHeader("X-User-ID")
-		if userID != "" && userLimiter != nil {
-			allowed, err := userLimiter.AllowUser(c, userID)
-			if err != nil || !allowed {
-				// 更新用户级别统计信息
-				limitStatsLock.Lock()
-				limitStatistics["rejected"]++
-				userKey := "user:" + userID
-				if _, exists := limitStatistics[userKey]; exists {
-					limitStatistics[userKey]++
-				} else {
-					limitStatistics[userKey] = 1
-				}
-				limitStatsLock.Unlock()
-
-				c.JSON(http.StatusTooManyRequests, gin.H{
-					"error": "您的请求频率过高，请稍后再试",
-				})
-				c.Abort()
-				return
-			}
+			return "您的请求频率过高，请稍后再试"
 		}
+	}
 
-		// 更新允许请求的统计信息
-		limitStatsLock.Lock()
-		limitStatistics["allowed"]++
-		limitStatsLock.Unlock()
+	// 更新允许请求的统计信息
+	limitStatsLock.Lock()
+	limitStatistics["allowed"]++
+	limitStatsLock.Unlock()
+	return ""
+}
 
-		c.Next()
-	}
+// rateLimitIPKey 没有用户ID的实时连接和gRPC调用按客户端IP限流
+func rateLimitIPKey(clientIP string) string {
+	return "ip:" + clientIP
 }
 
 // GetRateLimiterStats 获取限流器状态
@@ -192,9 +195,9 @@ func GetRateLimiterStats(c *gin.Context) {
 		RateLimiterConfig: rateLimiterConfig,
 	}
 
-	// 提取用户统计信息
+	// 提取用户和客户端IP的被拒统计信息
 	for key, value := range limitStatistics {
-		if strings.HasPrefix(key, "user:") {
+		if strings.HasPrefix(key, "user:") || strings.HasPrefix(key, "ip:") {
 			stats.UserRequestStats[key] = value
 		}
 	}
@@ -219,6 +222,7 @@ func UpdateRateLimiterConfig(c *gin.Context) {
 	}
 
 	// 更新配置
+	previousConfig := rateLimiterConfig
 	rateLimiterConfig = config
 	rateLimitEnabled = config.Enabled
 
@@ -227,6 +231,8 @@ func UpdateRateLimiterConfig(c *gin.Context) {
 		resetRateLimiters()
 	}
 
+	recordAudit(c, AuditActionRateLimitUpdate, "ratelimit", previousConfig, rateLimiterConfig)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "限流器配置已更新",
 		"config":  rateLimiterConfig,
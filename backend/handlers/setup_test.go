@@ -18,6 +18,9 @@ func SetupTestEnvironment(t *testing.T) (*gin.Engine, *gorm.DB) {
 	testing.Init()
 	gin.SetMode(gin.TestMode)
 
+	// Broadcasts scheduled by the previous test read database.DB, wait for them before swapping it
+	FlushPollBroadcasts()
+
 	// Use in-memory SQLite for testing
 	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
 		// Silence GORM logger for tests unless needed
@@ -33,13 +36,19 @@ func SetupTestEnvironment(t *testing.T) (*gin.Engine, *gorm.DB) {
 	database.DB = db
 
 	// Migrate the schema
-	err = database.DB.AutoMigrate(&models.Poll{}, &models.PollOption{})
+	err = database.DB.AutoMigrate(&models.Poll{}, &models.PollOption{}, &models.AuditLog{}, &models.QuarantinedVote{}, &models.IPRule{}, &models.Ballot{}, &models.TallyPublication{}, &models.Comment{}, &models.WebhookSubscription{})
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Realtime tests connect without tokens unless they call enableStreamAuth
+	previousSigner := streamSigner
+	streamSigner = nil
+
 	// Clean up function to close DB connection after tests
 	t.Cleanup(func() {
+		FlushPollBroadcasts()
+		streamSigner = previousSigner
 		sqlDB, _ := database.DB.DB()
 		if sqlDB != nil {
 			_ = sqlDB.Close()
@@ -65,8 +74,36 @@ func SetupTestEnvironment(t *testing.T) (*gin.Engine, *gorm.DB) {
 		api.PUT("/polls/:id", UpdatePoll)
 		api.DELETE("/polls/:id", DeletePoll)
 		api.POST("/polls/:id/vote", SubmitVote)
-		// WebSocket testing is more complex and often done via integration tests
-		// api.GET("/ws/polls/:id", HandleWebSocket)
+		api.GET("/polls/:id/live", HandleSSE)
+		api.GET("/polls/:id/poll", HandleLongPoll)
+		api.GET("/polls/:id/presence", GetPollPresence)
+		api.GET("/polls/:id/comments", GetPollComments)
+		api.POST("/polls/:id/comments", CreateComment)
+		api.GET("/polls/:id/reactions", GetPollReactions)
+		api.POST("/polls/:id/reactions", AddReaction)
+		api.GET("/admin/comments", GetComments)
+		api.POST("/admin/comments/:id/approve", ApproveComment)
+		api.DELETE("/admin/comments/:id", DeleteComment)
+		api.GET("/admin/webhooks", GetWebhooks)
+		api.POST("/admin/webhooks", CreateWebhook)
+		api.PUT("/admin/webhooks/:id", UpdateWebhook)
+		api.DELETE("/admin/webhooks/:id", DeleteWebhook)
+		api.GET("/admin/webhooks/dead-letters", GetWebhookDeadLetters)
+		api.POST("/admin/webhooks/dead-letters/:id/retry", RetryWebhookDeadLetter)
+		api.DELETE("/admin/webhooks/dead-letters/:id", DeleteWebhookDeadLetter)
+		api.GET("/admin/ws/clients", GetWebSocketClients)
+		api.GET("/admin/quarantine", GetQuarantinedVotes)
+		api.POST("/admin/quarantine/:id/approve", ApproveQuarantinedVote)
+		api.POST("/admin/quarantine/:id/discard", DiscardQuarantinedVote)
+		api.GET("/admin/queue", GetVoteQueue)
+		api.GET("/admin/queue/pending", GetVoteQueuePending)
+		api.POST("/admin/queue/dead-letters/retry", RetryVoteQueueDeadLetters)
+		api.GET("/polls/:id/tally", GetPollTally)
+		api.GET("/polls/:id/tally/proof", GetBallotProof)
+		api.GET("/polls/:id/tally/export", ExportPollBallots)
+		api.POST("/stream-token", IssueStreamToken)
+		api.GET("/ws", HandleMultiplexWebSocket)
+		api.GET("/polls/:id/ws", HandleWebSocket)
 	}
 
 	return router, db
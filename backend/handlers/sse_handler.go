@@ -1,31 +1,85 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"realtime-voting-backend/database"
+	"realtime-voting-backend/fanout"
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/streamauth"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// SSE事件类型
+const (
+	SSEEventResults        = "results"         // 投票结果，带事件ID，可断线补发
+	SSEEventStatus         = "status"          // 连接状态通知
+	SSEEventHeartbeat      = "heartbeat"       // 心跳
+	SSEEventClosed         = "closed"          // 投票已关闭，带事件ID，可断线补发
+	SSEEventPresence       = "presence"        // 在线人数变化
+	SSEEventComment        = "comment"         // 新评论
+	SSEEventCommentDeleted = "comment_deleted" // 评论被删除
+	SSEEventReactions      = "reactions"       // 表情累计数
+	SSEEventAuthExpired    = "auth_expired"    // 访问令牌已过期，随后服务端关闭连接
+)
+
+// 每个投票保留的SSE事件条数和保留时间
+const (
+	sseHistorySize      = 100
+	sseHistoryRetention = 5 * time.Minute
+)
+
 // 客户端SSE连接管理
 type SSEClient struct {
 	PollID  uint
 	Writer  http.ResponseWriter
 	Flusher http.Flusher
 	Done    chan bool
+
+	// 写锁，广播、心跳和补发可能同时写入同一个连接
+	mu sync.Mutex
+
+	// 已发送的最大事件ID，补发与广播并发时避免重复发送
+	lastSeq uint64
+
+	// 处理函数已返回，ResponseWriter不能再写入
+	closed bool
+}
+
+// sseMessage 跨实例转发的SSE事件
+type sseMessage struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
 }
 
 var (
 	// sseClients存储所有SSE连接，按投票ID进行分组
 	sseClients      = make(map[uint][]*SSEClient)
 	sseClientsMutex = make(chan bool, 1) // 简单的互斥锁实现
+
+	// 带ID的SSE事件历史，用于Last-Event-ID断线补发
+	sseHistory = livefeed.NewHistory(sseHistorySize, sseHistoryRetention)
+
+	// 浏览器断线后的重连间隔
+	sseRetry = sseRetryInterval()
 )
 
+// sseRetryInterval 从环境变量SSE_RETRY读取重连间隔，默认3秒
+func sseRetryInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SSE_RETRY")); err == nil && d > 0 {
+		return d
+	}
+	return 3 * time.Second
+}
+
 // HandleSSE处理SSE连接请求
 func HandleSSE(c *gin.Context) {
 	// 获取投票ID
@@ -37,6 +91,11 @@ func HandleSSE(c *gin.Context) {
 	}
 	pollUintID := uint(pollID)
 
+	claims, ok := authorizeStream(c, sseStreamToken(c), pollUintID)
+	if !ok {
+		return
+	}
+
 	// 直接使用SQL语句原样执行
 	var exists int64
 	sql := "SELECT COUNT(*) FROM polls WHERE id = ? AND deleted_at IS NULL"
@@ -62,8 +121,15 @@ func HandleSSE(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if origin := c.GetHeader("Origin"); origin != "" {
+		// 来源已通过允许列表检查，回显来源以便浏览器携带令牌Cookie
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Add("Vary", "Origin")
+	} else {
+		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
 	c.Writer.Header().Set("X-Accel-Buffering", "no") // 禁用Nginx缓冲
 
 	// 获取Flusher接口
@@ -81,24 +147,50 @@ func HandleSSE(c *gin.Context) {
 		Done:    make(chan bool),
 	}
 
-	// 注册客户端
+	// 浏览器重连时通过Last-Event-ID头携带最后收到的事件ID
+	// 首次连接无法设置请求头，也可以通过last_event_id查询参数传入
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// 注册和补发期间持有客户端写锁，期间的广播会等待补发完成，保证事件按顺序到达
+	client.mu.Lock()
+
 	sseClientsMutex <- true // 获取锁
 	sseClients[pollUintID] = append(sseClients[pollUintID], client)
 	<-sseClientsMutex // 释放锁
+	presenceJoinedBy(pollUintID)
 
-	log.Printf("已注册SSE客户端，投票ID: %d，客户端IP: %s", pollUintID, c.ClientIP())
+	log.Printf("已注册SSE客户端，投票ID: %d，客户端IP: %s, Last-Event-ID: %q", pollUintID, c.ClientIP(), lastEventID)
 
-	// 发送初始数据
-	results, err := GetCurrentPollResults(pollUintID)
-	if err == nil {
-		log.Printf("获取初始数据成功，选项数量: %d", len(results))
-		sendSSEEvent(client, results)
-	} else {
-		log.Printf("发送初始数据失败: %v", err)
+	// 告知浏览器重连间隔
+	fmt.Fprintf(client.Writer, "retry: %d\n\n", sseRetry.Milliseconds())
+
+	replayed := false
+	if lastEventID != "" {
+		if since, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+			if entries, ok := sseHistory.Since(pollUintID, since); ok {
+				log.Printf("向SSE客户端补发 %d 条事件，投票ID: %d", len(entries), pollUintID)
+				client.lastSeq = since
+				for _, entry := range entries {
+					writeSSEFrameLocked(client, entry.Seq, entry.Data)
+				}
+				replayed = true
+			}
+		}
+	}
+
+	// 新连接或无法补发时发送当前结果作为快照
+	if !replayed {
+		if err := sendSSESnapshotLocked(client); err != nil {
+			log.Printf("发送初始数据失败: %v", err)
+		}
 	}
 
 	// 发送初始连接确认
-	sendSSEEvent(client, map[string]string{"status": "connected", "message": "SSE连接已建立"})
+	writeSSEFrameLocked(client, 0, formatSSEEvent(0, SSEEventStatus, map[string]string{"status": "connected", "message": "SSE连接已建立"}))
+	client.mu.Unlock()
 
 	// 设置定时发送心跳的goroutine
 	heartbeat := time.NewTicker(15 * time.Second)
@@ -107,6 +199,14 @@ func HandleSSE(c *gin.Context) {
 	// 设置关闭通知
 	notify := c.Request.Context().Done()
 
+	// 令牌过期时通知客户端并关闭连接，客户端需获取新令牌后重连
+	var expired <-chan time.Time
+	if claims != nil {
+		expiry := time.NewTimer(time.Until(claims.Expiry()))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
 	// 保持连接直到客户端断开
 	go func() {
 		for {
@@ -120,9 +220,17 @@ func HandleSSE(c *gin.Context) {
 				// 服务端关闭连接
 				log.Printf("服务端关闭SSE连接, 投票ID: %d", pollUintID)
 				return
+			case <-expired:
+				log.Printf("SSE访问令牌已过期，关闭连接, 投票ID: %d", pollUintID)
+				sendSSEEvent(client, SSEEventAuthExpired, map[string]interface{}{
+					"code":    streamauth.CloseTokenExpired,
+					"message": "访问令牌已过期",
+				})
+				client.Done <- true
+				return
 			case <-heartbeat.C:
 				// 发送心跳
-				err := sendSSEEvent(client, map[string]string{"type": "heartbeat", "time": time.Now().Format(time.RFC3339)})
+				err := sendSSEEvent(client, SSEEventHeartbeat, map[string]string{"type": "heartbeat", "time": time.Now().Format(time.RFC3339)})
 				if err != nil {
 					log.Printf("发送心跳失败，关闭连接: %v", err)
 					client.Done <- true
@@ -137,6 +245,11 @@ func HandleSSE(c *gin.Context) {
 
 	// 注销客户端
 	unregisterSSEClient(client)
+
+	// 广播可能已取得客户端列表的副本，处理函数返回前禁止后续写入
+	client.mu.Lock()
+	client.closed = true
+	client.mu.Unlock()
 }
 
 // 从列表中删除客户端
@@ -159,22 +272,45 @@ func unregisterSSEClient(client *SSEClient) {
 	}
 
 	log.Printf("已注销SSE客户端，当前连接数: %d", len(sseClients[client.PollID]))
+	presenceChanged(client.PollID)
 }
 
-// 向单个SSE客户端发送事件
-func sendSSEEvent(client *SSEClient, data interface{}) error {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("序列化数据失败，投票ID %d: %v", client.PollID, err)
-		return err
+// formatSSEEvent 构建SSE事件帧，id为0时不写入id字段
+func formatSSEEvent(id uint64, event string, data interface{}) []byte {
+	var jsonData []byte
+	switch v := data.(type) {
+	case json.RawMessage:
+		jsonData = v
+	default:
+		var err error
+		if jsonData, err = json.Marshal(data); err != nil {
+			log.Printf("序列化SSE数据失败: %v", err)
+			return nil
+		}
 	}
 
-	// 构建SSE事件
-	event := fmt.Sprintf("data: %s\n\n", jsonData)
+	var buf bytes.Buffer
+	if id > 0 {
+		fmt.Fprintf(&buf, "id: %d\n", id)
+	}
+	fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", event, jsonData)
+	return buf.Bytes()
+}
 
-	// 写入事件数据
-	_, err = fmt.Fprint(client.Writer, event)
-	if err != nil {
+// writeSSEFrameLocked 写入一个事件帧，调用方需持有client.mu
+// 连接已关闭或带ID的事件不大于已发送的ID时跳过
+func writeSSEFrameLocked(client *SSEClient, seq uint64, frame []byte) error {
+	if frame == nil || client.closed {
+		return nil
+	}
+	if seq > 0 {
+		if seq <= client.lastSeq {
+			return nil
+		}
+		client.lastSeq = seq
+	}
+
+	if _, err := client.Writer.Write(frame); err != nil {
 		log.Printf("写入SSE数据失败，投票ID %d: %v", client.PollID, err)
 		return err
 	}
@@ -184,21 +320,89 @@ func sendSSEEvent(client *SSEClient, data interface{}) error {
 	return nil
 }
 
-// BroadcastSSEUpdate向所有监听特定投票的SSE客户端广播更新
+// writeSSEFrame 加锁写入一个事件帧
+func writeSSEFrame(client *SSEClient, seq uint64, frame []byte) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return writeSSEFrameLocked(client, seq, frame)
+}
+
+// 向单个SSE客户端发送不带ID的事件
+func sendSSEEvent(client *SSEClient, event string, data interface{}) error {
+	return writeSSEFrame(client, 0, formatSSEEvent(0, event, data))
+}
+
+// sendSSESnapshotLocked 发送投票当前结果，事件ID为当前序号，调用方需持有client.mu
+func sendSSESnapshotLocked(client *SSEClient) error {
+	seq := currentSeq(sseSequencer, sseHistory, client.PollID)
+
+	results, err := GetCurrentPollResults(client.PollID)
+	if err != nil {
+		return err
+	}
+	log.Printf("获取初始数据成功，选项数量: %d", len(results))
+
+	// 快照可能已包含之后的更新，结果事件携带完整票数，重复应用不影响结果
+	frame := formatSSEEvent(seq, SSEEventResults, results)
+	if seq == 0 {
+		return writeSSEFrameLocked(client, 0, frame)
+	}
+	client.lastSeq = seq - 1
+	return writeSSEFrameLocked(client, seq, frame)
+}
+
+// BroadcastSSEUpdate向所有监听特定投票的SSE客户端广播结果更新，包括其他实例上的客户端
 func BroadcastSSEUpdate(pollID uint, data interface{}) {
+	broadcastSSEEvent(pollID, SSEEventResults, data)
+}
+
+// BroadcastSSEClosed 通知监听特定投票的SSE客户端投票已关闭
+func BroadcastSSEClosed(pollID uint) {
+	broadcastSSEEvent(pollID, SSEEventClosed, map[string]interface{}{
+		"poll_id": pollID,
+		"status":  "closed",
+	})
+}
+
+// broadcastSSEEvent 为事件分配ID并广播
+func broadcastSSEEvent(pollID uint, event string, data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("序列化SSE数据失败，投票ID %d: %v", pollID, err)
+		return
+	}
+
+	seq := nextSeq(sseSequencer, pollID)
+	publishBroadcast(fanout.KindSSE, pollID, seq, sseMessage{Event: event, Data: jsonData})
+}
+
+// deliverLocalSSEUpdate 向本实例监听特定投票的SSE客户端推送事件
+func deliverLocalSSEUpdate(pollID uint, seq uint64, payload json.RawMessage) {
+	var message sseMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Printf("解析SSE事件失败，投票ID %d: %v", pollID, err)
+		return
+	}
+
+	frame := formatSSEEvent(seq, message.Event, message.Data)
+	if seq > 0 {
+		sseSequencer.Observe(pollID, seq)
+		sseHistory.Append(pollID, seq, frame)
+	}
+
 	sseClientsMutex <- true // 获取锁
-	clients := sseClients[pollID]
+	clients := append([]*SSEClient(nil), sseClients[pollID]...)
 	<-sseClientsMutex // 释放锁
 
 	if len(clients) == 0 {
 		return // 没有客户端监听
 	}
 
-	log.Printf("通过SSE广播更新给%d个客户端, 投票ID: %d", len(clients), pollID)
+	log.Printf("通过SSE广播%s事件给%d个客户端, 投票ID: %d, 事件ID: %d", message.Event, len(clients), pollID, seq)
 
 	// 向所有客户端发送更新
 	for _, client := range clients {
-		sendSSEEvent(client, data)
+		writeSSEFrame(client, seq, frame)
 	}
 }
 
@@ -212,13 +416,11 @@ func init() {
 			for pollID, clients := range sseClients {
 				for _, client := range clients {
 					// 发送注释作为心跳
-					_, err := fmt.Fprint(client.Writer, ": ping\n\n")
-					if err != nil {
+					if err := writeSSEFrame(client, 0, []byte(": ping\n\n")); err != nil {
 						log.Printf("心跳发送失败，投票ID %d: %v", pollID, err)
 						client.Done <- true
 						continue
 					}
-					client.Flusher.Flush()
 				}
 			}
 			<-sseClientsMutex // 释放锁
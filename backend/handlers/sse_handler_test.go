@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openSSE connects to the poll's SSE stream, lets it run briefly and returns what was written.
+func openSSE(t *testing.T, router *gin.Engine, pollID uint, lastEventID string) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("/api/polls/%d/live", pollID), nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	w := httptest.NewRecorder()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestFormatSSEEvent(t *testing.T) {
+	frame := string(formatSSEEvent(7, SSEEventResults, map[string]int{"votes": 1}))
+	assert.Equal(t, "id: 7\nevent: results\ndata: {\"votes\":1}\n\n", frame)
+
+	frame = string(formatSSEEvent(0, SSEEventHeartbeat, map[string]string{}))
+	assert.Equal(t, "event: heartbeat\ndata: {}\n\n", frame)
+}
+
+func TestHandleSSE_ReplaysFromLastEventID(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "SSE?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+	require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+
+	// Earlier tests may have broadcast for the same poll ID
+	sseHistory = livefeed.NewHistory(sseHistorySize, sseHistoryRetention)
+	sseSequencer = cache.NewPollSequencer("sse_seq")
+
+	deliverLocalSSEUpdate(poll.ID, 1, []byte(`{"event":"results","data":[{"id":1,"votes":1}]}`))
+	deliverLocalSSEUpdate(poll.ID, 2, []byte(`{"event":"results","data":[{"id":1,"votes":2}]}`))
+	deliverLocalSSEUpdate(poll.ID, 3, []byte(`{"event":"closed","data":{"status":"closed"}}`))
+
+	body := openSSE(t, router, poll.ID, "1")
+	assert.True(t, strings.HasPrefix(body, "retry: "), body)
+	assert.NotContains(t, body, "id: 1\n")
+	second := strings.Index(body, "id: 2\nevent: results\n")
+	third := strings.Index(body, "id: 3\nevent: closed\n")
+	require.True(t, second > 0 && third > second, body)
+	assert.Contains(t, body, "event: status\n")
+
+	// An ID the buffer cannot serve falls back to a snapshot tagged with the latest ID
+	latest := sseHistory.LatestSeq(poll.ID)
+	body = openSSE(t, router, poll.ID, "42")
+	assert.Contains(t, body, fmt.Sprintf("id: %d\nevent: results\n", latest))
+	assert.NotContains(t, body, "event: closed")
+}
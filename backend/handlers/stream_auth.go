@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/streamauth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 携带访问令牌的方式：WebSocket使用查询参数或 "token.<令牌>" 子协议，SSE使用Authorization头或Cookie
+const (
+	streamTokenQuery       = "token"
+	streamTokenSubprotocol = "token."
+	streamTokenCookie      = "stream_token"
+)
+
+// 每次最多为多少个投票签发令牌
+const streamTokenMaxPolls = 50
+
+var (
+	// 访问令牌签发器，只有STREAM_AUTH_DISABLED=true时为nil，实时连接不校验令牌
+	streamSigner = newStreamSigner()
+
+	// 允许建立实时连接的页面来源
+	streamOrigins = streamauth.ParseOrigins(os.Getenv("STREAM_ALLOWED_ORIGINS"))
+)
+
+// newStreamSigner 从环境变量STREAM_TOKEN_SECRET读取令牌密钥
+// 未配置密钥时生成随机密钥，令牌只在本实例有效；关闭令牌校验必须显式设置STREAM_AUTH_DISABLED=true
+func newStreamSigner() *streamauth.Signer {
+	if os.Getenv("STREAM_AUTH_DISABLED") == "true" {
+		log.Printf("警告: STREAM_AUTH_DISABLED=true，WebSocket/SSE连接不校验访问令牌")
+		return nil
+	}
+	if secret := os.Getenv("STREAM_TOKEN_SECRET"); secret != "" {
+		return streamauth.NewSigner([]byte(secret))
+	}
+
+	signer, err := streamauth.NewRandomSigner()
+	if err != nil {
+		log.Fatalf("生成实时连接访问令牌密钥失败: %v", err)
+	}
+	log.Printf("未配置STREAM_TOKEN_SECRET，已生成随机令牌密钥，令牌在重启后失效且不能跨实例使用")
+	return signer
+}
+
+// streamTokenTTL 从环境变量STREAM_TOKEN_TTL读取令牌有效期，默认1小时
+func streamTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("STREAM_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Hour
+}
+
+// checkStreamOrigin 检查WebSocket和SSE请求的来源，替代允许所有来源的升级器
+func checkStreamOrigin(r *http.Request) bool {
+	if streamOrigins.Allowed(r) {
+		return true
+	}
+	log.Printf("拒绝来源不在允许列表中的实时连接: %s", r.Header.Get("Origin"))
+	return false
+}
+
+// wsStreamToken 从查询参数或子协议中读取WebSocket访问令牌
+// 浏览器的WebSocket无法设置请求头，使用子协议时需同时请求json或msgpack，服务端不会回显令牌子协议
+func wsStreamToken(c *gin.Context) string {
+	if token := c.Query(streamTokenQuery); token != "" {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		if strings.HasPrefix(protocol, streamTokenSubprotocol) {
+			return strings.TrimPrefix(protocol, streamTokenSubprotocol)
+		}
+	}
+	return ""
+}
+
+// sseStreamToken 从查询参数、Authorization头或Cookie中读取SSE访问令牌
+// 浏览器的EventSource无法设置请求头，同域页面可使用签发令牌时写入的Cookie，跨域页面需使用查询参数
+func sseStreamToken(c *gin.Context) string {
+	if token := c.Query(streamTokenQuery); token != "" {
+		return token
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if token, err := c.Cookie(streamTokenCookie); err == nil {
+		return token
+	}
+	return ""
+}
+
+// verifyStreamToken 校验访问令牌，关闭令牌校验时返回nil声明表示不限制
+func verifyStreamToken(token string) (*streamauth.Claims, error) {
+	if streamSigner == nil {
+		return nil, nil
+	}
+	return streamSigner.Verify(token, time.Now())
+}
+
+// authorizeStream 校验实时连接的来源和访问令牌，pollID不为0时同时检查是否可以观看该投票
+// 校验失败时已写入响应
+func authorizeStream(c *gin.Context, token string, pollID uint) (*streamauth.Claims, bool) {
+	if !checkStreamOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不允许的请求来源"})
+		return nil, false
+	}
+
+	claims, err := verifyStreamToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if pollID != 0 && !claimsCanView(claims, pollID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该投票"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// claimsCanView 判断声明是否允许观看投票，nil表示已关闭令牌校验
+func claimsCanView(claims *streamauth.Claims, pollID uint) bool {
+	return claims == nil || claims.CanView(pollID)
+}
+
+// IssueStreamTokenInput 申请访问令牌的输入
+type IssueStreamTokenInput struct {
+	PollIDs []uint `json:"poll_ids"`
+	Subject string `json:"subject" binding:"max=64"`
+}
+
+// IssueStreamToken 签发观看投票实时更新的访问令牌，同时写入Cookie供SSE使用
+// 普通调用方需指定投票，且投票存在、IP允许访问；携带管理员密钥时可不指定投票，令牌可观看所有投票
+func IssueStreamToken(c *gin.Context) {
+	if streamSigner == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用实时连接访问令牌"})
+		return
+	}
+
+	var input IssueStreamTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input.PollIDs) == 0 && !checkAdminKey(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须指定poll_ids"})
+		return
+	}
+	if len(input.PollIDs) > streamTokenMaxPolls {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "一次最多申请50个投票的令牌"})
+		return
+	}
+	for _, pollID := range input.PollIDs {
+		if !pollExists(pollID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "投票不存在", "poll_id": pollID})
+			return
+		}
+		if !ipAllowed(c.ClientIP(), pollID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": ipDeniedMessage, "poll_id": pollID})
+			return
+		}
+	}
+
+	ttl := streamTokenTTL()
+	claims := streamauth.Claims{
+		Subject:   input.Subject,
+		PollIDs:   input.PollIDs,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	token, err := streamSigner.Sign(claims)
+	if err != nil {
+		log.Printf("签发访问令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "签发访问令牌失败"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(streamTokenCookie, token, int(ttl/time.Second), "/api", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"poll_ids":   input.PollIDs,
+		"expires_at": claims.Expiry(),
+	})
+}
+
+// clientAuth WebSocket连接的访问令牌，令牌过期时关闭连接
+type clientAuth struct {
+	mu     sync.Mutex
+	claims *streamauth.Claims
+	timer  *time.Timer
+}
+
+// setAuth 设置连接的访问令牌，并在令牌过期时以4001关闭连接
+func (c *Client) setAuth(claims *streamauth.Claims) {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+
+	if c.auth.timer != nil {
+		c.auth.timer.Stop()
+		c.auth.timer = nil
+	}
+	c.auth.claims = claims
+	if claims != nil {
+		c.auth.timer = time.AfterFunc(time.Until(claims.Expiry()), func() {
+			c.expireAuth(claims)
+		})
+	}
+}
+
+// stopAuth 连接关闭时停止过期计时
+func (c *Client) stopAuth() {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	if c.auth.timer != nil {
+		c.auth.timer.Stop()
+		c.auth.timer = nil
+	}
+}
+
+// canView 判断连接的令牌是否允许观看投票
+func (c *Client) canView(pollID uint) bool {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	return claimsCanView(c.auth.claims, pollID)
+}
+
+// expireAuth 令牌过期且未被刷新时关闭连接
+func (c *Client) expireAuth(claims *streamauth.Claims) {
+	c.auth.mu.Lock()
+	current := c.auth.claims == claims
+	c.auth.mu.Unlock()
+	if !current {
+		return
+	}
+
+	log.Printf("WebSocket访问令牌已过期，关闭连接 [订阅者: %s]", claims.Subject)
+	// WriteControl可以与写循环并发调用
+	message := websocket.FormatCloseMessage(streamauth.CloseTokenExpired, "token expired")
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// refreshAuth 处理客户端的AUTH消息，用新令牌延长连接
+// 新令牌必须允许观看连接当前订阅的所有投票
+func (c *Client) refreshAuth(token string) {
+	claims, err := verifyStreamToken(token)
+	if err == nil && claims == nil {
+		err = errors.New("未启用实时连接访问令牌")
+	}
+	if err != nil {
+		c.replyError(0, err.Error())
+		return
+	}
+
+	c.hub.mu.RLock()
+	for pollID := range c.polls {
+		if !claims.CanView(pollID) {
+			c.hub.mu.RUnlock()
+			c.replyError(pollID, "新令牌无权查看已订阅的投票")
+			return
+		}
+	}
+	c.hub.mu.RUnlock()
+
+	c.setAuth(claims)
+	c.reply(wsAuthMessage{Type: WSTypeAuthOK, ExpiresAt: claims.ExpiresAt})
+}
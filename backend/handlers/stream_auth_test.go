@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/streamauth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// enableStreamAuth turns on token checks for the duration of a test.
+func enableStreamAuth(t *testing.T) *streamauth.Signer {
+	signer := streamauth.NewSigner([]byte("test-secret"))
+	previous := streamSigner
+	streamSigner = signer
+	t.Cleanup(func() { streamSigner = previous })
+	return signer
+}
+
+func createStreamPolls(t *testing.T, db *gorm.DB, n int) []models.Poll {
+	var polls []models.Poll
+	for i := 0; i < n; i++ {
+		poll := models.Poll{Question: "Private stream?", IsActive: true}
+		require.NoError(t, db.Create(&poll).Error)
+		require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+		polls = append(polls, poll)
+	}
+	return polls
+}
+
+func signStreamToken(t *testing.T, signer *streamauth.Signer, ttl time.Duration, pollIDs ...uint) string {
+	token, err := signer.Sign(streamauth.Claims{PollIDs: pollIDs, ExpiresAt: time.Now().Add(ttl).Unix()})
+	require.NoError(t, err)
+	return token
+}
+
+// requestStreamToken posts to the token endpoint from a routable client address.
+func requestStreamToken(router *gin.Engine, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/api/stream-token", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// dialStatus dials a WebSocket endpoint and returns the handshake status code.
+func dialStatus(t *testing.T, dialer *websocket.Dialer, url string, header http.Header) (*websocket.Conn, int) {
+	conn, resp, err := dialer.Dial(url, header)
+	if err != nil {
+		require.NotNil(t, resp, err)
+		return nil, resp.StatusCode
+	}
+	return conn, resp.StatusCode
+}
+
+func TestStreamAuth_WebSocket(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	polls := createStreamPolls(t, db, 2)
+	enableStreamAuth(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// Anyone may request a token for specific polls; all-poll tokens need the admin key
+	w := requestStreamToken(router, gin.H{"poll_ids": []uint{polls[0].ID}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var issued struct {
+		Token   string `json:"token"`
+		PollIDs []uint `json:"poll_ids"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	assert.Equal(t, []uint{polls[0].ID}, issued.PollIDs)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), streamTokenCookie+"=")
+
+	w = requestStreamToken(router, gin.H{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = requestStreamToken(router, gin.H{"poll_ids": []uint{999999}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	pollURL := func(pollID uint) string { return fmt.Sprintf("%s/api/polls/%d/ws", wsURL, pollID) }
+
+	_, status := dialStatus(t, websocket.DefaultDialer, pollURL(polls[0].ID), nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	_, status = dialStatus(t, websocket.DefaultDialer, pollURL(polls[0].ID)+"?token=garbage", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	_, status = dialStatus(t, websocket.DefaultDialer, pollURL(polls[1].ID)+"?token="+issued.Token, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Cross-site pages are rejected unless listed in STREAM_ALLOWED_ORIGINS
+	_, status = dialStatus(t, websocket.DefaultDialer, pollURL(polls[0].ID)+"?token="+issued.Token, http.Header{"Origin": {"https://evil.example"}})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	conn, status := dialStatus(t, websocket.DefaultDialer, pollURL(polls[0].ID)+"?token="+issued.Token, nil)
+	require.Equal(t, http.StatusSwitchingProtocols, status)
+	conn.Close()
+
+	// Browsers pass the token as a subprotocol next to the encoding they want
+	dialer := &websocket.Dialer{Subprotocols: []string{SubprotocolJSON, streamTokenSubprotocol + issued.Token}}
+	conn, status = dialStatus(t, dialer, wsURL+"/api/ws", nil)
+	require.Equal(t, http.StatusSwitchingProtocols, status)
+	defer conn.Close()
+	assert.Equal(t, SubprotocolJSON, conn.Subprotocol())
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[1].ID}))
+	messages := readWSMessages(t, conn, 1)
+	assert.Equal(t, "ERROR", messages[0]["type"])
+	assert.Equal(t, "无权查看该投票", messages[0]["error"])
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[0].ID}))
+	messages = readWSMessages(t, conn, 1)
+	assert.Equal(t, "SUBSCRIBED", messages[0]["type"])
+}
+
+func TestStreamAuth_WebSocketExpiry(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	polls := createStreamPolls(t, db, 1)
+	signer := enableStreamAuth(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws?token="
+
+	short := signStreamToken(t, signer, time.Second, polls[0].ID)
+	refreshed, _, err := websocket.DefaultDialer.Dial(wsURL+short, nil)
+	require.NoError(t, err)
+	defer refreshed.Close()
+	expiring, _, err := websocket.DefaultDialer.Dial(wsURL+short, nil)
+	require.NoError(t, err)
+	defer expiring.Close()
+
+	// A refreshed connection outlives its original token
+	require.NoError(t, refreshed.WriteJSON(map[string]interface{}{"type": "AUTH", "token": signStreamToken(t, signer, time.Hour, polls[0].ID)}))
+	messages := readWSMessages(t, refreshed, 1)
+	assert.Equal(t, "AUTH_OK", messages[0]["type"])
+
+	// The other one is closed with the token-expired code
+	expiring.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = expiring.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, streamauth.CloseTokenExpired), err)
+
+	require.NoError(t, refreshed.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[0].ID}))
+	messages = readWSMessages(t, refreshed, 1)
+	assert.Equal(t, "SUBSCRIBED", messages[0]["type"])
+}
+
+func TestStreamAuth_SSE(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	polls := createStreamPolls(t, db, 2)
+	signer := enableStreamAuth(t)
+
+	livePath := fmt.Sprintf("/api/polls/%d/live", polls[0].ID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", livePath, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token := signStreamToken(t, signer, time.Hour, polls[1].ID)
+	req := httptest.NewRequest("GET", livePath, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Cross-origin pages can't rely on the cookie and pass the token in the query instead
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", livePath+"?token="+token, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The cookie set when issuing a token works for EventSource, and the stream ends when it expires
+	req = httptest.NewRequest("GET", livePath, nil)
+	req.AddCookie(&http.Cookie{Name: streamTokenCookie, Value: signStreamToken(t, signer, time.Second, polls[0].ID)})
+	req.Header.Set("Origin", "http://"+req.Host)
+	w = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SSE stream did not close after the token expired")
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "http://"+req.Host, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Body.String(), "event: results\n")
+	assert.Contains(t, w.Body.String(), "event: auth_expired\n")
+}
+
+func TestNewStreamSigner_FailsClosed(t *testing.T) {
+	t.Setenv("STREAM_TOKEN_SECRET", "")
+	t.Setenv("STREAM_AUTH_DISABLED", "")
+
+	// Without a secret every instance gets its own random key
+	first, second := newStreamSigner(), newStreamSigner()
+	require.NotNil(t, first)
+	require.NotNil(t, second)
+	token := signStreamToken(t, first, time.Minute, 1)
+	_, err := first.Verify(token, time.Now())
+	assert.NoError(t, err)
+	_, err = second.Verify(token, time.Now())
+	assert.ErrorIs(t, err, streamauth.ErrSignature)
+
+	t.Setenv("STREAM_TOKEN_SECRET", "shared")
+	token = signStreamToken(t, newStreamSigner(), time.Minute, 1)
+	_, err = newStreamSigner().Verify(token, time.Now())
+	assert.NoError(t, err)
+
+	t.Setenv("STREAM_AUTH_DISABLED", "true")
+	assert.Nil(t, newStreamSigner())
+}
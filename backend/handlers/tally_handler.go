@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/tally"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errTallyPublished 可验证投票已公布计票结果，不能再修改票数
+var errTallyPublished = errors.New("该投票已公布可验证计票结果，不能再修改票数")
+
+// errBallotPollClosed 写入选票时投票已关闭
+var errBallotPollClosed = errors.New("此投票已关闭")
+
+// 已公布投票的Merkle树缓存，公布后选票不再变化
+var tallyTrees sync.Map // pollID -> *tally.Tree
+
+// lockPollForBallot 在事务中锁定投票行，确认投票仍在进行且尚未公布计票结果
+// 公布计票结果时持有同一把锁，保证公布后不会再有选票写入
+func lockPollForBallot(tx *gorm.DB, pollID uint) error {
+	var poll models.Poll
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "is_active").First(&poll, pollID).Error; err != nil {
+		return fmt.Errorf("锁定投票失败: %w", err)
+	}
+	if !poll.IsActive {
+		return errBallotPollClosed
+	}
+	if isTallyPublished(tx, pollID) {
+		return errTallyPublished
+	}
+	return nil
+}
+
+// ballotErrorResponse 将写入可验证选票时的错误转换为HTTP状态码和响应内容
+func ballotErrorResponse(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, errBallotPollClosed):
+		return http.StatusForbidden, gin.H{"error": err.Error()}
+	case errors.Is(err, errTallyPublished):
+		return http.StatusConflict, gin.H{"error": err.Error()}
+	default:
+		return http.StatusInternalServerError, gin.H{"error": "记录投票失败"}
+	}
+}
+
+// castBallot 在事务中为可验证投票写入一张选票
+func castBallot(tx *gorm.DB, pollID uint, optionIDs []uint) (*models.Ballot, error) {
+	salt, err := tally.NewSalt()
+	if err != nil {
+		return nil, fmt.Errorf("生成选票盐失败: %v", err)
+	}
+
+	ballot := &models.Ballot{
+		PollID:    pollID,
+		OptionIDs: tally.CanonicalOptions(optionIDs),
+		Salt:      salt,
+		Receipt:   tally.Receipt(pollID, optionIDs, salt),
+	}
+	if err := tx.Create(ballot).Error; err != nil {
+		return nil, fmt.Errorf("写入选票失败: %v", err)
+	}
+	return ballot, nil
+}
+
+// recordVerifiableVote 为可验证投票计票并写入选票，两者在同一事务中完成
+func recordVerifiableVote(pollID uint, optionIDs []uint) (*models.Ballot, error) {
+	var ballot *models.Ballot
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPollForBallot(tx, pollID); err != nil {
+			return err
+		}
+		for _, optionID := range optionIDs {
+			result := tx.Model(&models.PollOption{}).Where("id = ? AND poll_id = ?", optionID, pollID).
+				UpdateColumn("votes", gorm.Expr("votes + ?", 1))
+			if result.Error != nil {
+				return fmt.Errorf("更新选项 %d 票数失败: %v", optionID, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("选项 %d 不存在或不属于投票 %d", optionID, pollID)
+			}
+		}
+
+		var err error
+		ballot, err = castBallot(tx, pollID, optionIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ballot, nil
+}
+
+// withBallotReceipt 在投票响应中附加选票收据
+func withBallotReceipt(response gin.H, ballot *models.Ballot) gin.H {
+	if ballot != nil {
+		response["receipt"] = ballot.Receipt
+		response["receipt_salt"] = ballot.Salt
+	}
+	return response
+}
+
+// isTallyPublished 判断投票是否已公布计票结果
+func isTallyPublished(db *gorm.DB, pollID uint) bool {
+	var count int64
+	db.Model(&models.TallyPublication{}).Where("poll_id = ?", pollID).Count(&count)
+	return count > 0
+}
+
+// publishTally 对可验证投票的全部选票构建Merkle树，公布树根、票数和纳入树中的收据
+// 已公布过的投票直接返回已有结果
+func publishTally(pollID uint) (*models.TallyPublication, error) {
+	var existing models.TallyPublication
+	result := database.DB.Where("poll_id = ?", pollID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &existing, nil
+	}
+
+	var publication *models.TallyPublication
+	var tree *tally.Tree
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定投票行，与写入选票互斥，读取到的选票即为最终选票
+		var poll models.Poll
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&poll, pollID).Error; err != nil {
+			return err
+		}
+		if !poll.Verifiable {
+			return fmt.Errorf("投票 %d 未启用可验证计票", pollID)
+		}
+		if err := tx.Where("poll_id = ?", pollID).Find(&poll.Options).Error; err != nil {
+			return fmt.Errorf("读取选项失败: %v", err)
+		}
+
+		var ballots []models.Ballot
+		if err := tx.Where("poll_id = ?", pollID).Find(&ballots).Error; err != nil {
+			return fmt.Errorf("读取选票失败: %v", err)
+		}
+
+		receipts := ballotReceipts(ballots)
+		var err error
+		tree, err = tally.BuildTree(receipts)
+		if err != nil {
+			return err
+		}
+
+		// 票数以选票统计为准，同时与选项计数器比对
+		counts := tally.Count(exportBallots(ballots))
+		consistent := true
+		for _, opt := range poll.Options {
+			if _, ok := counts[opt.ID]; !ok {
+				counts[opt.ID] = 0
+			}
+			if counts[opt.ID] != opt.Votes {
+				consistent = false
+				log.Printf("警告: 可验证投票 %d 的选项 %d 计数器为 %d，选票统计为 %d", pollID, opt.ID, opt.Votes, counts[opt.ID])
+			}
+		}
+
+		countsJSON, err := json.Marshal(counts)
+		if err != nil {
+			return err
+		}
+		receiptsJSON, err := json.Marshal(receipts)
+		if err != nil {
+			return err
+		}
+
+		publication = &models.TallyPublication{
+			PollID:      pollID,
+			MerkleRoot:  tree.Root(),
+			BallotCount: tree.Size(),
+			Counts:      string(countsJSON),
+			Consistent:  consistent,
+			Receipts:    string(receiptsJSON),
+			PublishedAt: time.Now().Truncate(time.Second),
+		}
+		if err := tx.Create(publication).Error; err != nil {
+			return fmt.Errorf("保存计票结果失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// 并发公布时唯一索引冲突，返回先写入的结果
+		if result := database.DB.Where("poll_id = ?", pollID).Limit(1).Find(&existing); result.Error == nil && result.RowsAffected > 0 {
+			return &existing, nil
+		}
+		return nil, err
+	}
+
+	tallyTrees.Store(pollID, tree)
+	log.Printf("可验证投票 %d 已公布计票结果: 选票数=%d, 树根=%s", pollID, publication.BallotCount, publication.MerkleRoot)
+	return publication, nil
+}
+
+// publishClosedVerifiablePolls 为已关闭但尚未公布的可验证投票公布计票结果
+func publishClosedVerifiablePolls() {
+	var pollIDs []uint
+	err := database.DB.Model(&models.Poll{}).
+		Where("verifiable = ? AND is_active = ?", true, false).
+		Where("id NOT IN (?)", database.DB.Model(&models.TallyPublication{}).Select("poll_id")).
+		Pluck("id", &pollIDs).Error
+	if err != nil {
+		log.Printf("查询待公布的可验证投票失败: %v", err)
+		return
+	}
+
+	for _, pollID := range pollIDs {
+		if _, err := publishTally(pollID); err != nil {
+			log.Printf("公布可验证投票 %d 的计票结果失败: %v", pollID, err)
+		}
+	}
+}
+
+// ballotReceipts 提取选票收据
+func ballotReceipts(ballots []models.Ballot) []string {
+	receipts := make([]string, len(ballots))
+	for i, ballot := range ballots {
+		receipts[i] = ballot.Receipt
+	}
+	return receipts
+}
+
+// exportBallots 将选票转换为导出格式
+func exportBallots(ballots []models.Ballot) []tally.ExportedBallot {
+	exported := make([]tally.ExportedBallot, len(ballots))
+	for i, ballot := range ballots {
+		exported[i] = tally.ExportedBallot{
+			Receipt:   ballot.Receipt,
+			OptionIDs: splitOptionIDs(ballot.OptionIDs),
+			Salt:      ballot.Salt,
+		}
+	}
+	return exported
+}
+
+// loadPublishedTally 读取投票的公布结果，未公布时写入错误响应并返回nil
+func loadPublishedTally(c *gin.Context) (*models.TallyPublication, map[uint]int64) {
+	pollID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的投票ID格式"})
+		return nil, nil
+	}
+
+	var publication models.TallyPublication
+	result := database.DB.Where("poll_id = ?", uint(pollID)).Limit(1).Find(&publication)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取计票结果失败"})
+		return nil, nil
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该投票尚未公布可验证计票结果"})
+		return nil, nil
+	}
+
+	counts := make(map[uint]int64)
+	if err := json.Unmarshal([]byte(publication.Counts), &counts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析计票结果失败"})
+		return nil, nil
+	}
+
+	return &publication, counts
+}
+
+// publishedReceipts 解析公布时纳入Merkle树的收据
+func publishedReceipts(publication *models.TallyPublication) ([]string, error) {
+	var receipts []string
+	if err := json.Unmarshal([]byte(publication.Receipts), &receipts); err != nil {
+		return nil, fmt.Errorf("解析公布的收据失败: %v", err)
+	}
+	return receipts, nil
+}
+
+// tallyTree 获取已公布投票的Merkle树，只使用公布时记录的收据，优先使用缓存
+func tallyTree(publication *models.TallyPublication) (*tally.Tree, error) {
+	if cached, ok := tallyTrees.Load(publication.PollID); ok {
+		return cached.(*tally.Tree), nil
+	}
+
+	receipts, err := publishedReceipts(publication)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := tally.BuildTree(receipts)
+	if err != nil {
+		return nil, err
+	}
+	if tree.Root() != publication.MerkleRoot {
+		return nil, fmt.Errorf("重建的树根 %s 与公布的树根 %s 不一致", tree.Root(), publication.MerkleRoot)
+	}
+
+	tallyTrees.Store(publication.PollID, tree)
+	return tree, nil
+}
+
+// GetPollTally 获取可验证投票公布的树根和票数
+func GetPollTally(c *gin.Context) {
+	publication, counts := loadPublishedTally(c)
+	if publication == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id":      publication.PollID,
+		"merkle_root":  publication.MerkleRoot,
+		"ballot_count": publication.BallotCount,
+		"counts":       counts,
+		"consistent":   publication.Consistent,
+		"published_at": publication.PublishedAt,
+	})
+}
+
+// GetBallotProof 获取选票收据的Merkle包含性证明
+func GetBallotProof(c *gin.Context) {
+	publication, _ := loadPublishedTally(c)
+	if publication == nil {
+		return
+	}
+
+	receipt := c.Query("receipt")
+	if receipt == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须提供receipt参数"})
+		return
+	}
+
+	tree, err := tallyTree(publication)
+	if err != nil {
+		log.Printf("构建Merkle树失败: 投票ID=%d, 错误: %v", publication.PollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "构建Merkle树失败"})
+		return
+	}
+
+	index, proof, err := tree.Proof(receipt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到该收据对应的选票"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id":     publication.PollID,
+		"receipt":     receipt,
+		"leaf_index":  index,
+		"proof":       proof,
+		"merkle_root": publication.MerkleRoot,
+	})
+}
+
+// ExportPollBallots 导出可验证投票的全部选票，供独立校验工具使用
+func ExportPollBallots(c *gin.Context) {
+	publication, counts := loadPublishedTally(c)
+	if publication == nil {
+		return
+	}
+
+	receipts, err := publishedReceipts(publication)
+	if err != nil {
+		log.Printf("读取公布的收据失败: 投票ID=%d, 错误: %v", publication.PollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取选票失败"})
+		return
+	}
+	published := make(map[string]bool, len(receipts))
+	for _, receipt := range receipts {
+		published[receipt] = true
+	}
+
+	// 只导出公布时纳入Merkle树的选票
+	var all []models.Ballot
+	if err := database.DB.Where("poll_id = ?", publication.PollID).Order("receipt asc").Find(&all).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取选票失败"})
+		return
+	}
+	ballots := make([]models.Ballot, 0, len(receipts))
+	for _, ballot := range all {
+		if published[ballot.Receipt] {
+			ballots = append(ballots, ballot)
+		}
+	}
+
+	export := tally.Export{
+		PollID:      publication.PollID,
+		MerkleRoot:  publication.MerkleRoot,
+		Counts:      counts,
+		BallotCount: publication.BallotCount,
+		PublishedAt: publication.PublishedAt,
+		Ballots:     exportBallots(ballots),
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=poll-%d-ballots.json", publication.PollID))
+	c.JSON(http.StatusOK, export)
+}
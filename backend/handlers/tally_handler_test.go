@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/tally"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func performJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestVerifiableTally_PublishProofAndExport(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Verifiable?", IsActive: true, Verifiable: true}
+	require.NoError(t, db.Create(&poll).Error)
+	options := []models.PollOption{{PollID: poll.ID, Text: "A"}, {PollID: poll.ID, Text: "B"}}
+	require.NoError(t, db.Create(&options).Error)
+
+	votes := []uint{options[0].ID, options[1].ID, options[0].ID}
+	receipts := make([]string, 0, len(votes))
+	for _, optionID := range votes {
+		w := performJSON(router, "POST", fmt.Sprintf("/api/polls/%d/vote", poll.ID), gin.H{"option_id": optionID})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		receipt, ok := resp["receipt"].(string)
+		require.True(t, ok)
+		receipts = append(receipts, receipt)
+	}
+
+	// Nothing is published while the poll is open
+	w := performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally", poll.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performJSON(router, "PUT", fmt.Sprintf("/api/polls/%d", poll.ID), gin.H{"is_active": false})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally", poll.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var published struct {
+		MerkleRoot  string         `json:"merkle_root"`
+		BallotCount int            `json:"ballot_count"`
+		Counts      map[uint]int64 `json:"counts"`
+		Consistent  bool           `json:"consistent"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &published))
+	assert.Equal(t, 3, published.BallotCount)
+	assert.Equal(t, int64(2), published.Counts[options[0].ID])
+	assert.Equal(t, int64(1), published.Counts[options[1].ID])
+	assert.True(t, published.Consistent)
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally/proof?receipt=%s", poll.ID, receipts[1]), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var proof struct {
+		Proof []tally.ProofStep `json:"proof"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &proof))
+	assert.True(t, tally.VerifyProof(receipts[1], proof.Proof, published.MerkleRoot))
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally/export", poll.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var export tally.Export
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Empty(t, tally.VerifyExport(&export))
+
+	// A ballot written after publication is not part of the published tree or export
+	late := models.Ballot{PollID: poll.ID, OptionIDs: fmt.Sprint(options[1].ID), Salt: "late"}
+	late.Receipt = tally.Receipt(poll.ID, []uint{options[1].ID}, late.Salt)
+	require.NoError(t, db.Create(&late).Error)
+	tallyTrees.Delete(poll.ID)
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally/proof?receipt=%s", poll.ID, late.Receipt), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally/proof?receipt=%s", poll.ID, receipts[0]), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &proof))
+	assert.True(t, tally.VerifyProof(receipts[0], proof.Proof, published.MerkleRoot))
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/polls/%d/tally/export", poll.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	export = tally.Export{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Len(t, export.Ballots, 3)
+	assert.Empty(t, tally.VerifyExport(&export))
+
+	// A published poll cannot be reopened
+	w = performJSON(router, "PUT", fmt.Sprintf("/api/polls/%d", poll.ID), gin.H{"is_active": true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestRecordVerifiableVote_RejectsClosedOrPublishedPoll(t *testing.T) {
+	_, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Verifiable?", IsActive: true, Verifiable: true}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+
+	// Closed after the handler loaded the poll
+	require.NoError(t, db.Model(&poll).Update("is_active", false).Error)
+	_, err := recordVerifiableVote(poll.ID, []uint{option.ID})
+	assert.ErrorIs(t, err, errBallotPollClosed)
+
+	require.NoError(t, db.Model(&poll).Update("is_active", true).Error)
+	require.NoError(t, db.Create(&models.TallyPublication{PollID: poll.ID, MerkleRoot: "root", Receipts: "[]"}).Error)
+	_, err = recordVerifiableVote(poll.ID, []uint{option.ID})
+	assert.ErrorIs(t, err, errTallyPublished)
+
+	var count int64
+	db.Model(&models.Ballot{}).Where("poll_id = ?", poll.ID).Count(&count)
+	assert.Zero(t, count)
+	require.NoError(t, db.First(&option, option.ID).Error)
+	assert.Zero(t, option.Votes)
+}
@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"realtime-voting-backend/cache"
 	"realtime-voting-backend/database"
-	"realtime-voting-backend/mq"
 )
 
 // VoteRequest 投票请求结构
@@ -67,7 +67,7 @@ func HandleVote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 4. 发送消息到消息队列
-	err = mq.SendVoteMessage(req.PollID, req.OptionID)
+	err = mqAdapter.SendVoteMessage(req.PollID, req.OptionID)
 	if err != nil {
 		log.Printf("发送投票消息失败: %v", err)
 		http.Error(w, "处理投票失败", http.StatusInternalServerError)
@@ -115,7 +115,9 @@ func ProcessVoteMessage(pollID string, optionID string) error {
 	}
 
 	// 5. 广播投票更新
-	BroadcastPollUpdateStr(pollID, nil)
+	if id, err := strconv.ParseUint(pollID, 10, 32); err == nil {
+		SchedulePollBroadcast(uint(id))
+	}
 
 	return nil
 }
@@ -0,0 +1,571 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/mq"
+	"realtime-voting-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 审计动作
+const (
+	AuditActionWebhookCreate = "webhook.create"
+	AuditActionWebhookUpdate = "webhook.update"
+	AuditActionWebhookDelete = "webhook.delete"
+)
+
+// 加入投递队列的超时时间，Redis响应缓慢时不阻塞业务请求
+const webhookEnqueueTimeout = 500 * time.Millisecond
+
+// 投票阈值通知记录的保留时间
+const webhookThresholdTTL = 30 * 24 * time.Hour
+
+// 读取接收方响应体的上限
+const webhookMaxResponseBody = 64 << 10
+
+var (
+	// webhookQueue 投递队列，StartWebhookDispatcher启动前只入队不投递
+	webhookQueue = mq.NewWebhookQueue(mq.NewMemoryWebhookStore(), deliverWebhook, webhookQueueOptions())
+
+	// webhookClient 投递使用的HTTP客户端
+	webhookClient = &http.Client{Timeout: webhookTimeout()}
+
+	// webhookThresholds 触发poll.vote_threshold事件的总票数
+	webhookThresholds = webhookVoteThresholds()
+
+	// webhookThresholdsFired 本实例已通知过的阈值，只在Redis不可用或出错时用于去重
+	webhookThresholdsFired sync.Map
+)
+
+// webhookVoteThresholds 从环境变量WEBHOOK_VOTE_THRESHOLDS读取逗号分隔的票数阈值
+// 未设置时默认100,1000,10000，设为空时不发送阈值事件
+func webhookVoteThresholds() []int64 {
+	list, ok := os.LookupEnv("WEBHOOK_VOTE_THRESHOLDS")
+	if !ok {
+		list = "100,1000,10000"
+	}
+	return webhook.ParseThresholds(list)
+}
+
+// webhookTimeout 从环境变量WEBHOOK_TIMEOUT读取单次投递的超时时间，默认5秒
+func webhookTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Second
+}
+
+// webhookQueueOptions 从环境变量读取投递队列配置
+// WEBHOOK_MAX_ATTEMPTS 最多投递次数，默认6；WEBHOOK_RETRY_BASE 第一次重试的等待时间，默认10秒，之后每次翻倍，最多1小时
+func webhookQueueOptions() mq.WebhookQueueOptions {
+	opts := mq.WebhookQueueOptions{
+		Workers:     4,
+		MaxAttempts: 6,
+		BaseDelay:   10 * time.Second,
+		MaxDelay:    time.Hour,
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		opts.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_BASE")); err == nil && d > 0 {
+		opts.BaseDelay = d
+	}
+	return opts
+}
+
+// StartWebhookDispatcher 启动webhook投递，需在Redis初始化之后调用
+// Redis可用时任务保存在Redis中，多个实例共同投递；否则保存在本实例内存中
+func StartWebhookDispatcher(ctx context.Context) {
+	if client, err := cache.GetClient(); err == nil && client != nil {
+		webhookQueue = mq.NewWebhookQueue(mq.NewRedisWebhookStore(client), deliverWebhook, webhookQueueOptions())
+	} else {
+		log.Printf("Redis不可用，webhook投递任务保存在内存中，重启后未投递的通知会丢失")
+	}
+	webhookQueue.Run(ctx)
+}
+
+// emitWebhookEvent 向订阅了该事件的webhook投递通知，投递异步进行
+func emitWebhookEvent(eventType string, pollID uint, data interface{}) {
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		log.Printf("查询webhook订阅失败，跳过事件 %s: %v", eventType, err)
+		return
+	}
+
+	var payload []byte
+	ctx, cancel := context.WithTimeout(context.Background(), webhookEnqueueTimeout)
+	defer cancel()
+
+	for _, sub := range subscriptions {
+		if !webhook.Subscribed(sub.Events, eventType) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(webhook.NewEvent(eventType, pollID, data))
+			if err != nil {
+				log.Printf("序列化webhook事件失败: %v", err)
+				return
+			}
+		}
+
+		job := &mq.WebhookJob{SubscriptionID: sub.ID, Event: eventType, Payload: payload}
+		if err := webhookQueue.Enqueue(ctx, job); err != nil {
+			log.Printf("webhook任务入队失败: 订阅=%d, 事件=%s, 错误: %v", sub.ID, eventType, err)
+		}
+	}
+}
+
+// deliverWebhook 向订阅的URL投递一次通知
+// 订阅已删除或停用时放弃投递；接收方返回4xx（408、429除外）时不再重试
+func deliverWebhook(ctx context.Context, job *mq.WebhookJob) error {
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, job.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return mq.Drop(errors.New("webhook订阅已删除"))
+		}
+		return fmt.Errorf("读取webhook订阅失败: %v", err)
+	}
+	if !sub.Active {
+		return mq.Drop(errors.New("webhook订阅已停用"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return mq.Permanent(err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "realtime-voting-webhook/1.0")
+	req.Header.Set(webhook.HeaderEvent, job.Event)
+	req.Header.Set(webhook.HeaderDelivery, job.ID)
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(sub.Secret, timestamp, job.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponseBody))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("接收方返回状态码 %d", resp.StatusCode)
+	default:
+		return mq.Permanent(fmt.Errorf("接收方返回状态码 %d", resp.StatusCode))
+	}
+}
+
+// webhookPollData 投票生命周期事件携带的投票信息
+type webhookPollData struct {
+	Question string          `json:"question"`
+	PollType models.PollType `json:"poll_type"`
+	IsActive bool            `json:"is_active"`
+	EndTime  *time.Time      `json:"end_time,omitempty"`
+	Options  []wsOption      `json:"options"`
+}
+
+func newWebhookPollData(poll models.Poll) webhookPollData {
+	data := webhookPollData{
+		Question: poll.Question,
+		PollType: poll.PollType,
+		IsActive: poll.IsActive,
+		EndTime:  poll.EndTime,
+		Options:  make([]wsOption, 0, len(poll.Options)),
+	}
+	for _, opt := range poll.Options {
+		data.Options = append(data.Options, wsOption{ID: opt.ID, Text: opt.Text, Votes: opt.Votes})
+	}
+	return data
+}
+
+// emitPollClosedWebhook 发送poll.closed事件，携带关闭原因和最终票数
+func emitPollClosedWebhook(pollID uint, reason string) {
+	data := gin.H{"reason": reason}
+	if results, err := GetCurrentPollResults(pollID); err == nil {
+		data["results"] = formatPollResults(results)
+	} else {
+		log.Printf("获取投票 %d 的最终结果失败: %v", pollID, err)
+	}
+	emitWebhookEvent(webhook.EventPollClosed, pollID, data)
+}
+
+// checkVoteThresholds 总票数达到阈值时发送poll.vote_threshold事件，每个阈值只通知一次
+func checkVoteThresholds(pollID uint, results []PollOptionResult) {
+	if len(webhookThresholds) == 0 {
+		return
+	}
+	var total int64
+	for _, r := range results {
+		total += r.Votes
+	}
+	for _, threshold := range webhook.Reached(webhookThresholds, total) {
+		if claimVoteThreshold(pollID, threshold) {
+			emitWebhookEvent(webhook.EventVoteThreshold, pollID, gin.H{"threshold": threshold, "total_votes": total})
+		}
+	}
+}
+
+// claimVoteThreshold 记录阈值已通知，返回false表示本实例或其他实例已经通知过
+func claimVoteThreshold(pollID uint, threshold int64) bool {
+	client, _ := cache.GetClient()
+	return claimThresholdKey(client, webhookThresholdKey(pollID, threshold))
+}
+
+// claimThresholdKey Redis可用时只以SETNX的结果为准，其他实例重置投票后删除的键在这里立即生效；
+// 没有Redis或Redis出错时退回本实例的记录
+func claimThresholdKey(client *redis.Client, key string) bool {
+	if client == nil {
+		return claimLocalThreshold(key)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookEnqueueTimeout)
+	defer cancel()
+	claimed, err := client.SetNX(ctx, key, time.Now().Unix(), webhookThresholdTTL).Result()
+	if err != nil {
+		log.Printf("记录投票阈值通知失败，使用本地记录: %v", err)
+		return claimLocalThreshold(key)
+	}
+	return claimed
+}
+
+func claimLocalThreshold(key string) bool {
+	_, fired := webhookThresholdsFired.LoadOrStore(key, true)
+	return !fired
+}
+
+func webhookThresholdKey(pollID uint, threshold int64) string {
+	return fmt.Sprintf("webhook_threshold:%d:%d", pollID, threshold)
+}
+
+// resetVoteThresholds 投票重置后允许再次通知各个阈值
+func resetVoteThresholds(pollID uint) {
+	keys := make([]string, 0, len(webhookThresholds))
+	for _, threshold := range webhookThresholds {
+		key := webhookThresholdKey(pollID, threshold)
+		webhookThresholdsFired.Delete(key)
+		keys = append(keys, key)
+	}
+
+	client, err := cache.GetClient()
+	if err != nil || client == nil || len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookEnqueueTimeout)
+	defer cancel()
+	if err := client.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("清除投票阈值通知记录失败: %v", err)
+	}
+}
+
+// webhookView 订阅在管理接口中的展示，密钥只在创建和轮换时返回
+type webhookView struct {
+	models.WebhookSubscription
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func newWebhookView(sub models.WebhookSubscription, withSecret bool) webhookView {
+	view := webhookView{WebhookSubscription: sub, Events: splitWebhookEvents(sub.Events)}
+	if withSecret {
+		view.Secret = sub.Secret
+	}
+	return view
+}
+
+func splitWebhookEvents(events string) []string {
+	var list []string
+	for _, event := range webhook.Events {
+		if webhook.Subscribed(events, event) {
+			list = append(list, event)
+		}
+	}
+	return list
+}
+
+func webhookAuditTarget(id uint) string {
+	return "webhook:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// CreateWebhookInput 创建webhook订阅的输入
+type CreateWebhookInput struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Secret      string   `json:"secret" binding:"omitempty,min=16,max=128"` // 为空时自动生成
+	Description string   `json:"description"`
+}
+
+// UpdateWebhookInput 修改webhook订阅的输入，未提供的字段保持不变
+type UpdateWebhookInput struct {
+	URL          *string  `json:"url"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"`
+	Description  *string  `json:"description"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// GetWebhooks 查询webhook订阅和投递队列统计
+func GetWebhooks(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Order("id asc").Find(&subscriptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询webhook订阅失败"})
+		return
+	}
+
+	views := make([]webhookView, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		views = append(views, newWebhookView(sub, false))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": views,
+		"events":   webhook.Events,
+		"queue":    webhookQueue.Stats(c.Request.Context()),
+	})
+}
+
+// CreateWebhook 创建webhook订阅
+func CreateWebhook(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	var input CreateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhook.ValidateURL(input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := webhook.NormalizeEvents(input.Events)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		secret = webhook.NewSecret()
+	}
+	sub := models.WebhookSubscription{
+		URL:         input.URL,
+		Events:      events,
+		Secret:      secret,
+		Active:      true,
+		Description: input.Description,
+		CreatedBy:   auditActor(c),
+	}
+	if err := database.DB.Create(&sub).Error; err != nil {
+		log.Printf("创建webhook订阅失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建webhook订阅失败"})
+		return
+	}
+
+	recordAudit(c, AuditActionWebhookCreate, webhookAuditTarget(sub.ID), nil, newWebhookView(sub, false))
+	log.Printf("webhook订阅已创建: ID=%d, URL=%s, 事件=%s", sub.ID, sub.URL, sub.Events)
+
+	c.JSON(http.StatusCreated, newWebhookView(sub, true))
+}
+
+// loadWebhook 按路径参数读取webhook订阅，失败时已写入响应
+func loadWebhook(c *gin.Context) (*models.WebhookSubscription, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的webhook ID"})
+		return nil, false
+	}
+
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook订阅未找到"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取webhook订阅失败"})
+		}
+		return nil, false
+	}
+	return &sub, true
+}
+
+// UpdateWebhook 修改webhook订阅，rotate_secret为true时生成新密钥并返回
+func UpdateWebhook(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	var input UpdateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := newWebhookView(*sub, false)
+	updates := map[string]interface{}{}
+	if input.URL != nil {
+		if err := webhook.ValidateURL(*input.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["url"] = *input.URL
+	}
+	if input.Events != nil {
+		events, err := webhook.NormalizeEvents(input.Events)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["events"] = events
+	}
+	if input.Active != nil {
+		updates["active"] = *input.Active
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.RotateSecret {
+		updates["secret"] = webhook.NewSecret()
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有需要修改的字段"})
+		return
+	}
+
+	if err := database.DB.Model(sub).Updates(updates).Error; err != nil {
+		log.Printf("修改webhook订阅失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改webhook订阅失败"})
+		return
+	}
+	if err := database.DB.First(sub, sub.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取webhook订阅失败"})
+		return
+	}
+
+	recordAudit(c, AuditActionWebhookUpdate, webhookAuditTarget(sub.ID), before, newWebhookView(*sub, false))
+	c.JSON(http.StatusOK, newWebhookView(*sub, input.RotateSecret))
+}
+
+// DeleteWebhook 删除webhook订阅，队列中尚未投递的通知会被放弃
+func DeleteWebhook(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(sub).Error; err != nil {
+		log.Printf("删除webhook订阅失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除webhook订阅失败"})
+		return
+	}
+
+	recordAudit(c, AuditActionWebhookDelete, webhookAuditTarget(sub.ID), newWebhookView(*sub, false), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "webhook订阅已删除"})
+}
+
+// GetWebhookDeadLetters 查询重试耗尽或被接收方拒绝的投递
+// 支持的查询参数: subscription_id
+func GetWebhookDeadLetters(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	var subscriptionID uint64
+	if idStr := c.Query("subscription_id"); idStr != "" {
+		var err error
+		if subscriptionID, err = strconv.ParseUint(idStr, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的webhook ID"})
+			return
+		}
+	}
+
+	jobs, err := webhookQueue.DeadLetters(c.Request.Context())
+	if err != nil {
+		log.Printf("查询webhook死信失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询webhook死信失败"})
+		return
+	}
+
+	filtered := make([]*mq.WebhookJob, 0, len(jobs))
+	for _, job := range jobs {
+		if subscriptionID == 0 || job.SubscriptionID == uint(subscriptionID) {
+			filtered = append(filtered, job)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(filtered), "dead_letters": filtered})
+}
+
+// RetryWebhookDeadLetter 将死信重新加入投递队列
+func RetryWebhookDeadLetter(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	found, err := webhookQueue.RetryDeadLetter(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("重新投递webhook死信失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信未找到"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "已重新加入投递队列", "id": c.Param("id")})
+}
+
+// DeleteWebhookDeadLetter 删除死信
+func DeleteWebhookDeadLetter(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	found, err := webhookQueue.DeleteDeadLetter(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("删除webhook死信失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除死信失败"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信未找到"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "死信已删除"})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/models"
+	"realtime-voting-backend/mq"
+	"realtime-voting-backend/webhook"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// receivedWebhook is one request captured by a test receiver.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	event  webhook.Event
+}
+
+// webhookReceiver answers with failStatus for the first `failures` requests and 200 afterwards.
+type webhookReceiver struct {
+	*httptest.Server
+	failures   int64
+	failStatus int
+	received   chan receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, failures int64, failStatus int) *webhookReceiver {
+	r := &webhookReceiver{failures: failures, failStatus: failStatus, received: make(chan receivedWebhook, 32)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var event webhook.Event
+		json.Unmarshal(body, &event)
+		r.received <- receivedWebhook{header: req.Header.Clone(), body: body, event: event}
+		if atomic.AddInt64(&r.failures, -1) >= 0 {
+			w.WriteHeader(r.failStatus)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) next(t *testing.T) receivedWebhook {
+	select {
+	case got := <-r.received:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+		return receivedWebhook{}
+	}
+}
+
+// startTestWebhookQueue replaces the delivery queue with a fast in-memory one for the test.
+func startTestWebhookQueue(t *testing.T, db *gorm.DB) {
+	db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.WebhookSubscription{})
+
+	previous := webhookQueue
+	ctx, cancel := context.WithCancel(context.Background())
+	webhookQueue = mq.NewWebhookQueue(mq.NewMemoryWebhookStore(), deliverWebhook, mq.WebhookQueueOptions{
+		Workers:     2,
+		MaxAttempts: 3,
+		BaseDelay:   20 * time.Millisecond,
+		MaxDelay:    50 * time.Millisecond,
+		PollEvery:   10 * time.Millisecond,
+	})
+	webhookQueue.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		webhookQueue = previous
+		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.WebhookSubscription{})
+	})
+}
+
+func createTestWebhook(t *testing.T, router *gin.Engine, url string, events ...string) webhookView {
+	w := performJSON(router, "POST", "/api/admin/webhooks?admin_key=admin123", gin.H{"url": url, "events": events})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var view webhookView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &view))
+	return view
+}
+
+func TestWebhooks_SignedDeliveryWithRetry(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	startTestWebhookQueue(t, db)
+
+	receiver := newWebhookReceiver(t, 2, http.StatusServiceUnavailable)
+	sub := createTestWebhook(t, router, receiver.URL, webhook.EventPollCreated, webhook.EventPollClosed)
+	require.NotEmpty(t, sub.Secret)
+	assert.Equal(t, []string{webhook.EventPollCreated, webhook.EventPollClosed}, sub.Events)
+
+	// The secret is only shown once
+	w := performJSON(router, "GET", "/api/admin/webhooks?admin_key=admin123", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), sub.Secret)
+
+	w = performJSON(router, "POST", "/api/polls", gin.H{"question": "Hooked?", "options": []gin.H{{"text": "A"}, {"text": "B"}}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var poll models.Poll
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &poll))
+
+	// Two 503s are retried with the same delivery ID until the receiver accepts
+	first := receiver.next(t)
+	receiver.next(t)
+	final := receiver.next(t)
+	assert.Equal(t, first.header.Get(webhook.HeaderDelivery), final.header.Get(webhook.HeaderDelivery))
+	assert.Equal(t, webhook.EventPollCreated, final.header.Get(webhook.HeaderEvent))
+	assert.Equal(t, webhook.EventPollCreated, final.event.Type)
+	assert.Equal(t, poll.ID, final.event.PollID)
+
+	timestamp, err := strconv.ParseInt(final.header.Get(webhook.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.True(t, webhook.Verify(sub.Secret, timestamp, final.body, final.header.Get(webhook.HeaderSignature), time.Minute, time.Now()))
+
+	// Closing the poll sends the final results
+	w = performJSON(router, "PUT", fmt.Sprintf("/api/polls/%d", poll.ID), gin.H{"is_active": false})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	closed := receiver.next(t)
+	assert.Equal(t, webhook.EventPollClosed, closed.event.Type)
+	data := closed.event.Data.(map[string]interface{})
+	assert.Equal(t, "manual", data["reason"])
+	assert.Len(t, data["results"], 2)
+
+	// Events the subscription did not ask for are not delivered
+	w = performJSON(router, "PUT", fmt.Sprintf("/api/polls/%d", poll.ID), gin.H{"is_active": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	select {
+	case got := <-receiver.received:
+		t.Fatalf("unexpected delivery: %s", got.event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhooks_DeadLetters(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	startTestWebhookQueue(t, db)
+
+	poll := models.Poll{Question: "Dead letters?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+
+	// Every attempt fails until the receiver recovers
+	receiver := newWebhookReceiver(t, 3, http.StatusInternalServerError)
+	sub := createTestWebhook(t, router, receiver.URL, webhook.EventVoteThreshold)
+	rejecting := newWebhookReceiver(t, 1000, http.StatusGone)
+	createTestWebhook(t, router, rejecting.URL, webhook.EventVoteThreshold)
+
+	previous := webhookThresholds
+	webhookThresholds = []int64{2, 5}
+	defer func() { webhookThresholds = previous }()
+	resetVoteThresholds(poll.ID)
+
+	// Only newly reached thresholds fire, once each
+	checkVoteThresholds(poll.ID, []PollOptionResult{{Votes: 1}, {Votes: 2}})
+	checkVoteThresholds(poll.ID, []PollOptionResult{{Votes: 2}, {Votes: 2}})
+	for i := 0; i < 3; i++ {
+		got := receiver.next(t)
+		assert.Equal(t, float64(2), got.event.Data.(map[string]interface{})["threshold"])
+	}
+	// A 410 is not retried
+	rejecting.next(t)
+
+	var dead struct {
+		Total       int              `json:"total"`
+		DeadLetters []*mq.WebhookJob `json:"dead_letters"`
+	}
+	require.Eventually(t, func() bool {
+		w := performJSON(router, "GET", "/api/admin/webhooks/dead-letters?admin_key=admin123", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dead))
+		return dead.Total == 2
+	}, 2*time.Second, 20*time.Millisecond)
+
+	w := performJSON(router, "GET", fmt.Sprintf("/api/admin/webhooks/dead-letters?admin_key=admin123&subscription_id=%d", sub.ID), nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dead))
+	require.Equal(t, 1, dead.Total)
+	job := dead.DeadLetters[0]
+	assert.Equal(t, 3, job.Attempts)
+	assert.Contains(t, job.LastError, "500")
+	assert.Equal(t, webhook.EventVoteThreshold, job.Event)
+
+	// Retrying a dead letter delivers it again once the receiver is healthy
+	w = performJSON(router, "POST", "/api/admin/webhooks/dead-letters/"+job.ID+"/retry?admin_key=admin123", nil)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	got := receiver.next(t)
+	assert.Equal(t, job.ID, got.header.Get(webhook.HeaderDelivery))
+
+	w = performJSON(router, "POST", "/api/admin/webhooks/dead-letters/"+job.ID+"/retry?admin_key=admin123", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performJSON(router, "GET", "/api/admin/webhooks/dead-letters?admin_key=admin123", nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dead))
+	require.Equal(t, 1, dead.Total)
+	w = performJSON(router, "DELETE", "/api/admin/webhooks/dead-letters/"+dead.DeadLetters[0].ID+"?admin_key=admin123", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The second threshold fires when reached
+	checkVoteThresholds(poll.ID, []PollOptionResult{{Votes: 5}})
+	got = receiver.next(t)
+	assert.Equal(t, float64(5), got.event.Data.(map[string]interface{})["threshold"])
+}
+
+func TestWebhooks_Validation(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	startTestWebhookQueue(t, db)
+
+	w := performJSON(router, "POST", "/api/admin/webhooks", gin.H{"url": "https://example.com/hook", "events": []string{"poll.created"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performJSON(router, "POST", "/api/admin/webhooks?admin_key=admin123", gin.H{"url": "ftp://example.com", "events": []string{"poll.created"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(router, "POST", "/api/admin/webhooks?admin_key=admin123", gin.H{"url": "https://example.com/hook", "events": []string{"poll.deleted"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	sub := createTestWebhook(t, router, "https://example.com/hook", webhook.EventPollReset)
+	w = performJSON(router, "PUT", fmt.Sprintf("/api/admin/webhooks/%d?admin_key=admin123", sub.ID), gin.H{"active": false, "rotate_secret": true})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated webhookView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.False(t, updated.Active)
+	assert.NotEmpty(t, updated.Secret)
+	assert.NotEqual(t, sub.Secret, updated.Secret)
+
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/admin/webhooks/%d?admin_key=admin123", sub.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/admin/webhooks/%d?admin_key=admin123", sub.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestClaimThresholdKey_RedisIsSourceOfTruth(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	key := webhookThresholdKey(9001, 100)
+	t.Cleanup(func() { webhookThresholdsFired.Delete(key) })
+
+	// A stale local record does not block the claim while Redis is reachable
+	webhookThresholdsFired.Store(key, true)
+	assert.True(t, claimThresholdKey(client, key))
+	assert.False(t, claimThresholdKey(client, key))
+
+	// Another instance reset the poll and cleared the key
+	server.Del(key)
+	assert.True(t, claimThresholdKey(client, key))
+
+	// Without Redis the local record deduplicates
+	webhookThresholdsFired.Delete(key)
+	assert.True(t, claimThresholdKey(nil, key))
+	assert.False(t, claimThresholdKey(nil, key))
+}
@@ -2,11 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
-	"math"
 	"net/http"
+	"os"
 	"realtime-voting-backend/cache"
+	"realtime-voting-backend/fanout"
+	"realtime-voting-backend/livefeed"
 	"realtime-voting-backend/models"
 	"strconv"
 	"sync"
@@ -17,45 +18,59 @@ import (
 )
 
 // Hub 管理WebSocket连接的中心
+// 一个连接可以订阅多个投票，clients按投票ID索引订阅了该投票的连接
+// clients、conns和Client.polls只在run循环中修改，外部读取时需持有mu
 type Hub struct {
 	// 分组存储的客户端连接，按投票ID组织
 	clients map[uint]map[*Client]bool
 
+	// 所有已注册的连接
+	conns map[*Client]bool
+
 	// 添加新客户端的注册通道
 	register chan *Client
 
 	// 删除客户端的注销通道
 	unregister chan *Client
 
+	// 订阅、取消订阅和回复等客户端请求
+	control chan *clientRequest
+
 	// 广播特定投票的更新消息
 	broadcast chan *BroadcastMessage
 
 	// 锁，用于保护clients字典
 	mu sync.RWMutex
 
-	// 用于跟踪每个投票的连接数
-	pollConnections map[uint]int
-
 	// 定期清理过期连接
 	expireTicker *time.Ticker
 
 	// 最大连接数限制
 	maxConnections int
 
+	// 每个连接最多订阅的投票数
+	maxSubscriptions int
+
 	// 当前连接总数
 	totalConnections int
 
-	// 消息历史缓存，用于新连接时的初始同步和重试
-	messageHistory map[uint]map[string][]byte
-
-	// 消息历史锁
-	historyMu sync.RWMutex
+	// 带序号的消息历史，用于新连接的初始同步和断线重连后的补发
+	history *livefeed.History
 
-	// 历史消息保留时间
-	historyRetention time.Duration
+	// 增量编码器，为增量模式的客户端生成VOTE_DELTA消息
+	deltas *livefeed.DeltaEncoder
 
 	// 消息清理计时器
 	historyCleanupTicker *time.Ticker
+
+	// 发送队列已满时的处理策略，以及block策略每次广播最长的等待时间
+	slowPolicy  livefeed.SlowConsumerPolicy
+	sendTimeout time.Duration
+
+	// 慢消费者统计，原子操作读写
+	slowDisconnects int64
+	droppedMessages int64
+	blockedNanos    int64
 }
 
 // Client 表示一个WebSocket客户端连接
@@ -66,33 +81,76 @@ type Client struct {
 	// WebSocket连接
 	conn *websocket.Conn
 
-	// 发送消息的通道
+	// 发送消息的通道，只由Hub写入和关闭
 	send chan []byte
 
-	// 客户端关注的投票ID
-	pollID uint
+	// 订阅的投票ID
+	polls map[uint]bool
+
+	// 按投票URL连接时的初始订阅，注册时一并处理
+	initial *clientRequest
 
 	// 客户端上次活动时间
 	lastActivity time.Time
 
 	// 是否为keepalive连接
 	isKeepalive bool
+
+	// 是否只接收增量更新
+	deltaMode bool
+
+	// 连接建立时的客户端IP和User-Agent，通过WebSocket投票时使用
+	clientIP  string
+	userAgent string
+
+	// 握手时通过子协议协商的消息编码
+	format wsFormat
+
+	// 发送队列的积压统计
+	lag livefeed.LagTracker
+
+	// 访问令牌，过期时关闭连接
+	auth clientAuth
 }
 
 // BroadcastMessage 定义广播消息的结构
 type BroadcastMessage struct {
 	PollID  uint        `json:"poll_id"`
+	Seq     uint64      `json:"seq"`
 	Results interface{} `json:"results"`
+
+	// 临时消息（如在线人数）不写入历史，也不参与增量编码
+	Transient bool `json:"transient,omitempty"`
+}
+
+// 每个投票保留的历史更新条数和保留时间，超出范围的重连客户端会收到完整快照
+const (
+	wsHistorySize      = 200
+	wsHistoryRetention = 5 * time.Minute
+)
+
+// 客户端连接时通过mode参数选择的更新模式
+const (
+	UpdateModeSnapshot = "snapshot" // 每次更新发送完整结果（默认）
+	UpdateModeDelta    = "delta"    // 只发送票数变化的选项，定期发送完整结果作为关键帧
+)
+
+// wsKeyframeInterval 从环境变量WS_KEYFRAME_INTERVAL读取关键帧间隔，默认每20个增量一次
+func wsKeyframeInterval() int {
+	if n, err := strconv.Atoi(os.Getenv("WS_KEYFRAME_INTERVAL")); err == nil && n > 0 {
+		return n
+	}
+	return 20
 }
 
 // 定义WebSocket升级器
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// 允许所有CORS请求，生产环境应限制
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	// 客户端同时支持两种编码时优先使用JSON，只请求msgpack时使用MessagePack
+	Subprotocols: []string{SubprotocolJSON, SubprotocolMsgpack},
+	// 只允许STREAM_ALLOWED_ORIGINS中的页面来源，未配置时只允许同域页面
+	CheckOrigin: checkStreamOrigin,
 }
 
 // 全局Hub实例
@@ -105,22 +163,31 @@ var (
 func init() {
 	// 确保Hub只被初始化一次
 	hubOnce.Do(func() {
-		GlobalHub = &Hub{
-			clients:              make(map[uint]map[*Client]bool),
-			register:             make(chan *Client),
-			unregister:           make(chan *Client),
-			broadcast:            make(chan *BroadcastMessage),
-			pollConnections:      make(map[uint]int),
-			expireTicker:         time.NewTicker(5 * time.Minute),
-			maxConnections:       10000, // 默认最大连接数
-			messageHistory:       make(map[uint]map[string][]byte),
-			historyRetention:     5 * time.Minute, // 保留消息历史5分钟
-			historyCleanupTicker: time.NewTicker(1 * time.Minute),
-		}
+		GlobalHub = newHub()
 		go GlobalHub.run()
 	})
 }
 
+// newHub 按环境变量配置创建Hub
+func newHub() *Hub {
+	return &Hub{
+		clients:              make(map[uint]map[*Client]bool),
+		conns:                make(map[*Client]bool),
+		register:             make(chan *Client),
+		unregister:           make(chan *Client),
+		control:              make(chan *clientRequest),
+		broadcast:            make(chan *BroadcastMessage),
+		expireTicker:         time.NewTicker(5 * time.Minute),
+		maxConnections:       10000, // 默认最大连接数
+		maxSubscriptions:     wsMaxSubscriptions(),
+		history:              livefeed.NewHistory(wsHistorySize, wsHistoryRetention),
+		deltas:               livefeed.NewDeltaEncoder(wsKeyframeInterval()),
+		historyCleanupTicker: time.NewTicker(1 * time.Minute),
+		slowPolicy:           wsSlowConsumerPolicy(),
+		sendTimeout:          wsSendTimeout(),
+	}
+}
+
 // run 运行Hub处理循环
 func (h *Hub) run() {
 	for {
@@ -128,104 +195,37 @@ func (h *Hub) run() {
 		case client := <-h.register:
 			// 注册新客户端
 			h.mu.Lock()
-			// 初始化该投票的客户端映射（如果不存在）
-			if _, ok := h.clients[client.pollID]; !ok {
-				h.clients[client.pollID] = make(map[*Client]bool)
-				h.pollConnections[client.pollID] = 0
-			}
-
-			// 添加客户端并更新计数
-			h.clients[client.pollID][client] = true
-			h.pollConnections[client.pollID]++
+			h.conns[client] = true
 			h.totalConnections++
-			connCount := h.pollConnections[client.pollID]
 			totalCount := h.totalConnections
 			h.mu.Unlock()
 
-			log.Printf("新WebSocket客户端已连接 [Poll ID: %d, 连接数: %d, 总连接: %d]",
-				client.pollID, connCount, totalCount)
+			log.Printf("新WebSocket客户端已连接 [总连接: %d]", totalCount)
 
-			// 发送历史消息以确保新客户端同步到最新状态
-			h.sendHistoryToClient(client)
+			// 按投票URL连接的客户端同时订阅该投票
+			if client.initial != nil {
+				h.handleRequest(client.initial)
+				client.initial = nil
+			}
 
 		case client := <-h.unregister:
 			// 注销客户端
 			h.mu.Lock()
-			// 检查该投票的客户端映射是否存在
-			if _, ok := h.clients[client.pollID]; ok {
-				// 检查该客户端是否在映射中
-				if _, ok := h.clients[client.pollID][client]; ok {
-					// 删除客户端
-					delete(h.clients[client.pollID], client)
-					h.pollConnections[client.pollID]--
-					h.totalConnections--
-
-					// 关闭客户端发送通道
-					close(client.send)
-
-					log.Printf("WebSocket客户端已断开 [Poll ID: %d, 连接数: %d]",
-						client.pollID, h.pollConnections[client.pollID])
-
-					// 如果该投票没有连接了，清理映射
-					if len(h.clients[client.pollID]) == 0 {
-						delete(h.clients, client.pollID)
-						delete(h.pollConnections, client.pollID)
-					}
-				}
+			if h.conns[client] {
+				h.removeClientLocked(client)
+				log.Printf("WebSocket客户端已断开 [总连接: %d]", h.totalConnections)
 			}
 			h.mu.Unlock()
 
-		case message := <-h.broadcast:
-			// 广播消息给关注特定投票的所有客户端
-			h.mu.RLock()
-			clients := h.clients[message.PollID]
-			clientCount := len(clients)
-			h.mu.RUnlock()
-
-			// 将结果序列化为JSON
-			data, err := json.Marshal(message.Results)
-			if err != nil {
-				log.Printf("序列化广播消息失败: %v", err)
-				continue
-			}
-
-			// 存储消息到历史记录
-			h.storeMessageInHistory(message.PollID, data)
-
-			// 如果没有客户端，直接跳过广播但保留历史
-			if clientCount == 0 {
-				log.Printf("没有已连接的客户端接收广播 [Poll ID: %d], 已将消息保存到历史", message.PollID)
-				continue
-			}
+		case req := <-h.control:
+			h.handleRequest(req)
 
-			// 计数成功发送和失败的客户端
-			successCount := 0
-			failureCount := 0
-
-			// 广播给所有关注该投票的客户端
-			h.mu.RLock()
-			for client := range clients {
-				select {
-				case client.send <- data:
-					// 消息发送成功
-					successCount++
-				default:
-					// 客户端缓冲区已满，关闭连接
-					failureCount++
-					close(client.send)
-					delete(h.clients[message.PollID], client)
-					h.pollConnections[message.PollID]--
-					h.totalConnections--
-				}
-			}
-			h.mu.RUnlock()
-
-			log.Printf("广播更新到 %d 个WebSocket客户端 [Poll ID: %d], 成功: %d, 失败: %d",
-				clientCount, message.PollID, successCount, failureCount)
+		case message := <-h.broadcast:
+			h.broadcastMessage(message)
 
 		case <-h.historyCleanupTicker.C:
 			// 清理过期的历史消息
-			h.cleanupOldMessages()
+			h.history.Cleanup(time.Now())
 
 		case <-h.expireTicker.C:
 			// 清理长时间不活跃的连接
@@ -233,22 +233,11 @@ func (h *Hub) run() {
 			timeout := 30 * time.Minute
 
 			h.mu.Lock()
-			for pollID, clients := range h.clients {
-				for client := range clients {
-					if client.lastActivity.Add(timeout).Before(now) {
-						log.Printf("关闭不活跃的WebSocket连接 [Poll ID: %d, 不活跃时间: %v]",
-							pollID, now.Sub(client.lastActivity))
-						delete(clients, client)
-						h.pollConnections[pollID]--
-						h.totalConnections--
-						close(client.send)
-					}
-				}
-
-				// 如果该投票没有连接了，清理映射
-				if len(clients) == 0 {
-					delete(h.clients, pollID)
-					delete(h.pollConnections, pollID)
+			for client := range h.conns {
+				if client.lastActivity.Add(timeout).Before(now) {
+					log.Printf("关闭不活跃的WebSocket连接 [订阅数: %d, 不活跃时间: %v]",
+						len(client.polls), now.Sub(client.lastActivity))
+					h.removeClientLocked(client)
 				}
 			}
 			h.mu.Unlock()
@@ -256,104 +245,202 @@ func (h *Hub) run() {
 	}
 }
 
-// 在历史记录中存储消息
-func (h *Hub) storeMessageInHistory(pollID uint, data []byte) {
-	h.historyMu.Lock()
-	defer h.historyMu.Unlock()
+// broadcastMessage 广播消息给关注特定投票的所有客户端，只能在run循环中调用
+func (h *Hub) broadcastMessage(message *BroadcastMessage) {
+	// 将结果序列化为JSON，其他编码在有对应客户端时各编码一次
+	data, err := json.Marshal(message.Results)
+	if err != nil {
+		log.Printf("序列化广播消息失败: %v", err)
+		return
+	}
+	var typed interface{}
+	if _, raw := message.Results.(json.RawMessage); !raw {
+		typed = message.Results
+	}
+	frames := newWSFrames(typed, data)
+
+	deltaFrames := frames
+	if !message.Transient {
+		// 存储消息到历史记录
+		h.history.Append(message.PollID, message.Seq, data)
+		longPollWaiters.Notify(message.PollID)
+		grpcWatchers.Notify(message.PollID)
+
+		// 增量模式客户端的消息，nil表示无需发送
+		deltaFrames = h.encodeDelta(message, frames)
+	}
+
+	// 复制订阅者列表，断开慢客户端会修改订阅索引
+	clients := make([]*Client, 0, len(h.clients[message.PollID]))
+	for client := range h.clients[message.PollID] {
+		clients = append(clients, client)
+	}
+
+	// 如果没有客户端，直接跳过广播但保留历史
+	if len(clients) == 0 {
+		if !message.Transient {
+			log.Printf("没有已连接的客户端接收广播 [Poll ID: %d], 已将消息保存到历史", message.PollID)
+		}
+		return
+	}
 
-	if _, ok := h.messageHistory[pollID]; !ok {
-		h.messageHistory[pollID] = make(map[string][]byte)
+	// 丢弃旧消息时，历史中的最新结果可以代替本条更新；临时消息没有写入历史，需要原样发送
+	supersededBy := message.PollID
+	if message.Transient {
+		supersededBy = 0
 	}
 
-	// 使用时间戳作为消息唯一标识
-	messageID := fmt.Sprintf("%d", time.Now().UnixNano())
-	h.messageHistory[pollID][messageID] = data
+	// block策略下整次广播共用一个截止时间，慢客户端再多也不会让Hub等待超过sendTimeout
+	deadline := time.Now().Add(h.sendTimeout)
 
-	// 限制每个投票的历史消息数量
-	const maxHistoryPerPoll = 5
-	if len(h.messageHistory[pollID]) > maxHistoryPerPoll {
-		// 找到最旧的消息并删除
-		var oldestID string
-		var oldestTime int64 = math.MaxInt64
+	// 计数成功发送和失败的客户端
+	successCount := 0
+	var slow []*Client
 
-		for id := range h.messageHistory[pollID] {
-			// 尝试将ID解析为时间戳
-			if ts, err := strconv.ParseInt(id, 10, 64); err == nil {
-				if ts < oldestTime {
-					oldestTime = ts
-					oldestID = id
-				}
+	// 广播给所有关注该投票的客户端
+	for _, client := range clients {
+		source := frames
+		if client.deltaMode {
+			if deltaFrames == nil {
+				continue
 			}
+			source = deltaFrames
 		}
+		payload := source.get(client.format)
+		if payload == nil {
+			continue
+		}
+
+		if h.deliver(client, supersededBy, payload, deadline) {
+			successCount++
+		} else {
+			// 客户端跟不上，遍历结束后关闭连接
+			slow = append(slow, client)
+		}
+	}
 
-		if oldestID != "" {
-			delete(h.messageHistory[pollID], oldestID)
+	if len(slow) > 0 {
+		h.mu.Lock()
+		for _, client := range slow {
+			h.removeClientLocked(client)
 		}
+		h.mu.Unlock()
 	}
+
+	log.Printf("广播更新到 %d 个WebSocket客户端 [Poll ID: %d], 成功: %d, 失败: %d",
+		len(clients), message.PollID, successCount, len(slow))
 }
 
-// 发送历史消息给新客户端
-func (h *Hub) sendHistoryToClient(client *Client) {
-	h.historyMu.RLock()
-	defer h.historyMu.RUnlock()
+// removeClientLocked 删除连接及其全部订阅并关闭发送通道，调用方需持有mu
+func (h *Hub) removeClientLocked(client *Client) {
+	if !h.conns[client] {
+		return
+	}
+	for pollID := range client.polls {
+		h.removeSubscriptionLocked(client, pollID)
+	}
+	delete(h.conns, client)
+	h.totalConnections--
+	close(client.send)
+}
 
-	pollHistory, exists := h.messageHistory[client.pollID]
-	if !exists || len(pollHistory) == 0 {
+// removeSubscriptionLocked 取消连接对某个投票的订阅，调用方需持有mu
+func (h *Hub) removeSubscriptionLocked(client *Client, pollID uint) {
+	if !client.polls[pollID] {
 		return
 	}
+	delete(client.polls, pollID)
+	if clients, ok := h.clients[pollID]; ok {
+		delete(clients, client)
+		// 如果该投票没有连接了，清理映射
+		if len(clients) == 0 {
+			delete(h.clients, pollID)
+		}
+	}
+	presenceChanged(pollID)
+}
 
-	log.Printf("向新客户端发送 %d 条历史消息 [Poll ID: %d]", len(pollHistory), client.pollID)
+// pollConnectionCount 订阅某个投票的连接数
+func (h *Hub) pollConnectionCount(pollID uint) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[pollID])
+}
 
-	// 找到最新的消息发送给客户端
-	var newestMessage []byte
-	var newestTime int64 = 0
+// encodeDelta 为增量模式的客户端生成消息
+// 返回完整消息表示关键帧，返回nil表示票数没有变化或更新已过期
+func (h *Hub) encodeDelta(message *BroadcastMessage, frames *wsFrames) *wsFrames {
+	if message.Seq == 0 {
+		return frames
+	}
 
-	for id, data := range pollHistory {
-		// 尝试将ID解析为时间戳
-		if ts, err := strconv.ParseInt(id, 10, 64); err == nil {
-			if ts > newestTime {
-				newestTime = ts
-				newestMessage = data
-			}
-		}
+	var update wsResultsMessage
+	if err := json.Unmarshal(frames.get(wsFormatJSON), &update); err != nil {
+		log.Printf("解析更新消息失败，增量客户端将收到完整结果: %v", err)
+		return frames
 	}
 
-	if newestMessage != nil {
-		select {
-		case client.send <- newestMessage:
-			log.Printf("成功向新客户端发送最新状态 [Poll ID: %d]", client.pollID)
-		default:
-			log.Printf("无法向新客户端发送历史消息 [Poll ID: %d]", client.pollID)
-		}
+	options := make([]livefeed.OptionCount, len(update.Data.Options))
+	for i, option := range update.Data.Options {
+		options[i] = livefeed.OptionCount{ID: option.ID, Votes: option.Votes}
 	}
-}
 
-// 清理旧消息
-func (h *Hub) cleanupOldMessages() {
-	h.historyMu.Lock()
-	defer h.historyMu.Unlock()
+	delta, emit := h.deltas.Encode(message.PollID, message.Seq, options)
+	if !emit {
+		return nil
+	}
+	if delta.Keyframe {
+		return frames
+	}
 
-	cutoffTime := time.Now().Add(-h.historyRetention)
-	cutoffNano := cutoffTime.UnixNano()
+	deltaMessage := &wsDeltaMessage{
+		Type:    WSTypeVoteDelta,
+		Seq:     delta.Seq,
+		BaseSeq: delta.BaseSeq,
+		Data: wsDeltaData{
+			PollID:    message.PollID,
+			Changes:   delta.Changes,
+			Timestamp: update.Data.Timestamp,
+		},
+	}
+	deltaData, err := json.Marshal(deltaMessage)
+	if err != nil {
+		log.Printf("序列化增量消息失败: %v", err)
+		return frames
+	}
+	return newWSFrames(deltaMessage, deltaData)
+}
 
-	for pollID, messages := range h.messageHistory {
-		for id := range messages {
-			// 尝试将ID解析为时间戳
-			if ts, err := strconv.ParseInt(id, 10, 64); err == nil {
-				if ts < cutoffNano {
-					delete(messages, id)
-				}
-			}
-		}
+// historyForSubscription 订阅时需要补发的历史消息
+// 断线重连的客户端补发错过的全部更新，新订阅只发送最新状态
+// 增量模式的客户端只需要最新的完整结果作为关键帧
+func (h *Hub) historyForSubscription(client *Client, pollID uint, since *uint64) [][]byte {
+	var messages [][]byte
 
-		// 如果该投票没有历史消息了，删除该投票的条目
-		if len(messages) == 0 {
-			delete(h.messageHistory, pollID)
+	if client.deltaMode {
+		latest, ok := h.history.Latest(pollID)
+		if ok && (since == nil || latest.Seq > *since) {
+			messages = append(messages, latest.Data)
+		}
+	} else if since != nil {
+		entries, ok := h.history.Since(pollID, *since)
+		if !ok {
+			log.Printf("无法补发历史消息，客户端将通过序号检测到缺失 [Poll ID: %d, since: %d]",
+				pollID, *since)
+			return nil
 		}
+		for _, entry := range entries {
+			messages = append(messages, entry.Data)
+		}
+	} else if latest, ok := h.history.Latest(pollID); ok {
+		messages = append(messages, latest.Data)
 	}
+
+	return messages
 }
 
 // HandleWebSocket 处理WebSocket连接
+// 按投票URL连接等同于连接/api/ws后订阅该投票，连接后仍可发送SUBSCRIBE订阅其他投票
 func HandleWebSocket(c *gin.Context) {
 	// 获取投票ID
 	pollIDStr := c.Param("id")
@@ -363,17 +450,30 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// 检查是否有keepalive参数
-	keepalive := c.Query("keepalive") == "true"
+	keepalive, deltaMode, ok := parseWebSocketOptions(c)
+	if !ok {
+		return
+	}
 
-	// 检查连接数量是否达到上限
-	GlobalHub.mu.RLock()
-	if GlobalHub.totalConnections >= GlobalHub.maxConnections {
-		GlobalHub.mu.RUnlock()
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器连接已达上限，请稍后重试"})
+	claims, ok := authorizeStream(c, wsStreamToken(c), uint(pollID))
+	if !ok {
+		return
+	}
+
+	// 断线重连时客户端携带已收到的最大序号
+	var since *uint64
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		value, err := strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的since参数"})
+			return
+		}
+		since = &value
+	}
+
+	if !checkConnectionLimit(c) {
 		return
 	}
-	GlobalHub.mu.RUnlock()
 
 	// 打印连接详情
 	log.Printf("正在建立WebSocket连接 [Poll ID: %d, keepalive: %v]", pollID, keepalive)
@@ -386,29 +486,78 @@ func HandleWebSocket(c *gin.Context) {
 	}
 
 	// 创建新客户端
-	client := &Client{
+	client := newClient(c, conn, keepalive, deltaMode)
+	client.setAuth(claims)
+
+	// 按投票URL连接的初始订阅，不回复SUBSCRIBED以兼容旧客户端
+	client.initial, err = prepareSubscription(client, uint(pollID), since, false)
+	if err != nil {
+		log.Printf("发送投票快照失败 [Poll ID: %d]: %v", pollID, err)
+		conn.Close()
+		return
+	}
+	client.initial.silent = true
+
+	serveClient(client)
+}
+
+// parseWebSocketOptions 解析keepalive和mode参数，参数无效时返回400
+func parseWebSocketOptions(c *gin.Context) (keepalive bool, deltaMode bool, ok bool) {
+	// 检查是否有keepalive参数
+	keepalive = c.Query("keepalive") == "true"
+
+	// 更新模式：snapshot（默认）或delta
+	mode := c.DefaultQuery("mode", UpdateModeSnapshot)
+	if mode != UpdateModeSnapshot && mode != UpdateModeDelta {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的mode参数，可选值为snapshot或delta"})
+		return false, false, false
+	}
+	return keepalive, mode == UpdateModeDelta, true
+}
+
+// checkConnectionLimit 检查连接数量是否达到上限，达到上限时返回503
+func checkConnectionLimit(c *gin.Context) bool {
+	GlobalHub.mu.RLock()
+	defer GlobalHub.mu.RUnlock()
+	if GlobalHub.totalConnections >= GlobalHub.maxConnections {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器连接已达上限，请稍后重试"})
+		return false
+	}
+	return true
+}
+
+// newClient 创建新客户端
+func newClient(c *gin.Context, conn *websocket.Conn, keepalive bool, deltaMode bool) *Client {
+	return &Client{
 		hub:          GlobalHub,
 		conn:         conn,
 		send:         make(chan []byte, 256),
-		pollID:       uint(pollID),
+		polls:        make(map[uint]bool),
 		lastActivity: time.Now(),
 		isKeepalive:  keepalive, // 存储keepalive状态
+		deltaMode:    deltaMode,
+		clientIP:     c.ClientIP(),
+		userAgent:    c.Request.UserAgent(),
+		format:       negotiatedFormat(conn),
 	}
+}
 
+// serveClient 注册客户端并启动读写循环
+func serveClient(client *Client) {
 	// 设置更长的连接保持时间，如果请求了keepalive
-	if keepalive {
+	if client.isKeepalive {
 		// 在投票后保持活跃的连接设置为3小时
 		client.conn.SetReadDeadline(time.Now().Add(3 * time.Hour))
 
 		// 发送欢迎消息，通知客户端连接已建立
-		welcomeMsg := map[string]interface{}{
-			"type":    "CONNECT_SUCCESS",
-			"message": "连接已建立，将接收实时更新",
+		welcomeMsg := wsControlMessage{
+			Type:    WSTypeConnectSuccess,
+			Message: "连接已建立，将接收实时更新",
 		}
 
-		if msgData, err := json.Marshal(welcomeMsg); err == nil {
-			// 直接写入消息，无需通过hub
-			client.conn.WriteMessage(websocket.TextMessage, msgData)
+		if msgData, err := encodeWSMessage(client.format, welcomeMsg); err == nil {
+			// 写循环尚未启动，直接写入消息，无需通过hub
+			client.conn.WriteMessage(client.format.frameType(), msgData)
 		}
 	}
 
@@ -421,121 +570,99 @@ func HandleWebSocket(c *gin.Context) {
 }
 
 // BroadcastPollUpdate 广播投票更新给所有关注该投票的客户端
+// 每条更新在这里分配投票内单调递增的序号，客户端据此检测丢失和乱序
 func BroadcastPollUpdate(pollID uint, results interface{}) {
+	formattedResults := formatPollResults(results)
+	seq := nextPollSeq(pollID)
+
+	// 创建符合前端预期的消息格式
+	formattedMessage := &wsResultsMessage{
+		Type: WSTypeVoteUpdate,
+		Seq:  seq,
+		Data: wsResultsData{
+			PollID:    pollID,
+			Options:   formattedResults,
+			Timestamp: time.Now().UnixNano(), // 添加时间戳以便客户端判断消息顺序
+		},
+	}
+
+	log.Printf("WebSocket广播投票更新: 投票ID=%d, 序号=%d, 选项数=%d",
+		pollID, seq, len(formattedResults))
+
+	// 推送给本实例的客户端，并通过Redis转发给其他实例
+	publishBroadcast(fanout.KindWebSocket, pollID, seq, formattedMessage)
+}
+
+// formatPollResults 将各种类型的投票结果统一转换为前端使用的选项数组
+// 百分比由前端计算，不发送
+func formatPollResults(results interface{}) []wsOption {
 	// 确保结果是一个数组格式，便于前端处理
-	var formattedResults []map[string]interface{}
+	var formattedResults []wsOption
 
 	// 处理不同类型的results输入
 	switch v := results.(type) {
 	case []PollOptionResult:
-		// 已经是PollOptionResult数组，转换为通用格式
-		formattedResults = make([]map[string]interface{}, len(v))
+		formattedResults = make([]wsOption, len(v))
 		for i, result := range v {
-			formattedResults[i] = map[string]interface{}{
-				"id":    result.ID,
-				"text":  result.Text,
-				"votes": result.Votes,
-				// 百分比由前端计算，不发送
-			}
+			formattedResults[i] = wsOption{ID: result.ID, Text: result.Text, Votes: result.Votes}
 		}
 	case []OptionResult:
-		// OptionResult数组，转换为通用格式
-		formattedResults = make([]map[string]interface{}, len(v))
+		formattedResults = make([]wsOption, len(v))
 		for i, result := range v {
-			formattedResults[i] = map[string]interface{}{
-				"id":    result.ID,
-				"text":  result.Text,
-				"votes": result.Votes,
-				// 百分比由前端计算，不发送
-			}
+			formattedResults[i] = wsOption{ID: result.ID, Text: result.Text, Votes: result.Votes}
 		}
 	case []models.PollOption:
-		// 原始PollOption数组，转换为通用格式
-		formattedResults = make([]map[string]interface{}, len(v))
+		// 原始PollOption数组
+		formattedResults = make([]wsOption, len(v))
 		for i, option := range v {
-			formattedResults[i] = map[string]interface{}{
-				"id":    option.ID,
-				"text":  option.Text,
-				"votes": option.Votes,
-			}
+			formattedResults[i] = wsOption{ID: option.ID, Text: option.Text, Votes: option.Votes}
 		}
 	case map[string]int64:
 		// 如果是从Redis获取的键值对，转换为数组
-		formattedResults = make([]map[string]interface{}, 0, len(v))
+		formattedResults = make([]wsOption, 0, len(v))
 		for optionID, count := range v {
 			// 转换optionID从字符串到数字
 			id, err := strconv.ParseUint(optionID, 10, 32)
 			if err != nil {
 				continue
 			}
-			formattedResults = append(formattedResults, map[string]interface{}{
-				"id":    uint(id),
-				"votes": count,
-			})
+			formattedResults = append(formattedResults, wsOption{ID: uint(id), Votes: count})
 		}
 	default:
 		// 如果无法识别类型，则记录日志但继续广播
 		log.Printf("WebSocket广播：无法识别的results类型: %T", results)
 
-		// 尝试使用反射遍历数组
-		if formattedResults == nil {
-			log.Printf("尝试使用通用方法处理结果: %v", results)
-			// 使用json序列化再反序列化为通用格式
-			data, err := json.Marshal(results)
-			if err == nil {
-				var genericResults []map[string]interface{}
-				if err := json.Unmarshal(data, &genericResults); err == nil {
-					formattedResults = genericResults
-				}
+		// 使用json序列化再反序列化为选项数组
+		data, err := json.Marshal(results)
+		if err == nil {
+			var genericResults []wsOption
+			if err := json.Unmarshal(data, &genericResults); err == nil {
+				formattedResults = genericResults
 			}
 		}
 	}
 
 	// 如果仍然无法格式化结果，使用空数组
 	if formattedResults == nil {
-		formattedResults = []map[string]interface{}{}
+		formattedResults = []wsOption{}
 	}
 
-	// 创建符合前端预期的消息格式
-	formattedMessage := map[string]interface{}{
-		"type": "VOTE_UPDATE",
-		"data": map[string]interface{}{
-			"poll_id":   pollID,
-			"options":   formattedResults,
-			"timestamp": time.Now().UnixNano(), // 添加时间戳以便客户端判断消息顺序
-		},
-	}
+	return formattedResults
+}
 
-	log.Printf("WebSocket广播投票更新: 投票ID=%d, 数据结构=%T, 选项数=%d",
-		pollID, formattedResults, len(formattedResults))
+// deliverLocalPollUpdate 将已格式化的更新消息推送给本实例的WebSocket客户端
+func deliverLocalPollUpdate(pollID uint, seq uint64, payload interface{}) {
+	pollSequencer.Observe(pollID, seq)
 
 	message := &BroadcastMessage{
 		PollID:  pollID,
-		Results: formattedMessage,
-	}
-
-	// 使用goroutine异步发送广播，避免阻塞主流程
-	go func() {
-		// 重试逻辑：如果广播失败，等待短暂时间后重试
-		maxRetries := 2
-		for retry := 0; retry <= maxRetries; retry++ {
-			select {
-			case GlobalHub.broadcast <- message:
-				if retry > 0 {
-					log.Printf("WebSocket广播成功 (重试 %d): Poll ID=%d", retry, pollID)
-				}
-				return
-			default:
-				if retry < maxRetries {
-					log.Printf("WebSocket广播通道已满，等待重试 (%d/%d): Poll ID=%d",
-						retry+1, maxRetries, pollID)
-					time.Sleep(time.Duration(20*(retry+1)) * time.Millisecond)
-				} else {
-					log.Printf("WebSocket广播失败，达到最大重试次数: Poll ID=%d", pollID)
-				}
-			}
-		}
-	}()
+		Seq:     seq,
+		Results: payload,
+	}
+
+	// 同步交给Hub，保证同一投票的更新按序号顺序进入历史和发送队列
+	// Hub处理循环不会阻塞在慢客户端上，广播频率由合并器限制
+	GlobalHub.broadcast <- message
 }
 
 // BroadcastPollUpdateStr 将投票更新广播给所有连接的客户端（支持字符串ID）
@@ -568,12 +695,13 @@ func BroadcastPollUpdateStr(pollIDStr string, results interface{}) {
 // 客户端读取循环
 func (c *Client) readPump() {
 	defer func() {
+		c.stopAuth()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
 	// 配置连接
-	c.conn.SetReadLimit(512) // 限制消息大小
+	c.conn.SetReadLimit(4096) // 限制消息大小，批量订阅时消息较长
 
 	// 根据keepalive标志设置超时时间
 	if c.isKeepalive {
@@ -611,22 +739,10 @@ func (c *Client) readPump() {
 		// 更新最后活动时间
 		c.lastActivity = time.Now()
 
-		// 处理客户端消息，特别是ping
-		if messageType == websocket.TextMessage {
-			var msg map[string]interface{}
-			if err := json.Unmarshal(message, &msg); err == nil {
-				// 检查是否为ping消息
-				if msgType, ok := msg["type"].(string); ok && msgType == "PING" {
-					// 回复一个pong消息
-					pongMsg := map[string]string{
-						"type": "PONG",
-						"time": time.Now().Format(time.RFC3339),
-					}
-					if pongData, err := json.Marshal(pongMsg); err == nil {
-						c.conn.WriteMessage(websocket.TextMessage, pongData)
-					}
-				}
-			}
+		// 处理客户端消息：PING、SUBSCRIBE、UNSUBSCRIBE和VOTE
+		// MessagePack连接的客户端消息可以是二进制帧，也可以是JSON文本帧
+		if messageType == websocket.TextMessage || messageType == websocket.BinaryMessage {
+			c.handleMessage(messageType, message)
 		}
 	}
 }
@@ -665,6 +781,14 @@ func (c *Client) writePump() {
 			// 更新最后活动时间
 			c.lastActivity = time.Now()
 
+			// MessagePack消息无法用换行分隔，每条消息单独一帧
+			if c.format == wsFormatMsgpack {
+				if err := c.writeBinaryFrames(message); err != nil {
+					return
+				}
+				continue
+			}
+
 			// 写入消息
 			w, err := c.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
@@ -673,15 +797,22 @@ func (c *Client) writePump() {
 			w.Write(message)
 
 			// 添加排队的消息
+			written := 1
 			n := len(c.send)
 			for i := 0; i < n; i++ {
+				queued, ok := c.nextQueued()
+				if !ok {
+					break
+				}
 				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+				w.Write(queued)
+				written++
 			}
 
 			if err := w.Close(); err != nil {
 				return
 			}
+			c.lag.Delivered(written, time.Now())
 
 		case <-ticker.C:
 			// 发送ping保持连接活跃
@@ -691,14 +822,14 @@ func (c *Client) writePump() {
 			}
 			c.conn.SetWriteDeadline(time.Now().Add(pingTimeout))
 
-			// 对于keepalive连接，发送JSON ping而不是WebSocket ping
+			// 对于keepalive连接，发送应用层PING消息而不是WebSocket ping
 			if c.isKeepalive {
-				pingMsg := map[string]string{
-					"type": "PING",
-					"time": time.Now().Format(time.RFC3339),
+				pingMsg := wsControlMessage{
+					Type: WSTypePing,
+					Time: time.Now().Format(time.RFC3339),
 				}
-				if pingData, err := json.Marshal(pingMsg); err == nil {
-					if err := c.conn.WriteMessage(websocket.TextMessage, pingData); err != nil {
+				if pingData, err := encodeWSMessage(c.format, pingMsg); err == nil {
+					if err := c.conn.WriteMessage(c.format.frameType(), pingData); err != nil {
 						return
 					}
 				}
@@ -711,3 +842,35 @@ func (c *Client) writePump() {
 		}
 	}
 }
+
+// writeBinaryFrames 将消息和已排队的消息逐条写为二进制帧
+func (c *Client) writeBinaryFrames(message []byte) error {
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		return err
+	}
+	c.lag.Delivered(1, time.Now())
+
+	n := len(c.send)
+	for i := 0; i < n; i++ {
+		queued, ok := c.nextQueued()
+		if !ok {
+			return nil
+		}
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, queued); err != nil {
+			return err
+		}
+		c.lag.Delivered(1, time.Now())
+	}
+	return nil
+}
+
+// nextQueued 不等待地取出一条排队的消息
+// drop_oldest策略下Hub可能同时清空队列，不能按之前读到的队列长度阻塞读取
+func (c *Client) nextQueued() ([]byte, bool) {
+	select {
+	case queued, ok := <-c.send:
+		return queued, ok
+	default:
+		return nil, false
+	}
+}
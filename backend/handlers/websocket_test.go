@@ -0,0 +1,572 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/cache"
+	"realtime-voting-backend/livefeed"
+	"realtime-voting-backend/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+func voteUpdate(t *testing.T, seq uint64, votes ...int64) (*BroadcastMessage, []byte) {
+	options := make([]map[string]interface{}, len(votes))
+	for i, v := range votes {
+		options[i] = map[string]interface{}{"id": i + 1, "text": "opt", "votes": v}
+	}
+	message := &BroadcastMessage{
+		PollID: 5,
+		Seq:    seq,
+		Results: map[string]interface{}{
+			"type": "VOTE_UPDATE",
+			"seq":  seq,
+			"data": map[string]interface{}{"poll_id": 5, "options": options, "timestamp": 1},
+		},
+	}
+	data, err := json.Marshal(message.Results)
+	require.NoError(t, err)
+	return message, data
+}
+
+func TestHub_EncodeDelta(t *testing.T) {
+	hub := &Hub{deltas: livefeed.NewDeltaEncoder(20)}
+
+	// The first update is a keyframe carrying the full results
+	message, data := voteUpdate(t, 1, 0, 0)
+	assert.Equal(t, data, hub.encodeDelta(message, newWSFrames(nil, data)).get(wsFormatJSON))
+
+	message, data = voteUpdate(t, 2, 1, 0)
+	var delta map[string]interface{}
+	require.NoError(t, json.Unmarshal(hub.encodeDelta(message, newWSFrames(nil, data)).get(wsFormatJSON), &delta))
+	assert.Equal(t, "VOTE_DELTA", delta["type"])
+	assert.Equal(t, float64(2), delta["seq"])
+	assert.Equal(t, float64(1), delta["base_seq"])
+	changes := delta["data"].(map[string]interface{})["changes"].([]interface{})
+	require.Len(t, changes, 1)
+	assert.Equal(t, map[string]interface{}{"id": float64(1), "votes": float64(1)}, changes[0])
+
+	// Re-broadcasting identical counts sends nothing to delta clients
+	message, data = voteUpdate(t, 3, 1, 0)
+	assert.Nil(t, hub.encodeDelta(message, newWSFrames(nil, data)))
+}
+
+// readWSFrames reads frames until keep accepted n messages; the write pump may join queued messages with newlines.
+func readWSFrames(t *testing.T, conn *websocket.Conn, n int, keep func(msg map[string]interface{}) bool) []map[string]interface{} {
+	var messages []map[string]interface{}
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for len(messages) < n {
+		_, frame, err := conn.ReadMessage()
+		require.NoError(t, err)
+		for _, line := range strings.Split(string(frame), "\n") {
+			var msg map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &msg))
+			if keep(msg) {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	return messages
+}
+
+// readWSMessages reads n protocol messages, skipping presence updates that arrive asynchronously.
+func readWSMessages(t *testing.T, conn *websocket.Conn, n int) []map[string]interface{} {
+	return readWSFrames(t, conn, n, func(msg map[string]interface{}) bool {
+		return msg["type"] != "PRESENCE"
+	})
+}
+
+func TestMultiplexWebSocket_Subscriptions(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	var polls []models.Poll
+	for i := 0; i < 2; i++ {
+		poll := models.Poll{Question: "Multiplex?", IsActive: true}
+		require.NoError(t, db.Create(&poll).Error)
+		require.NoError(t, db.Create(&models.PollOption{PollID: poll.ID, Text: "A"}).Error)
+		polls = append(polls, poll)
+	}
+
+	limit := GlobalHub.maxSubscriptions
+	GlobalHub.maxSubscriptions = 1
+	defer func() { GlobalHub.maxSubscriptions = limit }()
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Subscribing acknowledges and then sends a full snapshot
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[0].ID}))
+	messages := readWSMessages(t, conn, 2)
+	assert.Equal(t, "SUBSCRIBED", messages[0]["type"])
+	assert.Equal(t, float64(polls[0].ID), messages[0]["poll_id"])
+	assert.Equal(t, "SNAPSHOT", messages[1]["type"])
+
+	// The per-connection limit rejects a second poll
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[1].ID}))
+	messages = readWSMessages(t, conn, 1)
+	assert.Equal(t, "ERROR", messages[0]["type"])
+	assert.Equal(t, float64(polls[1].ID), messages[0]["poll_id"])
+
+	// Unknown polls are rejected
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": 999999}))
+	messages = readWSMessages(t, conn, 1)
+	assert.Equal(t, "ERROR", messages[0]["type"])
+
+	// Unsubscribing frees the slot and stops updates for that poll
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "UNSUBSCRIBE", "poll_id": polls[0].ID}))
+	messages = readWSMessages(t, conn, 1)
+	assert.Equal(t, "UNSUBSCRIBED", messages[0]["type"])
+	assert.Equal(t, 0, GlobalHub.pollConnectionCount(polls[0].ID))
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": polls[1].ID}))
+	messages = readWSMessages(t, conn, 2)
+	assert.Equal(t, "SUBSCRIBED", messages[0]["type"])
+	assert.Equal(t, 1, GlobalHub.pollConnectionCount(polls[1].ID))
+}
+
+func TestMultiplexWebSocket_Vote(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Vote over WS?", IsActive: true, PollType: models.SingleChoice}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+
+	// Poll IDs restart with the in-memory database, so drop replies remembered by earlier runs
+	wsVoteReplies = &voteReplyCache{entries: make(map[string]voteReplyEntry)}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	vote := map[string]interface{}{"type": "VOTE", "poll_id": poll.ID, "option_ids": []uint{option.ID}, "message_id": "kiosk-1"}
+	require.NoError(t, conn.WriteJSON(vote))
+	ack := readWSMessages(t, conn, 1)[0]
+	assert.Equal(t, "VOTE_ACK", ack["type"])
+	assert.Equal(t, "kiosk-1", ack["message_id"])
+
+	// A resend with the same message ID gets the same ack and is not counted again
+	require.NoError(t, conn.WriteJSON(vote))
+	assert.Equal(t, ack, readWSMessages(t, conn, 1)[0])
+
+	var stored models.PollOption
+	require.NoError(t, db.First(&stored, option.ID).Error)
+	assert.Equal(t, int64(1), stored.Votes)
+
+	// Validation failures are correlated to the message ID
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "VOTE", "poll_id": poll.ID, "option_ids": []uint{999999}, "message_id": "kiosk-2"}))
+	voteErr := readWSMessages(t, conn, 1)[0]
+	assert.Equal(t, "VOTE_ERROR", voteErr["type"])
+	assert.Equal(t, "kiosk-2", voteErr["message_id"])
+	assert.Equal(t, float64(400), voteErr["code"])
+	assert.NotEmpty(t, voteErr["error"])
+}
+
+func TestMultiplexWebSocket_VoteMessageIDScopedToCaller(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Shared message IDs?", IsActive: true, PollType: models.SingleChoice}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+	wsVoteReplies = &voteReplyCache{entries: make(map[string]voteReplyEntry)}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+
+	// Two clients behind different addresses both number their messages from "1"
+	vote := map[string]interface{}{"type": "VOTE", "poll_id": poll.ID, "option_ids": []uint{option.ID}, "message_id": "1"}
+	var acks []map[string]interface{}
+	for _, ip := range []string{"203.0.113.10", "203.0.113.20"} {
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Forwarded-For": {ip}})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.WriteJSON(vote))
+		acks = append(acks, readWSMessages(t, conn, 1)[0])
+	}
+	for _, ack := range acks {
+		assert.Equal(t, "VOTE_ACK", ack["type"])
+		assert.Equal(t, "1", ack["message_id"])
+	}
+
+	var stored models.PollOption
+	require.NoError(t, db.First(&stored, option.ID).Error)
+	assert.Equal(t, int64(2), stored.Votes, "the second client's vote was answered from the first client's cached reply")
+}
+
+// enableTestRateLimit turns on the shared limiter with a per-client budget of one request per second.
+func enableTestRateLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	enabled, global, user := rateLimitEnabled, globalLimiter, userLimiter
+	rateLimitEnabled = true
+	globalLimiter = cache.NewTokenBucketRateLimiter(client, "test_global", 1000, 1000)
+	userLimiter = cache.NewUserRateLimiter(client, "test_user", 1000, 1000, 1, 1)
+	t.Cleanup(func() { rateLimitEnabled, globalLimiter, userLimiter = enabled, global, user })
+}
+
+func TestMultiplexWebSocket_VoteRateLimited(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+	enableTestRateLimit(t)
+
+	poll := models.Poll{Question: "Vote over WS?", IsActive: true, PollType: models.MultiChoice}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+	wsVoteReplies = &voteReplyCache{entries: make(map[string]voteReplyEntry)}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The bucket refills at most once while these are sent, so at least one vote is rejected
+	var limited map[string]interface{}
+	for i := 0; i < 3 && limited == nil; i++ {
+		messageID := fmt.Sprintf("burst-%d", i)
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "VOTE", "poll_id": poll.ID, "option_ids": []uint{option.ID}, "message_id": messageID}))
+		reply := readWSMessages(t, conn, 1)[0]
+		assert.Equal(t, messageID, reply["message_id"])
+		if reply["type"] == "VOTE_ERROR" {
+			limited = reply
+		}
+	}
+	require.NotNil(t, limited, "votes over the per-IP limit were accepted")
+	assert.Equal(t, float64(429), limited["code"])
+
+	// Rejected votes are not counted and their message IDs are not remembered
+	var stored models.PollOption
+	require.NoError(t, db.First(&stored, option.ID).Error)
+	assert.Less(t, stored.Votes, int64(3))
+	wsVoteReplies.mu.Lock()
+	_, remembered := wsVoteReplies.entries[wsVoteKey(poll.ID, "ip:127.0.0.1", limited["message_id"].(string))]
+	wsVoteReplies.mu.Unlock()
+	assert.False(t, remembered)
+}
+
+// readMsgpackFrame reads binary frames until one of the wanted type arrives and decodes it into out.
+func readMsgpackFrame(t *testing.T, conn *websocket.Conn, want string, out interface{}) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		frameType, frame, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, frameType)
+
+		var head struct {
+			Type string `json:"type"`
+		}
+		require.NoError(t, codec.NewDecoderBytes(frame, msgpackHandle).Decode(&head))
+		if head.Type == want {
+			require.NoError(t, codec.NewDecoderBytes(frame, msgpackHandle).Decode(out))
+			return
+		}
+	}
+}
+
+func TestMultiplexWebSocket_Msgpack(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Binary?", IsActive: true, PollType: models.SingleChoice}
+	require.NoError(t, db.Create(&poll).Error)
+	option := models.PollOption{PollID: poll.ID, Text: "A"}
+	require.NoError(t, db.Create(&option).Error)
+
+	wsVoteReplies = &voteReplyCache{entries: make(map[string]voteReplyEntry)}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	dialer := websocket.Dialer{Subprotocols: []string{SubprotocolMsgpack}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, SubprotocolMsgpack, conn.Subprotocol())
+
+	send := func(msg map[string]interface{}) {
+		data, err := encodeWSMessage(wsFormatMsgpack, msg)
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, data))
+	}
+
+	// Replies use the same field names as JSON, one message per binary frame
+	send(map[string]interface{}{"type": "SUBSCRIBE", "poll_id": poll.ID})
+	var subscribed wsSubscriptionMessage
+	readMsgpackFrame(t, conn, WSTypeSubscribed, &subscribed)
+	assert.Equal(t, poll.ID, subscribed.PollID)
+	var snapshot wsResultsMessage
+	readMsgpackFrame(t, conn, WSTypeSnapshot, &snapshot)
+	require.Len(t, snapshot.Data.Options, 1)
+	assert.Equal(t, option.ID, snapshot.Data.Options[0].ID)
+
+	// Broadcasts triggered by a vote are delivered in binary as well
+	send(map[string]interface{}{"type": "VOTE", "poll_id": poll.ID, "option_ids": []uint{option.ID}, "message_id": "bin-1"})
+	var ack wsVoteReply
+	readMsgpackFrame(t, conn, WSTypeVoteAck, &ack)
+	assert.Equal(t, "bin-1", ack.MessageID)
+	var update wsResultsMessage
+	readMsgpackFrame(t, conn, WSTypeVoteUpdate, &update)
+	require.Len(t, update.Data.Options, 1)
+	assert.Equal(t, int64(1), update.Data.Options[0].Votes)
+}
+
+func TestWSFrames_EncodeOncePerFormat(t *testing.T) {
+	message := &wsResultsMessage{Type: WSTypeVoteUpdate, Seq: 7, Data: wsResultsData{PollID: 3, Options: []wsOption{{ID: 1, Votes: 2}}}}
+	jsonData, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	// Frames relayed from other instances only carry JSON and are decoded on demand
+	for _, frames := range []*wsFrames{newWSFrames(message, jsonData), newWSFrames(nil, jsonData)} {
+		assert.Equal(t, jsonData, frames.get(wsFormatJSON))
+		packed := frames.get(wsFormatMsgpack)
+		require.NotNil(t, packed)
+		assert.Equal(t, &packed[0], &frames.get(wsFormatMsgpack)[0])
+
+		var decoded wsResultsMessage
+		require.NoError(t, codec.NewDecoderBytes(packed, msgpackHandle).Decode(&decoded))
+		assert.Equal(t, *message, decoded)
+	}
+}
+
+func TestPresence_ViewerCounts(t *testing.T) {
+	router, db := SetupTestEnvironment(t)
+	ClearTables(db)
+
+	poll := models.Poll{Question: "Who is watching?", IsActive: true}
+	require.NoError(t, db.Create(&poll).Error)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + fmt.Sprintf("/api/polls/%d/ws", poll.ID)
+
+	// waitForViewers skips updates until the expected count is pushed
+	waitForViewers := func(conn *websocket.Conn, viewers float64) map[string]interface{} {
+		return readWSFrames(t, conn, 1, func(msg map[string]interface{}) bool {
+			if msg["type"] != "PRESENCE" {
+				return false
+			}
+			return msg["data"].(map[string]interface{})["viewers"] == viewers
+		})[0]["data"].(map[string]interface{})
+	}
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer first.Close()
+	data := waitForViewers(first, 1)
+	assert.Equal(t, float64(poll.ID), data["poll_id"])
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	waitForViewers(first, 2)
+
+	// Leaving is pushed to the remaining viewers and the peak is kept
+	require.NoError(t, second.Close())
+	data = waitForViewers(first, 1)
+	assert.Equal(t, float64(2), data["peak_viewers"])
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/polls/%d/presence", poll.ID), nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(1), body["viewers"])
+	assert.GreaterOrEqual(t, body["peak_viewers"], float64(2))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/polls/999999/presence", nil))
+	assert.Equal(t, 404, w.Code)
+}
+
+// newTestHub creates a hub that is driven directly by the test instead of its run loop.
+func newTestHub(t *testing.T, policy livefeed.SlowConsumerPolicy, sendTimeout time.Duration) *Hub {
+	hub := newHub()
+	hub.expireTicker.Stop()
+	hub.historyCleanupTicker.Stop()
+	hub.slowPolicy = policy
+	hub.sendTimeout = sendTimeout
+	return hub
+}
+
+// subscribeSlowClient registers a client without a connection whose send queue is already full of stale messages.
+func subscribeSlowClient(hub *Hub, pollID uint, capacity int, deltaMode bool) *Client {
+	client := &Client{hub: hub, send: make(chan []byte, capacity), polls: map[uint]bool{pollID: true}, deltaMode: deltaMode}
+	for i := 0; i < capacity; i++ {
+		client.send <- []byte(`{"type":"STALE"}`)
+		client.lag.Enqueued(1, time.Now())
+	}
+	hub.conns[client] = true
+	if hub.clients[pollID] == nil {
+		hub.clients[pollID] = make(map[*Client]bool)
+	}
+	hub.clients[pollID][client] = true
+	return client
+}
+
+func resultsBroadcast(pollID uint, seq uint64, votes int64) *BroadcastMessage {
+	return &BroadcastMessage{PollID: pollID, Seq: seq, Results: &wsResultsMessage{
+		Type: WSTypeVoteUpdate,
+		Seq:  seq,
+		Data: wsResultsData{PollID: pollID, Options: []wsOption{{ID: 1, Votes: votes}}},
+	}}
+}
+
+// drainQueue returns the messages left in a client's send queue.
+func drainQueue(t *testing.T, client *Client) []map[string]interface{} {
+	var messages []map[string]interface{}
+	for {
+		select {
+		case data, ok := <-client.send:
+			if !ok {
+				return messages
+			}
+			var msg map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &msg))
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestGetWebSocketClients_RequiresAdminKey(t *testing.T) {
+	router, _ := SetupTestEnvironment(t)
+
+	w := performJSON(router, "GET", "/api/admin/ws/clients", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performJSON(router, "GET", "/api/admin/ws/clients?admin_key=wrong", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performJSON(router, "GET", "/api/admin/ws/clients?admin_key=admin123", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"connections"`)
+}
+
+func TestHub_SlowConsumerDisconnect(t *testing.T) {
+	hub := newTestHub(t, livefeed.PolicyDisconnect, time.Second)
+	const pollID = 9101
+	slow := subscribeSlowClient(hub, pollID, 1, false)
+
+	hub.broadcastMessage(resultsBroadcast(pollID, 1, 1))
+
+	assert.False(t, hub.conns[slow])
+	assert.Empty(t, hub.clients[pollID])
+	// The stale message is still there, then the queue is closed
+	<-slow.send
+	_, ok := <-slow.send
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), hub.Stats().SlowDisconnects)
+}
+
+func TestHub_SlowConsumerDropOldest(t *testing.T) {
+	hub := newTestHub(t, livefeed.PolicyDropOldest, time.Second)
+	const pollID = 9102
+	snapshot := subscribeSlowClient(hub, pollID, 4, false)
+	delta := subscribeSlowClient(hub, pollID, 4, true)
+
+	hub.broadcastMessage(resultsBroadcast(pollID, 1, 1))
+	hub.broadcastMessage(resultsBroadcast(pollID, 2, 2))
+
+	// Both clients stay connected; the first update replaced the stale backlog and the second fit behind it
+	for _, client := range []*Client{snapshot, delta} {
+		assert.True(t, hub.conns[client])
+		messages := drainQueue(t, client)
+		require.Len(t, messages, 2)
+		assert.Equal(t, "VOTE_UPDATE", messages[0]["type"])
+		assert.Equal(t, float64(1), messages[0]["seq"])
+		assert.Equal(t, float64(2), messages[1]["seq"])
+
+		lag := client.lag.Stats(time.Now())
+		assert.Equal(t, int64(4), lag.Dropped)
+		assert.Equal(t, int64(2), lag.Pending)
+	}
+
+	// Once full again, only the latest full result per poll is kept, even for delta clients
+	for _, client := range []*Client{snapshot, delta} {
+		for i := 0; i < 4; i++ {
+			client.send <- []byte(`{"type":"STALE"}`)
+		}
+	}
+	hub.broadcastMessage(resultsBroadcast(pollID, 3, 4))
+	for _, client := range []*Client{snapshot, delta} {
+		messages := drainQueue(t, client)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "VOTE_UPDATE", messages[0]["type"])
+		assert.Equal(t, float64(3), messages[0]["seq"])
+	}
+
+	// Transient messages are not in the history, so they are queued after the latest results
+	for i := 0; i < 4; i++ {
+		snapshot.send <- []byte(`{"type":"STALE"}`)
+	}
+	hub.broadcastMessage(&BroadcastMessage{PollID: pollID, Transient: true, Results: &wsPresenceMessage{
+		Type: WSTypePresence,
+		Data: presenceUpdate{PollID: pollID, Viewers: 2},
+	}})
+	messages := drainQueue(t, snapshot)
+	require.Len(t, messages, 2)
+	assert.Equal(t, float64(3), messages[0]["seq"])
+	assert.Equal(t, "PRESENCE", messages[1]["type"])
+
+	stats := hub.Stats()
+	assert.Equal(t, int64(0), stats.SlowDisconnects)
+	assert.Equal(t, int64(20), stats.DroppedMessages)
+}
+
+func TestHub_SlowConsumerBlock(t *testing.T) {
+	const sendTimeout = 200 * time.Millisecond
+	hub := newTestHub(t, livefeed.PolicyBlock, sendTimeout)
+	const pollID = 9103
+	lagging := subscribeSlowClient(hub, pollID, 1, false)
+	stuck := subscribeSlowClient(hub, pollID, 1, false)
+	another := subscribeSlowClient(hub, pollID, 1, false)
+
+	// A reader that catches up within the timeout keeps its connection
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-lagging.send
+		lagging.lag.Delivered(1, time.Now())
+	}()
+
+	start := time.Now()
+	hub.broadcastMessage(resultsBroadcast(pollID, 1, 1))
+	elapsed := time.Since(start)
+
+	// Stuck readers share one deadline, so the broadcast never waits much longer than the timeout
+	assert.Less(t, elapsed, sendTimeout+150*time.Millisecond)
+	assert.True(t, hub.conns[lagging])
+	assert.False(t, hub.conns[stuck])
+	assert.False(t, hub.conns[another])
+
+	messages := drainQueue(t, lagging)
+	require.Len(t, messages, 1)
+	assert.Equal(t, float64(1), messages[0]["seq"])
+
+	stats := hub.Stats()
+	assert.Equal(t, int64(2), stats.SlowDisconnects)
+	assert.Greater(t, stats.BlockedMs, 0.0)
+	require.Len(t, stats.Clients, 1)
+	assert.Equal(t, []uint{pollID}, stats.Clients[0].Polls)
+}
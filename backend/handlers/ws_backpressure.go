@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"realtime-voting-backend/livefeed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsSlowConsumerPolicy 从环境变量WS_SLOW_CONSUMER_POLICY读取发送队列已满时的处理策略
+// 可选disconnect（默认）、drop_oldest和block
+func wsSlowConsumerPolicy() livefeed.SlowConsumerPolicy {
+	policy, err := livefeed.ParseSlowConsumerPolicy(os.Getenv("WS_SLOW_CONSUMER_POLICY"))
+	if err != nil {
+		log.Printf("%v，使用默认策略%s", err, policy)
+	}
+	return policy
+}
+
+// wsSendTimeout 从环境变量WS_SEND_TIMEOUT读取block策略每次广播最长的等待时间，默认500毫秒
+func wsSendTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("WS_SEND_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 500 * time.Millisecond
+}
+
+// deliver 按慢消费者策略向客户端发送队列写入一条消息，只能在run循环中调用
+// supersededBy为非0时，丢弃旧消息后该投票的最新完整结果可以代替本条消息
+// 返回false表示客户端跟不上，调用方需要断开连接
+func (h *Hub) deliver(client *Client, supersededBy uint, data []byte, deadline time.Time) bool {
+	if !h.conns[client] {
+		return false
+	}
+	if h.tryEnqueue(client, data) {
+		return true
+	}
+
+	switch h.slowPolicy {
+	case livefeed.PolicyDropOldest:
+		resynced := h.dropOldest(client)
+		if supersededBy != 0 && resynced[supersededBy] {
+			return true
+		}
+		if !h.tryEnqueue(client, data) {
+			// 队列容量小于订阅数时补发的最新结果可能占满队列，只丢弃本条消息
+			client.lag.Dropped(1)
+			atomic.AddInt64(&h.droppedMessages, 1)
+		}
+		return true
+
+	case livefeed.PolicyBlock:
+		if wait := time.Until(deadline); wait > 0 {
+			start := time.Now()
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			var sent bool
+			select {
+			case client.send <- data:
+				sent = true
+			case <-timer.C:
+			}
+
+			blocked := time.Since(start)
+			client.lag.Blocked(blocked)
+			atomic.AddInt64(&h.blockedNanos, int64(blocked))
+			if sent {
+				client.lag.Enqueued(1, time.Now())
+				return true
+			}
+		}
+	}
+
+	atomic.AddInt64(&h.slowDisconnects, 1)
+	stats := client.lag.Stats(time.Now())
+	log.Printf("WebSocket客户端发送队列已满，断开连接 [策略: %s, 积压: %d, 延迟: %.0fms]",
+		h.slowPolicy, stats.Pending, stats.LagMs)
+	return false
+}
+
+// tryEnqueue 不等待地写入发送队列
+func (h *Hub) tryEnqueue(client *Client, data []byte) bool {
+	select {
+	case client.send <- data:
+		client.lag.Enqueued(1, time.Now())
+		return true
+	default:
+		return false
+	}
+}
+
+// dropOldest 丢弃客户端队列中尚未发送的消息，改为发送每个已订阅投票的最新完整结果
+// 丢弃的回复（如VOTE_ACK）需要客户端按message_id重发获取；返回已补发最新结果的投票
+func (h *Hub) dropOldest(client *Client) map[uint]bool {
+	dropped := 0
+	for drained := false; !drained; {
+		select {
+		case <-client.send:
+			dropped++
+		default:
+			drained = true
+		}
+	}
+	client.lag.Dropped(dropped)
+	atomic.AddInt64(&h.droppedMessages, int64(dropped))
+
+	resynced := make(map[uint]bool)
+	for pollID := range client.polls {
+		latest, ok := h.history.Latest(pollID)
+		if !ok {
+			continue
+		}
+		// 增量模式的客户端同样收到完整结果，作为重新同步的关键帧
+		data, err := transcodeWSMessage(client.format, latest.Data)
+		if err != nil {
+			continue
+		}
+		if !h.tryEnqueue(client, data) {
+			break
+		}
+		resynced[pollID] = true
+	}
+
+	log.Printf("WebSocket客户端发送队列已满，丢弃%d条旧消息并补发%d个投票的最新结果", dropped, len(resynced))
+	return resynced
+}
+
+// WebSocketClientStats 单个WebSocket连接的发送积压
+type WebSocketClientStats struct {
+	RemoteAddr string `json:"remote_addr"`
+	Polls      []uint `json:"polls"`
+	Mode       string `json:"mode"`
+	Format     string `json:"format"`
+	livefeed.LagStats
+}
+
+// WebSocketStats WebSocket发送队列的整体统计
+type WebSocketStats struct {
+	Policy          livefeed.SlowConsumerPolicy `json:"policy"`
+	SendTimeoutMs   int64                       `json:"send_timeout_ms"`
+	Connections     int                         `json:"connections"`
+	SlowDisconnects int64                       `json:"slow_disconnects"`
+	DroppedMessages int64                       `json:"dropped_messages"`
+	BlockedMs       float64                     `json:"blocked_ms"`
+	MaxPending      int64                       `json:"max_pending"` // 当前积压最多的连接的积压数
+	MaxLagMs        float64                     `json:"max_lag_ms"`  // 当前延迟最大的连接的延迟
+	Clients         []WebSocketClientStats      `json:"clients,omitempty"`
+}
+
+// Stats 统计慢消费者处理情况和每个连接的积压，按积压数从多到少排列
+func (h *Hub) Stats() WebSocketStats {
+	now := time.Now()
+	stats := WebSocketStats{
+		Policy:          h.slowPolicy,
+		SendTimeoutMs:   h.sendTimeout.Milliseconds(),
+		SlowDisconnects: atomic.LoadInt64(&h.slowDisconnects),
+		DroppedMessages: atomic.LoadInt64(&h.droppedMessages),
+		BlockedMs:       float64(atomic.LoadInt64(&h.blockedNanos)) / float64(time.Millisecond),
+	}
+
+	h.mu.RLock()
+	stats.Connections = len(h.conns)
+	for client := range h.conns {
+		info := WebSocketClientStats{
+			Mode:     UpdateModeSnapshot,
+			Format:   SubprotocolJSON,
+			LagStats: client.lag.Stats(now),
+		}
+		if client.conn != nil {
+			info.RemoteAddr = client.conn.RemoteAddr().String()
+		}
+		if client.deltaMode {
+			info.Mode = UpdateModeDelta
+		}
+		if client.format == wsFormatMsgpack {
+			info.Format = SubprotocolMsgpack
+		}
+		for pollID := range client.polls {
+			info.Polls = append(info.Polls, pollID)
+		}
+		sort.Slice(info.Polls, func(i, j int) bool { return info.Polls[i] < info.Polls[j] })
+
+		if info.Pending > stats.MaxPending {
+			stats.MaxPending = info.Pending
+		}
+		if info.LagMs > stats.MaxLagMs {
+			stats.MaxLagMs = info.LagMs
+		}
+		stats.Clients = append(stats.Clients, info)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		if stats.Clients[i].Pending != stats.Clients[j].Pending {
+			return stats.Clients[i].Pending > stats.Clients[j].Pending
+		}
+		return stats.Clients[i].LagMs > stats.Clients[j].LagMs
+	})
+	return stats
+}
+
+// GetWebSocketClients 查询WebSocket连接的发送积压，limit限制返回的连接数，默认100
+func GetWebSocketClients(c *gin.Context) {
+	if !checkAdminKey(c) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的管理员密钥"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		limit = n
+	}
+
+	stats := GlobalHub.Stats()
+	if len(stats.Clients) > limit {
+		stats.Clients = stats.Clients[:limit]
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"realtime-voting-backend/livefeed"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// WebSocket子协议，客户端通过Sec-WebSocket-Protocol请求头协商，未协商时使用JSON
+const (
+	SubprotocolJSON    = "json"
+	SubprotocolMsgpack = "msgpack"
+)
+
+// WebSocket服务端消息类型
+const (
+	WSTypeVoteUpdate     = "VOTE_UPDATE"
+	WSTypeVoteDelta      = "VOTE_DELTA"
+	WSTypeSnapshot       = "SNAPSHOT"
+	WSTypePresence       = "PRESENCE"
+	WSTypeSubscribed     = "SUBSCRIBED"
+	WSTypeUnsubscribed   = "UNSUBSCRIBED"
+	WSTypeError          = "ERROR"
+	WSTypeVoteAck        = "VOTE_ACK"
+	WSTypeVoteError      = "VOTE_ERROR"
+	WSTypePing           = "PING"
+	WSTypePong           = "PONG"
+	WSTypeConnectSuccess = "CONNECT_SUCCESS"
+	WSTypeComment        = "COMMENT"
+	WSTypeCommentDeleted = "COMMENT_DELETED"
+	WSTypeReactions      = "REACTIONS"
+	WSTypeAuthOK         = "AUTH_OK"
+)
+
+// wsFormat 连接使用的消息编码
+type wsFormat int
+
+const (
+	wsFormatJSON wsFormat = iota
+	wsFormatMsgpack
+	wsFormatCount
+)
+
+// msgpackHandle MessagePack编码配置，字段名沿用json标签，两种编码共用同一套结构
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true // 字符串使用str类型，与JSON的字符串语义一致
+	h.Canonical = true
+	return h
+}()
+
+// wsOption 选项及其票数
+type wsOption struct {
+	ID    uint   `json:"id"`
+	Text  string `json:"text,omitempty"`
+	Votes int64  `json:"votes"`
+}
+
+// wsResultsData VOTE_UPDATE和SNAPSHOT消息的数据
+type wsResultsData struct {
+	PollID    uint       `json:"poll_id"`
+	Options   []wsOption `json:"options"`
+	Timestamp int64      `json:"timestamp"`
+}
+
+// wsResultsMessage 完整投票结果，VOTE_UPDATE或SNAPSHOT
+type wsResultsMessage struct {
+	Type string        `json:"type"`
+	Seq  uint64        `json:"seq"`
+	Data wsResultsData `json:"data"`
+}
+
+// wsDeltaData VOTE_DELTA消息的数据
+type wsDeltaData struct {
+	PollID    uint                   `json:"poll_id"`
+	Changes   []livefeed.OptionCount `json:"changes"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+// wsDeltaMessage 增量更新
+type wsDeltaMessage struct {
+	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq"`
+	BaseSeq uint64      `json:"base_seq"`
+	Data    wsDeltaData `json:"data"`
+}
+
+// wsPresenceMessage 在线人数
+type wsPresenceMessage struct {
+	Type string         `json:"type"`
+	Data presenceUpdate `json:"data"`
+}
+
+// wsCommentMessage 新评论
+type wsCommentMessage struct {
+	Type string      `json:"type"`
+	Data commentView `json:"data"`
+}
+
+// wsCommentDeletedMessage 评论被删除
+type wsCommentDeletedMessage struct {
+	Type string          `json:"type"`
+	Data commentDeletion `json:"data"`
+}
+
+// wsReactionsMessage 表情累计数
+type wsReactionsMessage struct {
+	Type string         `json:"type"`
+	Data reactionUpdate `json:"data"`
+}
+
+// wsSubscriptionMessage SUBSCRIBED和UNSUBSCRIBED消息
+type wsSubscriptionMessage struct {
+	Type   string  `json:"type"`
+	PollID uint    `json:"poll_id"`
+	Seq    *uint64 `json:"seq,omitempty"`
+}
+
+// wsErrorMessage 请求错误
+type wsErrorMessage struct {
+	Type   string `json:"type"`
+	Error  string `json:"error"`
+	PollID uint   `json:"poll_id,omitempty"`
+}
+
+// wsVoteReply VOTE_ACK和VOTE_ERROR消息，按message_id与VOTE关联
+type wsVoteReply struct {
+	Type        string                 `json:"type"`
+	MessageID   string                 `json:"message_id"`
+	PollID      uint                   `json:"poll_id,omitempty"`
+	Code        int                    `json:"code,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	PowRequired bool                   `json:"pow_required,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+}
+
+// wsAuthMessage 访问令牌已更新
+type wsAuthMessage struct {
+	Type      string `json:"type"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// wsControlMessage PING、PONG和CONNECT_SUCCESS等连接控制消息
+type wsControlMessage struct {
+	Type    string `json:"type"`
+	Time    string `json:"time,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// negotiatedFormat 根据握手协商的子协议确定编码
+func negotiatedFormat(conn *websocket.Conn) wsFormat {
+	if conn.Subprotocol() == SubprotocolMsgpack {
+		return wsFormatMsgpack
+	}
+	return wsFormatJSON
+}
+
+// frameType 编码对应的WebSocket帧类型
+func (f wsFormat) frameType() int {
+	if f == wsFormatMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// encodeWSMessage 按编码序列化消息
+func encodeWSMessage(format wsFormat, message interface{}) ([]byte, error) {
+	if format != wsFormatMsgpack {
+		return json.Marshal(message)
+	}
+	var buf []byte
+	if err := codec.NewEncoderBytes(&buf, msgpackHandle).Encode(message); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// decodeWSMessage 按消息类型将JSON解析为对应的结构，用于重新编码历史消息和跨实例转发的消息
+func decodeWSMessage(data []byte) (interface{}, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+
+	var message interface{}
+	switch head.Type {
+	case WSTypeVoteUpdate, WSTypeSnapshot:
+		message = &wsResultsMessage{}
+	case WSTypeVoteDelta:
+		message = &wsDeltaMessage{}
+	case WSTypePresence:
+		message = &wsPresenceMessage{}
+	case WSTypeComment:
+		message = &wsCommentMessage{}
+	case WSTypeCommentDeleted:
+		message = &wsCommentDeletedMessage{}
+	case WSTypeReactions:
+		message = &wsReactionsMessage{}
+	case WSTypeSubscribed, WSTypeUnsubscribed:
+		message = &wsSubscriptionMessage{}
+	case WSTypeError:
+		message = &wsErrorMessage{}
+	case WSTypeVoteAck, WSTypeVoteError:
+		message = &wsVoteReply{}
+	case WSTypeAuthOK:
+		message = &wsAuthMessage{}
+	case WSTypePing, WSTypePong, WSTypeConnectSuccess:
+		message = &wsControlMessage{}
+	default:
+		return nil, fmt.Errorf("未知的WebSocket消息类型: %q", head.Type)
+	}
+
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// transcodeWSMessage 将JSON消息转换为指定编码
+func transcodeWSMessage(format wsFormat, data []byte) ([]byte, error) {
+	if format == wsFormatJSON {
+		return data, nil
+	}
+	message, err := decodeWSMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWSMessage(format, message)
+}
+
+// wsFrames 一条广播消息的各种编码，每种编码最多序列化一次，供所有同编码的客户端共用
+type wsFrames struct {
+	message interface{}
+	encoded [wsFormatCount][]byte
+}
+
+// newWSFrames 包装已序列化为JSON的消息，message为nil时在需要时从JSON解析
+func newWSFrames(message interface{}, jsonData []byte) *wsFrames {
+	f := &wsFrames{message: message}
+	f.encoded[wsFormatJSON] = jsonData
+	return f
+}
+
+// get 返回指定编码的消息，编码失败时返回nil
+// 跨实例转发的消息只有JSON，首次需要其他编码时按消息类型解析一次
+func (f *wsFrames) get(format wsFormat) []byte {
+	if f == nil {
+		return nil
+	}
+	if f.encoded[format] == nil {
+		if f.message == nil {
+			message, err := decodeWSMessage(f.encoded[wsFormatJSON])
+			if err != nil {
+				log.Printf("解析WebSocket消息失败: %v", err)
+				return nil
+			}
+			f.message = message
+		}
+		data, err := encodeWSMessage(format, f.message)
+		if err != nil {
+			log.Printf("编码WebSocket消息失败: %v", err)
+			return nil
+		}
+		f.encoded[format] = data
+	}
+	return f.encoded[format]
+}
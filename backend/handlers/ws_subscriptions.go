@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"realtime-voting-backend/database"
+	"realtime-voting-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// 客户端请求类型，由Hub处理循环执行
+const (
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+	wsActionReply       = "reply"
+)
+
+// clientRequest 客户端发给Hub的请求
+// 订阅需要的快照在读循环中生成，Hub处理循环只负责修改订阅索引和写入发送队列
+type clientRequest struct {
+	client *Client
+	action string
+	pollID uint
+
+	// 从该序号之后补发历史更新，nil表示只发送最新状态
+	since *uint64
+
+	// 订阅前先发送的完整快照
+	snapshot []byte
+
+	// 直接回复给客户端的消息
+	reply []byte
+
+	// 不回复SUBSCRIBED，按投票URL连接时使用
+	silent bool
+}
+
+// wsClientMessage 客户端发送的消息
+type wsClientMessage struct {
+	Type    string  `json:"type"`
+	PollID  uint    `json:"poll_id"`
+	PollIDs []uint  `json:"poll_ids"`
+	Since   *uint64 `json:"since"`
+
+	// VOTE消息的选项和客户端生成的消息ID
+	OptionIDs []uint `json:"option_ids"`
+	MessageID string `json:"message_id"`
+	ProofOfWork
+
+	// AUTH消息携带的新访问令牌
+	Token string `json:"token"`
+}
+
+// wsMaxSubscriptions 从环境变量WS_MAX_SUBSCRIPTIONS读取每个连接最多订阅的投票数，默认50
+func wsMaxSubscriptions() int {
+	if n, err := strconv.Atoi(os.Getenv("WS_MAX_SUBSCRIPTIONS")); err == nil && n > 0 {
+		return n
+	}
+	return 50
+}
+
+// HandleMultiplexWebSocket 处理通用WebSocket连接
+// 连接建立后不订阅任何投票，客户端通过SUBSCRIBE/UNSUBSCRIBE消息管理订阅
+func HandleMultiplexWebSocket(c *gin.Context) {
+	keepalive, deltaMode, ok := parseWebSocketOptions(c)
+	if !ok {
+		return
+	}
+
+	// 投票的访问权限在SUBSCRIBE时按令牌检查
+	claims, ok := authorizeStream(c, wsStreamToken(c), 0)
+	if !ok {
+		return
+	}
+
+	if !checkConnectionLimit(c) {
+		return
+	}
+
+	log.Printf("正在建立多路WebSocket连接 [keepalive: %v]", keepalive)
+
+	// 升级HTTP连接为WebSocket
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("升级WebSocket连接失败: %v", err)
+		return
+	}
+
+	client := newClient(c, conn, keepalive, deltaMode)
+	client.setAuth(claims)
+	serveClient(client)
+}
+
+// handleMessage 处理客户端发来的消息，二进制帧按MessagePack解析
+func (c *Client) handleMessage(messageType int, message []byte) {
+	var msg wsClientMessage
+	if messageType == websocket.BinaryMessage {
+		if err := codec.NewDecoderBytes(message, msgpackHandle).Decode(&msg); err != nil {
+			return
+		}
+	} else if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+
+	switch msg.Type {
+	case "PING":
+		// 回复经由Hub写入发送队列，避免与写循环并发写连接
+		c.reply(wsControlMessage{
+			Type: WSTypePong,
+			Time: time.Now().Format(time.RFC3339),
+		})
+
+	case "SUBSCRIBE":
+		pollIDs := messagePollIDs(msg)
+		if len(pollIDs) == 0 {
+			c.replyError(0, "缺少poll_id")
+			return
+		}
+		// since只对应单个投票的序号，批量订阅时忽略
+		since := msg.Since
+		if len(pollIDs) > 1 {
+			since = nil
+		}
+		for _, pollID := range pollIDs {
+			if !c.canView(pollID) {
+				c.replyError(pollID, "无权查看该投票")
+				continue
+			}
+			if !pollExists(pollID) {
+				c.replyError(pollID, "投票不存在")
+				continue
+			}
+			req, err := prepareSubscription(c, pollID, since, true)
+			if err != nil {
+				log.Printf("生成投票快照失败 [Poll ID: %d]: %v", pollID, err)
+				c.replyError(pollID, "获取投票结果失败")
+				continue
+			}
+			c.hub.control <- req
+		}
+
+	case "VOTE":
+		c.handleVote(msg)
+
+	case "AUTH":
+		c.refreshAuth(msg.Token)
+
+	case "UNSUBSCRIBE":
+		pollIDs := messagePollIDs(msg)
+		if len(pollIDs) == 0 {
+			c.replyError(0, "缺少poll_id")
+			return
+		}
+		for _, pollID := range pollIDs {
+			c.hub.control <- &clientRequest{client: c, action: wsActionUnsubscribe, pollID: pollID}
+		}
+	}
+}
+
+// messagePollIDs 合并消息中的poll_id和poll_ids
+func messagePollIDs(msg wsClientMessage) []uint {
+	pollIDs := make([]uint, 0, len(msg.PollIDs)+1)
+	if msg.PollID != 0 {
+		pollIDs = append(pollIDs, msg.PollID)
+	}
+	for _, pollID := range msg.PollIDs {
+		if pollID != 0 {
+			pollIDs = append(pollIDs, pollID)
+		}
+	}
+	return pollIDs
+}
+
+// pollExists 检查投票是否存在
+func pollExists(pollID uint) bool {
+	var count int64
+	if err := database.DB.Model(&models.Poll{}).Where("id = ?", pollID).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// prepareSubscription 生成订阅请求
+// 历史中缺少客户端错过的更新时附带完整快照，再从快照序号开始补发
+// snapshotOnJoin为true时首次订阅也发送快照，否则只发送历史中的最新状态
+func prepareSubscription(client *Client, pollID uint, since *uint64, snapshotOnJoin bool) (*clientRequest, error) {
+	req := &clientRequest{
+		client: client,
+		action: wsActionSubscribe,
+		pollID: pollID,
+		since:  since,
+	}
+
+	needSnapshot := snapshotOnJoin && since == nil
+	if since != nil {
+		if _, ok := client.hub.history.Since(pollID, *since); !ok {
+			needSnapshot = true
+		}
+	}
+	if !needSnapshot {
+		return req, nil
+	}
+
+	snapshotSeq, snapshot, err := buildPollSnapshot(pollID)
+	if err != nil {
+		return nil, err
+	}
+	req.snapshot = snapshot
+	req.since = &snapshotSeq
+	return req, nil
+}
+
+// reply 通过Hub向客户端发送一条消息，消息在写入发送队列时按连接的编码转换
+func (c *Client) reply(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.hub.control <- &clientRequest{client: c, action: wsActionReply, reply: data}
+}
+
+// replyError 向客户端发送错误消息
+func (c *Client) replyError(pollID uint, message string) {
+	c.reply(wsErrorMessage{Type: WSTypeError, Error: message, PollID: pollID})
+}
+
+// handleRequest 在Hub处理循环中执行客户端请求
+func (h *Hub) handleRequest(req *clientRequest) {
+	client := req.client
+	if !h.conns[client] {
+		return
+	}
+
+	var messages [][]byte
+	switch req.action {
+	case wsActionReply:
+		messages = append(messages, req.reply)
+
+	case wsActionSubscribe:
+		if !client.polls[req.pollID] && len(client.polls) >= h.maxSubscriptions {
+			if data, err := json.Marshal(wsErrorMessage{Type: WSTypeError, Error: "订阅数已达上限", PollID: req.pollID}); err == nil {
+				messages = append(messages, data)
+			}
+			break
+		}
+
+		h.mu.Lock()
+		joined := !client.polls[req.pollID]
+		client.polls[req.pollID] = true
+		if _, ok := h.clients[req.pollID]; !ok {
+			h.clients[req.pollID] = make(map[*Client]bool)
+		}
+		h.clients[req.pollID][client] = true
+		count := len(h.clients[req.pollID])
+		h.mu.Unlock()
+
+		if joined {
+			presenceJoinedBy(req.pollID)
+		}
+
+		log.Printf("WebSocket客户端订阅投票 [Poll ID: %d, 投票连接: %d, 连接订阅数: %d]",
+			req.pollID, count, len(client.polls))
+
+		if !req.silent {
+			seq := h.history.LatestSeq(req.pollID)
+			if data, err := json.Marshal(wsSubscriptionMessage{
+				Type:   WSTypeSubscribed,
+				PollID: req.pollID,
+				Seq:    &seq,
+			}); err == nil {
+				messages = append(messages, data)
+			}
+		}
+		if req.snapshot != nil {
+			messages = append(messages, req.snapshot)
+		}
+		messages = append(messages, h.historyForSubscription(client, req.pollID, req.since)...)
+
+	case wsActionUnsubscribe:
+		h.mu.Lock()
+		h.removeSubscriptionLocked(client, req.pollID)
+		h.mu.Unlock()
+
+		if data, err := json.Marshal(wsSubscriptionMessage{
+			Type:   WSTypeUnsubscribed,
+			PollID: req.pollID,
+		}); err == nil {
+			messages = append(messages, data)
+		}
+	}
+
+	deadline := time.Now().Add(h.sendTimeout)
+	for _, data := range messages {
+		// 历史、快照和回复都以JSON保存，按连接的编码转换后发送
+		data, err := transcodeWSMessage(client.format, data)
+		if err != nil {
+			log.Printf("转换WebSocket消息编码失败: %v", err)
+			continue
+		}
+		if !h.deliver(client, 0, data, deadline) {
+			// 客户端跟不上，关闭连接
+			h.mu.Lock()
+			h.removeClientLocked(client)
+			h.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/cache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WebSocket投票回复的保留时间，期间重发相同message_id的VOTE会收到相同的回复
+const wsVoteReplyTTL = 10 * time.Minute
+
+// 投票处理中的占位值，重发的VOTE在处理完成前收到VOTE_ERROR
+const wsVotePending = "pending"
+
+// 本实例的投票回复缓存，Redis不可用时用于去重
+var wsVoteReplies = &voteReplyCache{entries: make(map[string]voteReplyEntry)}
+
+// voteReplyEntry 一条已处理投票的回复
+type voteReplyEntry struct {
+	reply   string
+	expires time.Time
+}
+
+// voteReplyCache 按消息ID保存投票回复的本地缓存
+type voteReplyCache struct {
+	mu      sync.Mutex
+	entries map[string]voteReplyEntry
+}
+
+// claim 占用消息ID，已被占用时返回保存的回复
+func (r *voteReplyCache) claim(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := r.entries[key]; ok && now.Before(entry.expires) {
+		return entry.reply, false
+	}
+
+	// 顺带清理过期记录，缓存大小受保留时间内的投票数限制
+	for k, entry := range r.entries {
+		if !now.Before(entry.expires) {
+			delete(r.entries, k)
+		}
+	}
+	r.entries[key] = voteReplyEntry{reply: wsVotePending, expires: now.Add(wsVoteReplyTTL)}
+	return "", true
+}
+
+// store 保存投票回复
+func (r *voteReplyCache) store(key string, reply string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[key] = voteReplyEntry{reply: reply, expires: time.Now().Add(wsVoteReplyTTL)}
+}
+
+// release 释放消息ID，客户端可以重试
+func (r *voteReplyCache) release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, key)
+}
+
+// wsVoteKey 投票回复在Redis和本地缓存中的键
+// message_id由客户端生成，不同客户端可能重复，键中加入投票者标识，只对同一投票者的重发去重
+func wsVoteKey(pollID uint, caller string, messageID string) string {
+	return fmt.Sprintf("ws_vote:%d:%s:%s", pollID, caller, messageID)
+}
+
+// voteCaller 投票者标识：令牌带有订阅者时使用订阅者，否则使用客户端IP
+func (c *Client) voteCaller() string {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	if c.auth.claims != nil && c.auth.claims.Subject != "" {
+		return "sub:" + c.auth.claims.Subject
+	}
+	return "ip:" + c.clientIP
+}
+
+// claimVoteMessage 占用消息ID，Redis可用时在所有实例之间去重
+// 返回false时reply为之前保存的回复，处理中时为wsVotePending
+func claimVoteMessage(key string) (string, bool) {
+	redisClient, err := cache.GetClient()
+	if err != nil || redisClient == nil {
+		return wsVoteReplies.claim(key)
+	}
+
+	ctx := context.Background()
+	claimed, err := redisClient.SetNX(ctx, key, wsVotePending, wsVoteReplyTTL).Result()
+	if err != nil {
+		log.Printf("Redis去重失败，使用本地缓存: %v", err)
+		return wsVoteReplies.claim(key)
+	}
+	if claimed {
+		return "", true
+	}
+
+	reply, err := redisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// 占位刚好过期，按新消息处理
+		return claimVoteMessage(key)
+	}
+	if err != nil {
+		return wsVotePending, false
+	}
+	return reply, false
+}
+
+// storeVoteReply 保存投票回复，重发的VOTE直接收到该回复
+func storeVoteReply(key string, reply string) {
+	redisClient, err := cache.GetClient()
+	if err == nil && redisClient != nil {
+		if err := redisClient.Set(context.Background(), key, reply, wsVoteReplyTTL).Err(); err == nil {
+			return
+		}
+	}
+	wsVoteReplies.store(key, reply)
+}
+
+// releaseVoteMessage 释放消息ID，服务端错误时允许客户端用同一消息ID重试
+func releaseVoteMessage(key string) {
+	redisClient, err := cache.GetClient()
+	if err == nil && redisClient != nil {
+		redisClient.Del(context.Background(), key)
+	}
+	wsVoteReplies.release(key)
+}
+
+// handleVote 处理客户端通过WebSocket提交的投票
+// 校验与计票规则和增强版投票接口相同，结果以VOTE_ACK或VOTE_ERROR回复，按message_id关联
+func (c *Client) handleVote(msg wsClientMessage) {
+	if msg.MessageID == "" {
+		c.reply(voteErrorMessage(msg, http.StatusBadRequest, "缺少message_id"))
+		return
+	}
+	if msg.PollID == 0 {
+		c.reply(voteErrorMessage(msg, http.StatusBadRequest, "缺少poll_id"))
+		return
+	}
+	if len(msg.OptionIDs) == 0 {
+		c.reply(voteErrorMessage(msg, http.StatusBadRequest, "必须至少选择一个选项"))
+		return
+	}
+	if !c.canView(msg.PollID) {
+		c.reply(voteErrorMessage(msg, http.StatusForbidden, "无权查看该投票"))
+		return
+	}
+
+	// 与HTTP投票接口共用限流器，按客户端IP限流，被限流的消息可以稍后用同一消息ID重发
+	if message := checkRateLimit(context.Background(), rateLimitIPKey(c.clientIP)); message != "" {
+		c.reply(voteErrorMessage(msg, http.StatusTooManyRequests, message))
+		return
+	}
+
+	// 重发的消息直接返回第一次的处理结果，不会重复计票
+	key := wsVoteKey(msg.PollID, c.voteCaller(), msg.MessageID)
+	reply, claimed := claimVoteMessage(key)
+	if !claimed {
+		if reply == wsVotePending {
+			c.reply(voteErrorMessage(msg, http.StatusConflict, "投票正在处理中"))
+			return
+		}
+		log.Printf("收到重复的WebSocket投票: 投票ID=%d, 消息ID=%s", msg.PollID, msg.MessageID)
+		c.hub.control <- &clientRequest{client: c, action: wsActionReply, reply: []byte(reply)}
+		return
+	}
+
+	var status int
+	var body map[string]interface{}
+	if !ipAllowed(c.clientIP, msg.PollID) {
+		status, body = http.StatusForbidden, map[string]interface{}{"error": ipDeniedMessage}
+	} else {
+		status, body = applyEnhancedVote(msg.PollID, EnhancedVoteInput{
+			OptionIDs:   msg.OptionIDs,
+			MessageID:   msg.MessageID,
+			ProofOfWork: msg.ProofOfWork,
+		}, c.clientIP, c.userAgent)
+	}
+
+	var result wsVoteReply
+	if status < http.StatusBadRequest {
+		result = wsVoteReply{
+			Type:      WSTypeVoteAck,
+			MessageID: msg.MessageID,
+			PollID:    msg.PollID,
+			Data:      body,
+		}
+	} else {
+		message, _ := body["error"].(string)
+		result = voteErrorMessage(msg, status, message)
+		result.PowRequired, _ = body["pow_required"].(bool)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		releaseVoteMessage(key)
+		return
+	}
+
+	// 服务端错误时投票未记录，允许客户端用同一消息ID重试
+	if status >= http.StatusInternalServerError {
+		releaseVoteMessage(key)
+	} else {
+		storeVoteReply(key, string(data))
+	}
+	c.hub.control <- &clientRequest{client: c, action: wsActionReply, reply: data}
+}
+
+// voteErrorMessage 构造VOTE_ERROR消息，code与HTTP接口的状态码一致
+func voteErrorMessage(msg wsClientMessage, code int, message string) wsVoteReply {
+	return wsVoteReply{
+		Type:      WSTypeVoteError,
+		MessageID: msg.MessageID,
+		PollID:    msg.PollID,
+		Code:      code,
+		Error:     message,
+	}
+}
@@ -0,0 +1,212 @@
+// Package ipfilter 实现基于IP/CIDR的投票访问控制，支持IPv4和IPv6
+//
+// 判定顺序：
+//  1. 命中投票级或全局的deny规则：拒绝（deny优先于allow）
+//  2. 投票配置了allow规则：只有命中其中之一才允许
+//  3. 存在全局allow规则：只有命中其中之一才允许
+//  4. 其余情况允许
+package ipfilter
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-voting-backend/models"
+)
+
+// Decision 判定结果
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	RuleID  uint   `json:"rule_id,omitempty"` // 命中的规则
+}
+
+// compiledRule 预解析的规则
+type compiledRule struct {
+	id      uint
+	network *net.IPNet
+}
+
+// ruleList 同一作用域内的allow/deny规则
+type ruleList struct {
+	allow []compiledRule
+	deny  []compiledRule
+}
+
+// RuleSet 编译后的全部规则
+type RuleSet struct {
+	global ruleList
+	polls  map[uint]*ruleList
+}
+
+// ParseCIDR 解析CIDR，单个IP视为/32或/128，返回规范化后的网段
+func ParseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的IP地址: %s", value)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR: %s", value)
+	}
+	return network, nil
+}
+
+// Compile 将数据库中的规则编译为RuleSet，无法解析的规则会被跳过并返回错误列表
+func Compile(rules []models.IPRule) (*RuleSet, []error) {
+	set := &RuleSet{polls: make(map[uint]*ruleList)}
+	var errs []error
+
+	for _, rule := range rules {
+		network, err := ParseCIDR(rule.CIDR)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("规则 %d: %v", rule.ID, err))
+			continue
+		}
+
+		list := &set.global
+		if rule.PollID != nil {
+			list = set.polls[*rule.PollID]
+			if list == nil {
+				list = &ruleList{}
+				set.polls[*rule.PollID] = list
+			}
+		}
+
+		compiled := compiledRule{id: rule.ID, network: network}
+		switch rule.Action {
+		case models.IPRuleAllow:
+			list.allow = append(list.allow, compiled)
+		case models.IPRuleDeny:
+			list.deny = append(list.deny, compiled)
+		default:
+			errs = append(errs, fmt.Errorf("规则 %d: 未知的动作 %s", rule.ID, rule.Action))
+		}
+	}
+
+	return set, errs
+}
+
+// match 返回第一个包含该IP的规则
+func match(rules []compiledRule, ip net.IP) (uint, bool) {
+	for _, rule := range rules {
+		if rule.network.Contains(ip) {
+			return rule.id, true
+		}
+	}
+	return 0, false
+}
+
+// Decide 判定IP能否参与指定投票，pollID为0时只检查全局规则
+func (s *RuleSet) Decide(ipStr string, pollID uint) Decision {
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return Decision{Allowed: false, Reason: "无法识别客户端IP"}
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	pollRules := s.polls[pollID]
+
+	if pollRules != nil {
+		if id, ok := match(pollRules.deny, ip); ok {
+			return Decision{Allowed: false, Reason: "命中投票黑名单", RuleID: id}
+		}
+	}
+	if id, ok := match(s.global.deny, ip); ok {
+		return Decision{Allowed: false, Reason: "命中全局黑名单", RuleID: id}
+	}
+
+	if pollRules != nil && len(pollRules.allow) > 0 {
+		if id, ok := match(pollRules.allow, ip); ok {
+			return Decision{Allowed: true, Reason: "命中投票白名单", RuleID: id}
+		}
+		return Decision{Allowed: false, Reason: "不在投票白名单内"}
+	}
+
+	if len(s.global.allow) > 0 {
+		if id, ok := match(s.global.allow, ip); ok {
+			return Decision{Allowed: true, Reason: "命中全局白名单", RuleID: id}
+		}
+		return Decision{Allowed: false, Reason: "不在全局白名单内"}
+	}
+
+	return Decision{Allowed: true, Reason: "未配置限制"}
+}
+
+// Cache 进程内规则缓存
+// 本实例修改规则后调用Invalidate立即失效；其他实例的修改在refresh间隔后生效
+type Cache struct {
+	loader   func() ([]models.IPRule, error)
+	refresh  time.Duration
+	mu       sync.RWMutex
+	rules    *RuleSet
+	loadedAt time.Time
+}
+
+// NewCache 创建规则缓存，loader负责从数据库读取全部规则
+func NewCache(loader func() ([]models.IPRule, error), refresh time.Duration) *Cache {
+	return &Cache{
+		loader:  loader,
+		refresh: refresh,
+	}
+}
+
+// Invalidate 使缓存失效，下次读取时重新加载
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// Get 返回当前规则，缓存失效或过期时重新加载
+// 加载失败时继续使用旧规则；从未加载成功时返回错误
+func (c *Cache) Get() (*RuleSet, error) {
+	c.mu.RLock()
+	rules := c.rules
+	fresh := rules != nil && time.Since(c.loadedAt) < c.refresh
+	c.mu.RUnlock()
+	if fresh {
+		return rules, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 其他goroutine可能已经完成加载
+	if c.rules != nil && time.Since(c.loadedAt) < c.refresh {
+		return c.rules, nil
+	}
+
+	loaded, err := c.loader()
+	if err != nil {
+		if c.rules != nil {
+			// 推迟下次重试，避免数据库故障时每个请求都去加载
+			log.Printf("加载IP规则失败，继续使用旧规则: %v", err)
+			c.loadedAt = time.Now()
+			return c.rules, nil
+		}
+		return nil, err
+	}
+
+	compiled, errs := Compile(loaded)
+	for _, err := range errs {
+		log.Printf("跳过无效的IP规则: %v", err)
+	}
+	c.rules = compiled
+	c.loadedAt = time.Now()
+	return compiled, nil
+}
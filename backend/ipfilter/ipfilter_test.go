@@ -0,0 +1,96 @@
+package ipfilter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"realtime-voting-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pollID(id uint) *uint {
+	return &id
+}
+
+func TestDecide_Precedence(t *testing.T) {
+	rules, errs := Compile([]models.IPRule{
+		{ID: 1, CIDR: "198.51.100.0/24", Action: models.IPRuleDeny},
+		{ID: 2, PollID: pollID(7), CIDR: "10.0.0.0/8", Action: models.IPRuleAllow},
+		{ID: 3, PollID: pollID(7), CIDR: "10.9.0.0/16", Action: models.IPRuleDeny},
+		{ID: 4, PollID: pollID(8), CIDR: "2001:db8::/32", Action: models.IPRuleAllow},
+	})
+	require.Empty(t, errs)
+
+	// Polls without their own rules only see the global deny list
+	assert.True(t, rules.Decide("203.0.113.5", 1).Allowed)
+	assert.False(t, rules.Decide("198.51.100.9", 1).Allowed)
+
+	// Poll 7 is restricted to 10/8, minus the denied 10.9/16
+	assert.True(t, rules.Decide("10.1.2.3", 7).Allowed)
+	assert.False(t, rules.Decide("203.0.113.5", 7).Allowed)
+	decision := rules.Decide("10.9.1.1", 7)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, uint(3), decision.RuleID)
+
+	// IPv6 allow list
+	assert.True(t, rules.Decide("2001:db8:abcd::1", 8).Allowed)
+	assert.False(t, rules.Decide("2001:db9::1", 8).Allowed)
+	assert.False(t, rules.Decide("10.1.2.3", 8).Allowed)
+
+	assert.False(t, rules.Decide("garbage", 1).Allowed)
+}
+
+func TestDecide_GlobalAllowList(t *testing.T) {
+	rules, _ := Compile([]models.IPRule{
+		{ID: 1, CIDR: "192.0.2.10", Action: models.IPRuleAllow},
+	})
+
+	assert.True(t, rules.Decide("192.0.2.10", 3).Allowed)
+	assert.True(t, rules.Decide("::ffff:192.0.2.10", 3).Allowed)
+	assert.False(t, rules.Decide("192.0.2.11", 3).Allowed)
+}
+
+func TestCompile_SkipsInvalidRules(t *testing.T) {
+	rules, errs := Compile([]models.IPRule{
+		{ID: 1, CIDR: "not-a-cidr", Action: models.IPRuleDeny},
+		{ID: 2, CIDR: "192.0.2.0/24", Action: "block"},
+	})
+	assert.Len(t, errs, 2)
+	assert.True(t, rules.Decide("192.0.2.1", 1).Allowed)
+}
+
+func TestCache_InvalidateAndFallback(t *testing.T) {
+	loads := 0
+	stored := []models.IPRule{{ID: 1, CIDR: "192.0.2.0/24", Action: models.IPRuleDeny}}
+	var loadErr error
+
+	cache := NewCache(func() ([]models.IPRule, error) {
+		loads++
+		return stored, loadErr
+	}, time.Hour)
+
+	rules, err := cache.Get()
+	require.NoError(t, err)
+	assert.False(t, rules.Decide("192.0.2.1", 1).Allowed)
+
+	// Cached until invalidated
+	stored = nil
+	_, _ = cache.Get()
+	assert.Equal(t, 1, loads)
+
+	cache.Invalidate()
+	rules, err = cache.Get()
+	require.NoError(t, err)
+	assert.True(t, rules.Decide("192.0.2.1", 1).Allowed)
+	assert.Equal(t, 2, loads)
+
+	// A failing reload keeps serving the last good rules
+	cache.Invalidate()
+	loadErr = errors.New("db down")
+	rules, err = cache.Get()
+	require.NoError(t, err)
+	assert.NotNil(t, rules)
+}
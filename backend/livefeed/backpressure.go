@@ -0,0 +1,117 @@
+package livefeed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SlowConsumerPolicy 客户端发送队列已满时的处理策略
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDisconnect 断开客户端，客户端重连后按序号补发或收到快照（默认）
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyDropOldest 丢弃队列中尚未发送的消息，只保留每个投票的最新状态
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyBlock 等待客户端腾出队列空间，超时后断开
+	PolicyBlock SlowConsumerPolicy = "block"
+)
+
+// ParseSlowConsumerPolicy 解析慢消费者策略，空字符串表示默认的disconnect
+func ParseSlowConsumerPolicy(s string) (SlowConsumerPolicy, error) {
+	switch policy := SlowConsumerPolicy(s); policy {
+	case "":
+		return PolicyDisconnect, nil
+	case PolicyDisconnect, PolicyDropOldest, PolicyBlock:
+		return policy, nil
+	default:
+		return PolicyDisconnect, fmt.Errorf("未知的慢消费者策略: %q", s)
+	}
+}
+
+// LagStats 单个消费者的积压统计
+type LagStats struct {
+	Enqueued   int64   `json:"enqueued"`    // 写入发送队列的消息数
+	Delivered  int64   `json:"delivered"`   // 已写入连接的消息数
+	Dropped    int64   `json:"dropped"`     // 队列满时被丢弃的消息数
+	Pending    int64   `json:"pending"`     // 队列中等待发送的消息数
+	MaxPending int64   `json:"max_pending"` // 等待发送消息数的最大值
+	BlockedMs  float64 `json:"blocked_ms"`  // 广播等待队列空间的累计时间
+	LagMs      float64 `json:"lag_ms"`      // 最早一条未发送消息已等待的时间，没有积压时为0
+}
+
+// LagTracker 记录单个消费者的积压情况
+// 入队和丢弃由生产者记录，发送由消费者记录，可以并发调用
+type LagTracker struct {
+	mu           sync.Mutex
+	enqueued     int64
+	delivered    int64
+	dropped      int64
+	maxPending   int64
+	blocked      time.Duration
+	pendingSince time.Time // 队列从空变为非空，或积压期间最近一次发送的时间
+}
+
+// Enqueued 记录n条消息写入队列
+func (t *LagTracker) Enqueued(n int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pendingLocked() == 0 {
+		t.pendingSince = now
+	}
+	t.enqueued += int64(n)
+	if pending := t.pendingLocked(); pending > t.maxPending {
+		t.maxPending = pending
+	}
+}
+
+// Delivered 记录n条消息已发送
+func (t *LagTracker) Delivered(n int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delivered += int64(n)
+	t.pendingSince = now
+}
+
+// Dropped 记录n条已入队的消息被丢弃
+func (t *LagTracker) Dropped(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropped += int64(n)
+}
+
+// Blocked 记录生产者等待队列空间的时间
+func (t *LagTracker) Blocked(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blocked += d
+}
+
+// Stats 返回当前的积压统计
+func (t *LagTracker) Stats(now time.Time) LagStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := LagStats{
+		Enqueued:   t.enqueued,
+		Delivered:  t.delivered,
+		Dropped:    t.dropped,
+		Pending:    t.pendingLocked(),
+		MaxPending: t.maxPending,
+		BlockedMs:  float64(t.blocked) / float64(time.Millisecond),
+	}
+	if stats.Pending > 0 && now.After(t.pendingSince) {
+		stats.LagMs = float64(now.Sub(t.pendingSince)) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+func (t *LagTracker) pendingLocked() int64 {
+	pending := t.enqueued - t.delivered - t.dropped
+	if pending < 0 {
+		return 0
+	}
+	return pending
+}
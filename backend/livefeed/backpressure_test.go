@@ -0,0 +1,70 @@
+package livefeed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	for input, want := range map[string]SlowConsumerPolicy{
+		"":            PolicyDisconnect,
+		"disconnect":  PolicyDisconnect,
+		"drop_oldest": PolicyDropOldest,
+		"block":       PolicyBlock,
+	} {
+		policy, err := ParseSlowConsumerPolicy(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, policy)
+	}
+
+	policy, err := ParseSlowConsumerPolicy("drop-newest")
+	assert.Error(t, err)
+	assert.Equal(t, PolicyDisconnect, policy)
+}
+
+func TestLagTracker(t *testing.T) {
+	var lag LagTracker
+	start := time.Unix(1000, 0)
+
+	assert.Equal(t, LagStats{}, lag.Stats(start))
+
+	lag.Enqueued(1, start)
+	lag.Enqueued(1, start.Add(10*time.Millisecond))
+	lag.Enqueued(1, start.Add(20*time.Millisecond))
+	stats := lag.Stats(start.Add(100 * time.Millisecond))
+	assert.Equal(t, int64(3), stats.Pending)
+	assert.Equal(t, int64(3), stats.MaxPending)
+	// Lag is measured from when the queue stopped being empty
+	assert.Equal(t, 100.0, stats.LagMs)
+
+	// A delivery restarts the lag clock for what is still queued
+	lag.Delivered(1, start.Add(150*time.Millisecond))
+	stats = lag.Stats(start.Add(200 * time.Millisecond))
+	assert.Equal(t, int64(2), stats.Pending)
+	assert.Equal(t, 50.0, stats.LagMs)
+
+	lag.Dropped(2)
+	lag.Blocked(30 * time.Millisecond)
+	stats = lag.Stats(start.Add(300 * time.Millisecond))
+	assert.Equal(t, LagStats{
+		Enqueued:   3,
+		Delivered:  1,
+		Dropped:    2,
+		MaxPending: 3,
+		BlockedMs:  30,
+	}, stats)
+}
+
+func TestLagTracker_DeliveredBeforeEnqueued(t *testing.T) {
+	var lag LagTracker
+	now := time.Now()
+
+	// The consumer may record a delivery before the producer records the enqueue
+	lag.Delivered(1, now)
+	assert.Equal(t, int64(0), lag.Stats(now).Pending)
+	lag.Enqueued(1, now)
+	assert.Equal(t, int64(0), lag.Stats(now).Pending)
+}
@@ -0,0 +1,171 @@
+package livefeed
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoalescerStats 合并器的运行统计
+type CoalescerStats struct {
+	Triggers int64   `json:"triggers"`  // 收到的广播请求数
+	Emits    int64   `json:"emits"`     // 实际执行的广播数
+	Saved    int64   `json:"saved"`     // 被合并掉的广播数
+	EmitRate float64 `json:"emit_rate"` // 最近一分钟平均每秒广播数
+}
+
+// coalesceState 单个投票的合并状态
+type coalesceState struct {
+	scheduled bool // 当前窗口内已安排了下一次广播
+	pending   bool // 上次广播之后又收到了新的请求
+}
+
+// Coalescer 按投票合并广播请求，每个间隔内最多广播一次
+// 空闲时第一次请求立即广播，间隔内的后续请求合并为间隔结束时的一次广播，
+// 最后一次请求之后总会有一次广播，保证最终状态不会丢失
+type Coalescer struct {
+	interval time.Duration
+	emit     func(pollID uint)
+
+	mu    sync.Mutex
+	polls map[uint]*coalesceState
+	wg    sync.WaitGroup // 进行中的合并窗口
+
+	triggers int64
+	emits    int64
+	rate     *rateCounter
+}
+
+// NewCoalescer 创建合并器，emit负责读取最新状态并广播，同一投票的emit不会并发执行
+// interval为0时不合并，每次请求都立即广播
+func NewCoalescer(interval time.Duration, emit func(pollID uint)) *Coalescer {
+	return &Coalescer{
+		interval: interval,
+		emit:     emit,
+		polls:    make(map[uint]*coalesceState),
+		rate:     newRateCounter(time.Minute),
+	}
+}
+
+// Trigger 请求广播投票的最新状态
+func (c *Coalescer) Trigger(pollID uint) {
+	atomic.AddInt64(&c.triggers, 1)
+
+	if c.interval <= 0 {
+		c.doEmit(pollID)
+		return
+	}
+
+	c.mu.Lock()
+	st, ok := c.polls[pollID]
+	if ok && st.scheduled {
+		st.pending = true
+		c.mu.Unlock()
+		return
+	}
+	if !ok {
+		st = &coalesceState{}
+		c.polls[pollID] = st
+	}
+	st.scheduled = true
+	c.mu.Unlock()
+
+	// 空闲状态下立即广播，之后进入合并窗口
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(pollID)
+	}()
+}
+
+// Flush 等待已安排的广播全部执行完毕，包括合并窗口结束时的最后一次广播
+func (c *Coalescer) Flush() {
+	c.wg.Wait()
+}
+
+// run 广播一次，然后在每个间隔结束时检查是否有新的请求
+func (c *Coalescer) run(pollID uint) {
+	for {
+		c.doEmit(pollID)
+		time.Sleep(c.interval)
+
+		c.mu.Lock()
+		st := c.polls[pollID]
+		if !st.pending {
+			// 窗口内没有新请求，回到空闲状态
+			delete(c.polls, pollID)
+			c.mu.Unlock()
+			return
+		}
+		st.pending = false
+		c.mu.Unlock()
+	}
+}
+
+func (c *Coalescer) doEmit(pollID uint) {
+	atomic.AddInt64(&c.emits, 1)
+	c.rate.Add(time.Now())
+	c.emit(pollID)
+}
+
+// Stats 返回运行统计
+func (c *Coalescer) Stats() CoalescerStats {
+	triggers := atomic.LoadInt64(&c.triggers)
+	emits := atomic.LoadInt64(&c.emits)
+	return CoalescerStats{
+		Triggers: triggers,
+		Emits:    emits,
+		Saved:    triggers - emits,
+		EmitRate: c.rate.Rate(time.Now()),
+	}
+}
+
+// rateCounter 按秒分桶统计最近一段时间内的事件速率
+type rateCounter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets []int64
+	seconds []int64 // 每个桶对应的Unix秒
+}
+
+func newRateCounter(window time.Duration) *rateCounter {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &rateCounter{
+		window:  window,
+		buckets: make([]int64, n),
+		seconds: make([]int64, n),
+	}
+}
+
+// Add 记录一次事件
+func (r *rateCounter) Add(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sec := now.Unix()
+	i := int(sec % int64(len(r.buckets)))
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.buckets[i] = 0
+	}
+	r.buckets[i]++
+}
+
+// Rate 返回窗口内平均每秒事件数
+func (r *rateCounter) Rate(now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sec := now.Unix()
+	n := int64(len(r.buckets))
+	var total int64
+	for i := range r.buckets {
+		if sec-r.seconds[i] < n {
+			total += r.buckets[i]
+		}
+	}
+	return float64(total) / r.window.Seconds()
+}
@@ -0,0 +1,109 @@
+package livefeed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stateRecorder simulates a poll whose state changes with every trigger.
+type stateRecorder struct {
+	mu      sync.Mutex
+	state   int
+	emitted []int
+}
+
+func (r *stateRecorder) bump() {
+	r.mu.Lock()
+	r.state++
+	r.mu.Unlock()
+}
+
+func (r *stateRecorder) emit(uint) {
+	r.mu.Lock()
+	r.emitted = append(r.emitted, r.state)
+	r.mu.Unlock()
+}
+
+func (r *stateRecorder) snapshot() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.emitted...)
+}
+
+func TestCoalescer_LeadingAndTrailingEmit(t *testing.T) {
+	rec := &stateRecorder{}
+	c := NewCoalescer(50*time.Millisecond, rec.emit)
+
+	for i := 0; i < 100; i++ {
+		rec.bump()
+		c.Trigger(1)
+	}
+
+	assert.Eventually(t, func() bool {
+		emitted := rec.snapshot()
+		return len(emitted) >= 2 && emitted[len(emitted)-1] == 100
+	}, time.Second, 10*time.Millisecond)
+
+	// Give the coalescer time to go idle; no further emits should happen
+	time.Sleep(120 * time.Millisecond)
+	emitted := rec.snapshot()
+	assert.Equal(t, 100, emitted[len(emitted)-1], "final state must be broadcast")
+	assert.LessOrEqual(t, len(emitted), 3)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(100), stats.Triggers)
+	assert.Equal(t, int64(len(emitted)), stats.Emits)
+	assert.Equal(t, stats.Triggers-stats.Emits, stats.Saved)
+	assert.Greater(t, stats.EmitRate, 0.0)
+}
+
+func TestCoalescer_IdleTriggerEmitsImmediately(t *testing.T) {
+	rec := &stateRecorder{}
+	c := NewCoalescer(time.Hour, rec.emit)
+
+	rec.bump()
+	c.Trigger(1)
+	c.Trigger(2)
+	assert.Eventually(t, func() bool { return len(rec.snapshot()) == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestCoalescer_FlushWaitsForTrailingEmit(t *testing.T) {
+	rec := &stateRecorder{}
+	c := NewCoalescer(30*time.Millisecond, rec.emit)
+
+	for i := 0; i < 10; i++ {
+		rec.bump()
+		c.Trigger(1)
+	}
+	c.Flush()
+
+	// Nothing runs after Flush returns, so the recorder can be read without waiting
+	emitted := rec.snapshot()
+	assert.Equal(t, 10, emitted[len(emitted)-1])
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, emitted, rec.snapshot())
+}
+
+func TestCoalescer_ZeroIntervalDisablesCoalescing(t *testing.T) {
+	rec := &stateRecorder{}
+	c := NewCoalescer(0, rec.emit)
+	for i := 0; i < 5; i++ {
+		c.Trigger(1)
+	}
+	assert.Len(t, rec.snapshot(), 5)
+	assert.Equal(t, int64(0), c.Stats().Saved)
+}
+
+func TestRateCounter(t *testing.T) {
+	r := newRateCounter(10 * time.Second)
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 20; i++ {
+		r.Add(now.Add(time.Duration(i%5) * time.Second))
+	}
+	assert.InDelta(t, 2.0, r.Rate(now.Add(5*time.Second)), 0.001)
+	// Everything has aged out of the window
+	assert.Equal(t, 0.0, r.Rate(now.Add(time.Minute)))
+}
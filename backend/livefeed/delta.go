@@ -0,0 +1,105 @@
+package livefeed
+
+import "sync"
+
+// OptionCount 单个选项的票数
+type OptionCount struct {
+	ID    uint  `json:"id"`
+	Votes int64 `json:"votes"`
+}
+
+// Delta 一次更新相对于上一次发出的更新的变化
+type Delta struct {
+	Seq      uint64
+	BaseSeq  uint64        // 增量基于的序号，客户端本地序号不小于它时才能应用
+	Keyframe bool          // 为true时应发送完整结果
+	Changes  []OptionCount // 票数发生变化的选项
+}
+
+// deltaState 单个投票的编码状态
+type deltaState struct {
+	lastSeq       uint64 // 最近处理的序号
+	emittedSeq    uint64 // 最近发出的序号，被抑制的空增量不计入
+	sinceKeyframe int    // 上一个关键帧之后发出的增量数
+	counts        map[uint]int64
+}
+
+// DeltaEncoder 将完整结果转换为增量，必须按序号顺序调用
+type DeltaEncoder struct {
+	mu               sync.Mutex
+	keyframeInterval int
+	polls            map[uint]*deltaState
+}
+
+// NewDeltaEncoder 创建增量编码器，每发出keyframeInterval个增量后强制发送一次关键帧
+func NewDeltaEncoder(keyframeInterval int) *DeltaEncoder {
+	return &DeltaEncoder{
+		keyframeInterval: keyframeInterval,
+		polls:            make(map[uint]*deltaState),
+	}
+}
+
+// Encode 计算序号为seq的完整结果相对于上一次更新的增量
+// 第二个返回值为false表示无需向增量客户端发送（票数没有变化或更新已过期）
+func (e *DeltaEncoder) Encode(pollID uint, seq uint64, options []OptionCount) (Delta, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[uint]int64, len(options))
+	for _, opt := range options {
+		counts[opt.ID] = opt.Votes
+	}
+
+	st, ok := e.polls[pollID]
+	if ok && seq <= st.lastSeq {
+		// 乱序到达的旧更新，增量客户端已经有更新的状态
+		return Delta{}, false
+	}
+
+	keyframe := !ok || seq != st.lastSeq+1 || st.sinceKeyframe >= e.keyframeInterval
+	var changes []OptionCount
+	if !keyframe {
+		for id := range st.counts {
+			if _, exists := counts[id]; !exists {
+				// 选项被删除无法用增量表示
+				keyframe = true
+				break
+			}
+		}
+	}
+	if !keyframe {
+		for _, opt := range options {
+			if prev, exists := st.counts[opt.ID]; !exists || prev != opt.Votes {
+				changes = append(changes, opt)
+			}
+		}
+	}
+
+	if !ok {
+		st = &deltaState{}
+		e.polls[pollID] = st
+	}
+	st.lastSeq = seq
+	st.counts = counts
+
+	if keyframe {
+		st.emittedSeq = seq
+		st.sinceKeyframe = 0
+		return Delta{Seq: seq, Keyframe: true}, true
+	}
+	if len(changes) == 0 {
+		return Delta{}, false
+	}
+
+	delta := Delta{Seq: seq, BaseSeq: st.emittedSeq, Changes: changes}
+	st.emittedSeq = seq
+	st.sinceKeyframe++
+	return delta, true
+}
+
+// Forget 清除投票的编码状态，下一次更新将作为关键帧发送
+func (e *DeltaEncoder) Forget(pollID uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.polls, pollID)
+}
@@ -0,0 +1,69 @@
+package livefeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func counts(votes ...int64) []OptionCount {
+	out := make([]OptionCount, len(votes))
+	for i, v := range votes {
+		out[i] = OptionCount{ID: uint(i + 1), Votes: v}
+	}
+	return out
+}
+
+func TestDeltaEncoder_ChangesAndSuppression(t *testing.T) {
+	e := NewDeltaEncoder(10)
+
+	d, emit := e.Encode(1, 1, counts(0, 0, 0))
+	assert.True(t, emit)
+	assert.True(t, d.Keyframe)
+
+	d, emit = e.Encode(1, 2, counts(1, 0, 0))
+	assert.True(t, emit)
+	assert.False(t, d.Keyframe)
+	assert.Equal(t, uint64(1), d.BaseSeq)
+	assert.Equal(t, []OptionCount{{ID: 1, Votes: 1}}, d.Changes)
+
+	// A repeated broadcast with the same counts is not sent
+	_, emit = e.Encode(1, 3, counts(1, 0, 0))
+	assert.False(t, emit)
+
+	// The next delta is based on the last one actually sent
+	d, emit = e.Encode(1, 4, counts(1, 2, 1))
+	assert.True(t, emit)
+	assert.Equal(t, uint64(2), d.BaseSeq)
+	assert.Equal(t, []OptionCount{{ID: 2, Votes: 2}, {ID: 3, Votes: 1}}, d.Changes)
+
+	// Stale updates arriving late are dropped
+	_, emit = e.Encode(1, 4, counts(9, 9, 9))
+	assert.False(t, emit)
+}
+
+func TestDeltaEncoder_Keyframes(t *testing.T) {
+	e := NewDeltaEncoder(2)
+	e.Encode(1, 1, counts(0))
+
+	d, _ := e.Encode(1, 2, counts(1))
+	assert.False(t, d.Keyframe)
+	d, _ = e.Encode(1, 3, counts(2))
+	assert.False(t, d.Keyframe)
+	// Interval reached
+	d, _ = e.Encode(1, 4, counts(3))
+	assert.True(t, d.Keyframe)
+
+	// A gap in sequence numbers means our counts may be stale
+	d, _ = e.Encode(1, 6, counts(5))
+	assert.True(t, d.Keyframe)
+
+	// Removed options cannot be expressed as a delta
+	e.Encode(1, 7, counts(5, 1))
+	d, _ = e.Encode(1, 8, counts(5))
+	assert.True(t, d.Keyframe)
+
+	e.Forget(1)
+	d, _ = e.Encode(1, 9, counts(5))
+	assert.True(t, d.Keyframe)
+}
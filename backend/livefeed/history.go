@@ -0,0 +1,145 @@
+package livefeed
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry 一条带序号的实时更新
+type Entry struct {
+	Seq  uint64
+	Data []byte
+	At   time.Time
+}
+
+// pollHistory 单个投票的更新历史
+type pollHistory struct {
+	entries []Entry // 按序号升序
+	latest  uint64  // 见过的最大序号，历史被清理后仍然保留
+}
+
+// History 按投票保存最近的实时更新，用于客户端断线重连后补发
+type History struct {
+	mu        sync.RWMutex
+	capacity  int
+	retention time.Duration
+	polls     map[uint]*pollHistory
+}
+
+// NewHistory 创建更新历史，每个投票最多保留capacity条，超过retention的更新会被清理
+func NewHistory(capacity int, retention time.Duration) *History {
+	return &History{
+		capacity:  capacity,
+		retention: retention,
+		polls:     make(map[uint]*pollHistory),
+	}
+}
+
+// Append 保存一条更新，重复的序号会被忽略
+// 来自其他实例的更新可能乱序到达，按序号插入到正确的位置
+func (h *History) Append(pollID uint, seq uint64, data []byte) {
+	h.AppendAt(pollID, seq, data, time.Now())
+}
+
+// AppendAt 与Append相同，但使用指定的时间
+func (h *History) AppendAt(pollID uint, seq uint64, data []byte, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ph, ok := h.polls[pollID]
+	if !ok {
+		ph = &pollHistory{}
+		h.polls[pollID] = ph
+	}
+
+	entries := ph.entries
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Seq >= seq })
+	if i < len(entries) && entries[i].Seq == seq {
+		return
+	}
+	if seq > ph.latest {
+		ph.latest = seq
+	}
+
+	entries = append(entries, Entry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = Entry{Seq: seq, Data: data, At: at}
+
+	if len(entries) > h.capacity {
+		entries = append([]Entry(nil), entries[len(entries)-h.capacity:]...)
+	}
+	ph.entries = entries
+}
+
+// Since 返回序号大于since的全部更新
+// 第二个返回值为false表示无法准确补发（更新已被清理、未收到或since超出已知范围），调用方应改为发送完整快照
+func (h *History) Since(pollID uint, since uint64) ([]Entry, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ph, ok := h.polls[pollID]
+	if !ok {
+		return nil, since == 0
+	}
+	if since > ph.latest {
+		return nil, false
+	}
+
+	entries := ph.entries
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Seq > since })
+	missed := entries[i:]
+
+	expected := since + 1
+	for _, entry := range missed {
+		if entry.Seq != expected {
+			return nil, false
+		}
+		expected++
+	}
+	if expected-1 != ph.latest {
+		return nil, false
+	}
+
+	return append([]Entry(nil), missed...), true
+}
+
+// Latest 返回投票最新的一条更新
+func (h *History) Latest(pollID uint) (Entry, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ph, ok := h.polls[pollID]
+	if !ok || len(ph.entries) == 0 {
+		return Entry{}, false
+	}
+	return ph.entries[len(ph.entries)-1], true
+}
+
+// LatestSeq 返回投票见过的最大序号
+func (h *History) LatestSeq(pollID uint) uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if ph, ok := h.polls[pollID]; ok {
+		return ph.latest
+	}
+	return 0
+}
+
+// Cleanup 清理超过保留时间的更新
+func (h *History) Cleanup(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := now.Add(-h.retention)
+	for _, ph := range h.polls {
+		kept := ph.entries[:0]
+		for _, entry := range ph.entries {
+			if !entry.At.Before(cutoff) {
+				kept = append(kept, entry)
+			}
+		}
+		ph.entries = kept
+	}
+}
@@ -0,0 +1,92 @@
+package livefeed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seqs(entries []Entry) []uint64 {
+	out := make([]uint64, len(entries))
+	for i, entry := range entries {
+		out[i] = entry.Seq
+	}
+	return out
+}
+
+func TestHistory_SinceReturnsMissedUpdates(t *testing.T) {
+	h := NewHistory(10, time.Minute)
+	for seq := uint64(1); seq <= 5; seq++ {
+		h.Append(1, seq, []byte{byte(seq)})
+	}
+
+	missed, ok := h.Since(1, 2)
+	require.True(t, ok)
+	assert.Equal(t, []uint64{3, 4, 5}, seqs(missed))
+
+	missed, ok = h.Since(1, 5)
+	require.True(t, ok)
+	assert.Empty(t, missed)
+
+	// A client ahead of the server cannot be resumed
+	_, ok = h.Since(1, 9)
+	assert.False(t, ok)
+}
+
+func TestHistory_OutOfOrderAndDuplicates(t *testing.T) {
+	h := NewHistory(10, time.Minute)
+	h.Append(1, 1, nil)
+	h.Append(1, 3, nil)
+	h.Append(1, 2, nil)
+	h.Append(1, 3, nil)
+
+	missed, ok := h.Since(1, 0)
+	require.True(t, ok)
+	assert.Equal(t, []uint64{1, 2, 3}, seqs(missed))
+}
+
+func TestHistory_GapRequiresSnapshot(t *testing.T) {
+	h := NewHistory(3, time.Minute)
+	for seq := uint64(1); seq <= 6; seq++ {
+		h.Append(1, seq, nil)
+	}
+
+	// Only 4..6 are kept
+	_, ok := h.Since(1, 2)
+	assert.False(t, ok)
+	missed, ok := h.Since(1, 3)
+	require.True(t, ok)
+	assert.Equal(t, []uint64{4, 5, 6}, seqs(missed))
+
+	// A hole in the middle (update 8 never arrived)
+	h.Append(1, 7, nil)
+	h.Append(1, 9, nil)
+	_, ok = h.Since(1, 6)
+	assert.False(t, ok)
+}
+
+func TestHistory_CleanupKeepsLatestSeq(t *testing.T) {
+	h := NewHistory(10, time.Minute)
+	old := time.Now().Add(-2 * time.Minute)
+	h.AppendAt(1, 1, nil, old)
+	h.AppendAt(1, 2, nil, old)
+	h.Cleanup(time.Now())
+
+	_, found := h.Latest(1)
+	assert.False(t, found)
+	assert.Equal(t, uint64(2), h.LatestSeq(1))
+
+	// Up to date clients need nothing, stale ones need a snapshot
+	_, ok := h.Since(1, 2)
+	assert.True(t, ok)
+	_, ok = h.Since(1, 1)
+	assert.False(t, ok)
+
+	// Unknown polls can only serve clients that have seen nothing
+	_, ok = h.Since(2, 0)
+	assert.True(t, ok)
+	_, ok = h.Since(2, 1)
+	assert.False(t, ok)
+}
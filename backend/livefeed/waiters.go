@@ -0,0 +1,103 @@
+package livefeed
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTooManyWaiters 挂起的请求已达上限
+var ErrTooManyWaiters = errors.New("挂起的长轮询请求过多")
+
+// Waiters 按投票登记等待更新的长轮询请求，限制同时挂起的请求数
+type Waiters struct {
+	mu       sync.Mutex
+	limit    int
+	count    int
+	rejected int64
+	polls    map[uint]map[*Waiter]struct{}
+}
+
+// Waiter 一个挂起的请求，投票有新的更新时C被关闭
+type Waiter struct {
+	C <-chan struct{}
+
+	ch      chan struct{}
+	pollID  uint
+	waiters *Waiters
+}
+
+// NewWaiters 创建等待登记，最多同时挂起limit个请求
+func NewWaiters(limit int) *Waiters {
+	return &Waiters{
+		limit: limit,
+		polls: make(map[uint]map[*Waiter]struct{}),
+	}
+}
+
+// Park 登记一个等待投票更新的请求，超过上限时返回ErrTooManyWaiters
+// 调用方在检查是否已有新更新之前登记，避免检查和等待之间的更新被错过
+func (w *Waiters) Park(pollID uint) (*Waiter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.count >= w.limit {
+		w.rejected++
+		return nil, ErrTooManyWaiters
+	}
+
+	ch := make(chan struct{})
+	waiter := &Waiter{C: ch, ch: ch, pollID: pollID, waiters: w}
+	set, ok := w.polls[pollID]
+	if !ok {
+		set = make(map[*Waiter]struct{})
+		w.polls[pollID] = set
+	}
+	set[waiter] = struct{}{}
+	w.count++
+	return waiter, nil
+}
+
+// Notify 唤醒等待投票更新的全部请求，返回唤醒的数量
+func (w *Waiters) Notify(pollID uint) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	set := w.polls[pollID]
+	for waiter := range set {
+		close(waiter.ch)
+	}
+	delete(w.polls, pollID)
+	w.count -= len(set)
+	return len(set)
+}
+
+// Release 请求结束时取消登记，已被唤醒的请求重复调用无影响
+func (waiter *Waiter) Release() {
+	w := waiter.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	set := w.polls[waiter.pollID]
+	if _, ok := set[waiter]; !ok {
+		return
+	}
+	delete(set, waiter)
+	if len(set) == 0 {
+		delete(w.polls, waiter.pollID)
+	}
+	w.count--
+}
+
+// Len 当前挂起的请求数
+func (w *Waiters) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Rejected 因达到上限被拒绝的请求数
+func (w *Waiters) Rejected() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rejected
+}
@@ -0,0 +1,63 @@
+package livefeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWaiters_NotifyWakesOnlyThatPoll(t *testing.T) {
+	w := NewWaiters(10)
+
+	a1, err := w.Park(1)
+	require.NoError(t, err)
+	a2, err := w.Park(1)
+	require.NoError(t, err)
+	b, err := w.Park(2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, w.Len())
+
+	assert.Equal(t, 2, w.Notify(1))
+	assert.True(t, closed(a1.C))
+	assert.True(t, closed(a2.C))
+	assert.False(t, closed(b.C))
+	assert.Equal(t, 1, w.Len())
+
+	// Releasing an already woken waiter does not double count
+	a1.Release()
+	assert.Equal(t, 1, w.Len())
+	assert.Equal(t, 0, w.Notify(1))
+
+	b.Release()
+	assert.Equal(t, 0, w.Len())
+	assert.Equal(t, 0, w.Notify(2))
+	assert.False(t, closed(b.C))
+}
+
+func TestWaiters_Limit(t *testing.T) {
+	w := NewWaiters(2)
+
+	first, err := w.Park(1)
+	require.NoError(t, err)
+	_, err = w.Park(2)
+	require.NoError(t, err)
+
+	_, err = w.Park(3)
+	assert.ErrorIs(t, err, ErrTooManyWaiters)
+	assert.Equal(t, int64(1), w.Rejected())
+
+	// Slots free up once a request finishes
+	first.Release()
+	_, err = w.Park(3)
+	assert.NoError(t, err)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -101,11 +102,11 @@ func main() {
 		log.Println("Redis连接初始化成功")
 	}
 
-	// 初始化消息队列适配器（自动选择RocketMQ或Redis MQ）
+	// 初始化消息队列适配器（按 MQ_BACKEND 选择 Redis、RocketMQ 或内存队列）
 	mqAdapter = mq.NewMQAdapter()
 	err = mqAdapter.Initialize()
 	if err != nil {
-		log.Printf("警告: 消息队列初始化失败，将使用内存模式: %v", err)
+		log.Printf("警告: 消息队列初始化失败，异步投票处理不可用: %v", err)
 	}
 
 	// 注册消息处理函数
@@ -120,6 +121,14 @@ func main() {
 	handlers.InitHandler(mqAdapter)
 	log.Println("已将消息队列适配器传递给处理程序")
 
+	// 启动跨实例WebSocket/SSE广播，Redis不可用时仅推送给本实例客户端
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	handlers.StartBroadcastRelay(relayCtx)
+
+	// 启动webhook投递，Redis不可用时任务保存在内存中
+	handlers.StartWebhookDispatcher(relayCtx)
+
 	// 设置路由
 	router := routes.SetupRouter()
 	log.Println("路由设置完成")
@@ -128,6 +137,9 @@ func main() {
 	srv := routes.StartServer(router)
 	log.Println("服务器启动成功")
 
+	// 启动gRPC服务器，与HTTP接口共用业务逻辑
+	grpcServer := routes.StartGRPCServer()
+
 	// 输出消息队列状态
 	stats := mqAdapter.GetQueueStats()
 	log.Printf("消息队列状态: %v", stats)
@@ -149,6 +161,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("服务器强制关闭: %v", err)
 	}
+	routes.ShutdownGRPCServer(ctx, grpcServer)
 
 	// 关闭数据库和消息队列连接
 	database.CloseDB()
@@ -164,29 +177,30 @@ func updateVoteInDatabase(pollID string, optionID string) error {
 	err := database.IncrementVote(pollID, optionID)
 	if err != nil {
 		log.Printf("错误: 无法更新选项 %s 的投票: %v", optionID, err)
-		return err
+		return classifyVoteError(err)
 	}
 
-	// 获取更新后的投票结果
-	pollResults, err := database.GetPollResults(uint(getPollIDUint(pollID)))
-	if err != nil {
-		log.Printf("错误: 无法获取投票 %s 的结果: %v", pollID, err)
-		return err
-	}
-
-	// 构建返回结果
-	poll := map[string]interface{}{
-		"poll_id": pollID,
-		"results": pollResults,
-	}
-
-	// 使用WebSocket广播更新
-	handlers.BroadcastPollUpdateStr(pollID, poll)
+	// 广播更新，消息队列批量消费时多次更新会合并为一次广播
+	handlers.SchedulePollBroadcast(uint(getPollIDUint(pollID)))
 
 	fmt.Printf("投票已更新: 投票ID=%s, 选项ID=%s\n", pollID, optionID)
 	return nil
 }
 
+// classifyVoteError 标记不需要重试的错误，其余错误（如数据库暂时不可用）按退避策略重试
+// 投票关闭后才处理到的票直接丢弃；投票、选项不存在或ID无效的票重试也不会成功，进入死信供排查
+func classifyVoteError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrPollClosed):
+		return mq.Drop(err)
+	case errors.Is(err, database.ErrPollNotFound),
+		errors.Is(err, database.ErrOptionNotFound),
+		errors.Is(err, database.ErrInvalidVote):
+		return mq.Permanent(err)
+	}
+	return err
+}
+
 // getPollIDUint 转换字符串ID为uint
 func getPollIDUint(pollID string) uint {
 	id, err := strconv.ParseUint(pollID, 10, 32)
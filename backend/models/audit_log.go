@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditLog 管理操作审计日志
+// 记录只允许追加，每条记录的Hash覆盖自身内容和上一条记录的Hash，形成哈希链
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Seq       uint64    `gorm:"not null;uniqueIndex" json:"seq"` // 连续递增的序号，用于检测缺失
+	Actor     string    `gorm:"size:128;not null;index" json:"actor"`
+	Action    string    `gorm:"size:64;not null;index" json:"action"`
+	Target    string    `gorm:"size:255;index" json:"target"`
+	Before    string    `gorm:"type:text" json:"before"` // 操作前状态（JSON）
+	After     string    `gorm:"type:text" json:"after"`  // 操作后状态（JSON）
+	Diff      string    `gorm:"type:text" json:"diff"`   // 变更字段（JSON）
+	IP        string    `gorm:"size:64" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	PrevHash  string    `gorm:"size:64;not null" json:"prev_hash"`
+	Hash      string    `gorm:"size:64;not null;uniqueIndex" json:"hash"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Ballot 可验证投票中的一张选票，不包含任何投票人身份信息
+type Ballot struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	PollID    uint      `gorm:"not null;index" json:"poll_id"`
+	OptionIDs string    `gorm:"not null" json:"option_ids"` // 升序、逗号分隔的选项ID
+	Salt      string    `gorm:"size:32;not null" json:"salt"`
+	Receipt   string    `gorm:"size:64;not null;uniqueIndex" json:"receipt"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TallyPublication 可验证投票结束时公布的计票结果，每个投票只公布一次
+type TallyPublication struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	PollID      uint      `gorm:"not null;uniqueIndex" json:"poll_id"`
+	MerkleRoot  string    `gorm:"size:64;not null" json:"merkle_root"`
+	BallotCount int       `json:"ballot_count"`
+	Counts      string    `gorm:"type:text" json:"counts"` // JSON: 选项ID -> 选票统计的票数
+	Consistent  bool      `json:"consistent"`              // 选票统计与选项计数器是否一致
+	Receipts    string    `gorm:"type:text" json:"-"`      // JSON: 公布时纳入Merkle树的全部收据
+	PublishedAt time.Time `json:"published_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// 评论状态
+const (
+	CommentStatusVisible = "visible" // 已公开
+	CommentStatusFlagged = "flagged" // 被内容审核标记，等待管理员处理，不公开
+	CommentStatusDeleted = "deleted" // 已被管理员删除
+)
+
+// Comment 投票旁的评论
+type Comment struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	PollID      uint       `gorm:"not null;index" json:"poll_id"`
+	Author      string     `gorm:"size:64" json:"author"`
+	Content     string     `gorm:"type:text;not null" json:"content"`
+	IP          string     `gorm:"size:64" json:"ip"`
+	Status      string     `gorm:"size:16;not null;default:visible;index" json:"status"`
+	FlagReasons string     `json:"flag_reasons,omitempty"` // 逗号分隔的审核标记
+	DeletedBy   string     `json:"deleted_by,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
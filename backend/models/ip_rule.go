@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IP规则动作
+const (
+	IPRuleAllow = "allow"
+	IPRuleDeny  = "deny"
+)
+
+// IPRule IP/CIDR访问规则，PollID为空表示全局规则
+type IPRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PollID    *uint     `gorm:"index" json:"poll_id"`
+	CIDR      string    `gorm:"size:64;not null" json:"cidr"`
+	Action    string    `gorm:"size:8;not null" json:"action"` // allow 或 deny
+	Note      string    `json:"note"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -24,6 +24,12 @@ type Poll struct {
 	Options     []PollOption `gorm:"foreignKey:PollID" json:"options"`
 	IsActive    bool         `gorm:"default:true" json:"is_active"` // To easily enable/disable voting
 	EndTime     *time.Time   `json:"end_time,omitempty"`            // Optional end date for the poll
+
+	// 防机器人模式：开启后投票需要附带工作量证明
+	AntiBotEnabled bool `gorm:"default:false" json:"anti_bot_enabled"`
+
+	// 可验证计票：记录每张选票的收据，关闭时公布Merkle树根
+	Verifiable bool `gorm:"default:false" json:"verifiable"`
 }
 
 // PollOption represents an option within a poll
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// 隔离投票的审核状态
+const (
+	QuarantineStatusPending   = "pending"   // 等待审核，不计入票数
+	QuarantineStatusApproved  = "approved"  // 审核通过，已计入票数
+	QuarantineStatusDiscarded = "discarded" // 已丢弃
+)
+
+// QuarantinedVote 被异常检测标记、等待管理员审核的投票
+type QuarantinedVote struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	PollID     uint       `gorm:"not null;index" json:"poll_id"`
+	OptionIDs  string     `gorm:"not null" json:"option_ids"` // 逗号分隔的选项ID
+	IP         string     `gorm:"size:64" json:"ip"`
+	IPPrefix   string     `gorm:"size:64;index" json:"ip_prefix"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	Reasons    string     `json:"reasons"` // 逗号分隔的异常原因
+	Status     string     `gorm:"size:16;not null;default:pending;index" json:"status"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// WebhookSubscription 外部系统订阅的webhook，事件发生时向URL投递签名的JSON通知
+type WebhookSubscription struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	URL         string    `gorm:"size:2048;not null" json:"url"`
+	Events      string    `gorm:"size:255;not null" json:"events"` // 逗号分隔的事件类型
+	Secret      string    `gorm:"size:128;not null" json:"-"`      // 签名密钥，只在创建和轮换时返回
+	Active      bool      `gorm:"default:true;index" json:"active"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -2,171 +2,309 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// MQAdapter 消息队列适配器，支持在RocketMQ和Redis MQ之间自动切换
+// MQAdapter 消息队列适配器，按 MQ_BACKEND 配置选择 Redis列表、Redis Streams、RocketMQ 或内存队列
 type MQAdapter struct {
-	rocketEnabled  bool
-	redisEnabled   bool
-	redisMQ        *RedisMQ
-	redisClient    *redis.Client
-	processHandler func(pollID string, optionID string) error
-	initOnce       sync.Once
-	initialized    bool
+	backend     string
+	fallback    string // 配置的后端不可用、回退到内存队列时记录原来的后端
+	queue       VoteQueue
+	redisClient *redis.Client
+	initOnce    sync.Once
+	initialized bool
 }
 
 // NewMQAdapter 创建新的消息队列适配器
 func NewMQAdapter() *MQAdapter {
 	return &MQAdapter{
-		rocketEnabled: false,
-		redisEnabled:  false,
-		initialized:   false,
+		backend:     queueBackend(),
+		initialized: false,
 	}
 }
 
+// queueBackend 读取 MQ_BACKEND，默认使用Redis
+func queueBackend() string {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("MQ_BACKEND")))
+	if backend == "" {
+		return BackendRedis
+	}
+	return backend
+}
+
+// queueOptions 从环境变量读取重试配置
+func queueOptions() VoteQueueOptions {
+	opts := VoteQueueOptions{
+		MaxRetries:    3,                // 默认最大重试3次
+		RetryDelay:    30 * time.Second, // 默认第一次重试前等待30秒
+		MaxRetryDelay: 10 * time.Minute, // 默认最长等待10分钟
+	}
+	if v, err := strconv.Atoi(os.Getenv("MQ_MAX_RETRIES")); err == nil && v >= 0 {
+		opts.MaxRetries = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("MQ_RETRY_DELAY")); err == nil && v > 0 {
+		opts.RetryDelay = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("MQ_RETRY_MAX_DELAY")); err == nil && v > 0 {
+		opts.MaxRetryDelay = v
+	}
+	return opts
+}
+
 // Initialize 初始化消息队列
 func (a *MQAdapter) Initialize() error {
 	var err error
 	a.initOnce.Do(func() {
-		// // 首先尝试初始化RocketMQ // <-- 注释掉这部分
-		// rocketErr := InitRocketMQ()
-		// if rocketErr == nil && !mockMode {
-		// 	a.rocketEnabled = true
-		// 	log.Println("成功初始化RocketMQ")
-		// } else { // <-- 移除 else
-		// if rocketErr != nil { // <-- 注释掉
-		// 	log.Printf("RocketMQ初始化失败: %v", rocketErr) // <-- 注释掉
-		// } else { // <-- 注释掉
-		// 	log.Println("RocketMQ使用模拟模式，将尝试Redis MQ") // <-- 注释掉
-		// } // <-- 注释掉
-
-		// 直接尝试使用Redis MQ
-		log.Println("正在尝试初始化 Redis MQ...") // 添加日志
-
-		// 获取Redis客户端
-		redisHost := os.Getenv("REDIS_HOST")
-		if redisHost == "" {
-			redisHost = "localhost" // Default host
+		opts := queueOptions()
+		log.Printf("正在初始化消息队列，后端: %s", a.backend)
+
+		switch a.backend {
+		case BackendRedis:
+			a.queue, err = a.newRedisQueue(opts)
+		case BackendRedisStream:
+			a.queue, err = a.newRedisStreamQueue(opts)
+		case BackendRocketMQ:
+			a.queue, err = a.newRocketMQQueue(opts)
+		case BackendMemory:
+			a.queue, err = NewMemoryVoteQueue(opts, memoryQueueOptions())
+		default:
+			err = fmt.Errorf("不支持的消息队列后端: %s", a.backend)
 		}
-		redisPort := os.Getenv("REDIS_PORT")
-		if redisPort == "" {
-			redisPort = "6379" // Default port
+
+		if err != nil && (a.backend == BackendRedis || a.backend == BackendRedisStream || a.backend == BackendRocketMQ) && memoryFallbackEnabled() {
+			// 数据库是共享的，各实例用自己的内存队列异步写库也不会丢票，只是不再跨实例分摊处理
+			log.Printf("警告: 消息队列(%s)初始化失败，回退到内存队列: %v", a.backend, err)
+			a.fallback = a.backend
+			a.backend = BackendMemory
+			a.queue, err = NewMemoryVoteQueue(opts, memoryQueueOptions())
 		}
-		// 优先使用 REDIS_ADDR 如果设置了，否则组合 HOST 和 PORT
-		redisAddr := os.Getenv("REDIS_ADDR")
-		if redisAddr == "" {
-			// 默认使用16379端口，而不是6379
-			redisPort = "16379"
-			redisAddr = fmt.Sprintf("%s:%s", redisHost, redisPort) // 组合 host 和 port
+		if err != nil {
+			a.initialized = false
+			err = fmt.Errorf("无法初始化消息队列(%s): %v", a.backend, err)
+			return
 		}
+		a.initialized = true
+		log.Printf("成功初始化消息队列，后端: %s", a.backend)
+	})
 
-		log.Printf("使用 Redis 地址: %s", redisAddr) // 确认地址是正确的 host:port 格式
-
-		redisPassword := os.Getenv("REDIS_PASSWORD")
-
-		// 创建Redis客户端
-		a.redisClient = redis.NewClient(&redis.Options{
-			Addr:        redisAddr, // 使用修正后的 redisAddr
-			Password:    redisPassword,
-			DB:          0,
-			DialTimeout: 5 * time.Second, // 增加超时时间
-			ReadTimeout: 5 * time.Second, // 增加超时时间
-			PoolSize:    20,              // 增加连接池大小
-		})
-
-		// 测试连接
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // 增加上下文超时
-		defer cancel()
-
-		if _, redisErr := a.redisClient.Ping(ctx).Result(); redisErr != nil {
-			log.Printf("Redis连接失败: %v", redisErr)
-			// 如果Redis也失败，设置为错误状态，避免进入内存模式
-			a.initialized = false // 明确标记为未初始化
-			err = fmt.Errorf("无法初始化Redis MQ: %v", redisErr)
-		} else {
-			// Redis连接成功，创建RedisMQ实例
-			a.redisMQ = NewRedisMQ(a.redisClient)
-			a.redisEnabled = true
-			a.initialized = true // 标记为已初始化 (Redis 模式)
-			log.Println("成功初始化Redis MQ")
-		}
-		// } // <-- 移除与 RocketMQ else 对应的括号
+	return err
+}
 
-		// a.initialized = true // 移动到 Redis 初始化成功的分支
+// memoryQueueOptions 从环境变量读取内存队列配置
+func memoryQueueOptions() MemoryQueueOptions {
+	opts := MemoryQueueOptions{
+		Capacity: 10000,
+		Workers:  4,
+		AOFPath:  strings.TrimSpace(os.Getenv("MQ_MEMORY_AOF")),
+	}
+	if v, err := strconv.Atoi(os.Getenv("MQ_MEMORY_CAPACITY")); err == nil && v > 0 {
+		opts.Capacity = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MQ_MEMORY_WORKERS")); err == nil && v > 0 {
+		opts.Workers = v
+	}
+	return opts
+}
+
+// memoryFallbackEnabled 配置的后端不可用时是否回退到内存队列，默认开启
+func memoryFallbackEnabled() bool {
+	return os.Getenv("MQ_MEMORY_FALLBACK") != "false"
+}
+
+// connectRedis 连接Redis，列表和流两种后端共用
+func (a *MQAdapter) connectRedis() (*redis.Client, error) {
+	// 获取Redis客户端
+	redisHost := os.Getenv("REDIS_HOST")
+	if redisHost == "" {
+		redisHost = "localhost" // Default host
+	}
+	// 优先使用 REDIS_ADDR 如果设置了，否则组合 HOST 和 PORT
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		// 默认使用16379端口，而不是6379
+		redisAddr = fmt.Sprintf("%s:%s", redisHost, "16379")
+	}
+
+	log.Printf("使用 Redis 地址: %s", redisAddr)
+
+	client := redis.NewClient(&redis.Options{
+		Addr:        redisAddr,
+		Password:    os.Getenv("REDIS_PASSWORD"),
+		DB:          0,
+		DialTimeout: 5 * time.Second,
+		ReadTimeout: 5 * time.Second,
+		PoolSize:    20,
 	})
 
-	return err
+	// 测试连接
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Redis连接失败: %v", err)
+	}
+	a.redisClient = client
+	return client, nil
 }
 
-// RegisterHandler 注册消息处理函数
-func (a *MQAdapter) RegisterHandler(handler func(pollID string, optionID string) error) error {
-	if !a.initialized {
-		return fmt.Errorf("消息队列适配器未初始化")
+// newRedisQueue 创建基于列表的队列
+func (a *MQAdapter) newRedisQueue(opts VoteQueueOptions) (VoteQueue, error) {
+	client, err := a.connectRedis()
+	if err != nil {
+		return nil, err
 	}
+	return NewRedisMQ(client, opts, redisMQOptions()), nil
+}
 
-	a.processHandler = handler
+// redisMQOptions 从环境变量读取列表队列配置
+func redisMQOptions() RedisMQOptions {
+	opts := RedisMQOptions{Workers: 8}
+	if v, err := strconv.Atoi(os.Getenv("MQ_REDIS_WORKERS")); err == nil && v > 0 {
+		opts.Workers = v
+	}
+	return opts
+}
 
-	// 根据启用的队列类型，注册处理函数
-	if a.rocketEnabled { // 这个分支现在不应该被执行
-		log.Println("警告: RocketMQ 被禁用，但尝试注册其 Handler")
-		return fmt.Errorf("RocketMQ 已被禁用")
-	} else if a.redisEnabled {
-		// 用Redis MQ处理函数
-		if a.redisMQ == nil {
-			return fmt.Errorf("错误: Redis MQ 实例为空，无法注册 Handler")
-		}
-		a.redisMQ.RegisterHandler(handler)
-		err := a.redisMQ.Start()
-		if err != nil {
-			return fmt.Errorf("启动Redis MQ消费者失败: %v", err)
+// newRedisStreamQueue 创建基于Streams消费者组的队列
+func (a *MQAdapter) newRedisStreamQueue(opts VoteQueueOptions) (VoteQueue, error) {
+	client, err := a.connectRedis()
+	if err != nil {
+		return nil, err
+	}
+	queue, err := NewRedisStreamQueue(client, opts, redisStreamOptions())
+	if err != nil {
+		client.Close()
+		a.redisClient = nil
+		return nil, err
+	}
+	return queue, nil
+}
+
+// redisStreamOptions 从环境变量读取Redis Streams配置
+func redisStreamOptions() RedisStreamOptions {
+	opts := RedisStreamOptions{
+		Consumer:      strings.TrimSpace(os.Getenv("MQ_STREAM_CONSUMER")),
+		ClaimIdle:     5 * time.Minute,
+		MaxLen:        100000,
+		MigrateLegacy: os.Getenv("MQ_STREAM_MIGRATE") != "false",
+	}
+	if v, err := time.ParseDuration(os.Getenv("MQ_STREAM_CLAIM_IDLE")); err == nil && v > 0 {
+		opts.ClaimIdle = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MQ_STREAM_MAXLEN"), 10, 64); err == nil && v > 0 {
+		opts.MaxLen = v
+	}
+	return opts
+}
+
+// newRocketMQQueue 创建RocketMQ队列，Redis可用时死信保存在Redis中，各实例共享
+func (a *MQAdapter) newRocketMQQueue(opts VoteQueueOptions) (VoteQueue, error) {
+	rocket := rocketMQOptions()
+	if client, err := a.connectRedis(); err == nil {
+		group := rocket.ConsumerGroup
+		if group == "" {
+			group = defaultRocketConsumerGroup
 		}
-		log.Println("已注册并启动 Redis MQ 消费者")
+		rocket.DeadLetters = NewRedisRocketDeadLetters(client, group)
 	} else {
-		log.Println("错误: 适配器未初始化成功，无法注册 Handler")
-		return fmt.Errorf("适配器未初始化成功")
+		log.Printf("RocketMQ死信无法保存到Redis: %v", err)
 	}
 
-	return nil
+	queue, err := NewRocketMQQueue(rocket, opts)
+	if err != nil {
+		if a.redisClient != nil {
+			a.redisClient.Close()
+			a.redisClient = nil
+		}
+		return nil, err
+	}
+	return queue, nil
 }
 
-// SendVoteMessage 发送投票消息
-func (a *MQAdapter) SendVoteMessage(pollID string, optionID string) error {
-	// 修复：简化初始化检查
+// rocketMQOptions 从环境变量读取RocketMQ配置，ROCKETMQ_NAMESRV_ADDR 可用逗号分隔多个地址
+func rocketMQOptions() RocketMQOptions {
+	addrs := os.Getenv("ROCKETMQ_NAMESRV_ADDR")
+	if addrs == "" {
+		addrs = "localhost:9876" // 默认地址，与docker-compose一致
+	}
+	var nameServers []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			nameServers = append(nameServers, addr)
+		}
+	}
+	return RocketMQOptions{
+		NameServers:   nameServers,
+		ProducerGroup: os.Getenv("ROCKETMQ_PRODUCER_GROUP"),
+		ConsumerGroup: os.Getenv("ROCKETMQ_CONSUMER_GROUP"),
+	}
+}
+
+// Backend 返回配置的队列后端
+func (a *MQAdapter) Backend() string {
+	return a.backend
+}
+
+// Queue 返回当前使用的队列，未初始化时为nil
+func (a *MQAdapter) Queue() VoteQueue {
 	if !a.IsInitialized() {
-		return fmt.Errorf("消息队列适配器未初始化，无法发送消息")
+		return nil
 	}
+	return a.queue
+}
 
-	if a.redisEnabled {
-		if a.redisMQ == nil {
-			return fmt.Errorf("错误: Redis MQ 实例为空，无法发送消息")
-		}
-		// 委托给 RedisMQ 实现
-		return a.redisMQ.SendVoteMessage(pollID, optionID)
-	} else {
-		// 现在不应该进入此分支
-		return fmt.Errorf("消息队列未初始化为 Redis 模式")
+// RegisterHandler 注册消息处理函数并开始消费
+func (a *MQAdapter) RegisterHandler(handler func(pollID string, optionID string) error) error {
+	if !a.IsInitialized() {
+		return fmt.Errorf("消息队列适配器未初始化")
+	}
+	if err := a.queue.Subscribe(handler); err != nil {
+		return fmt.Errorf("启动消息队列消费者失败: %v", err)
 	}
+	log.Printf("已注册并启动消息队列消费者，后端: %s", a.backend)
+	return nil
 }
 
-// SendOrderedVoteMessage 发送顺序投票消息
+// SendVoteMessage 发送投票消息
+func (a *MQAdapter) SendVoteMessage(pollID string, optionID string) error {
+	return a.SendVoteMessageWithID(pollID, optionID, "")
+}
+
+// SendOrderedVoteMessage 发送顺序投票消息，与普通发送相同
+// 各后端都不保证跨实例的处理顺序，见VoteQueue
 func (a *MQAdapter) SendOrderedVoteMessage(pollID string, optionID string) error {
-	// 对于 Redis List，普通发送即保证顺序
 	return a.SendVoteMessage(pollID, optionID)
 }
 
+// SendVoteMessageWithID 发送投票消息，使用指定的messageID，重复的messageID只入队一次
+func (a *MQAdapter) SendVoteMessageWithID(pollID string, optionID string, messageID string) error {
+	if !a.IsInitialized() {
+		return fmt.Errorf("消息队列适配器未初始化，无法发送消息")
+	}
+	return a.queue.Send(context.Background(), VoteMessage{
+		PollID:    pollID,
+		OptionID:  optionID,
+		MessageID: messageID,
+	})
+}
+
 // Close 关闭消息队列
 func (a *MQAdapter) Close() {
-	if a.redisEnabled && a.redisMQ != nil {
-		// 关闭Redis MQ
-		a.redisMQ.Stop()
+	if a.IsInitialized() {
+		if err := a.queue.Close(); err != nil {
+			log.Printf("关闭消息队列失败: %v", err)
+		}
+	}
+	if a.redisClient != nil {
 		a.redisClient.Close()
 	}
 	log.Println("消息队列已关闭")
@@ -175,98 +313,50 @@ func (a *MQAdapter) Close() {
 // GetQueueStats 获取队列统计信息
 func (a *MQAdapter) GetQueueStats() map[string]interface{} {
 	stats := make(map[string]interface{})
+	stats["type"] = a.backend
+	if a.fallback != "" {
+		stats["fallback_from"] = a.fallback
+	}
 
-	if !a.IsInitialized() { // 使用 IsInitialized 判断
+	if !a.IsInitialized() {
 		stats["status"] = "未初始化"
 		return stats
 	}
 
-	if a.redisEnabled {
-		stats["type"] = "Redis MQ"
-		if a.redisMQ != nil {
-			stats["status"] = "正常运行"
-			stats["queues"] = a.redisMQ.GetQueueStats()
-		} else {
-			stats["status"] = "实例为空"
-		}
-	} else {
-		stats["type"] = "未知 (错误状态)"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	queueStats, err := a.queue.Stats(ctx)
+	if err != nil {
 		stats["status"] = "错误"
+		stats["error"] = err.Error()
+		return stats
 	}
-
+	stats["status"] = "正常运行"
+	stats["queues"] = queueStats
 	return stats
 }
 
-// RetryDeadLetters 重试死信队列中的消息（仅Redis MQ模式可用）
-func (a *MQAdapter) RetryDeadLetters() error {
+// DeadLetters 列出死信消息，最新的在前
+func (a *MQAdapter) DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error) {
 	if !a.IsInitialized() {
-		return fmt.Errorf("消息队列适配器未初始化")
+		return nil, fmt.Errorf("消息队列适配器未初始化")
 	}
-
-	if a.redisEnabled {
-		if a.redisMQ == nil {
-			return fmt.Errorf("Redis MQ 实例为空")
-		}
-		return a.redisMQ.RetryDeadLetters()
-	}
-
-	return fmt.Errorf("当前消息队列模式不支持死信队列操作")
-}
-
-// IsInitialized 检查适配器是否已初始化
-func (a *MQAdapter) IsInitialized() bool {
-	// 现在只关心 Redis 是否启用并初始化
-	return a.initialized && a.redisEnabled
+	return a.queue.DeadLetters(ctx, limit)
 }
 
-// SendVoteMessageWithID 发送投票消息，使用指定的messageID
-func (a *MQAdapter) SendVoteMessageWithID(pollID string, optionID string, messageID string) error {
+// RetryDeadLetters 重试死信队列中的消息，返回移回主队列的数量
+func (a *MQAdapter) RetryDeadLetters() (int, error) {
 	if !a.IsInitialized() {
-		return fmt.Errorf("消息队列适配器未初始化")
+		return 0, fmt.Errorf("消息队列适配器未初始化")
 	}
-
-	if a.redisEnabled {
-		if a.redisMQ == nil {
-			return fmt.Errorf("错误: Redis MQ 实例为空，无法发送消息")
-		}
-
-		// 构造消息
-		msg := VoteMessage{
-			PollID:    pollID,
-			OptionID:  optionID,
-			Timestamp: time.Now().Unix(),
-			MessageID: messageID, // 使用传入的 messageID
-		}
-		jsonData, err := json.Marshal(msg)
-		if err != nil {
-			return fmt.Errorf("序列化消息失败: %v", err)
-		}
-
-		// 幂等性检查
-		processedSetKey := "processed_vote_ids"
-		exists, err := a.redisClient.SIsMember(context.Background(), processedSetKey, messageID).Result()
-		if err != nil {
-			log.Printf("检查消息幂等性出错: %v", err) // 记录错误但继续
-		} else if exists {
-			log.Printf("检测到重复消息ID %s，跳过发送", messageID)
-			return nil // 幂等成功
-		}
-
-		// 发送消息到Redis List - 修复：使用 MainQueueName 常量
-		// 注意：MainQueueName 需要在包内可访问，或者直接用 "vote_queue"
-		err = a.redisClient.LPush(context.Background(), MainQueueName, string(jsonData)).Err()
-		if err != nil {
-			return fmt.Errorf("发送消息到 Redis 失败: %v", err)
-		}
-
-		// 添加到已处理集合
-		err = a.redisClient.SAdd(context.Background(), processedSetKey, messageID).Err()
-		if err != nil {
-			log.Printf("添加消息ID %s 到幂等性集合失败: %v", messageID, err) // 记录错误
-		}
-
-		return nil
-	} else {
-		return fmt.Errorf("消息队列未初始化为 Redis 模式")
+	retrier, ok := a.queue.(DeadLetterRetrier)
+	if !ok {
+		return 0, fmt.Errorf("当前消息队列后端不支持重试死信")
 	}
+	return retrier.RetryDeadLetters(context.Background())
+}
+
+// IsInitialized 检查适配器是否已初始化，nil适配器视为未初始化
+func (a *MQAdapter) IsInitialized() bool {
+	return a != nil && a.initialized && a.queue != nil
 }
@@ -0,0 +1,67 @@
+package mq
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyBuckets 排队和处理耗时直方图的桶上限（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Histogram 固定桶的耗时直方图，格式与Prometheus的histogram一致
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// HistogramSnapshot 直方图的一次快照，Counts为累计值，第i项是耗时不超过Buckets[i]秒的次数
+type HistogramSnapshot struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Sum     float64   `json:"sum"` // 总耗时（秒）
+	Count   uint64    `json:"count"`
+}
+
+// NewHistogram 按给定的桶上限（秒，升序）创建直方图
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe 记录一次耗时，负值按0计
+func (h *Histogram) Observe(d time.Duration) {
+	v := d.Seconds()
+	if v < 0 {
+		v = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Snapshot 返回累计计数的快照
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snap := HistogramSnapshot{
+		Buckets: append([]float64(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.counts)),
+		Sum:     h.sum,
+		Count:   h.count,
+	}
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		snap.Counts[i] = cumulative
+	}
+	return snap
+}
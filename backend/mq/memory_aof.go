@@ -0,0 +1,198 @@
+package mq
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// 追加写日志的记录类型
+const (
+	aofPush   = "push"   // 消息入队
+	aofAck    = "ack"    // 消息处理成功
+	aofBury   = "bury"   // 消息进入死信
+	aofRevive = "revive" // 全部死信移回队列
+)
+
+// aofRecord 追加写日志中的一行
+type aofRecord struct {
+	Op  string       `json:"op"`
+	Msg *VoteMessage `json:"msg,omitempty"`
+	ID  string       `json:"id,omitempty"`
+}
+
+// voteAOF 内存队列的追加写日志，每个状态变化写一行JSON，重启时重放得到未处理的消息和死信
+type voteAOF struct {
+	path    string
+	file    *os.File
+	records int // 当前文件中的记录数
+}
+
+// openVoteAOF 打开日志并重放，返回未处理的消息（按入队顺序）和死信（按进入死信的顺序），
+// 死信与内存中一样最多保留deadLimit条
+func openVoteAOF(path string, deadLimit int) (*voteAOF, []VoteMessage, []VoteMessage, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, nil, nil, fmt.Errorf("创建队列日志目录失败: %v", err)
+		}
+	}
+
+	pending, dead, err := replayVoteAOF(path, deadLimit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	aof := &voteAOF{path: path}
+	// 启动时压缩一次，去掉已处理的消息
+	if err := aof.rewrite(pending, dead); err != nil {
+		return nil, nil, nil, err
+	}
+	return aof, pending, dead, nil
+}
+
+func replayVoteAOF(path string, deadLimit int) ([]VoteMessage, []VoteMessage, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开队列日志失败: %v", err)
+	}
+	defer f.Close()
+
+	// order记录入队顺序，latest记录每个消息最近一次入队在order中的位置
+	var order []string
+	latest := make(map[string]int)
+	pending := make(map[string]VoteMessage)
+	var dead []VoteMessage
+	enqueue := func(msg VoteMessage) {
+		if _, ok := pending[msg.MessageID]; !ok {
+			latest[msg.MessageID] = len(order)
+			order = append(order, msg.MessageID)
+		}
+		pending[msg.MessageID] = msg
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec aofRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 进程崩溃时最后一行可能只写了一半
+			log.Printf("跳过无法解析的队列日志记录: 第%d行: %v", line, err)
+			continue
+		}
+		switch rec.Op {
+		case aofPush:
+			if rec.Msg == nil {
+				continue
+			}
+			enqueue(*rec.Msg)
+		case aofAck:
+			delete(pending, rec.ID)
+		case aofBury:
+			if rec.Msg == nil {
+				continue
+			}
+			delete(pending, rec.Msg.MessageID)
+			dead = append(dead, *rec.Msg)
+			if len(dead) > deadLimit {
+				dead = dead[len(dead)-deadLimit:]
+			}
+		case aofRevive:
+			for _, msg := range dead {
+				enqueue(msg)
+			}
+			dead = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("读取队列日志失败: %v", err)
+	}
+
+	result := make([]VoteMessage, 0, len(pending))
+	for i, id := range order {
+		// 被移回队列的死信在order中出现多次，只取最近一次的位置
+		if msg, ok := pending[id]; ok && latest[id] == i {
+			result = append(result, msg)
+		}
+	}
+	return result, dead, nil
+}
+
+// Append 追加一条记录，写入操作系统缓冲区后返回，由Sync定期落盘
+func (a *voteAOF) Append(rec aofRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入队列日志失败: %v", err)
+	}
+	a.records++
+	return nil
+}
+
+// NeedsRewrite 已失效的记录超过保留记录数和阈值时需要压缩
+func (a *voteAOF) NeedsRewrite(threshold, live int) bool {
+	return a.records-live > threshold && a.records > 2*live
+}
+
+// rewrite 用当前状态重写日志：先写临时文件再原子替换
+func (a *voteAOF) rewrite(pending, dead []VoteMessage) error {
+	tmp := a.path + ".rewrite"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("创建队列日志失败: %v", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range pending {
+		enc.Encode(aofRecord{Op: aofPush, Msg: &pending[i]})
+	}
+	for i := range dead {
+		enc.Encode(aofRecord{Op: aofBury, Msg: &dead[i]})
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("写入队列日志失败: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("写入队列日志失败: %v", err)
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, a.path); err != nil {
+		return fmt.Errorf("替换队列日志失败: %v", err)
+	}
+	if a.file != nil {
+		a.file.Close()
+	}
+	a.file, err = os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开队列日志失败: %v", err)
+	}
+	a.records = len(pending) + len(dead)
+	return nil
+}
+
+// Sync 将已写入的记录落盘
+func (a *voteAOF) Sync() error {
+	return a.file.Sync()
+}
+
+// Close 落盘并关闭文件
+func (a *voteAOF) Close() error {
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
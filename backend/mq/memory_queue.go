@@ -0,0 +1,415 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueFull 内存队列等待处理的消息达到容量上限
+var ErrQueueFull = errors.New("消息队列已满")
+
+const (
+	// 内存队列最多记住的消息ID数，用于去重
+	memoryQueueSeenLimit = 100000
+	// 内存队列保留的死信数上限，超过时丢弃最早的
+	memoryDeadLetterLimit = 1000
+	// 追加写日志中失效记录超过该数量时压缩
+	memoryAOFRewriteThreshold = 10000
+	// 追加写日志落盘间隔
+	memoryAOFSyncInterval = time.Second
+)
+
+// MemoryQueueOptions 内存队列的配置
+type MemoryQueueOptions struct {
+	Capacity int    // 最多等待处理的消息数（不含等待重试的），满时发送返回ErrQueueFull
+	Workers  int    // 并发处理的协程数
+	AOFPath  string // 追加写日志文件，为空时不持久化，进程退出后未处理的消息丢失
+}
+
+// MemoryVoteQueue 进程内的投票消息队列，消息不会跨实例共享
+//
+// 配置AOFPath后，入队、处理成功和进入死信都会追加写入日志并每秒落盘，
+// 重启时重放日志，未处理的消息和死信会恢复；重试次数不持久化，恢复后重新计数。
+type MemoryVoteQueue struct {
+	opts VoteQueueOptions
+	mem  MemoryQueueOptions
+
+	mu       sync.Mutex
+	pending  []VoteMessage
+	inflight map[string]VoteMessage // 正在处理或等待重试的消息，压缩日志时需要保留
+	dead     []VoteMessage
+	retries  map[string]int
+	handler  VoteHandler
+	closed   bool
+	aof      *voteAOF
+
+	seen   *messageIDSet
+	notify chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	processing int64
+	sent       int64
+	processed  int64
+	failed     int64
+	dropped    int64
+	delayed    int64
+}
+
+// NewMemoryVoteQueue 创建内存队列，配置了追加写日志时先重放日志
+func NewMemoryVoteQueue(opts VoteQueueOptions, mem MemoryQueueOptions) (*MemoryVoteQueue, error) {
+	if mem.Capacity <= 0 {
+		mem.Capacity = 10000
+	}
+	if mem.Workers <= 0 {
+		mem.Workers = 4
+	}
+
+	q := &MemoryVoteQueue{
+		opts:     opts,
+		mem:      mem,
+		inflight: make(map[string]VoteMessage),
+		retries:  make(map[string]int),
+		seen:     newMessageIDSet(memoryQueueSeenLimit),
+		notify:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+
+	if mem.AOFPath != "" {
+		aof, pending, dead, err := openVoteAOF(mem.AOFPath, memoryDeadLetterLimit)
+		if err != nil {
+			return nil, err
+		}
+		q.aof = aof
+		q.pending = pending
+		q.dead = dead
+		for _, msg := range pending {
+			q.seen.Add(msg.MessageID)
+		}
+		for _, msg := range dead {
+			q.seen.Add(msg.MessageID)
+		}
+		if len(pending) > 0 || len(dead) > 0 {
+			log.Printf("从队列日志恢复 %d 条待处理消息和 %d 条死信", len(pending), len(dead))
+		}
+
+		q.wg.Add(1)
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// Send 发送一条投票消息
+func (q *MemoryVoteQueue) Send(ctx context.Context, msg VoteMessage) error {
+	return q.SendBatch(ctx, []VoteMessage{msg})
+}
+
+// SendBatch 批量发送投票消息，重复的MessageID会被跳过；剩余容量不足时整批拒绝
+func (q *MemoryVoteQueue) SendBatch(ctx context.Context, msgs []VoteMessage) error {
+	prepared := make([]VoteMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		msg, err := prepareVoteMessage(msg)
+		if err != nil {
+			return err
+		}
+		prepared = append(prepared, msg)
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if len(q.pending)+len(prepared) > q.mem.Capacity {
+		q.mu.Unlock()
+		return ErrQueueFull
+	}
+	added := 0
+	for _, msg := range prepared {
+		if !q.seen.Add(msg.MessageID) {
+			log.Printf("消息已处理过，跳过: %s", msg.MessageID)
+			continue
+		}
+		if q.aof != nil {
+			if err := q.aof.Append(aofRecord{Op: aofPush, Msg: &msg}); err != nil {
+				q.seen.Remove(msg.MessageID)
+				q.mu.Unlock()
+				return err
+			}
+		}
+		q.pending = append(q.pending, msg)
+		added++
+	}
+	q.mu.Unlock()
+
+	atomic.AddInt64(&q.sent, int64(added))
+	q.wake()
+	return nil
+}
+
+// Subscribe 注册处理函数并启动处理协程
+func (q *MemoryVoteQueue) Subscribe(handler VoteHandler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.handler != nil {
+		return nil
+	}
+	q.handler = handler
+
+	for i := 0; i < q.mem.Workers; i++ {
+		q.wg.Add(1)
+		go q.workLoop()
+	}
+	log.Printf("内存消息队列消费者已启动，并发数: %d, 容量: %d", q.mem.Workers, q.mem.Capacity)
+	return nil
+}
+
+func (q *MemoryVoteQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *MemoryVoteQueue) workLoop() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		msg, ok := q.pop()
+		if !ok {
+			select {
+			case <-q.stop:
+				return
+			case <-q.notify:
+			}
+			continue
+		}
+		// 队列里可能还有消息，唤醒其他空闲的协程
+		q.wake()
+		q.process(msg)
+	}
+}
+
+func (q *MemoryVoteQueue) pop() (VoteMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return VoteMessage{}, false
+	}
+	msg := q.pending[0]
+	q.pending[0] = VoteMessage{}
+	q.pending = q.pending[1:]
+	q.inflight[msg.MessageID] = msg
+	atomic.AddInt64(&q.processing, 1)
+	return msg, true
+}
+
+// process 处理一条消息，失败时按错误分类延迟重试、放入死信或丢弃
+func (q *MemoryVoteQueue) process(msg VoteMessage) {
+	defer atomic.AddInt64(&q.processing, -1)
+
+	err := q.handler(msg.PollID, msg.OptionID)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err == nil {
+		atomic.AddInt64(&q.processed, 1)
+		delete(q.retries, msg.MessageID)
+		delete(q.inflight, msg.MessageID)
+		q.appendLocked(aofRecord{Op: aofAck, ID: msg.MessageID})
+		return
+	}
+
+	atomic.AddInt64(&q.failed, 1)
+	switch ClassifyError(err) {
+	case ErrorDrop:
+		atomic.AddInt64(&q.dropped, 1)
+		log.Printf("丢弃消息 %s: %v", msg.MessageID, err)
+		delete(q.retries, msg.MessageID)
+		delete(q.inflight, msg.MessageID)
+		q.appendLocked(aofRecord{Op: aofAck, ID: msg.MessageID})
+		return
+	case ErrorPermanent:
+		log.Printf("处理消息 %s 失败且不可重试，移至死信队列: %v", msg.MessageID, err)
+		delete(q.retries, msg.MessageID)
+		delete(q.inflight, msg.MessageID)
+		q.buryLocked(msg)
+		return
+	}
+	log.Printf("处理消息失败: %v", err)
+
+	retries := q.retries[msg.MessageID]
+	if retries >= q.opts.MaxRetries {
+		log.Printf("消息 %s 超过最大重试次数，移至死信队列", msg.MessageID)
+		delete(q.retries, msg.MessageID)
+		delete(q.inflight, msg.MessageID)
+		q.buryLocked(msg)
+		return
+	}
+	q.retries[msg.MessageID] = retries + 1
+
+	atomic.AddInt64(&q.delayed, 1)
+	time.AfterFunc(q.opts.backoff(retries+1), func() {
+		atomic.AddInt64(&q.delayed, -1)
+		q.mu.Lock()
+		if q.closed {
+			// 消息未确认，配置了追加写日志时重启后恢复
+			q.mu.Unlock()
+			return
+		}
+		delete(q.inflight, msg.MessageID)
+		q.pending = append(q.pending, msg)
+		q.mu.Unlock()
+		q.wake()
+		log.Printf("消息 %s 重新入队，重试次数: %d", msg.MessageID, retries+1)
+	})
+}
+
+func (q *MemoryVoteQueue) buryLocked(msg VoteMessage) {
+	q.dead = append(q.dead, msg)
+	if len(q.dead) > memoryDeadLetterLimit {
+		q.dead = q.dead[len(q.dead)-memoryDeadLetterLimit:]
+	}
+	q.appendLocked(aofRecord{Op: aofBury, Msg: &msg})
+}
+
+// appendLocked 写入追加写日志，失效记录过多时压缩；调用方持有q.mu
+func (q *MemoryVoteQueue) appendLocked(rec aofRecord) {
+	if q.aof == nil {
+		return
+	}
+	if err := q.aof.Append(rec); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+
+	live := len(q.pending) + len(q.inflight) + len(q.dead)
+	if !q.aof.NeedsRewrite(memoryAOFRewriteThreshold, live) {
+		return
+	}
+	// inflight中的消息尚未确认，压缩后仍作为待处理消息保留
+	pending := make([]VoteMessage, 0, len(q.inflight)+len(q.pending))
+	for _, msg := range q.inflight {
+		pending = append(pending, msg)
+	}
+	pending = append(pending, q.pending...)
+	if err := q.aof.rewrite(pending, q.dead); err != nil {
+		log.Printf("压缩队列日志失败: %v", err)
+	}
+}
+
+func (q *MemoryVoteQueue) syncLoop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(memoryAOFSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if err := q.aof.Sync(); err != nil {
+				log.Printf("队列日志落盘失败: %v", err)
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// Stats 返回队列的运行统计
+func (q *MemoryVoteQueue) Stats(ctx context.Context) (VoteQueueStats, error) {
+	q.mu.Lock()
+	pending, dead := len(q.pending), len(q.dead)
+	q.mu.Unlock()
+
+	return VoteQueueStats{
+		Backend:     BackendMemory,
+		Pending:     int64(pending),
+		Processing:  atomic.LoadInt64(&q.processing),
+		Delayed:     atomic.LoadInt64(&q.delayed),
+		DeadLetters: int64(dead),
+		Sent:        atomic.LoadInt64(&q.sent),
+		Processed:   atomic.LoadInt64(&q.processed),
+		Failed:      atomic.LoadInt64(&q.failed),
+		Dropped:     atomic.LoadInt64(&q.dropped),
+	}, nil
+}
+
+// DeadLetters 列出死信消息，最新的在前
+func (q *MemoryVoteQueue) DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.dead)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]VoteMessage, 0, n)
+	for i := len(q.dead) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, q.dead[i])
+	}
+	return result, nil
+}
+
+// RetryDeadLetters 将全部死信移回待处理队列，不受容量限制
+func (q *MemoryVoteQueue) RetryDeadLetters(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return 0, ErrQueueClosed
+	}
+	count := len(q.dead)
+	q.pending = append(q.pending, q.dead...)
+	q.dead = nil
+	if count > 0 {
+		q.appendLocked(aofRecord{Op: aofRevive})
+	}
+	q.mu.Unlock()
+
+	q.wake()
+	log.Printf("成功将 %d 条消息从死信队列移回主队列", count)
+	return count, nil
+}
+
+// Close 停止处理协程并等待正在处理的消息完成；未处理的消息保留在追加写日志中
+func (q *MemoryVoteQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	q.wg.Wait()
+
+	if q.aof != nil {
+		q.mu.Lock()
+		err := q.aof.Close()
+		q.aof = nil
+		q.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("关闭队列日志失败: %v", err)
+		}
+	}
+	log.Println("内存消息队列已关闭")
+	return nil
+}
@@ -0,0 +1,162 @@
+package mq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryVoteQueue_Capacity(t *testing.T) {
+	q, err := NewMemoryVoteQueue(VoteQueueOptions{}, MemoryQueueOptions{Capacity: 2, Workers: 1})
+	require.NoError(t, err)
+	defer q.Close()
+	ctx := context.Background()
+
+	// Nothing consumes yet, so the queue fills up
+	require.NoError(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "1"}))
+	assert.ErrorIs(t, q.SendBatch(ctx, []VoteMessage{{PollID: "1", OptionID: "2"}, {PollID: "1", OptionID: "3"}}), ErrQueueFull)
+	require.NoError(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "2"}))
+	assert.ErrorIs(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "3"}), ErrQueueFull)
+
+	stats, err := q.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Pending)
+}
+
+func TestMemoryVoteQueue_AOFSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "votes.aof")
+	opts := VoteQueueOptions{MaxRetries: 0, RetryDelay: time.Millisecond}
+	ctx := context.Background()
+
+	q, err := NewMemoryVoteQueue(opts, MemoryQueueOptions{AOFPath: path, Workers: 1})
+	require.NoError(t, err)
+	handled := make(chan string, 10)
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		handled <- optionID
+		if optionID == "bad" {
+			return assert.AnError
+		}
+		return nil
+	}))
+	require.NoError(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "ok", MessageID: "m-ok"}))
+	require.NoError(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "bad", MessageID: "m-bad"}))
+	require.Eventually(t, func() bool {
+		dead, _ := q.DeadLetters(ctx, 0)
+		return len(dead) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, q.Close())
+
+	// A second instance queues messages without consuming them before shutting down
+	q, err = NewMemoryVoteQueue(opts, MemoryQueueOptions{AOFPath: path})
+	require.NoError(t, err)
+	require.NoError(t, q.SendBatch(ctx, []VoteMessage{
+		{PollID: "2", OptionID: "a", MessageID: "m-a"},
+		{PollID: "2", OptionID: "b", MessageID: "m-b"},
+	}))
+	require.NoError(t, q.Close())
+
+	// A torn final line from a crash is skipped on replay
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	f.WriteString(`{"op":"push","msg":{"poll_id":"3"`)
+	f.Close()
+
+	q, err = NewMemoryVoteQueue(opts, MemoryQueueOptions{AOFPath: path, Workers: 1})
+	require.NoError(t, err)
+	defer q.Close()
+
+	stats, err := q.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Pending)
+	assert.Equal(t, int64(1), stats.DeadLetters)
+	dead, err := q.DeadLetters(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "m-bad", dead[0].MessageID)
+
+	// Recovered message IDs are still deduplicated
+	require.NoError(t, q.Send(ctx, VoteMessage{PollID: "2", OptionID: "a", MessageID: "m-a"}))
+
+	var got []string
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		got = append(got, optionID)
+		return nil
+	}))
+	require.Eventually(t, func() bool {
+		stats, _ := q.Stats(ctx)
+		return stats.Processed == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, got)
+
+	// The log was compacted at startup: processed messages are gone
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "m-ok")
+	assert.NotContains(t, string(data), `"poll_id":"3"`)
+}
+
+func TestMemoryVoteQueue_RewriteKeepsUnacked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "votes.aof")
+	aof, pending, dead, err := openVoteAOF(path, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.Empty(t, dead)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, aof.Append(aofRecord{Op: aofPush, Msg: &VoteMessage{PollID: "1", OptionID: "1", MessageID: id}}))
+	}
+	require.NoError(t, aof.Append(aofRecord{Op: aofAck, ID: "a"}))
+	require.NoError(t, aof.Append(aofRecord{Op: aofBury, Msg: &VoteMessage{PollID: "1", OptionID: "1", MessageID: "b"}}))
+	require.NoError(t, aof.Append(aofRecord{Op: aofRevive}))
+	require.NoError(t, aof.Close())
+
+	aof, pending, dead, err = openVoteAOF(path, 10)
+	require.NoError(t, err)
+	defer aof.Close()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "c", pending[0].MessageID)
+	assert.Equal(t, "b", pending[1].MessageID)
+	assert.Empty(t, dead)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestMQAdapter_FallsBackToMemory(t *testing.T) {
+	t.Setenv("MQ_BACKEND", BackendRedis)
+	t.Setenv("REDIS_ADDR", "127.0.0.1:1")
+	t.Setenv("MQ_MEMORY_AOF", "")
+
+	adapter := NewMQAdapter()
+	require.NoError(t, adapter.Initialize())
+	defer adapter.Close()
+	assert.Equal(t, BackendMemory, adapter.Backend())
+
+	handled := make(chan string, 1)
+	require.NoError(t, adapter.RegisterHandler(func(pollID, optionID string) error {
+		handled <- pollID + "/" + optionID
+		return nil
+	}))
+	require.NoError(t, adapter.SendVoteMessage("7", "3"))
+	select {
+	case got := <-handled:
+		assert.Equal(t, "7/3", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("vote message was not processed")
+	}
+
+	stats := adapter.GetQueueStats()
+	assert.Equal(t, BackendRedis, stats["fallback_from"])
+
+	t.Setenv("MQ_MEMORY_FALLBACK", "false")
+	strict := NewMQAdapter()
+	assert.Error(t, strict.Initialize())
+	assert.False(t, strict.IsInitialized())
+	assert.Error(t, strict.SendVoteMessage("7", "3"))
+}
@@ -0,0 +1,60 @@
+package mq
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// partitionPool 按键分区的固定大小协程池
+//
+// 同一个键的任务总是进入同一个协程，按提交顺序串行执行；不同键的任务分散到各个协程并行执行。
+// 每个协程的待执行任务数有上限，满时Submit阻塞，由调用方停止拉取新消息形成背压。
+type partitionPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+func newPartitionPool(workers, buffer int) *partitionPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &partitionPool{queues: make([]chan func(), workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), buffer)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *partitionPool) work(queue chan func()) {
+	defer p.wg.Done()
+	for task := range queue {
+		task()
+	}
+}
+
+// partition 返回键对应的协程序号
+func (p *partitionPool) partition(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Submit 提交任务，分区已满时阻塞；stop关闭时放弃提交并返回false
+func (p *partitionPool) Submit(key string, task func(), stop <-chan struct{}) bool {
+	select {
+	case p.queues[p.partition(key)] <- task:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Close 停止接受任务，等待已提交的任务执行完毕；调用后不能再Submit
+func (p *partitionPool) Close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
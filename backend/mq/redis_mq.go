@@ -6,109 +6,188 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// RedisMQ是基于Redis实现的消息队列
+// RedisMQ是基于Redis列表实现的消息队列，多个实例共享同一组队列
 type RedisMQ struct {
 	client            *redis.Client
+	list              *reliableList
 	ctx               context.Context
-	processHandler    func(pollID string, optionID string) error
+	processHandler    VoteHandler
+	mu                sync.Mutex
 	isRunning         bool
+	closed            bool
 	stopChan          chan struct{}
 	wg                sync.WaitGroup
 	processingTimeout time.Duration // 消息处理超时时间
-	retryDelay        time.Duration // 重试延迟
-	maxRetries        int           // 最大重试次数
+	opts              VoteQueueOptions
+	workers           int // 并发处理的协程数
+	pool              *partitionPool
+
+	sent      int64
+	processed int64
+	failed    int64
+	dropped   int64
+
+	waitTime    *Histogram // 入队到开始处理的耗时
+	processTime *Histogram // 处理函数的耗时
+}
+
+// RedisMQOptions 基于列表的Redis队列的配置
+//
+// 同一投票的消息只在单个实例内按取出顺序串行处理。多个实例从同一个vote_queue拉取，
+// 同一投票的消息可能同时在不同实例上处理；重试的消息经过vote_delayed回到队尾，
+// 排在同一投票之后入队的消息后面。投票计数与处理顺序无关，需要跨实例顺序的处理函数不能使用本后端。
+type RedisMQOptions struct {
+	Workers int // 本实例并发处理的协程数，同一投票的消息由本实例的同一个协程按顺序处理
 }
 
+// 每个处理协程最多缓存的消息数，满时暂停从Redis拉取
+const redisWorkerBuffer = 16
+
 // 消息队列的队列名称常量
 const (
 	MainQueueName       = "vote_queue"       // 主队列
 	ProcessingQueueName = "vote_processing"  // 处理中队列
 	DeadLetterQueueName = "vote_dead_letter" // 死信队列
 	RetriesHashName     = "vote_retries"     // 重试次数记录
+	MessageIDSetName    = "vote_message_ids" // 已入队的消息ID，用于幂等性检查
+	ClaimedHashName     = "vote_claimed_at"  // 消息被取出处理的时间，用于超时检查
+	DelayedQueueName    = "vote_delayed"     // 等待重试的消息，分数为到期时间（毫秒）
 )
 
-// 创建新的基于Redis的消息队列
-func NewRedisMQ(redisClient *redis.Client) *RedisMQ {
+// NewRedisMQ 创建新的基于Redis的消息队列
+func NewRedisMQ(redisClient *redis.Client, opts VoteQueueOptions, list RedisMQOptions) *RedisMQ {
+	if list.Workers <= 0 {
+		list.Workers = 8
+	}
 	return &RedisMQ{
-		client:            redisClient,
+		client: redisClient,
+		list: &reliableList{
+			client:     redisClient,
+			ready:      MainQueueName,
+			processing: ProcessingQueueName,
+			claimed:    ClaimedHashName,
+			delayed:    DelayedQueueName,
+			dead:       DeadLetterQueueName,
+		},
 		ctx:               context.Background(),
 		isRunning:         false,
 		stopChan:          make(chan struct{}),
-		processingTimeout: 5 * time.Minute,  // 默认5分钟超时
-		retryDelay:        30 * time.Second, // 默认30秒重试延迟
-		maxRetries:        3,                // 默认最大重试3次
+		processingTimeout: 5 * time.Minute, // 默认5分钟超时
+		opts:              opts,
+		workers:           list.Workers,
+		waitTime:          NewHistogram(latencyBuckets),
+		processTime:       NewHistogram(latencyBuckets),
 	}
 }
 
-// 注册消息处理函数
-func (r *RedisMQ) RegisterHandler(handler func(pollID string, optionID string) error) {
-	r.processHandler = handler
+// Send 发送一条投票消息
+func (r *RedisMQ) Send(ctx context.Context, msg VoteMessage) error {
+	return r.SendBatch(ctx, []VoteMessage{msg})
 }
 
-// 发送投票消息
-func (r *RedisMQ) SendVoteMessage(pollID string, optionID string) error {
-	// 构造消息
-	messageID := generateRedisMessageID(pollID, optionID)
-	msg := VoteMessage{
-		PollID:    pollID,
-		OptionID:  optionID,
-		Timestamp: time.Now().Unix(),
-		MessageID: messageID,
+// SendBatch 批量发送投票消息，已入队过的MessageID会被跳过
+func (r *RedisMQ) SendBatch(ctx context.Context, msgs []VoteMessage) error {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
 	}
 
-	// 序列化消息
-	jsonData, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("序列化消息失败: %v", err)
+	prepared := make([]VoteMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		msg, err := prepareVoteMessage(msg)
+		if err != nil {
+			return err
+		}
+		prepared = append(prepared, msg)
 	}
-
-	// 幂等性检查 - 检查该消息是否已在处理队列中
-	exists, err := r.client.SIsMember(r.ctx, "vote_message_ids", messageID).Result()
-	if err != nil {
-		// 继续处理，不因此阻止业务 - 但记录错误
-		log.Printf("检查消息幂等性出错: %v", err)
-	} else if exists {
-		// 消息已存在，已处理过
-		log.Printf("消息已处理过，跳过: %s", messageID)
+	if len(prepared) == 0 {
 		return nil
 	}
 
-	// 添加消息ID到集合，用于幂等性检查
-	err = r.client.SAdd(r.ctx, "vote_message_ids", messageID).Err()
-	if err != nil {
-		// 继续处理，但记录错误
-		log.Printf("添加消息ID到幂等性集合出错: %v", err)
+	fresh := claimMessageIDs(ctx, r.client, prepared)
+	if len(fresh) == 0 {
+		return nil
 	}
-	// 设置过期时间，避免集合无限增长
-	r.client.Expire(r.ctx, "vote_message_ids", 48*time.Hour)
 
-	// 发送消息到主队列
-	err = r.client.LPush(r.ctx, MainQueueName, jsonData).Err()
-	if err != nil {
+	now := time.Now().UnixMilli()
+	pipe := r.client.Pipeline()
+	for _, msg := range fresh {
+		msg.EnqueuedAt = now
+		jsonData, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("序列化消息失败: %v", err)
+		}
+		pipe.LPush(ctx, MainQueueName, jsonData)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		releaseMessageIDs(ctx, r.client, fresh)
 		return fmt.Errorf("发送消息到队列失败: %v", err)
 	}
 
-	log.Printf("消息成功发送到Redis队列: %s, 消息ID: %s", MainQueueName, messageID)
+	atomic.AddInt64(&r.sent, int64(len(fresh)))
+	log.Printf("消息成功发送到Redis队列: %s, 数量: %d", MainQueueName, len(fresh))
 	return nil
 }
 
-// 启动消费者
-func (r *RedisMQ) Start() error {
-	if r.processHandler == nil {
-		return fmt.Errorf("处理函数未注册")
+// claimMessageIDs 在共享的消息ID集合中登记消息，返回之前未入队过的消息
+// Redis出错时不阻止业务，全部视为新消息
+func claimMessageIDs(ctx context.Context, client *redis.Client, msgs []VoteMessage) []VoteMessage {
+	// 幂等性检查 - SADD返回0说明消息ID已经入队过
+	pipe := client.Pipeline()
+	added := make([]*redis.IntCmd, len(msgs))
+	for i, msg := range msgs {
+		added[i] = pipe.SAdd(ctx, MessageIDSetName, msg.MessageID)
+	}
+	// 设置过期时间，避免集合无限增长
+	pipe.Expire(ctx, MessageIDSetName, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("检查消息幂等性出错: %v", err)
+	}
+
+	fresh := make([]VoteMessage, 0, len(msgs))
+	for i, msg := range msgs {
+		if added[i].Err() == nil && added[i].Val() == 0 {
+			log.Printf("消息已处理过，跳过: %s", msg.MessageID)
+			continue
+		}
+		fresh = append(fresh, msg)
+	}
+	return fresh
+}
+
+// releaseMessageIDs 入队失败时移除消息ID，允许调用方重新发送
+func releaseMessageIDs(ctx context.Context, client *redis.Client, msgs []VoteMessage) {
+	ids := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.MessageID
 	}
+	client.SRem(ctx, MessageIDSetName, ids...)
+}
 
+// Subscribe 注册处理函数并启动消费者
+func (r *RedisMQ) Subscribe(handler VoteHandler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrQueueClosed
+	}
 	if r.isRunning {
 		return nil // 已经在运行中
 	}
 
+	r.processHandler = handler
 	r.isRunning = true
-	log.Println("Redis消息队列消费者启动中...")
+	r.pool = newPartitionPool(r.workers, redisWorkerBuffer)
+	log.Printf("Redis消息队列消费者启动中，处理协程数: %d，同一投票的消息只在本实例内按顺序处理，重试的消息排到队尾", r.workers)
 
 	// 启动主消费循环
 	r.wg.Add(1)
@@ -118,21 +197,35 @@ func (r *RedisMQ) Start() error {
 	r.wg.Add(1)
 	go r.timeoutCheckLoop()
 
+	// 启动到期重试消息的搬运
+	r.wg.Add(1)
+	go r.delayedLoop()
+
 	log.Println("Redis消息队列消费者已启动")
 	return nil
 }
 
-// 关闭消费者
-func (r *RedisMQ) Stop() {
-	if !r.isRunning {
-		return
+// Close 关闭消费者，Redis客户端由调用方关闭
+func (r *RedisMQ) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
 	}
-
-	log.Println("正在关闭Redis消息队列消费者...")
-	close(r.stopChan)
-	r.wg.Wait()
+	r.closed = true
+	running := r.isRunning
 	r.isRunning = false
-	log.Println("Redis消息队列消费者已关闭")
+	r.mu.Unlock()
+
+	if running {
+		log.Println("正在关闭Redis消息队列消费者...")
+		close(r.stopChan)
+		r.wg.Wait()
+		// 已交给处理协程的消息处理完后再退出
+		r.pool.Close()
+		log.Println("Redis消息队列消费者已关闭")
+	}
+	return nil
 }
 
 // 主消费循环
@@ -145,17 +238,28 @@ func (r *RedisMQ) consumeLoop() {
 			return
 		default:
 			// 使用BRPOPLPUSH原子操作从主队列获取并移动到处理中队列
-			result, err := r.client.BRPopLPush(r.ctx, MainQueueName, ProcessingQueueName, 1*time.Second).Result()
-
+			result, err := r.list.claim(r.ctx, 1*time.Second)
 			if err != nil {
-				if err != redis.Nil { // 忽略超时错误
-					log.Printf("从队列获取消息失败: %v", err)
-				}
+				log.Printf("从队列获取消息失败: %v", err)
+				continue
+			}
+			if result == "" {
 				continue
 			}
 
-			// 异步处理消息
-			go r.processMessage(result)
+			var msg VoteMessage
+			if err := json.Unmarshal([]byte(result), &msg); err != nil {
+				log.Printf("解析消息失败: %v", err)
+				r.moveToDeadLetter(result, "")
+				continue
+			}
+			r.list.markClaimed(r.ctx, msg.MessageID)
+
+			// 按投票分区交给处理协程，同一投票的消息在本实例内串行处理；协程都忙时阻塞，不再拉取新消息
+			if !r.pool.Submit(msg.PollID, func() { r.processMessage(result, msg) }, r.stopChan) {
+				// 消息留在处理中队列，超时后由超时检查重新入队
+				return
+			}
 		}
 	}
 }
@@ -177,161 +281,253 @@ func (r *RedisMQ) timeoutCheckLoop() {
 	}
 }
 
-// 检查消息处理超时
+// 检查消息处理超时，没有取出时间记录时按发送时间计算
 func (r *RedisMQ) checkTimeouts() {
-	// 获取处理中队列的所有消息
-	messages, err := r.client.LRange(r.ctx, ProcessingQueueName, 0, -1).Result()
+	stale, err := r.list.staleClaims(r.ctx, r.processingTimeout, time.Now(), func(item string) (string, int64, bool) {
+		var msg VoteMessage
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			log.Printf("解析消息数据失败: %v", err)
+			return "", 0, false
+		}
+		return msg.MessageID, msg.Timestamp, true
+	})
 	if err != nil {
 		log.Printf("获取处理中队列消息失败: %v", err)
 		return
 	}
 
-	now := time.Now().Unix()
-
-	for _, msgData := range messages {
+	for _, claim := range stale {
 		var msg VoteMessage
-		if err := json.Unmarshal([]byte(msgData), &msg); err != nil {
-			log.Printf("解析消息数据失败: %v", err)
-			continue
+		json.Unmarshal([]byte(claim.item), &msg)
+		retries, _ := r.client.HGet(r.ctx, RetriesHashName, msg.MessageID).Int()
+		if retries >= r.opts.MaxRetries {
+			// 超过最大重试次数，移至死信队列
+			log.Printf("消息 %s 处理超时且超过最大重试次数，移至死信队列", msg.MessageID)
+			r.moveToDeadLetter(claim.item, msg.MessageID)
+		} else {
+			log.Printf("消息 %s 处理超时", msg.MessageID)
+			r.scheduleRetry(claim.item, msg, retries+1)
 		}
+	}
+}
 
-		// 如果消息处理时间超过timeout，重新入队
-		if now-msg.Timestamp > int64(r.processingTimeout.Seconds()) {
-			retries, _ := r.client.HGet(r.ctx, RetriesHashName, msg.MessageID).Int()
-
-			if retries >= r.maxRetries {
-				// 超过最大重试次数，移至死信队列
-				log.Printf("消息 %s 超过最大重试次数，移至死信队列", msg.MessageID)
-				r.moveToDeadLetter(msgData)
-			} else {
-				// 增加重试计数
-				r.client.HIncrBy(r.ctx, RetriesHashName, msg.MessageID, 1)
-
-				// 更新时间戳
-				msg.Timestamp = now
-				updatedData, _ := json.Marshal(msg)
-
-				// 从处理中队列删除
-				r.client.LRem(r.ctx, ProcessingQueueName, 1, msgData)
-
-				// 延迟一段时间后重新入队
-				time.AfterFunc(r.retryDelay, func() {
-					r.client.LPush(r.ctx, MainQueueName, updatedData)
-					log.Printf("消息 %s 重新入队，重试次数: %d", msg.MessageID, retries+1)
-				})
-			}
+// delayedLoop 定期将到期的重试消息移回主队列
+func (r *RedisMQ) delayedLoop() {
+	defer r.wg.Done()
+
+	interval := r.opts.RetryDelay / 2
+	if interval > time.Second {
+		interval = time.Second
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+			r.promoteDelayed()
 		}
 	}
 }
 
-// 处理单个消息
-func (r *RedisMQ) processMessage(msgData string) {
-	var msg VoteMessage
-	if err := json.Unmarshal([]byte(msgData), &msg); err != nil {
-		log.Printf("解析消息失败: %v", err)
-		r.moveToDeadLetter(msgData)
+// promoteDelayed 移动所有已到期的重试消息
+func (r *RedisMQ) promoteDelayed() {
+	if _, err := r.list.promote(r.ctx, time.Now()); err != nil {
+		log.Printf("移动到期的重试消息失败: %v", err)
+	}
+}
+
+// scheduleRetry 将消息从处理中队列移到延迟队列，第attempt次重试在退避时间后到期
+// 在同一个事务中完成，进程退出也不会丢失或重复
+func (r *RedisMQ) scheduleRetry(msgData string, msg VoteMessage, attempt int) {
+	delay := r.opts.backoff(attempt)
+	due := time.Now().Add(delay)
+	msg.Timestamp = time.Now().Unix()
+	// 排队时间从到期时开始计算
+	msg.EnqueuedAt = due.UnixMilli()
+	updatedData, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("序列化重试消息失败: %v", err)
+		return
+	}
+
+	err = r.list.retryAt(r.ctx, msgData, msg.MessageID, string(updatedData), due, func(pipe redis.Pipeliner) {
+		pipe.HSet(r.ctx, RetriesHashName, msg.MessageID, attempt)
+	})
+	if err != nil {
+		// 消息仍在处理中队列，超时后由超时检查重新安排
+		log.Printf("安排消息 %s 重试失败: %v", msg.MessageID, err)
 		return
 	}
+	log.Printf("消息 %s 将在 %v 后第 %d 次重试", msg.MessageID, delay.Round(time.Millisecond), attempt)
+}
+
+// 处理单个消息，msgData是消息在处理中队列里的原始内容
+func (r *RedisMQ) processMessage(msgData string, msg VoteMessage) {
+	start := time.Now()
+	if msg.EnqueuedAt > 0 {
+		r.waitTime.Observe(start.Sub(time.UnixMilli(msg.EnqueuedAt)))
+	} else {
+		r.waitTime.Observe(start.Sub(time.Unix(msg.Timestamp, 0)))
+	}
 
 	log.Printf("处理消息: PollID=%s, OptionID=%s, MessageID=%s",
 		msg.PollID, msg.OptionID, msg.MessageID)
 
 	// 调用处理函数
-	if err := r.processHandler(msg.PollID, msg.OptionID); err != nil {
-		log.Printf("处理消息失败: %v", err)
+	err := r.processHandler(msg.PollID, msg.OptionID)
+	r.processTime.Observe(time.Since(start))
+	if err == nil {
+		// 处理成功，清除重试计数
+		atomic.AddInt64(&r.processed, 1)
+		r.ack(msgData, msg.MessageID)
+		log.Printf("消息处理成功: %s", msg.MessageID)
+		return
+	}
 
-		// 获取当前重试次数
+	atomic.AddInt64(&r.failed, 1)
+	switch ClassifyError(err) {
+	case ErrorDrop:
+		atomic.AddInt64(&r.dropped, 1)
+		log.Printf("丢弃消息 %s: %v", msg.MessageID, err)
+		r.ack(msgData, msg.MessageID)
+	case ErrorPermanent:
+		log.Printf("处理消息 %s 失败且不可重试，移至死信队列: %v", msg.MessageID, err)
+		r.moveToDeadLetter(msgData, msg.MessageID)
+	default:
+		log.Printf("处理消息失败: %v", err)
 		retries, _ := r.client.HGet(r.ctx, RetriesHashName, msg.MessageID).Int()
-
-		if retries >= r.maxRetries {
+		if retries >= r.opts.MaxRetries {
 			// 超过最大重试次数，移至死信队列
 			log.Printf("消息 %s 超过最大重试次数，移至死信队列", msg.MessageID)
-			r.moveToDeadLetter(msgData)
-		} else {
-			// 增加重试计数
-			r.client.HIncrBy(r.ctx, RetriesHashName, msg.MessageID, 1)
-
-			// 更新时间戳
-			msg.Timestamp = time.Now().Unix()
-			updatedData, _ := json.Marshal(msg)
-
-			// 延迟重试
-			time.AfterFunc(r.retryDelay, func() {
-				r.client.LPush(r.ctx, MainQueueName, updatedData)
-				log.Printf("消息 %s 重新入队，重试次数: %d", msg.MessageID, retries+1)
-			})
+			r.moveToDeadLetter(msgData, msg.MessageID)
+			return
 		}
-	} else {
-		// 处理成功，从处理中队列移除
-		log.Printf("消息处理成功: %s", msg.MessageID)
+		r.scheduleRetry(msgData, msg, retries+1)
 	}
-
-	// 无论成功失败，都从处理中队列移除
-	r.client.LRem(r.ctx, ProcessingQueueName, 1, msgData)
 }
 
-// 将消息移动到死信队列
-func (r *RedisMQ) moveToDeadLetter(msgData string) {
-	r.client.LPush(r.ctx, DeadLetterQueueName, msgData)
-	r.client.LRem(r.ctx, ProcessingQueueName, 1, msgData)
+// ack 消息处理完成或被丢弃，从处理中队列移除并清除重试计数
+func (r *RedisMQ) ack(msgData string, messageID string) {
+	err := r.list.ack(r.ctx, msgData, messageID, func(pipe redis.Pipeliner) {
+		pipe.HDel(r.ctx, RetriesHashName, messageID)
+	})
+	if err != nil {
+		// 消息仍在处理中队列，超时后会被再次处理
+		log.Printf("确认消息 %s 失败: %v", messageID, err)
+	}
 }
 
-// 生成唯一的Redis消息ID
-func generateRedisMessageID(pollID string, optionID string) string {
-	return fmt.Sprintf("redis_mq_%s_%s_%d", pollID, optionID, time.Now().UnixNano())
+// 将消息移动到死信队列
+// 重试计数保留到死信重新入队时清除；messageID为空表示消息无法解析
+func (r *RedisMQ) moveToDeadLetter(msgData string, messageID string) {
+	if err := r.list.bury(r.ctx, msgData, messageID, msgData); err != nil {
+		log.Printf("移动消息到死信队列失败: %v", err)
+	}
 }
 
-// 重新处理死信队列中的消息
-func (r *RedisMQ) RetryDeadLetters() error {
+// RetryDeadLetters 重新处理死信队列中的消息
+func (r *RedisMQ) RetryDeadLetters(ctx context.Context) (int, error) {
 	// 获取死信队列中的所有消息
-	messages, err := r.client.LRange(r.ctx, DeadLetterQueueName, 0, -1).Result()
+	messages, err := r.client.LRange(ctx, DeadLetterQueueName, 0, -1).Result()
 	if err != nil {
-		return fmt.Errorf("获取死信队列消息失败: %v", err)
+		return 0, fmt.Errorf("获取死信队列消息失败: %v", err)
 	}
 
 	count := 0
 	for _, msgData := range messages {
-		// 重新入队到主队列
-		err := r.client.LPush(r.ctx, MainQueueName, msgData).Err()
+		// 重新入队到主队列，排队时间从现在开始计算
+		requeued := msgData
+		var msg VoteMessage
+		parsed := json.Unmarshal([]byte(msgData), &msg) == nil
+		if parsed {
+			msg.EnqueuedAt = time.Now().UnixMilli()
+			if data, err := json.Marshal(msg); err == nil {
+				requeued = string(data)
+			}
+		}
+		err := r.client.LPush(ctx, MainQueueName, requeued).Err()
 		if err != nil {
 			log.Printf("重新入队消息失败: %v", err)
 			continue
 		}
 
 		// 从死信队列移除
-		r.client.LRem(r.ctx, DeadLetterQueueName, 1, msgData)
+		r.client.LRem(ctx, DeadLetterQueueName, 1, msgData)
 
 		// 重置重试计数
-		var msg VoteMessage
-		if json.Unmarshal([]byte(msgData), &msg) == nil {
-			r.client.HDel(r.ctx, RetriesHashName, msg.MessageID)
+		if parsed {
+			r.client.HDel(ctx, RetriesHashName, msg.MessageID)
 		}
 
 		count++
 	}
 
 	log.Printf("成功将 %d 条消息从死信队列移回主队列", count)
-	return nil
+	return count, nil
 }
 
-// 获取各队列的消息数量统计
-func (r *RedisMQ) GetQueueStats() map[string]int64 {
-	stats := make(map[string]int64)
+// DeadLetters 列出死信消息，最新的在前
+func (r *RedisMQ) DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	// 死信通过LPUSH写入，列表头部是最新的
+	items, err := r.client.LRange(ctx, DeadLetterQueueName, 0, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取死信队列消息失败: %v", err)
+	}
+
+	result := make([]VoteMessage, 0, len(items))
+	for _, item := range items {
+		var msg VoteMessage
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			log.Printf("解析死信消息失败: %v", err)
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
 
-	mainLen, _ := r.client.LLen(r.ctx, MainQueueName).Result()
-	procLen, _ := r.client.LLen(r.ctx, ProcessingQueueName).Result()
-	deadLen, _ := r.client.LLen(r.ctx, DeadLetterQueueName).Result()
+// Latency 返回本实例处理的消息的排队和处理耗时
+func (r *RedisMQ) Latency() QueueLatency {
+	return QueueLatency{Wait: r.waitTime.Snapshot(), Processing: r.processTime.Snapshot()}
+}
 
-	stats["main_queue"] = mainLen
-	stats["processing_queue"] = procLen
-	stats["dead_letter_queue"] = deadLen
+// Stats 获取各队列的消息数量统计
+func (r *RedisMQ) Stats(ctx context.Context) (VoteQueueStats, error) {
+	pipe := r.client.Pipeline()
+	mainLen := pipe.LLen(ctx, MainQueueName)
+	procLen := pipe.LLen(ctx, ProcessingQueueName)
+	delayedLen := pipe.ZCard(ctx, DelayedQueueName)
+	deadLen := pipe.LLen(ctx, DeadLetterQueueName)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return VoteQueueStats{}, fmt.Errorf("获取队列长度失败: %v", err)
+	}
 
-	return stats
+	return VoteQueueStats{
+		Backend:     BackendRedis,
+		Pending:     mainLen.Val(),
+		Processing:  procLen.Val(),
+		Delayed:     delayedLen.Val(),
+		DeadLetters: deadLen.Val(),
+		Sent:        atomic.LoadInt64(&r.sent),
+		Processed:   atomic.LoadInt64(&r.processed),
+		Failed:      atomic.LoadInt64(&r.failed),
+		Dropped:     atomic.LoadInt64(&r.dropped),
+	}, nil
 }
 
 // 清空所有队列（仅用于测试）
 func (r *RedisMQ) ClearAllQueues() error {
-	err := r.client.Del(r.ctx, MainQueueName, ProcessingQueueName, DeadLetterQueueName, RetriesHashName).Err()
+	err := r.client.Del(r.ctx, MainQueueName, ProcessingQueueName, DeadLetterQueueName, RetriesHashName, MessageIDSetName, ClaimedHashName, DelayedQueueName).Err()
 	if err != nil {
 		return fmt.Errorf("清空队列失败: %v", err)
 	}
@@ -0,0 +1,286 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisMQ_WorkerPoolOrdersPerPoll(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	q := NewRedisMQ(client, VoteQueueOptions{MaxRetries: 1, RetryDelay: 50 * time.Millisecond}, RedisMQOptions{Workers: 3})
+	defer q.Close()
+	ctx := context.Background()
+
+	const polls, perPoll = 6, 10
+	var msgs []VoteMessage
+	for i := 0; i < perPoll; i++ {
+		for p := 0; p < polls; p++ {
+			msgs = append(msgs, VoteMessage{PollID: fmt.Sprint(p), OptionID: fmt.Sprint(i)})
+		}
+	}
+	require.NoError(t, q.SendBatch(ctx, msgs))
+
+	var (
+		mu          sync.Mutex
+		order       = make(map[string][]string)
+		activePoll  = make(map[string]int)
+		active      int
+		maxActive   int
+		pollOverlap bool
+	)
+	done := make(chan struct{})
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		mu.Lock()
+		activePoll[pollID]++
+		if activePoll[pollID] > 1 {
+			pollOverlap = true
+		}
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		activePoll[pollID]--
+		active--
+		order[pollID] = append(order[pollID], optionID)
+		total := 0
+		for _, o := range order {
+			total += len(o)
+		}
+		if total == polls*perPoll {
+			close(done)
+		}
+		return nil
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("messages were not all processed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.False(t, pollOverlap, "messages of one poll were handled concurrently")
+	assert.LessOrEqual(t, maxActive, 3)
+	assert.Greater(t, maxActive, 1, "different polls should be handled in parallel")
+	for p := 0; p < polls; p++ {
+		want := make([]string, perPoll)
+		for i := range want {
+			want[i] = fmt.Sprint(i)
+		}
+		assert.Equal(t, want, order[fmt.Sprint(p)], "poll %d", p)
+	}
+
+	require.Eventually(t, func() bool {
+		return q.Latency().Processing.Count == polls*perPoll
+	}, time.Second, 10*time.Millisecond)
+	latency := q.Latency()
+	assert.Equal(t, uint64(polls*perPoll), latency.Wait.Count)
+	assert.GreaterOrEqual(t, latency.Processing.Sum, 0.005*polls*perPoll)
+	// Every handler call took at least 5ms, so none lands in the first bucket
+	assert.Zero(t, latency.Processing.Counts[0])
+	assert.Equal(t, latency.Processing.Count, latency.Processing.Counts[len(latency.Processing.Counts)-1])
+}
+
+// Ordering only holds within an instance and a retry goes back to the tail,
+// so a message that fails once is handled after later messages of its poll.
+func TestRedisMQ_RetriedMessageRunsAfterLaterMessages(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	q := NewRedisMQ(client, VoteQueueOptions{MaxRetries: 1, RetryDelay: 20 * time.Millisecond}, RedisMQOptions{Workers: 1})
+	defer q.Close()
+	ctx := context.Background()
+
+	require.NoError(t, q.SendBatch(ctx, []VoteMessage{
+		{PollID: "1", OptionID: "a"},
+		{PollID: "1", OptionID: "b"},
+	}))
+
+	var (
+		mu     sync.Mutex
+		order  []string
+		failed bool
+	)
+	done := make(chan struct{})
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, optionID)
+		if optionID == "a" && !failed {
+			failed = true
+			return errors.New("database busy")
+		}
+		if len(order) == 3 {
+			close(done)
+		}
+		return nil
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retried message was not processed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"a", "b", "a"}, order)
+}
+
+func TestRedisMQ_TimeoutCountsFromClaim(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	q := NewRedisMQ(client, VoteQueueOptions{MaxRetries: 1, RetryDelay: time.Millisecond}, RedisMQOptions{})
+	defer q.Close()
+	ctx := context.Background()
+
+	// Both messages were sent an hour ago; only the one without a claim record counts as timed out
+	old := time.Now().Add(-time.Hour).Unix()
+	for _, id := range []string{"claimed", "orphan"} {
+		data, err := json.Marshal(VoteMessage{PollID: "1", OptionID: "1", MessageID: id, Timestamp: old})
+		require.NoError(t, err)
+		require.NoError(t, client.LPush(ctx, ProcessingQueueName, data).Err())
+	}
+	require.NoError(t, client.HSet(ctx, ClaimedHashName, "claimed", time.Now().Unix()).Err())
+
+	q.checkTimeouts()
+
+	items, err := client.LRange(ctx, ProcessingQueueName, 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Contains(t, items[0], `"message_id":"claimed"`)
+
+	// The timed out message waits in the delayed set until its backoff expires
+	delayed, err := client.ZRange(ctx, DelayedQueueName, 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, delayed, 1)
+	assert.Contains(t, delayed[0], `"message_id":"orphan"`)
+	assert.Equal(t, "1", client.HGet(ctx, RetriesHashName, "orphan").Val())
+
+	require.Eventually(t, func() bool {
+		q.promoteDelayed()
+		return client.LLen(ctx, MainQueueName).Val() == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Zero(t, client.ZCard(ctx, DelayedQueueName).Val())
+
+	requeued, err := client.LIndex(ctx, MainQueueName, 0).Result()
+	require.NoError(t, err)
+	var msg VoteMessage
+	require.NoError(t, json.Unmarshal([]byte(requeued), &msg))
+	assert.Equal(t, "orphan", msg.MessageID)
+	assert.NotZero(t, msg.EnqueuedAt)
+}
+
+func TestRedisMQ_RetrySurvivesRestart(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	opts := VoteQueueOptions{MaxRetries: 3, RetryDelay: 200 * time.Millisecond}
+	ctx := context.Background()
+
+	first := NewRedisMQ(client, opts, RedisMQOptions{Workers: 1})
+	failed := make(chan struct{}, 1)
+	require.NoError(t, first.Subscribe(func(pollID, optionID string) error {
+		failed <- struct{}{}
+		return errors.New("database unavailable")
+	}))
+	require.NoError(t, first.Send(ctx, VoteMessage{PollID: "1", OptionID: "1", MessageID: "m1"}))
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+	// The process goes away before the retry is due
+	require.Eventually(t, func() bool {
+		return client.ZCard(ctx, DelayedQueueName).Val() == 1
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, first.Close())
+
+	stats, err := first.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Delayed)
+	assert.Zero(t, stats.Processing)
+
+	second := NewRedisMQ(client, opts, RedisMQOptions{Workers: 1})
+	defer second.Close()
+	handled := make(chan string, 1)
+	require.NoError(t, second.Subscribe(func(pollID, optionID string) error {
+		handled <- pollID + "/" + optionID
+		return nil
+	}))
+	select {
+	case got := <-handled:
+		assert.Equal(t, "1/1", got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry was lost across the restart")
+	}
+	require.Eventually(t, func() bool {
+		return !client.HExists(ctx, RetriesHashName, "m1").Val()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	base, max := time.Second, 10*time.Second
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: max, 20: max} {
+		for i := 0; i < 50; i++ {
+			d := exponentialBackoff(attempt, base, max)
+			assert.GreaterOrEqual(t, d, ceiling/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, d, ceiling, "attempt %d", attempt)
+		}
+	}
+}
+
+func TestPromoteDue_MovesDueMembersInOrderAcrossBatches(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	const due, later = promoteBatch + 20, 5
+	for i := 0; i < due; i++ {
+		require.NoError(t, client.ZAdd(ctx, "delayed", redis.Z{Score: float64(now.Add(-time.Duration(due-i) * time.Millisecond).UnixMilli()), Member: fmt.Sprint(i)}).Err())
+	}
+	for i := 0; i < later; i++ {
+		require.NoError(t, client.ZAdd(ctx, "delayed", redis.Z{Score: float64(now.Add(time.Hour).UnixMilli()), Member: fmt.Sprint("later-", i)}).Err())
+	}
+
+	moved, err := promoteDue(ctx, client, "delayed", "ready", now)
+	require.NoError(t, err)
+	assert.Equal(t, due, moved)
+	assert.Equal(t, int64(later), client.ZCard(ctx, "delayed").Val())
+
+	// The earliest due member is popped first from the tail
+	tail, err := client.RPop(ctx, "ready").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "0", tail)
+}
+
+func TestClassifyError(t *testing.T) {
+	cause := errors.New("poll closed")
+	assert.Equal(t, ErrorRetryable, ClassifyError(cause))
+	assert.Equal(t, ErrorDrop, ClassifyError(fmt.Errorf("wrapped: %w", Drop(cause))))
+	assert.Equal(t, ErrorPermanent, ClassifyError(Permanent(cause)))
+	assert.ErrorIs(t, Drop(cause), cause)
+}
+
+func TestHistogramSnapshot(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(50 * time.Millisecond)
+	h.Observe(500 * time.Millisecond)
+	h.Observe(2 * time.Second)
+	h.Observe(-time.Second)
+
+	snap := h.Snapshot()
+	assert.Equal(t, []uint64{2, 3}, snap.Counts)
+	assert.Equal(t, uint64(4), snap.Count)
+	assert.InDelta(t, 2.55, snap.Sum, 1e-9)
+}
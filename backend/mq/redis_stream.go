@@ -0,0 +1,679 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis Streams队列的键和消费者组
+const (
+	VoteStreamName           = "vote_stream"      // 投票消息流
+	VoteStreamDeadLetterName = "vote_stream_dead" // 死信流
+	VoteStreamGroup          = "vote_workers"     // 消费者组
+)
+
+// 长时间空闲且没有未确认消息的消费者会从组中删除，避免重启后残留的消费者名越积越多
+const streamConsumerTTL = 24 * time.Hour
+
+// RedisStreamOptions Redis Streams队列的配置
+type RedisStreamOptions struct {
+	Consumer      string        // 消费者名称，同一组内唯一，默认使用主机名
+	ClaimIdle     time.Duration // 消息超过该时间未确认时被其他消费者认领，至少为重试延迟的两倍
+	MaxLen        int64         // 流的近似最大长度，超过后裁剪最早的消息
+	BatchSize     int64         // 每次读取的消息数
+	MigrateLegacy bool          // 将旧版列表队列（vote_queue等）中的消息迁移到流中
+}
+
+// RedisStreamQueue 基于Redis Streams消费者组的投票消息队列
+//
+// 每条消息由组内的一个消费者读取并在处理成功后XACK；未确认的消息归属于读取它的消费者，
+// 可以按消费者查看。处理失败的消息由本消费者在重试延迟后重新认领，
+// 消费者宕机时其未确认的消息超过ClaimIdle后由其他消费者通过XAUTOCLAIM接管。
+// 投递次数超过最大重试次数的消息写入死信流并确认。
+type RedisStreamQueue struct {
+	client *redis.Client
+	opts   VoteQueueOptions
+	stream RedisStreamOptions
+
+	mu      sync.Mutex
+	handler VoteHandler
+	running bool
+	closed  bool
+	stop    chan struct{}
+	retry   chan streamRetry
+	wg      sync.WaitGroup
+
+	processing int64
+	sent       int64
+	processed  int64
+	failed     int64
+	dropped    int64
+}
+
+// streamRetry 一条等待本消费者重新认领的失败消息
+type streamRetry struct {
+	id    string
+	delay time.Duration // 认领时要求消息至少空闲的时间
+}
+
+// 从列表尾部（最早的消息）取出最多ARGV[1]条写入流
+var drainListScript = redis.NewScript(`
+local moved = 0
+for i = 1, tonumber(ARGV[1]) do
+	local item = redis.call('RPOP', KEYS[1])
+	if not item then
+		break
+	end
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*', 'data', item)
+	moved = moved + 1
+end
+return moved
+`)
+
+// 从延迟集合中取出最早到期的最多ARGV[1]条写入流，不等待到期
+var drainDelayedScript = redis.NewScript(`
+local items = redis.call('ZRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*', 'data', item)
+end
+return #items
+`)
+
+// 仅当消息仍在列表中时才移动到流，避免与旧版消费者重复处理
+var moveListItemScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*', 'data', ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// 仅当死信仍存在时才重新入队，避免并发重试时重复入队
+var reviveStreamEntryScript = redis.NewScript(`
+if redis.call('XDEL', KEYS[1], ARGV[1]) == 1 then
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', 'data', ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// NewRedisStreamQueue 创建消费者组（已存在时复用）并返回队列
+func NewRedisStreamQueue(client *redis.Client, opts VoteQueueOptions, stream RedisStreamOptions) (*RedisStreamQueue, error) {
+	if stream.Consumer == "" {
+		stream.Consumer, _ = os.Hostname()
+		if stream.Consumer == "" {
+			stream.Consumer = fmt.Sprintf("consumer-%d", os.Getpid())
+		}
+	}
+	if stream.ClaimIdle <= 0 {
+		stream.ClaimIdle = 5 * time.Minute
+	}
+	// 认领时间不长于重试延迟时，失败的消息会在本消费者重试之前被其他消费者抢走
+	if stream.ClaimIdle < 2*opts.RetryDelay {
+		stream.ClaimIdle = 2 * opts.RetryDelay
+	}
+	if stream.MaxLen <= 0 {
+		stream.MaxLen = 100000
+	}
+	if stream.BatchSize <= 0 {
+		stream.BatchSize = 16
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 从流的开头创建组，组创建之前写入的消息也会被消费
+	err := client.XGroupCreateMkStream(ctx, VoteStreamName, VoteStreamGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("创建消费者组失败: %v", err)
+	}
+
+	return &RedisStreamQueue{
+		client: client,
+		opts:   opts,
+		stream: stream,
+		stop:   make(chan struct{}),
+		retry:  make(chan streamRetry, 1024),
+	}, nil
+}
+
+// Send 发送一条投票消息
+func (q *RedisStreamQueue) Send(ctx context.Context, msg VoteMessage) error {
+	return q.SendBatch(ctx, []VoteMessage{msg})
+}
+
+// SendBatch 批量写入流，已入队过的MessageID会被跳过
+func (q *RedisStreamQueue) SendBatch(ctx context.Context, msgs []VoteMessage) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
+	}
+
+	prepared := make([]VoteMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		msg, err := prepareVoteMessage(msg)
+		if err != nil {
+			return err
+		}
+		prepared = append(prepared, msg)
+	}
+	if len(prepared) == 0 {
+		return nil
+	}
+
+	fresh := claimMessageIDs(ctx, q.client, prepared)
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	pipe := q.client.Pipeline()
+	for _, msg := range fresh {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("序列化消息失败: %v", err)
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: VoteStreamName,
+			MaxLen: q.stream.MaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"data": data},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		releaseMessageIDs(ctx, q.client, fresh)
+		return fmt.Errorf("发送消息到流失败: %v", err)
+	}
+
+	atomic.AddInt64(&q.sent, int64(len(fresh)))
+	return nil
+}
+
+// Subscribe 注册处理函数，启动读取和认领协程
+func (q *RedisStreamQueue) Subscribe(handler VoteHandler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.running {
+		return nil
+	}
+	q.handler = handler
+	q.running = true
+
+	q.wg.Add(2)
+	go q.consumeLoop()
+	go q.claimLoop()
+	log.Printf("Redis Streams消费者已启动: 组=%s, 消费者=%s", VoteStreamGroup, q.stream.Consumer)
+	return nil
+}
+
+func (q *RedisStreamQueue) stopped() bool {
+	select {
+	case <-q.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// consumeLoop 先处理本消费者重启前未确认的消息，再读取新消息
+func (q *RedisStreamQueue) consumeLoop() {
+	defer q.wg.Done()
+	ctx := context.Background()
+
+	// 使用"0"读取的是本消费者的未确认消息，按ID翻页直到读完
+	start := "0"
+	for !q.stopped() {
+		messages, err := q.read(ctx, start, -1)
+		if err != nil {
+			log.Printf("读取未确认消息失败: %v", err)
+			break
+		}
+		if len(messages) == 0 {
+			break
+		}
+		for _, message := range messages {
+			q.process(ctx, message)
+		}
+		start = messages[len(messages)-1].ID
+	}
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case retry := <-q.retry:
+			q.retryMessage(ctx, retry)
+			continue
+		default:
+		}
+
+		messages, err := q.read(ctx, ">", time.Second)
+		if err != nil {
+			if err != redis.Nil && !q.stopped() {
+				log.Printf("从流读取消息失败: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, message := range messages {
+			q.process(ctx, message)
+		}
+	}
+}
+
+// read 以消费者组读取消息，block为负数时不阻塞
+func (q *RedisStreamQueue) read(ctx context.Context, start string, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    VoteStreamGroup,
+		Consumer: q.stream.Consumer,
+		Streams:  []string{VoteStreamName, start},
+		Count:    q.stream.BatchSize,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
+
+// process 处理一条流消息，成功时确认，失败时安排重试或写入死信
+func (q *RedisStreamQueue) process(ctx context.Context, message redis.XMessage) {
+	atomic.AddInt64(&q.processing, 1)
+	defer atomic.AddInt64(&q.processing, -1)
+
+	data, _ := message.Values["data"].(string)
+	if data == "" {
+		// 被裁剪或删除的消息只剩ID，直接确认
+		q.client.XAck(ctx, VoteStreamName, VoteStreamGroup, message.ID)
+		return
+	}
+
+	var msg VoteMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		log.Printf("解析消息失败: %v", err)
+		q.bury(ctx, message.ID, data)
+		return
+	}
+
+	if err := q.handler(msg.PollID, msg.OptionID); err != nil {
+		atomic.AddInt64(&q.failed, 1)
+
+		switch ClassifyError(err) {
+		case ErrorDrop:
+			atomic.AddInt64(&q.dropped, 1)
+			log.Printf("丢弃消息 %s: %v", msg.MessageID, err)
+			q.client.XAck(ctx, VoteStreamName, VoteStreamGroup, message.ID)
+			return
+		case ErrorPermanent:
+			log.Printf("处理消息 %s 失败且不可重试，移至死信队列: %v", msg.MessageID, err)
+			q.bury(ctx, message.ID, data)
+			return
+		}
+		log.Printf("处理消息失败: %v", err)
+
+		deliveries := q.deliveries(ctx, message.ID)
+		if deliveries > int64(q.opts.MaxRetries) {
+			log.Printf("消息 %s 超过最大重试次数，移至死信队列", msg.MessageID)
+			q.bury(ctx, message.ID, data)
+			return
+		}
+
+		// 未确认的消息保存在流中，本进程退出后由其他消费者在ClaimIdle后接管，
+		// 因此等待时间不超过ClaimIdle的一半，避免被其他消费者提前认领
+		delay := q.opts.backoff(int(deliveries))
+		if delay > q.stream.ClaimIdle/2 {
+			delay = q.stream.ClaimIdle / 2
+		}
+		retry := streamRetry{id: message.ID, delay: delay}
+		time.AfterFunc(delay, func() {
+			select {
+			case q.retry <- retry:
+			case <-q.stop:
+			}
+		})
+		return
+	}
+
+	if err := q.client.XAck(ctx, VoteStreamName, VoteStreamGroup, message.ID).Err(); err != nil {
+		log.Printf("确认消息失败: %s, %v", message.ID, err)
+	}
+	atomic.AddInt64(&q.processed, 1)
+}
+
+// deliveries 返回消息被投递的次数，查询失败时按已投递一次处理
+func (q *RedisStreamQueue) deliveries(ctx context.Context, id string) int64 {
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: VoteStreamName,
+		Group:  VoteStreamGroup,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 1
+	}
+	return pending[0].RetryCount
+}
+
+// retryMessage 重新认领失败的消息并处理；消息已被其他消费者认领时跳过
+func (q *RedisStreamQueue) retryMessage(ctx context.Context, retry streamRetry) {
+	messages, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   VoteStreamName,
+		Group:    VoteStreamGroup,
+		Consumer: q.stream.Consumer,
+		MinIdle:  retry.delay,
+		Messages: []string{retry.id},
+	}).Result()
+	if err != nil {
+		log.Printf("重新认领消息失败: %s, %v", retry.id, err)
+		return
+	}
+	for _, message := range messages {
+		q.process(ctx, message)
+	}
+}
+
+// bury 写入死信流并确认原消息
+func (q *RedisStreamQueue) bury(ctx context.Context, id string, data string) {
+	pipe := q.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: VoteStreamDeadLetterName,
+		MaxLen: q.stream.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": data, "source_id": id},
+	})
+	pipe.XAck(ctx, VoteStreamName, VoteStreamGroup, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("写入死信流失败: %s, %v", id, err)
+	}
+}
+
+// claimLoop 定期接管其他消费者超时未确认的消息，并迁移旧版列表队列
+func (q *RedisStreamQueue) claimLoop() {
+	defer q.wg.Done()
+	ctx := context.Background()
+
+	interval := q.stream.ClaimIdle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if q.stream.MigrateLegacy {
+		q.migrate(ctx)
+	}
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.claimStale(ctx)
+			q.removeIdleConsumers(ctx)
+			if q.stream.MigrateLegacy {
+				q.migrate(ctx)
+			}
+		}
+	}
+}
+
+func (q *RedisStreamQueue) claimStale(ctx context.Context) {
+	start := "0-0"
+	// 每轮最多认领10批，剩余的留到下一轮
+	for i := 0; i < 10 && !q.stopped(); i++ {
+		messages, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   VoteStreamName,
+			Group:    VoteStreamGroup,
+			Consumer: q.stream.Consumer,
+			MinIdle:  q.stream.ClaimIdle,
+			Start:    start,
+			Count:    q.stream.BatchSize,
+		}).Result()
+		if err != nil {
+			log.Printf("认领超时消息失败: %v", err)
+			return
+		}
+		if len(messages) > 0 {
+			log.Printf("认领了 %d 条超时未确认的消息", len(messages))
+		}
+		for _, message := range messages {
+			q.process(ctx, message)
+		}
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+func (q *RedisStreamQueue) removeIdleConsumers(ctx context.Context) {
+	consumers, err := q.client.XInfoConsumers(ctx, VoteStreamName, VoteStreamGroup).Result()
+	if err != nil {
+		return
+	}
+	for _, c := range consumers {
+		if c.Name != q.stream.Consumer && c.Pending == 0 && c.Idle > streamConsumerTTL {
+			q.client.XGroupDelConsumer(ctx, VoteStreamName, VoteStreamGroup, c.Name)
+			log.Printf("删除空闲的流消费者: %s", c.Name)
+		}
+	}
+}
+
+func (q *RedisStreamQueue) migrate(ctx context.Context) {
+	moved, err := q.MigrateLegacyLists(ctx)
+	if err != nil {
+		log.Printf("迁移旧版列表队列失败: %v", err)
+	} else if moved > 0 {
+		log.Printf("已将 %d 条消息从旧版列表队列迁移到流", moved)
+	}
+}
+
+// MigrateLegacyLists 将旧版RedisMQ列表中的消息迁移到流，返回迁移的数量
+//
+// 主队列、等待重试的延迟集合和死信列表全部迁移；处理中列表只迁移时间戳早于ClaimIdle的消息，
+// 与旧版消费者的超时判断一致，正在被旧版实例处理的消息不受影响。
+// 滚动升级期间旧版实例仍会写入列表，因此认领协程会定期调用。
+func (q *RedisStreamQueue) MigrateLegacyLists(ctx context.Context) (int, error) {
+	const batch = 100
+	total := 0
+
+	drain := func(script *redis.Script, key, stream string) error {
+		for {
+			moved, err := script.Run(ctx, q.client, []string{key, stream}, batch, q.stream.MaxLen).Int()
+			if err != nil {
+				return err
+			}
+			total += moved
+			if moved < batch {
+				return nil
+			}
+		}
+	}
+	if err := drain(drainListScript, MainQueueName, VoteStreamName); err != nil {
+		return total, err
+	}
+	if err := drain(drainDelayedScript, DelayedQueueName, VoteStreamName); err != nil {
+		return total, err
+	}
+	if err := drain(drainListScript, DeadLetterQueueName, VoteStreamDeadLetterName); err != nil {
+		return total, err
+	}
+
+	items, err := q.client.LRange(ctx, ProcessingQueueName, 0, -1).Result()
+	if err != nil {
+		return total, err
+	}
+	cutoff := time.Now().Add(-q.stream.ClaimIdle).Unix()
+	for _, item := range items {
+		var msg VoteMessage
+		if json.Unmarshal([]byte(item), &msg) == nil && msg.Timestamp > cutoff {
+			continue
+		}
+		moved, err := moveListItemScript.Run(ctx, q.client, []string{ProcessingQueueName, VoteStreamName}, item, q.stream.MaxLen).Int()
+		if err != nil {
+			return total, err
+		}
+		total += moved
+	}
+	return total, nil
+}
+
+// Stats 返回消费者组的统计：Pending为尚未读取的消息数（需要Redis 7），Processing为未确认的消息数
+func (q *RedisStreamQueue) Stats(ctx context.Context) (VoteQueueStats, error) {
+	pipe := q.client.Pipeline()
+	groupsCmd := pipe.XInfoGroups(ctx, VoteStreamName)
+	deadCmd := pipe.XLen(ctx, VoteStreamDeadLetterName)
+	pipe.Exec(ctx)
+
+	groups, err := groupsCmd.Result()
+	if err != nil {
+		return VoteQueueStats{}, fmt.Errorf("获取消费者组信息失败: %v", err)
+	}
+	stats := VoteQueueStats{
+		Backend:     BackendRedisStream,
+		Pending:     -1,
+		Delayed:     -1, // 等待重试的消息仍是未确认消息，计入Processing
+		DeadLetters: deadCmd.Val(),
+		Sent:        atomic.LoadInt64(&q.sent),
+		Processed:   atomic.LoadInt64(&q.processed),
+		Failed:      atomic.LoadInt64(&q.failed),
+		Dropped:     atomic.LoadInt64(&q.dropped),
+	}
+	for _, group := range groups {
+		if group.Name == VoteStreamGroup {
+			stats.Pending = group.Lag
+			stats.Processing = group.Pending
+		}
+	}
+	return stats, nil
+}
+
+// ConsumerPending 列出组内每个消费者的未确认消息数和空闲时间
+func (q *RedisStreamQueue) ConsumerPending(ctx context.Context) ([]ConsumerPending, error) {
+	consumers, err := q.client.XInfoConsumers(ctx, VoteStreamName, VoteStreamGroup).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取消费者信息失败: %v", err)
+	}
+	result := make([]ConsumerPending, 0, len(consumers))
+	for _, c := range consumers {
+		result = append(result, ConsumerPending{
+			Name:    c.Name,
+			Pending: c.Pending,
+			IdleMs:  c.Idle.Milliseconds(),
+		})
+	}
+	return result, nil
+}
+
+// PendingMessages 列出未确认的消息，consumer为空时列出整个组的
+func (q *RedisStreamQueue) PendingMessages(ctx context.Context, consumer string, count int64) ([]PendingMessage, error) {
+	if count <= 0 {
+		count = 100
+	}
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   VoteStreamName,
+		Group:    VoteStreamGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("获取未确认消息失败: %v", err)
+	}
+	result := make([]PendingMessage, 0, len(pending))
+	for _, p := range pending {
+		result = append(result, PendingMessage{
+			ID:         p.ID,
+			Consumer:   p.Consumer,
+			IdleMs:     p.Idle.Milliseconds(),
+			Deliveries: p.RetryCount,
+		})
+	}
+	return result, nil
+}
+
+// DeadLetters 列出死信流中的消息，最新的在前
+func (q *RedisStreamQueue) DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error) {
+	var entries []redis.XMessage
+	var err error
+	if limit > 0 {
+		entries, err = q.client.XRevRangeN(ctx, VoteStreamDeadLetterName, "+", "-", int64(limit)).Result()
+	} else {
+		entries, err = q.client.XRevRange(ctx, VoteStreamDeadLetterName, "+", "-").Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取死信失败: %v", err)
+	}
+
+	result := make([]VoteMessage, 0, len(entries))
+	for _, entry := range entries {
+		data, _ := entry.Values["data"].(string)
+		var msg VoteMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			log.Printf("解析死信消息失败: %v", err)
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result, nil
+}
+
+// RetryDeadLetters 将死信流中的消息重新写入投票消息流
+func (q *RedisStreamQueue) RetryDeadLetters(ctx context.Context) (int, error) {
+	entries, err := q.client.XRange(ctx, VoteStreamDeadLetterName, "-", "+").Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取死信失败: %v", err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		data, _ := entry.Values["data"].(string)
+		moved, err := reviveStreamEntryScript.Run(ctx, q.client,
+			[]string{VoteStreamDeadLetterName, VoteStreamName}, entry.ID, data, q.stream.MaxLen).Int()
+		if err != nil {
+			return count, fmt.Errorf("重新入队死信失败: %v", err)
+		}
+		count += moved
+	}
+	log.Printf("成功将 %d 条消息从死信流移回主流", count)
+	return count, nil
+}
+
+// Close 停止读取和认领，未确认的消息留在流中，重启后由本消费者或其他消费者继续处理
+func (q *RedisStreamQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	q.wg.Wait()
+	log.Println("Redis Streams消费者已关闭")
+	return nil
+}
+
+// ClearStreams 删除流和死信流（仅用于测试）
+func (q *RedisStreamQueue) ClearStreams(ctx context.Context) error {
+	return q.client.Del(ctx, VoteStreamName, VoteStreamDeadLetterName, MessageIDSetName).Err()
+}
@@ -0,0 +1,125 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStreamQueue_MigratesLegacyLists(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	push := func(list string, msg VoteMessage) {
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		require.NoError(t, client.LPush(ctx, list, data).Err())
+	}
+	now := time.Now().Unix()
+	push(MainQueueName, VoteMessage{PollID: "1", OptionID: "a", MessageID: "queued-1", Timestamp: now})
+	push(MainQueueName, VoteMessage{PollID: "1", OptionID: "b", MessageID: "queued-2", Timestamp: now})
+	push(DeadLetterQueueName, VoteMessage{PollID: "1", OptionID: "c", MessageID: "dead", Timestamp: now})
+	// A stale processing entry belongs to a crashed legacy consumer, a fresh one is still being handled
+	push(ProcessingQueueName, VoteMessage{PollID: "1", OptionID: "d", MessageID: "stale", Timestamp: now - 3600})
+	push(ProcessingQueueName, VoteMessage{PollID: "1", OptionID: "e", MessageID: "fresh", Timestamp: now})
+
+	q, err := NewRedisStreamQueue(client, VoteQueueOptions{MaxRetries: 1, RetryDelay: 50 * time.Millisecond},
+		RedisStreamOptions{Consumer: "test", ClaimIdle: time.Minute, MigrateLegacy: true})
+	require.NoError(t, err)
+	defer q.Close()
+
+	moved, err := q.MigrateLegacyLists(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, moved)
+	assert.Zero(t, client.LLen(ctx, MainQueueName).Val())
+	assert.Zero(t, client.LLen(ctx, DeadLetterQueueName).Val())
+	assert.Equal(t, int64(1), client.LLen(ctx, ProcessingQueueName).Val())
+
+	dead, err := q.DeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "dead", dead[0].MessageID)
+
+	handled := make(chan string, 10)
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		handled <- optionID
+		return nil
+	}))
+	var got []string
+	for len(got) < 3 {
+		select {
+		case optionID := <-handled:
+			got = append(got, optionID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only handled %v", got)
+		}
+	}
+	// Oldest list entries are migrated first
+	assert.Equal(t, []string{"a", "b", "d"}, got)
+}
+
+func TestRedisStreamQueue_ClaimsFromStuckConsumer(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	ctx := context.Background()
+	opts := VoteQueueOptions{MaxRetries: 3, RetryDelay: 50 * time.Millisecond}
+
+	q, err := NewRedisStreamQueue(client, opts, RedisStreamOptions{Consumer: "alive", ClaimIdle: 200 * time.Millisecond})
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.SendBatch(ctx, []VoteMessage{
+		{PollID: "1", OptionID: "a"},
+		{PollID: "1", OptionID: "b"},
+	}))
+
+	// Another consumer reads both messages and never acknowledges them
+	streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    VoteStreamGroup,
+		Consumer: "stuck",
+		Streams:  []string{VoteStreamName, ">"},
+		Count:    10,
+	}).Result()
+	require.NoError(t, err)
+	require.Len(t, streams[0].Messages, 2)
+
+	consumers, err := q.ConsumerPending(ctx)
+	require.NoError(t, err)
+	require.Len(t, consumers, 1)
+	assert.Equal(t, "stuck", consumers[0].Name)
+	assert.Equal(t, int64(2), consumers[0].Pending)
+
+	pending, err := q.PendingMessages(ctx, "stuck", 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, streams[0].Messages[0].ID, pending[0].ID)
+	assert.Equal(t, int64(1), pending[0].Deliveries)
+	pending, err = q.PendingMessages(ctx, "alive", 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	handled := make(chan string, 10)
+	require.NoError(t, q.Subscribe(func(pollID, optionID string) error {
+		handled <- optionID
+		return nil
+	}))
+	for _, want := range []string{"a", "b"} {
+		select {
+		case got := <-handled:
+			assert.Equal(t, want, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("stuck messages were not claimed")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		stats, err := q.Stats(ctx)
+		return err == nil && stats.Processing == 0 && stats.Processed == 2
+	}, 2*time.Second, 20*time.Millisecond)
+	pending, err = q.PendingMessages(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
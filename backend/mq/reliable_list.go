@@ -0,0 +1,112 @@
+package mq
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reliableList 基于Redis列表的至少一次投递队列，RedisMQ和webhook投递队列共用
+//
+// 取出时用BRPOPLPUSH原子地把成员移到处理中列表并记录取出时间，确认、安排重试或移入死信之前
+// 成员一直留在处理中列表；处理进程崩溃后，超时的成员由staleClaims找出后重新安排，不会丢失。
+type reliableList struct {
+	client     *redis.Client
+	ready      string // 待处理，LPUSH写入，从尾部取出
+	processing string // 已取出、尚未确认
+	claimed    string // 哈希：成员ID -> 取出时间（Unix秒）
+	delayed    string // 有序集合：等待重试，分数为到期时间（Unix毫秒）
+	dead       string // 死信，最新的在前
+	deadLimit  int64  // 死信最多保留的数量，0表示不限制
+}
+
+// staleClaim 处理超时的成员
+type staleClaim struct {
+	item string
+	id   string
+}
+
+// claim 取出一个待处理成员并移入处理中列表，timeout内没有成员时返回空字符串
+func (l *reliableList) claim(ctx context.Context, timeout time.Duration) (string, error) {
+	item, err := l.client.BRPopLPush(ctx, l.ready, l.processing, timeout).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return item, err
+}
+
+// markClaimed 记录成员的取出时间，超时从取出时开始计算，在待处理列表中积压较久的成员不会一取出就超时
+func (l *reliableList) markClaimed(ctx context.Context, id string) {
+	l.client.HSet(ctx, l.claimed, id, time.Now().Unix())
+}
+
+// ack 处理完成（成功或丢弃）后从处理中列表移除，extra在同一个事务中执行
+func (l *reliableList) ack(ctx context.Context, item, id string, extra func(redis.Pipeliner)) error {
+	pipe := l.client.TxPipeline()
+	pipe.LRem(ctx, l.processing, 1, item)
+	pipe.HDel(ctx, l.claimed, id)
+	if extra != nil {
+		extra(pipe)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// retryAt 把成员从处理中列表移到延迟集合，到期后以next的内容重新处理
+// 在同一个事务中完成，进程退出也不会丢失或重复；extra在同一个事务中执行
+func (l *reliableList) retryAt(ctx context.Context, item, id, next string, due time.Time, extra func(redis.Pipeliner)) error {
+	pipe := l.client.TxPipeline()
+	pipe.ZAdd(ctx, l.delayed, redis.Z{Score: float64(due.UnixMilli()), Member: next})
+	pipe.LRem(ctx, l.processing, 1, item)
+	pipe.HDel(ctx, l.claimed, id)
+	if extra != nil {
+		extra(pipe)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// bury 把成员从处理中列表移到死信列表，写入死信的内容为dead；id为空表示成员无法解析
+func (l *reliableList) bury(ctx context.Context, item, id, dead string) error {
+	pipe := l.client.TxPipeline()
+	pipe.LPush(ctx, l.dead, dead)
+	if l.deadLimit > 0 {
+		pipe.LTrim(ctx, l.dead, 0, l.deadLimit-1)
+	}
+	pipe.LRem(ctx, l.processing, 1, item)
+	if id != "" {
+		pipe.HDel(ctx, l.claimed, id)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// promote 将到期的重试成员移回待处理列表
+func (l *reliableList) promote(ctx context.Context, now time.Time) (int, error) {
+	return promoteDue(ctx, l.client, l.delayed, l.ready, now)
+}
+
+// staleClaims 找出取出后超过timeout仍未确认的成员
+// parse返回成员ID和没有取出记录时用于计算超时的时间（Unix秒），无法解析的成员跳过
+func (l *reliableList) staleClaims(ctx context.Context, timeout time.Duration, now time.Time, parse func(item string) (id string, since int64, ok bool)) ([]staleClaim, error) {
+	items, err := l.client.LRange(ctx, l.processing, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []staleClaim
+	for _, item := range items {
+		id, since, ok := parse(item)
+		if !ok {
+			continue
+		}
+		if claimedAt, err := l.client.HGet(ctx, l.claimed, id).Int64(); err == nil {
+			since = claimedAt
+		}
+		if now.Unix()-since > int64(timeout.Seconds()) {
+			stale = append(stale, staleClaim{item: item, id: id})
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,102 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrorClass 处理函数返回的错误的分类，决定消息是否重试
+type ErrorClass int
+
+const (
+	ErrorRetryable ErrorClass = iota // 暂时性错误，按退避策略重试，重试耗尽后进入死信
+	ErrorPermanent                   // 重试也不会成功，直接进入死信
+	ErrorDrop                        // 消息已无意义，直接丢弃，不进入死信
+)
+
+// permanentError 重试也不会成功的错误，直接进入死信
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记错误不需要重试
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// dropError 消息应当被丢弃的错误
+type dropError struct {
+	err error
+}
+
+func (e *dropError) Error() string { return e.err.Error() }
+func (e *dropError) Unwrap() error { return e.err }
+
+// Drop 标记消息不需要重试也不需要进入死信，例如投票已关闭后到达的投票
+func Drop(err error) error {
+	return &dropError{err: err}
+}
+
+// ClassifyError 返回错误的分类，未标记的错误视为可重试
+func ClassifyError(err error) ErrorClass {
+	var drop *dropError
+	if errors.As(err, &drop) {
+		return ErrorDrop
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return ErrorPermanent
+	}
+	return ErrorRetryable
+}
+
+// exponentialBackoff 第attempt次重试前的等待时间，投票消息和webhook投递共用
+// 以base * 2^(attempt-1)为上限（不超过max），在上限的一半到上限之间随机取值，
+// 避免同一时刻失败的大量任务在同一时刻重试
+func exponentialBackoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(delay-half+1)
+}
+
+// 将有序集合中到期的成员移到列表头部，多个实例同时执行时每个成员也只移动一次
+// 按到期时间从早到晚LPUSH，从列表尾部取出时先到期的先被处理
+var promoteDueScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	redis.call('LPUSH', KEYS[2], item)
+end
+return #items
+`)
+
+// 每批最多移动的到期成员数
+const promoteBatch = 100
+
+// promoteDue 将delayed中分数（Unix毫秒）不晚于now的成员全部移到ready列表，返回移动的数量
+func promoteDue(ctx context.Context, client *redis.Client, delayed, ready string, now time.Time) (int, error) {
+	total := 0
+	for {
+		moved, err := promoteDueScript.Run(ctx, client, []string{delayed, ready}, now.UnixMilli(), promoteBatch).Int()
+		total += moved
+		if err != nil || moved < promoteBatch {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RocketDeadLetterPrefix RocketMQ死信在Redis中的列表键前缀，后接消费者组名，与broker的%DLQ%<组名>对应
+const RocketDeadLetterPrefix = "rocketmq_dead_letter:"
+
+// RocketDeadLetterStore RocketMQ后端重试耗尽或不可重试的消息的存储
+type RocketDeadLetterStore interface {
+	// Push 记录一条死信
+	Push(ctx context.Context, msg VoteMessage) error
+	// List 列出死信，最新的在前；limit<=0时返回全部
+	List(ctx context.Context, limit int) ([]VoteMessage, error)
+	// Len 返回死信数量
+	Len(ctx context.Context) (int64, error)
+	// Drain 取出全部死信并清空，最早的在前；多个实例同时调用时每条死信只会被一个实例取到
+	Drain(ctx context.Context) ([]VoteMessage, error)
+	// Restore 将Drain取出但未能重新发送的死信放回，msgs最早的在前
+	Restore(ctx context.Context, msgs []VoteMessage) error
+}
+
+// redisRocketDeadLetters 保存在Redis列表中的死信，同一消费者组的各个实例看到同一份死信，重启不丢失
+type redisRocketDeadLetters struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisRocketDeadLetters 创建消费者组group的Redis死信存储
+func NewRedisRocketDeadLetters(client *redis.Client, group string) RocketDeadLetterStore {
+	return &redisRocketDeadLetters{client: client, key: RocketDeadLetterPrefix + group}
+}
+
+func (s *redisRocketDeadLetters) Push(ctx context.Context, msg VoteMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化死信失败: %v", err)
+	}
+	pipe := s.client.TxPipeline()
+	pipe.LPush(ctx, s.key, data)
+	pipe.LTrim(ctx, s.key, 0, rocketDeadLetterLimit-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *redisRocketDeadLetters) List(ctx context.Context, limit int) ([]VoteMessage, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	items, err := s.client.LRange(ctx, s.key, 0, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取死信失败: %v", err)
+	}
+	return decodeRocketDeadLetters(items), nil
+}
+
+func (s *redisRocketDeadLetters) Len(ctx context.Context) (int64, error) {
+	return s.client.LLen(ctx, s.key).Result()
+}
+
+func (s *redisRocketDeadLetters) Drain(ctx context.Context) ([]VoteMessage, error) {
+	pipe := s.client.TxPipeline()
+	items := pipe.LRange(ctx, s.key, 0, -1)
+	pipe.Del(ctx, s.key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("取出死信失败: %v", err)
+	}
+	msgs := decodeRocketDeadLetters(items.Val())
+	// 列表中最新的在前，按进入死信的顺序返回
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+func (s *redisRocketDeadLetters) Restore(ctx context.Context, msgs []VoteMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	// 放回的死信比取出后新增的都早，从最新的开始追加到列表尾部
+	items := make([]interface{}, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		data, err := json.Marshal(msgs[i])
+		if err != nil {
+			return fmt.Errorf("序列化死信失败: %v", err)
+		}
+		items = append(items, data)
+	}
+	return s.client.RPush(ctx, s.key, items...).Err()
+}
+
+func decodeRocketDeadLetters(items []string) []VoteMessage {
+	msgs := make([]VoteMessage, 0, len(items))
+	for _, item := range items {
+		var msg VoteMessage
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			log.Printf("解析死信消息失败: %v", err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// memoryRocketDeadLetters Redis不可用时使用的进程内死信，只包含本实例处理的消息，重启后丢失
+type memoryRocketDeadLetters struct {
+	mu   sync.Mutex
+	dead []VoteMessage // 最早的在前
+}
+
+// NewMemoryRocketDeadLetters 创建进程内死信存储
+func NewMemoryRocketDeadLetters() RocketDeadLetterStore {
+	return &memoryRocketDeadLetters{}
+}
+
+func (s *memoryRocketDeadLetters) Push(ctx context.Context, msg VoteMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(s.dead, msg)
+	if len(s.dead) > rocketDeadLetterLimit {
+		s.dead = s.dead[len(s.dead)-rocketDeadLetterLimit:]
+	}
+	return nil
+}
+
+func (s *memoryRocketDeadLetters) List(ctx context.Context, limit int) ([]VoteMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.dead)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]VoteMessage, 0, n)
+	for i := len(s.dead) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, s.dead[i])
+	}
+	return result, nil
+}
+
+func (s *memoryRocketDeadLetters) Len(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.dead)), nil
+}
+
+func (s *memoryRocketDeadLetters) Drain(ctx context.Context) ([]VoteMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dead := s.dead
+	s.dead = nil
+	return dead, nil
+}
+
+func (s *memoryRocketDeadLetters) Restore(ctx context.Context, msgs []VoteMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(append([]VoteMessage(nil), msgs...), s.dead...)
+	return nil
+}
@@ -0,0 +1,98 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisRocketDeadLetters_SharedByConsumerGroup(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	ctx := context.Background()
+	first := NewRedisRocketDeadLetters(client, "vote_consumer")
+	second := NewRedisRocketDeadLetters(client, "vote_consumer")
+	other := NewRedisRocketDeadLetters(client, "other_group")
+
+	for _, id := range []string{"m1", "m2", "m3"} {
+		require.NoError(t, first.Push(ctx, VoteMessage{PollID: "1", OptionID: "1", MessageID: id}))
+	}
+
+	// Every instance of the group sees the same dead letters, newest first
+	listed, err := second.List(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m3", "m2"}, messageIDs(listed))
+	n, err := second.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = other.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// Only one instance drains them
+	drained, err := second.Drain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2", "m3"}, messageIDs(drained))
+	again, err := first.Drain(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	// Restored letters go back behind anything buried in the meantime
+	require.NoError(t, first.Push(ctx, VoteMessage{MessageID: "m4"}))
+	require.NoError(t, second.Restore(ctx, drained))
+	listed, err = first.List(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m4", "m3", "m2", "m1"}, messageIDs(listed))
+}
+
+func TestRocketMQQueue_DeadLettersSharedAcrossInstances(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	ctx := context.Background()
+	newInstance := func() *RocketMQQueue {
+		return &RocketMQQueue{
+			opts:         VoteQueueOptions{MaxRetries: 2},
+			dead:         NewRedisRocketDeadLetters(client, "vote_consumer"),
+			processedIDs: newMessageIDSet(100),
+		}
+	}
+	buried, viewer := newInstance(), newInstance()
+
+	calls := 0
+	handler := func(pollID, optionID string) error {
+		calls++
+		if calls == 1 {
+			return Permanent(errors.New("option not found"))
+		}
+		return nil
+	}
+	body := []byte(`{"poll_id":"1","option_id":"9","message_id":"m1"}`)
+	result := buried.consume(ctx, handler, []*primitive.MessageExt{{MsgId: "broker-1", Message: primitive.Message{Body: body}}})
+	assert.Equal(t, consumer.ConsumeSuccess, result)
+
+	dead, err := viewer.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "m1", dead[0].MessageID)
+	stats, err := viewer.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.DeadLetters)
+
+	// A redelivery of the same broker message is skipped, but a dead letter
+	// resent by another instance is a new delivery and gets handled
+	buried.consume(ctx, handler, []*primitive.MessageExt{{MsgId: "broker-1", Message: primitive.Message{Body: body}}})
+	assert.Equal(t, 1, calls)
+	buried.consume(ctx, handler, []*primitive.MessageExt{{MsgId: "broker-2", Message: primitive.Message{Body: body}}})
+	assert.Equal(t, 2, calls)
+}
+
+func messageIDs(msgs []VoteMessage) []string {
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.MessageID
+	}
+	return ids
+}
@@ -5,8 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
@@ -17,490 +18,372 @@ import (
 
 // VoteMessage 表示投票消息结构
 type VoteMessage struct {
-	PollID    string `json:"poll_id"`
-	OptionID  string `json:"option_id"`
-	Timestamp int64  `json:"timestamp"`
-	MessageID string `json:"message_id"` // 用于幂等性处理
+	PollID     string `json:"poll_id"`
+	OptionID   string `json:"option_id"`
+	Timestamp  int64  `json:"timestamp"`
+	MessageID  string `json:"message_id"`            // 用于幂等性处理
+	EnqueuedAt int64  `json:"enqueued_at,omitempty"` // 最近一次入队的时间（毫秒），用于统计排队耗时
 }
 
-// 全局RocketMQ生产者和消费者
-var (
-	rocketProducer rocketmq.Producer
-	initOnce       sync.Once
-	isInitialized  bool
-	mockMode       bool                                       // 模拟模式标志
-	mockMessages   = make([]VoteMessage, 0)                   // 模拟消息存储
-	mockMutex      sync.Mutex                                 // 模拟操作的互斥锁
-	processHandler func(pollID string, optionID string) error // 存储消息处理函数
-
-	// 幂等性处理相关
-	processedMessages      = make(map[string]bool) // 已处理消息的ID映射
-	processedMessagesMutex sync.RWMutex            // 保护已处理消息映射的互斥锁
-)
-
-// 主题常量
+// 主题和标签常量
 const (
 	TopicVoteEvents = "vote_events"
+	TagVote         = "vote"
 )
 
-// InitRocketMQ 初始化RocketMQ生产者
-func InitRocketMQ() error {
-	var initErr error
-
-	initOnce.Do(func() {
-		// 检查是否强制使用模拟模式
-		if os.Getenv("ROCKETMQ_MOCK") == "true" {
-			log.Println("强制使用RocketMQ模拟模式")
-			mockMode = true
-			mockMessages = make([]VoteMessage, 0)
-			isInitialized = true
-			return
-		}
-
-		// 从环境变量获取RocketMQ地址
-		nameServerAddr := os.Getenv("ROCKETMQ_NAMESRV_ADDR")
-		if nameServerAddr == "" {
-			nameServerAddr = "localhost:9876" // 默认地址，与docker-compose一致
-		}
-
-		log.Printf("初始化RocketMQ连接, 地址: %s", nameServerAddr)
-
-		// 打印更多诊断信息
-		log.Printf("RocketMQ连接环境：%v", os.Environ())
-
-		// 准备多个可能的地址，提高连接成功率
-		addrList := []string{
-			nameServerAddr,             // 配置的地址
-			"localhost:9876",           // 默认本地地址
-			"127.0.0.1:9876",           // 本地回环地址
-			"172.21.0.4:9876",          // Docker容器内部地址
-			"rocketmq:9876",            // Docker容器服务名
-			"89t3v2-rocketmq-dev:9876", // Docker容器名
-		}
-
-		// 尝试每个地址，直到成功或都失败
-		var p rocketmq.Producer
-		var err error
-		var connected bool
-
-		for _, addr := range addrList {
-			log.Printf("尝试连接RocketMQ: %s", addr)
-
-			// 尝试创建生产者
-			p, err = rocketmq.NewProducer(
-				producer.WithNameServer([]string{addr}),
-				producer.WithGroupName("vote_producer"),
-				producer.WithRetry(2),
-				producer.WithSendMsgTimeout(time.Second*10), // 增加超时时间
-				producer.WithVIPChannel(false),
-			)
-
-			if err != nil {
-				log.Printf("使用地址 %s 创建RocketMQ生产者失败: %v", addr, err)
-				continue
-			}
-
-			// 尝试启动生产者
-			if err := p.Start(); err != nil {
-				log.Printf("使用地址 %s 启动RocketMQ生产者失败: %v", addr, err)
-				continue
-			}
-
-			// 启动成功
-			connected = true
-			log.Printf("使用地址 %s 连接RocketMQ成功", addr)
-			break
-		}
-
-		if !connected {
-			log.Printf("所有RocketMQ连接尝试均失败，将使用模拟模式")
-			mockMode = true
-			isInitialized = true
-			return
-		}
-
-		rocketProducer = p
-		isInitialized = true
-		mockMode = false
-		log.Println("RocketMQ生产者初始化成功")
-	})
+// 未配置时使用的消费者组
+const defaultRocketConsumerGroup = "vote_consumer"
 
-	return initErr
-}
+// RocketMQ消费者最多记住的已处理消息ID数
+const rocketProcessedLimit = 100000
 
-// IsMockMode 检查是否处于模拟模式
-func IsMockMode() bool {
-	return mockMode
-}
+// 保留的死信消息数上限
+const rocketDeadLetterLimit = 1000
 
-// IsInitialized 检查RocketMQ是否已初始化
-func IsInitialized() bool {
-	return isInitialized && rocketProducer != nil
+// RocketMQ默认的消息延迟级别（1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h）
+var rocketDelayLevels = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
 }
 
-// 生成唯一的消息ID
-func generateMessageID(pollID string, optionID string) string {
-	return fmt.Sprintf("%s_%s_%d", pollID, optionID, time.Now().UnixNano())
+// RocketMQOptions RocketMQ连接配置
+type RocketMQOptions struct {
+	NameServers   []string // NameServer地址列表
+	ProducerGroup string
+	ConsumerGroup string
+	// DeadLetters 死信的存储，为nil时只保存在本实例内存中；
+	// 多实例部署时使用NewRedisRocketDeadLetters，同一消费者组的各实例共享死信
+	DeadLetters RocketDeadLetterStore
 }
 
-// 检查消息是否已经处理过（幂等性检查）
-func isMessageProcessed(messageID string) bool {
-	processedMessagesMutex.RLock()
-	defer processedMessagesMutex.RUnlock()
-	return processedMessages[messageID]
+// RocketMQQueue 基于RocketMQ的投票消息队列
+//
+// 消息以投票ID作为分区键发送，同一投票的消息进入同一个队列。
+// 重试由broker按延迟级别调度；超过最大重试次数的消息写入RocketMQOptions.DeadLetters，
+// 不再进入broker的%DLQ%主题，以便像其他后端一样列出和重新入队。
+type RocketMQQueue struct {
+	opts     VoteQueueOptions
+	rocket   RocketMQOptions
+	producer rocketmq.Producer
+
+	mu       sync.Mutex
+	consumer rocketmq.PushConsumer
+	closed   bool
+
+	dead RocketDeadLetterStore
+
+	processedIDs *messageIDSet
+	processing   int64
+	sent         int64
+	processed    int64
+	failed       int64
+	dropped      int64
 }
 
-// 标记消息为已处理
-func markMessageAsProcessed(messageID string) {
-	processedMessagesMutex.Lock()
-	defer processedMessagesMutex.Unlock()
-	processedMessages[messageID] = true
-
-	// 设置过期时间，避免无限增长
-	// 在实际生产环境中，应使用Redis等持久化存储
-	go func(id string) {
-		time.Sleep(24 * time.Hour) // 24小时后过期
-		processedMessagesMutex.Lock()
-		delete(processedMessages, id)
-		processedMessagesMutex.Unlock()
-	}(messageID)
+// RocketDelayLevel 返回不小于delay的最小延迟级别（从1开始），超过最大级别时返回最大级别
+func RocketDelayLevel(delay time.Duration) int {
+	for i, level := range rocketDelayLevels {
+		if delay <= level {
+			return i + 1
+		}
+	}
+	return len(rocketDelayLevels)
 }
 
-// SendVoteMessage 发送投票消息到RocketMQ
-func SendVoteMessage(pollID string, optionID string) error {
-	if !isInitialized {
-		return fmt.Errorf("RocketMQ生产者未初始化")
+// NewRocketMQQueue 连接RocketMQ并启动生产者，所有NameServer都不可达时返回错误
+func NewRocketMQQueue(rocket RocketMQOptions, opts VoteQueueOptions) (*RocketMQQueue, error) {
+	if len(rocket.NameServers) == 0 {
+		return nil, fmt.Errorf("未配置RocketMQ NameServer地址")
 	}
-
-	// 生成唯一消息ID
-	messageID := generateMessageID(pollID, optionID)
-
-	// 构造消息
-	msg := VoteMessage{
-		PollID:    pollID,
-		OptionID:  optionID,
-		Timestamp: time.Now().Unix(),
-		MessageID: messageID,
+	if rocket.ProducerGroup == "" {
+		rocket.ProducerGroup = "vote_producer"
 	}
-
-	// 模拟模式下的消息处理
-	if mockMode {
-		mockMutex.Lock()
-		defer mockMutex.Unlock()
-
-		// 保存消息到模拟存储
-		mockMessages = append(mockMessages, msg)
-		log.Printf("模拟模式: 发送消息成功, Poll: %s, Option: %s, MessageID: %s", pollID, optionID, messageID)
-
-		// 如果有处理函数，直接处理消息
-		if processHandler != nil {
-			go func() {
-				// 幂等性检查
-				if isMessageProcessed(messageID) {
-					log.Printf("模拟模式: 消息已处理过，跳过: %s", messageID)
-					return
-				}
-
-				if err := processHandler(pollID, optionID); err != nil {
-					log.Printf("模拟模式: 处理消息失败: %v", err)
-				} else {
-					log.Printf("模拟模式: 处理消息成功, Poll: %s, Option: %s", pollID, optionID)
-					// 标记为已处理
-					markMessageAsProcessed(messageID)
-				}
-			}()
-		}
-
-		return nil
+	if rocket.ConsumerGroup == "" {
+		rocket.ConsumerGroup = defaultRocketConsumerGroup
 	}
-
-	// 真实RocketMQ模式
-	// 序列化为JSON
-	body, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("序列化消息失败: %v", err)
+	if rocket.DeadLetters == nil {
+		log.Printf("警告: RocketMQ死信只保存在本实例内存中，重启后丢失，其他实例看不到")
+		rocket.DeadLetters = NewMemoryRocketDeadLetters()
 	}
 
-	// 创建RocketMQ消息
-	message := primitive.NewMessage(TopicVoteEvents, body)
-
-	// 添加标签
-	message.WithTag("vote")
-
-	// 添加键 (用于消息去重和顺序性)
-	message.WithKeys([]string{messageID})
-
-	// 设置分区键（确保同一投票的消息进入同一队列）
-	// 这样可以保证同一投票的操作顺序性
-	message.WithShardingKey(pollID)
-
-	// 发送消息（顺序消息）
-	res, err := rocketProducer.SendSync(context.Background(), message)
+	// 客户端启动时不会检查NameServer是否可达，先探测一次以便尽早失败
+	if err := probeNameServers(rocket.NameServers); err != nil {
+		return nil, err
+	}
 
+	p, err := rocketmq.NewProducer(
+		producer.WithNameServer(rocket.NameServers),
+		producer.WithGroupName(rocket.ProducerGroup),
+		producer.WithRetry(2),
+		producer.WithSendMsgTimeout(10*time.Second),
+		producer.WithQueueSelector(producer.NewHashQueueSelector()),
+		producer.WithVIPChannel(false),
+	)
 	if err != nil {
-		log.Printf("发送消息失败: %v", err)
-		return fmt.Errorf("发送消息失败: %v", err)
+		return nil, fmt.Errorf("创建RocketMQ生产者失败: %v", err)
 	}
-
-	log.Printf("发送消息成功, MsgID: %s, MessageID: %s, 队列: %s",
-		res.MsgID, messageID, res.MessageQueue.String())
-	return nil
+	if err := p.Start(); err != nil {
+		return nil, fmt.Errorf("启动RocketMQ生产者失败: %v", err)
+	}
+	log.Printf("RocketMQ生产者初始化成功, NameServer: %v", rocket.NameServers)
+
+	return &RocketMQQueue{
+		opts:         opts,
+		rocket:       rocket,
+		producer:     p,
+		dead:         rocket.DeadLetters,
+		processedIDs: newMessageIDSet(rocketProcessedLimit),
+	}, nil
 }
 
-// SendOrderedVoteMessage 发送顺序投票消息到RocketMQ
-// 保证同一投票ID的所有操作按顺序处理
-func SendOrderedVoteMessage(pollID string, optionID string) error {
-	if !isInitialized {
-		return fmt.Errorf("RocketMQ生产者未初始化")
+func probeNameServers(addrs []string) error {
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = err
 	}
+	return fmt.Errorf("无法连接RocketMQ NameServer: %v", lastErr)
+}
 
-	// 生成唯一消息ID
-	messageID := generateMessageID(pollID, optionID)
+// Send 发送一条投票消息
+func (q *RocketMQQueue) Send(ctx context.Context, msg VoteMessage) error {
+	return q.SendBatch(ctx, []VoteMessage{msg})
+}
 
-	// 构造消息
-	msg := VoteMessage{
-		PollID:    pollID,
-		OptionID:  optionID,
-		Timestamp: time.Now().Unix(),
-		MessageID: messageID,
+// SendBatch 批量发送投票消息，同一投票的消息作为一批发送到同一个队列
+func (q *RocketMQQueue) SendBatch(ctx context.Context, msgs []VoteMessage) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
 	}
 
-	// 模拟模式下的消息处理
-	if mockMode {
-		mockMutex.Lock()
-
-		// 保存消息到模拟存储（按顺序存储）
-		mockMessages = append(mockMessages, msg)
-		mockMutex.Unlock()
-
-		log.Printf("模拟模式: 发送顺序消息成功, Poll: %s, Option: %s, MessageID: %s",
-			pollID, optionID, messageID)
-
-		// 如果有处理函数，直接处理消息
-		if processHandler != nil {
-			// 幂等性检查
-			if isMessageProcessed(messageID) {
-				log.Printf("模拟模式: 顺序消息已处理过，跳过: %s", messageID)
-				return nil
-			}
-
-			if err := processHandler(pollID, optionID); err != nil {
-				log.Printf("模拟模式: 处理顺序消息失败: %v", err)
-			} else {
-				log.Printf("模拟模式: 处理顺序消息成功, Poll: %s, Option: %s", pollID, optionID)
-				// 标记为已处理
-				markMessageAsProcessed(messageID)
-			}
+	var order []string
+	groups := make(map[string][]*primitive.Message)
+	for _, msg := range msgs {
+		msg, err := prepareVoteMessage(msg)
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("序列化消息失败: %v", err)
 		}
 
-		return nil
-	}
+		message := primitive.NewMessage(TopicVoteEvents, body)
+		message.WithTag(TagVote)
+		// 键用于消息去重和查询
+		message.WithKeys([]string{msg.MessageID})
+		// 设置分区键（确保同一投票的消息进入同一队列）
+		message.WithShardingKey(msg.PollID)
 
-	// 真实RocketMQ模式
-	// 序列化为JSON
-	body, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("序列化顺序消息失败: %v", err)
+		if _, ok := groups[msg.PollID]; !ok {
+			order = append(order, msg.PollID)
+		}
+		groups[msg.PollID] = append(groups[msg.PollID], message)
 	}
 
-	// 创建RocketMQ消息
-	message := primitive.NewMessage(TopicVoteEvents, body)
-	message.WithTag("ordered_vote")
-	message.WithKeys([]string{messageID})
-	message.WithShardingKey(pollID) // 确保相同投票ID的消息路由到相同队列
-
-	// 通过选择相同队列来保证顺序性
-	// 在我们的场景中，使用普通同步发送，但在后台确保投票ID相同的消息进入同一队列
-	res, err := rocketProducer.SendSync(context.Background(), message)
-
-	if err != nil {
-		log.Printf("发送顺序消息失败: %v", err)
-		return fmt.Errorf("发送顺序消息失败: %v", err)
+	for _, pollID := range order {
+		batch := groups[pollID]
+		res, err := q.producer.SendSync(ctx, batch...)
+		if err != nil {
+			return fmt.Errorf("发送消息失败: %v", err)
+		}
+		if res.Status != primitive.SendOK {
+			return fmt.Errorf("发送消息失败，状态: %d", res.Status)
+		}
+		atomic.AddInt64(&q.sent, int64(len(batch)))
+		log.Printf("发送消息成功, Poll: %s, 数量: %d, 队列: %s", pollID, len(batch), res.MessageQueue.String())
 	}
-
-	log.Printf("发送顺序消息成功, MsgID: %s, MessageID: %s, 队列: %s",
-		res.MsgID, messageID, res.MessageQueue.String())
 	return nil
 }
 
-// StartVoteConsumer 启动投票消息消费者
-func StartVoteConsumer(processFunc func(pollID string, optionID string) error) error {
-	// 保存处理函数
-	processHandler = processFunc
-
-	// 模拟模式下不需要创建真实消费者
-	if mockMode {
-		log.Println("模拟模式: 消息消费者启动")
-		return nil
+// Subscribe 创建推送消费者并开始消费
+func (q *RocketMQQueue) Subscribe(handler VoteHandler) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
 	}
-
-	// 从环境变量获取RocketMQ地址
-	nameServerAddr := os.Getenv("ROCKETMQ_NAMESRV_ADDR")
-	if nameServerAddr == "" {
-		nameServerAddr = "localhost:9876" // 默认地址
+	if q.consumer != nil {
+		return nil
 	}
 
-	// 创建普通消费者
 	c, err := rocketmq.NewPushConsumer(
-		consumer.WithNameServer([]string{nameServerAddr}),
-		consumer.WithGroupName("vote_consumer"),
+		consumer.WithNameServer(q.rocket.NameServers),
+		consumer.WithGroupName(q.rocket.ConsumerGroup),
 		consumer.WithConsumerModel(consumer.Clustering),
 		consumer.WithConsumeFromWhere(consumer.ConsumeFromLastOffset),
+		// 比最大重试次数多一次，保证超过次数的消息总能写入死信存储，而不是被broker移到%DLQ%
+		consumer.WithMaxReconsumeTimes(int32(q.opts.MaxRetries+1)),
 	)
-
 	if err != nil {
 		return fmt.Errorf("创建消息消费者失败: %v", err)
 	}
 
-	// 订阅主题
 	err = c.Subscribe(TopicVoteEvents, consumer.MessageSelector{
 		Type:       consumer.TAG,
-		Expression: "vote",
+		Expression: TagVote,
 	}, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, msg := range msgs {
-			// 解析消息
-			var voteMsg VoteMessage
-			if err := json.Unmarshal(msg.Body, &voteMsg); err != nil {
-				log.Printf("解析消息失败: %v", err)
-				continue
-			}
-
-			// 幂等性检查 - 检查是否已处理过该消息
-			if isMessageProcessed(voteMsg.MessageID) {
-				log.Printf("消息已处理过，跳过: %s", voteMsg.MessageID)
-				continue
-			}
-
-			log.Printf("收到投票消息: Poll=%s, Option=%s, MessageID=%s",
-				voteMsg.PollID, voteMsg.OptionID, voteMsg.MessageID)
-
-			// 处理消息
-			if err := processFunc(voteMsg.PollID, voteMsg.OptionID); err != nil {
-				log.Printf("处理消息失败: %v", err)
-				return consumer.ConsumeRetryLater, nil // 稍后重试
-			}
-
-			// 标记消息为已处理，确保幂等性
-			markMessageAsProcessed(voteMsg.MessageID)
-		}
-		return consumer.ConsumeSuccess, nil
+		return q.consume(ctx, handler, msgs), nil
 	})
-
 	if err != nil {
 		return fmt.Errorf("订阅主题失败: %v", err)
 	}
 
-	// 启动消费者
-	if err = c.Start(); err != nil {
+	if err := c.Start(); err != nil {
 		return fmt.Errorf("启动消费者失败: %v", err)
 	}
-
-	log.Println("消息消费者启动成功")
+	q.consumer = c
+	log.Println("RocketMQ消息消费者启动成功")
 	return nil
 }
 
-// StartOrderedVoteConsumer 启动顺序投票消息消费者
-func StartOrderedVoteConsumer(processFunc func(pollID string, optionID string) error) error {
-	// 保存处理函数
-	processHandler = processFunc
+// consume 处理broker推送的一批消息，任意一条失败时整批稍后重试，已处理的消息靠幂等跳过
+func (q *RocketMQQueue) consume(ctx context.Context, handler VoteHandler, msgs []*primitive.MessageExt) consumer.ConsumeResult {
+	atomic.AddInt64(&q.processing, int64(len(msgs)))
+	defer atomic.AddInt64(&q.processing, -int64(len(msgs)))
 
-	// 模拟模式下不需要创建真实消费者
-	if mockMode {
-		log.Println("模拟模式: 顺序消息消费者启动")
-		return nil
-	}
-
-	// 从环境变量获取RocketMQ地址
-	nameServerAddr := os.Getenv("ROCKETMQ_NAMESRV_ADDR")
-	if nameServerAddr == "" {
-		nameServerAddr = "localhost:9876" // 默认地址
-	}
+	for _, ext := range msgs {
+		var msg VoteMessage
+		if err := json.Unmarshal(ext.Body, &msg); err != nil {
+			log.Printf("解析消息失败: %v", err)
+			continue
+		}
 
-	// 创建顺序消费者
-	c, err := rocketmq.NewPushConsumer(
-		consumer.WithNameServer([]string{nameServerAddr}),
-		consumer.WithGroupName("ordered_vote_consumer"),
-		consumer.WithConsumerModel(consumer.Clustering),
-		consumer.WithConsumeFromWhere(consumer.ConsumeFromLastOffset),
-		consumer.WithConsumerOrder(true), // 顺序消费
-	)
+		// 幂等性检查 - 检查是否已处理过该消息，或这次投递已经丢弃或进入死信
+		if q.processedIDs.Contains(msg.MessageID) || q.processedIDs.Contains(ext.MsgId) {
+			log.Printf("消息已处理过，跳过: %s", msg.MessageID)
+			continue
+		}
 
-	if err != nil {
-		return fmt.Errorf("创建顺序消息消费者失败: %v", err)
-	}
+		err := handler(msg.PollID, msg.OptionID)
+		if err == nil {
+			atomic.AddInt64(&q.processed, 1)
+			q.processedIDs.Add(msg.MessageID)
+			continue
+		}
 
-	// 订阅主题
-	err = c.Subscribe(TopicVoteEvents, consumer.MessageSelector{
-		Type:       consumer.TAG,
-		Expression: "ordered_vote",
-	}, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for _, msg := range msgs {
-			// 解析消息
-			var voteMsg VoteMessage
-			if err := json.Unmarshal(msg.Body, &voteMsg); err != nil {
-				log.Printf("解析顺序消息失败: %v", err)
-				continue
+		atomic.AddInt64(&q.failed, 1)
+		// 丢弃和进入死信的这次投递记为已处理，整批重试时不再重复处理；
+		// 按broker的消息ID记录，死信被任意实例重新发送后是新的投递，不会被当作重复消息跳过
+		switch ClassifyError(err) {
+		case ErrorDrop:
+			atomic.AddInt64(&q.dropped, 1)
+			log.Printf("丢弃消息 %s: %v", msg.MessageID, err)
+			q.processedIDs.Add(ext.MsgId)
+			continue
+		case ErrorPermanent:
+			log.Printf("处理消息 %s 失败且不可重试，移至死信队列: %v", msg.MessageID, err)
+			if !q.bury(ctx, msg) {
+				return q.retryLater(ctx, ext)
 			}
-
-			// 幂等性检查 - 检查是否已处理过该消息
-			if isMessageProcessed(voteMsg.MessageID) {
-				log.Printf("顺序消息已处理过，跳过: %s", voteMsg.MessageID)
-				continue
+			q.processedIDs.Add(ext.MsgId)
+			continue
+		}
+		log.Printf("处理消息失败: %v", err)
+		if int(ext.ReconsumeTimes) >= q.opts.MaxRetries {
+			log.Printf("消息 %s 超过最大重试次数，移至死信队列", msg.MessageID)
+			if !q.bury(ctx, msg) {
+				return q.retryLater(ctx, ext)
 			}
+			q.processedIDs.Add(ext.MsgId)
+			continue
+		}
 
-			log.Printf("收到顺序投票消息: Poll=%s, Option=%s, MessageID=%s",
-				voteMsg.PollID, voteMsg.OptionID, voteMsg.MessageID)
+		return q.retryLater(ctx, ext)
+	}
+	return consumer.ConsumeSuccess
+}
 
-			// 处理消息
-			if err := processFunc(voteMsg.PollID, voteMsg.OptionID); err != nil {
-				log.Printf("处理顺序消息失败: %v", err)
-				// 对于顺序消息，处理失败会阻塞同一队列的后续消息
-				return consumer.ConsumeRetryLater, nil
-			}
+// retryLater 整批交还broker，按退避时间对应的延迟级别重新投递
+func (q *RocketMQQueue) retryLater(ctx context.Context, ext *primitive.MessageExt) consumer.ConsumeResult {
+	if concurrentCtx, ok := primitive.GetConcurrentlyCtx(ctx); ok {
+		concurrentCtx.DelayLevelWhenNextConsume = RocketDelayLevel(q.opts.backoff(int(ext.ReconsumeTimes) + 1))
+	}
+	return consumer.ConsumeRetryLater
+}
 
-			// 标记消息为已处理，确保幂等性
-			markMessageAsProcessed(voteMsg.MessageID)
-		}
-		return consumer.ConsumeSuccess, nil
-	})
+// bury 写入死信存储，失败时返回false，消息交还broker稍后重试，避免丢失
+func (q *RocketMQQueue) bury(ctx context.Context, msg VoteMessage) bool {
+	if err := q.dead.Push(ctx, msg); err != nil {
+		log.Printf("写入死信失败，稍后重试: 消息=%s, 错误: %v", msg.MessageID, err)
+		return false
+	}
+	return true
+}
 
+// Stats 返回本实例的统计，待消费和等待重试的数量由broker维护，这里为-1
+func (q *RocketMQQueue) Stats(ctx context.Context) (VoteQueueStats, error) {
+	dead, err := q.dead.Len(ctx)
 	if err != nil {
-		return fmt.Errorf("订阅顺序主题失败: %v", err)
+		return VoteQueueStats{}, fmt.Errorf("获取死信数量失败: %v", err)
 	}
 
-	// 启动消费者
-	if err = c.Start(); err != nil {
-		return fmt.Errorf("启动顺序消费者失败: %v", err)
-	}
+	return VoteQueueStats{
+		Backend:     BackendRocketMQ,
+		Pending:     -1,
+		Processing:  atomic.LoadInt64(&q.processing),
+		Delayed:     -1,
+		DeadLetters: dead,
+		Sent:        atomic.LoadInt64(&q.sent),
+		Processed:   atomic.LoadInt64(&q.processed),
+		Failed:      atomic.LoadInt64(&q.failed),
+		Dropped:     atomic.LoadInt64(&q.dropped),
+	}, nil
+}
 
-	log.Println("顺序消息消费者启动成功")
-	return nil
+// DeadLetters 列出死信消息，最新的在前
+func (q *RocketMQQueue) DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error) {
+	return q.dead.List(ctx, limit)
 }
 
-// CloseRocketMQ 关闭RocketMQ连接
-func CloseRocketMQ() {
-	if mockMode {
-		log.Println("模拟模式: 关闭RocketMQ连接")
-		return
+// RetryDeadLetters 将死信重新发送到主题
+func (q *RocketMQQueue) RetryDeadLetters(ctx context.Context) (int, error) {
+	dead, err := q.dead.Drain(ctx)
+	if err != nil {
+		return 0, err
 	}
-
-	if rocketProducer != nil {
-		err := rocketProducer.Shutdown()
-		if err != nil {
-			log.Printf("关闭RocketMQ生产者失败: %v", err)
-		} else {
-			log.Println("RocketMQ生产者已关闭")
+	if len(dead) == 0 {
+		return 0, nil
+	}
+	if err := q.SendBatch(ctx, dead); err != nil {
+		// 发送失败时放回死信，避免消息丢失
+		if restoreErr := q.dead.Restore(ctx, dead); restoreErr != nil {
+			log.Printf("放回死信失败，%d 条消息丢失: %v", len(dead), restoreErr)
 		}
+		return 0, err
 	}
+	log.Printf("成功将 %d 条消息从死信队列重新发送", len(dead))
+	return len(dead), nil
 }
 
-// GetQueuedMessageCount 获取队列中的消息数量
-func GetQueuedMessageCount() int {
-	if !mockMode {
-		return -1 // 非模拟模式不支持此操作
+// Close 关闭消费者和生产者
+func (q *RocketMQQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
 	}
+	q.closed = true
+	c := q.consumer
+	q.mu.Unlock()
 
-	mockMutex.Lock()
-	defer mockMutex.Unlock()
-	return len(mockMessages)
+	if c != nil {
+		if err := c.Shutdown(); err != nil {
+			log.Printf("关闭RocketMQ消费者失败: %v", err)
+		}
+	}
+	if err := q.producer.Shutdown(); err != nil {
+		return fmt.Errorf("关闭RocketMQ生产者失败: %v", err)
+	}
+	log.Println("RocketMQ生产者已关闭")
+	return nil
 }
@@ -0,0 +1,177 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 支持的投票消息队列后端，通过 MQ_BACKEND 选择
+const (
+	BackendRedis       = "redis"
+	BackendRedisStream = "redis_stream"
+	BackendRocketMQ    = "rocketmq"
+	BackendMemory      = "memory"
+)
+
+// ErrQueueClosed 队列关闭后继续发送或订阅时返回
+var ErrQueueClosed = errors.New("消息队列已关闭")
+
+// VoteHandler 处理一条投票消息，返回错误时按ClassifyError的分类重试、进入死信或丢弃
+type VoteHandler func(pollID string, optionID string) error
+
+// VoteQueueOptions 各后端共用的重试配置
+type VoteQueueOptions struct {
+	MaxRetries    int           // 处理失败后最多重试次数，超过后进入死信
+	RetryDelay    time.Duration // 第一次重试前的等待时间，之后每次翻倍并加入随机抖动
+	MaxRetryDelay time.Duration // 重试等待时间上限，小于RetryDelay时按RetryDelay
+}
+
+// backoff 第attempt次重试前的等待时间；RocketMQ按不小于该值的延迟级别重试
+func (o VoteQueueOptions) backoff(attempt int) time.Duration {
+	max := o.MaxRetryDelay
+	if max < o.RetryDelay {
+		max = o.RetryDelay
+	}
+	return exponentialBackoff(attempt, o.RetryDelay, max)
+}
+
+// VoteQueueStats 队列的运行统计，后端无法统计的数量为-1
+type VoteQueueStats struct {
+	Backend     string `json:"backend"`
+	Pending     int64  `json:"pending"`      // 等待消费
+	Processing  int64  `json:"processing"`   // 正在处理
+	Delayed     int64  `json:"delayed"`      // 等待重试
+	DeadLetters int64  `json:"dead_letters"` // 重试耗尽或不可重试
+	Sent        int64  `json:"sent"`         // 本实例发送成功
+	Processed   int64  `json:"processed"`    // 本实例处理成功
+	Failed      int64  `json:"failed"`       // 本实例处理失败（含之后重试成功的和丢弃的）
+	Dropped     int64  `json:"dropped"`      // 本实例按处理函数的要求丢弃
+}
+
+// VoteQueue 投票消息队列后端
+//
+// 同一个MessageID只会被成功处理一次；处理失败的消息按指数退避最多重试MaxRetries次，
+// 之后放入死信，可通过DeadLetters查看。处理函数返回Permanent标记的错误时直接放入死信，
+// 返回Drop标记的错误时直接丢弃。
+//
+// 各后端都不保证同一投票的消息跨实例按入队顺序处理，重试的消息也会排在之后入队的消息后面；
+// redis后端在单个实例内按投票串行处理，见RedisMQOptions。
+type VoteQueue interface {
+	// Send 发送一条投票消息，MessageID为空时自动生成
+	Send(ctx context.Context, msg VoteMessage) error
+	// SendBatch 批量发送投票消息
+	SendBatch(ctx context.Context, msgs []VoteMessage) error
+	// Subscribe 注册处理函数并开始消费，只能调用一次
+	Subscribe(handler VoteHandler) error
+	// Stats 返回队列的运行统计
+	Stats(ctx context.Context) (VoteQueueStats, error)
+	// DeadLetters 列出死信消息，最新的在前；limit<=0时返回全部
+	DeadLetters(ctx context.Context, limit int) ([]VoteMessage, error)
+	// Close 停止消费并释放资源，之后的发送返回ErrQueueClosed
+	Close() error
+}
+
+// DeadLetterRetrier 支持将死信重新入队的后端实现此接口
+type DeadLetterRetrier interface {
+	// RetryDeadLetters 将全部死信移回主队列并清零重试次数，返回移动的数量
+	RetryDeadLetters(ctx context.Context) (int, error)
+}
+
+// QueueLatency 消息的排队耗时（最近一次入队到开始处理）和处理耗时
+type QueueLatency struct {
+	Wait       HistogramSnapshot `json:"wait"`
+	Processing HistogramSnapshot `json:"processing"`
+}
+
+// LatencyReporter 统计排队和处理耗时的后端实现此接口
+type LatencyReporter interface {
+	Latency() QueueLatency
+}
+
+// ConsumerPending 一个消费者持有的未确认消息
+type ConsumerPending struct {
+	Name    string `json:"name"`
+	Pending int64  `json:"pending"`
+	IdleMs  int64  `json:"idle_ms"` // 距离该消费者上次读取的时间
+}
+
+// PendingMessage 一条已读取但未确认的消息
+type PendingMessage struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	IdleMs     int64  `json:"idle_ms"`
+	Deliveries int64  `json:"deliveries"` // 已投递次数
+}
+
+// PendingInspector 支持按消费者查看未确认消息的后端实现此接口
+type PendingInspector interface {
+	// ConsumerPending 列出每个消费者的未确认消息数
+	ConsumerPending(ctx context.Context) ([]ConsumerPending, error)
+	// PendingMessages 列出未确认的消息，consumer为空时不按消费者过滤
+	PendingMessages(ctx context.Context, consumer string, count int64) ([]PendingMessage, error)
+}
+
+// prepareVoteMessage 校验消息并补全MessageID和时间戳
+func prepareVoteMessage(msg VoteMessage) (VoteMessage, error) {
+	if msg.PollID == "" || msg.OptionID == "" {
+		return msg, fmt.Errorf("投票ID和选项ID不能为空")
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = generateMessageID(msg.PollID, msg.OptionID)
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = time.Now().Unix()
+	}
+	return msg, nil
+}
+
+// 生成唯一的消息ID
+func generateMessageID(pollID string, optionID string) string {
+	return fmt.Sprintf("%s_%s_%d", pollID, optionID, time.Now().UnixNano())
+}
+
+// messageIDSet 记录最近见过的消息ID，超过容量时淘汰最早的，用于进程内幂等
+type messageIDSet struct {
+	mu    sync.Mutex
+	limit int
+	ids   map[string]struct{}
+	order []string
+}
+
+func newMessageIDSet(limit int) *messageIDSet {
+	return &messageIDSet{limit: limit, ids: make(map[string]struct{})}
+}
+
+// Add 记录消息ID，已存在时返回false
+func (s *messageIDSet) Add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > s.limit {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// Remove 删除消息ID，使其可以再次被接受
+func (s *messageIDSet) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, id)
+}
+
+// Contains 判断消息ID是否存在
+func (s *messageIDSet) Contains(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[id]
+	return ok
+}
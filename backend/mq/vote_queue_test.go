@@ -0,0 +1,290 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// voteQueueBackend creates fresh queues of one implementation for the conformance suite.
+type voteQueueBackend struct {
+	name string
+	// wait bounds every Eventually; broker-scheduled retries need more time
+	wait time.Duration
+	new  func(t *testing.T, opts VoteQueueOptions) VoteQueue
+}
+
+func TestVoteQueueConformance(t *testing.T) {
+	backends := []voteQueueBackend{
+		{name: BackendMemory, wait: 5 * time.Second, new: newTestMemoryQueue},
+		{name: BackendRedis, wait: 10 * time.Second, new: newTestRedisQueue},
+		{name: BackendRedisStream, wait: 10 * time.Second, new: newTestRedisStreamQueue},
+		{name: BackendRocketMQ, wait: 60 * time.Second, new: newTestRocketMQQueue},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			runVoteQueueConformance(t, backend)
+		})
+	}
+}
+
+func newTestMemoryQueue(t *testing.T, opts VoteQueueOptions) VoteQueue {
+	q, err := NewMemoryVoteQueue(opts, MemoryQueueOptions{Capacity: 100, Workers: 2})
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// newTestRedisClient connects to an in-process miniredis server.
+func newTestRedisClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func newTestRedisQueue(t *testing.T, opts VoteQueueOptions) VoteQueue {
+	_, client := newTestRedisClient(t)
+	q := NewRedisMQ(client, opts, RedisMQOptions{Workers: 2})
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func newTestRedisStreamQueue(t *testing.T, opts VoteQueueOptions) VoteQueue {
+	_, client := newTestRedisClient(t)
+	q, err := NewRedisStreamQueue(client, opts, RedisStreamOptions{Consumer: "test"})
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// newTestRocketMQQueue requires ROCKETMQ_NAMESRV_ADDR and uses a consumer group per test.
+func newTestRocketMQQueue(t *testing.T, opts VoteQueueOptions) VoteQueue {
+	addr := os.Getenv("ROCKETMQ_NAMESRV_ADDR")
+	if addr == "" {
+		t.Skip("ROCKETMQ_NAMESRV_ADDR not set")
+	}
+	conn, err := net.DialTimeout("tcp", strings.Split(addr, ",")[0], time.Second)
+	if err != nil {
+		t.Skipf("RocketMQ at %s unreachable: %v", addr, err)
+	}
+	conn.Close()
+
+	_, client := newTestRedisClient(t)
+	group := fmt.Sprintf("vote_conformance_%d", time.Now().UnixNano())
+	q, err := NewRocketMQQueue(RocketMQOptions{
+		NameServers:   strings.Split(addr, ","),
+		ConsumerGroup: group,
+		DeadLetters:   NewRedisRocketDeadLetters(client, group),
+	}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// voteRecorder counts handled messages whose poll ID belongs to the current run,
+// so leftovers from earlier runs on a shared broker are ignored.
+type voteRecorder struct {
+	prefix string
+	mu     sync.Mutex
+	calls  map[string]int
+	errs   map[string]error
+}
+
+func newVoteRecorder() *voteRecorder {
+	return &voteRecorder{
+		prefix: fmt.Sprintf("run%d-", time.Now().UnixNano()),
+		calls:  make(map[string]int),
+		errs:   make(map[string]error),
+	}
+}
+
+func (r *voteRecorder) poll(name string) string { return r.prefix + name }
+
+func (r *voteRecorder) handle(pollID, optionID string) error {
+	if !strings.HasPrefix(pollID, r.prefix) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[pollID+"/"+optionID]++
+	return r.errs[pollID]
+}
+
+func (r *voteRecorder) setFailing(pollID string, failing bool) {
+	if failing {
+		r.setError(pollID, errors.New("handler failure"))
+	} else {
+		r.setError(pollID, nil)
+	}
+}
+
+// setError makes every message of pollID fail with err; nil makes them succeed.
+func (r *voteRecorder) setError(pollID string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs[pollID] = err
+}
+
+func (r *voteRecorder) count(pollID, optionID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[pollID+"/"+optionID]
+}
+
+func (r *voteRecorder) total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, c := range r.calls {
+		n += c
+	}
+	return n
+}
+
+func runVoteQueueConformance(t *testing.T, backend voteQueueBackend) {
+	tick := 20 * time.Millisecond
+	opts := VoteQueueOptions{MaxRetries: 1, RetryDelay: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	t.Run("DeliversSentAndBatchedMessages", func(t *testing.T) {
+		q := backend.new(t, opts)
+		rec := newVoteRecorder()
+		require.NoError(t, q.Subscribe(rec.handle))
+
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: rec.poll("1"), OptionID: "1"}))
+		require.NoError(t, q.SendBatch(ctx, []VoteMessage{
+			{PollID: rec.poll("1"), OptionID: "2"},
+			{PollID: rec.poll("2"), OptionID: "1"},
+			{PollID: rec.poll("2"), OptionID: "2"},
+		}))
+
+		require.Eventually(t, func() bool { return rec.total() == 4 }, backend.wait, tick)
+		assert.Equal(t, 1, rec.count(rec.poll("2"), "2"))
+
+		require.Eventually(t, func() bool {
+			stats, err := q.Stats(ctx)
+			return err == nil && stats.Processed == 4
+		}, backend.wait, tick)
+		stats, err := q.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, backend.name, stats.Backend)
+		assert.Equal(t, int64(4), stats.Sent)
+		assert.Zero(t, stats.DeadLetters)
+	})
+
+	t.Run("DuplicateMessageIDHandledOnce", func(t *testing.T) {
+		q := backend.new(t, opts)
+		rec := newVoteRecorder()
+		require.NoError(t, q.Subscribe(rec.handle))
+
+		msg := VoteMessage{PollID: rec.poll("1"), OptionID: "1", MessageID: rec.prefix + "dup"}
+		require.NoError(t, q.Send(ctx, msg))
+		require.Eventually(t, func() bool { return rec.count(msg.PollID, "1") == 1 }, backend.wait, tick)
+
+		require.NoError(t, q.Send(ctx, msg))
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: rec.poll("1"), OptionID: "2"}))
+		require.Eventually(t, func() bool { return rec.count(msg.PollID, "2") == 1 }, backend.wait, tick)
+		assert.Equal(t, 1, rec.count(msg.PollID, "1"))
+	})
+
+	t.Run("ExhaustedRetriesGoToDeadLetters", func(t *testing.T) {
+		q := backend.new(t, opts)
+		rec := newVoteRecorder()
+		bad := rec.poll("bad")
+		rec.setFailing(bad, true)
+		require.NoError(t, q.Subscribe(rec.handle))
+
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: bad, OptionID: "1"}))
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: rec.poll("good"), OptionID: "1"}))
+
+		var dead []VoteMessage
+		require.Eventually(t, func() bool {
+			var err error
+			dead, err = q.DeadLetters(ctx, 10)
+			return err == nil && len(dead) == 1
+		}, backend.wait, tick)
+		assert.Equal(t, bad, dead[0].PollID)
+		// The first attempt plus MaxRetries retries
+		assert.Equal(t, 1+opts.MaxRetries, rec.count(bad, "1"))
+		assert.Equal(t, 1, rec.count(rec.poll("good"), "1"))
+
+		stats, err := q.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.DeadLetters)
+		assert.GreaterOrEqual(t, stats.Failed, int64(1+opts.MaxRetries))
+
+		retrier, ok := q.(DeadLetterRetrier)
+		if !ok {
+			return
+		}
+		rec.setFailing(bad, false)
+		moved, err := retrier.RetryDeadLetters(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, moved)
+		require.Eventually(t, func() bool { return rec.count(bad, "1") == 2+opts.MaxRetries }, backend.wait, tick)
+		dead, err = q.DeadLetters(ctx, 0)
+		require.NoError(t, err)
+		assert.Empty(t, dead)
+	})
+
+	t.Run("ClassifiedErrorsAreNotRetried", func(t *testing.T) {
+		q := backend.new(t, opts)
+		rec := newVoteRecorder()
+		closed, broken := rec.poll("closed"), rec.poll("broken")
+		rec.setError(closed, Drop(errors.New("poll closed")))
+		rec.setError(broken, Permanent(errors.New("option missing")))
+		require.NoError(t, q.Subscribe(rec.handle))
+
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: closed, OptionID: "1"}))
+		require.NoError(t, q.Send(ctx, VoteMessage{PollID: broken, OptionID: "1"}))
+
+		var dead []VoteMessage
+		require.Eventually(t, func() bool {
+			stats, err := q.Stats(ctx)
+			if err != nil || stats.Dropped != 1 {
+				return false
+			}
+			dead, err = q.DeadLetters(ctx, 10)
+			return err == nil && len(dead) == 1
+		}, backend.wait, tick)
+		assert.Equal(t, broken, dead[0].PollID)
+
+		// Wait past the first retry delay to make sure neither message comes back
+		time.Sleep(4 * opts.RetryDelay)
+		assert.Equal(t, 1, rec.count(closed, "1"))
+		assert.Equal(t, 1, rec.count(broken, "1"))
+		dead, err := q.DeadLetters(ctx, 0)
+		require.NoError(t, err)
+		assert.Len(t, dead, 1)
+	})
+
+	t.Run("RejectsInvalidAndClosed", func(t *testing.T) {
+		q := backend.new(t, opts)
+		assert.Error(t, q.Send(ctx, VoteMessage{OptionID: "1"}))
+
+		require.NoError(t, q.Close())
+		assert.ErrorIs(t, q.Send(ctx, VoteMessage{PollID: "1", OptionID: "1"}), ErrQueueClosed)
+		assert.ErrorIs(t, q.Subscribe(func(string, string) error { return nil }), ErrQueueClosed)
+		assert.NoError(t, q.Close())
+	})
+}
+
+func TestRocketDelayLevel(t *testing.T) {
+	assert.Equal(t, 1, RocketDelayLevel(0))
+	assert.Equal(t, 1, RocketDelayLevel(time.Second))
+	assert.Equal(t, 4, RocketDelayLevel(20*time.Second))
+	assert.Equal(t, 4, RocketDelayLevel(30*time.Second))
+	assert.Equal(t, 18, RocketDelayLevel(24*time.Hour))
+}
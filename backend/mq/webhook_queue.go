@@ -0,0 +1,281 @@
+package mq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookJob 一次webhook投递任务
+// 任务只保存订阅ID，投递时重新读取订阅，修改密钥或停用订阅后立即生效
+type WebhookJob struct {
+	ID             string          `json:"id"`
+	SubscriptionID uint            `json:"subscription_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      int64           `json:"created_at"`
+	FailedAt       int64           `json:"failed_at,omitempty"`
+
+	raw string // 取出时的原始内容，Redis存储按它确认任务
+}
+
+// WebhookDeliverFunc 执行一次投递，返回错误时按退避策略重试
+type WebhookDeliverFunc func(ctx context.Context, job *WebhookJob) error
+
+// WebhookQueueOptions 投递队列的配置
+type WebhookQueueOptions struct {
+	Workers     int           // 并发投递数
+	MaxAttempts int           // 最多投递次数（含第一次）
+	BaseDelay   time.Duration // 第一次重试的等待时间上限，之后每次翻倍，实际等待在上限的一半到上限之间
+	MaxDelay    time.Duration // 重试等待时间上限
+	PollEvery   time.Duration // 检查到期重试任务的间隔
+	// ClaimTimeout 取出后超过该时间仍未确认的任务视为处理实例已崩溃，计一次失败后重新安排
+	ClaimTimeout time.Duration
+}
+
+// WebhookQueueStats 投递队列的运行统计
+type WebhookQueueStats struct {
+	Pending    int64 `json:"pending"`
+	Processing int64 `json:"processing"`
+	Delayed    int64 `json:"delayed"`
+	Dead       int64 `json:"dead"`
+	Delivered  int64 `json:"delivered"`
+	Retried    int64 `json:"retried"`
+	Failed     int64 `json:"failed"`
+	Dropped    int64 `json:"dropped"` // 已无意义而丢弃的任务，例如订阅已删除
+}
+
+// WebhookQueue 异步投递webhook，失败时指数退避重试，重试耗尽后放入死信列表
+type WebhookQueue struct {
+	store   WebhookStore
+	deliver WebhookDeliverFunc
+	opts    WebhookQueueOptions
+
+	delivered int64
+	retried   int64
+	failed    int64
+	dropped   int64
+
+	runOnce sync.Once
+}
+
+// NewWebhookQueue 创建投递队列，调用Run后开始投递
+func NewWebhookQueue(store WebhookStore, deliver WebhookDeliverFunc, opts WebhookQueueOptions) *WebhookQueue {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 6
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 10 * time.Second
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+	if opts.PollEvery <= 0 {
+		opts.PollEvery = time.Second
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = 5 * time.Minute
+	}
+	return &WebhookQueue{store: store, deliver: deliver, opts: opts}
+}
+
+// Enqueue 加入投递队列
+func (q *WebhookQueue) Enqueue(ctx context.Context, job *WebhookJob) error {
+	if job.ID == "" {
+		job.ID = newWebhookJobID()
+	}
+	if job.CreatedAt == 0 {
+		job.CreatedAt = time.Now().Unix()
+	}
+	return q.store.Push(ctx, job)
+}
+
+// Run 启动投递和重试调度，直到ctx取消；重复调用只启动一次
+func (q *WebhookQueue) Run(ctx context.Context) {
+	q.runOnce.Do(func() {
+		for i := 0; i < q.opts.Workers; i++ {
+			go q.workLoop(ctx)
+		}
+		go q.promoteLoop(ctx)
+		go q.recoverLoop(ctx)
+		log.Printf("webhook投递队列已启动，并发数: %d, 最多投递次数: %d", q.opts.Workers, q.opts.MaxAttempts)
+	})
+}
+
+func (q *WebhookQueue) workLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.store.Pop(ctx, q.opts.PollEvery)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("获取webhook任务失败: %v", err)
+				time.Sleep(q.opts.PollEvery)
+			}
+			continue
+		}
+		if job != nil {
+			q.process(ctx, job)
+		}
+	}
+}
+
+func (q *WebhookQueue) promoteLoop(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := q.store.PromoteDue(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("调度webhook重试任务失败: %v", err)
+			}
+		}
+	}
+}
+
+// recoverLoop 定期找回处理超时的任务，例如投递中途实例崩溃
+func (q *WebhookQueue) recoverLoop(ctx context.Context) {
+	interval := q.opts.ClaimTimeout / 2
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.recoverStale(ctx)
+		}
+	}
+}
+
+// recoverStale 处理超时的任务计一次失败，按退避重新安排或放入死信
+func (q *WebhookQueue) recoverStale(ctx context.Context) {
+	jobs, err := q.store.Stale(ctx, q.opts.ClaimTimeout)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("检查webhook处理超时任务失败: %v", err)
+		}
+		return
+	}
+	for _, job := range jobs {
+		job.Attempts++
+		job.LastError = "处理超时"
+		q.fail(ctx, job, job.Attempts >= q.opts.MaxAttempts)
+	}
+}
+
+// process 投递一个任务，失败时按错误分类丢弃、安排重试或放入死信
+func (q *WebhookQueue) process(ctx context.Context, job *WebhookJob) {
+	job.Attempts++
+	err := q.deliver(ctx, job)
+	if err == nil {
+		atomic.AddInt64(&q.delivered, 1)
+		q.ack(ctx, job)
+		return
+	}
+
+	job.LastError = err.Error()
+	class := ClassifyError(err)
+	if class == ErrorDrop {
+		atomic.AddInt64(&q.dropped, 1)
+		log.Printf("丢弃webhook任务: 任务=%s, 订阅=%d, 事件=%s: %v", job.ID, job.SubscriptionID, job.Event, err)
+		q.ack(ctx, job)
+		return
+	}
+	q.fail(ctx, job, class == ErrorPermanent || job.Attempts >= q.opts.MaxAttempts)
+}
+
+// ack 确认任务，失败时任务留在处理中，超时后会被再次投递
+func (q *WebhookQueue) ack(ctx context.Context, job *WebhookJob) {
+	if err := q.store.Ack(ctx, job); err != nil {
+		log.Printf("确认webhook任务失败: 任务=%s, 错误: %v", job.ID, err)
+	}
+}
+
+// fail 投递失败的任务：bury为true时放入死信，否则按退避安排重试
+func (q *WebhookQueue) fail(ctx context.Context, job *WebhookJob, bury bool) {
+	if bury {
+		job.FailedAt = time.Now().Unix()
+		atomic.AddInt64(&q.failed, 1)
+		log.Printf("webhook投递失败，放入死信: 任务=%s, 订阅=%d, 事件=%s, 次数=%d, 错误: %s",
+			job.ID, job.SubscriptionID, job.Event, job.Attempts, job.LastError)
+		if buryErr := q.store.Bury(ctx, job); buryErr != nil {
+			log.Printf("写入webhook死信失败: 任务=%s, 错误: %v", job.ID, buryErr)
+		}
+		return
+	}
+
+	delay := exponentialBackoff(job.Attempts, q.opts.BaseDelay, q.opts.MaxDelay)
+	atomic.AddInt64(&q.retried, 1)
+	log.Printf("webhook投递失败，%v后重试: 任务=%s, 订阅=%d, 次数=%d, 错误: %s",
+		delay, job.ID, job.SubscriptionID, job.Attempts, job.LastError)
+	if err := q.store.Schedule(ctx, job, time.Now().Add(delay)); err != nil {
+		log.Printf("安排webhook重试失败: 任务=%s, 错误: %v", job.ID, err)
+	}
+}
+
+// DeadLetters 列出死信任务
+func (q *WebhookQueue) DeadLetters(ctx context.Context) ([]*WebhookJob, error) {
+	return q.store.DeadLetters(ctx)
+}
+
+// RetryDeadLetter 将死信任务重新加入投递队列，投递次数清零；任务不存在时返回false
+func (q *WebhookQueue) RetryDeadLetter(ctx context.Context, id string) (bool, error) {
+	job, err := q.store.TakeDeadLetter(ctx, id)
+	if err != nil || job == nil {
+		return false, err
+	}
+	job.Attempts = 0
+	job.FailedAt = 0
+	if err := q.store.Push(ctx, job); err != nil {
+		// 重新放回死信，避免任务丢失
+		q.store.Bury(ctx, job)
+		return false, fmt.Errorf("重新投递webhook失败: %v", err)
+	}
+	return true, nil
+}
+
+// DeleteDeadLetter 删除死信任务，任务不存在时返回false
+func (q *WebhookQueue) DeleteDeadLetter(ctx context.Context, id string) (bool, error) {
+	job, err := q.store.TakeDeadLetter(ctx, id)
+	return job != nil, err
+}
+
+// Stats 返回队列的运行统计
+func (q *WebhookQueue) Stats(ctx context.Context) WebhookQueueStats {
+	pending, processing, delayed, dead := q.store.Lengths(ctx)
+	return WebhookQueueStats{
+		Pending:    pending,
+		Processing: processing,
+		Delayed:    delayed,
+		Dead:       dead,
+		Delivered:  atomic.LoadInt64(&q.delivered),
+		Retried:    atomic.LoadInt64(&q.retried),
+		Failed:     atomic.LoadInt64(&q.failed),
+		Dropped:    atomic.LoadInt64(&q.dropped),
+	}
+}
+
+func newWebhookJobID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("whd_%d", time.Now().UnixNano())
+	}
+	return "whd_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebhookQueue(t *testing.T, store WebhookStore, deliver WebhookDeliverFunc) *WebhookQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	q := NewWebhookQueue(store, deliver, WebhookQueueOptions{
+		Workers:     1,
+		MaxAttempts: 3,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    20 * time.Millisecond,
+		PollEvery:   10 * time.Millisecond,
+	})
+	q.Run(ctx)
+	return q
+}
+
+func TestWebhookQueue_ErrorClasses(t *testing.T) {
+	attempts := make(map[string]int)
+	results := make(chan string, 10)
+	q := newTestWebhookQueue(t, NewMemoryWebhookStore(), func(ctx context.Context, job *WebhookJob) error {
+		attempts[job.Event]++
+		results <- job.Event
+		switch job.Event {
+		case "drop":
+			return Drop(errors.New("subscription deleted"))
+		case "permanent":
+			return Permanent(errors.New("410 gone"))
+		default:
+			return nil
+		}
+	})
+
+	ctx := context.Background()
+	for _, event := range []string{"drop", "permanent", "ok"} {
+		require.NoError(t, q.Enqueue(ctx, &WebhookJob{Event: event}))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-results:
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook jobs were not delivered")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		stats := q.Stats(ctx)
+		return stats.Dropped == 1 && stats.Failed == 1 && stats.Delivered == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Dropped jobs are neither retried nor dead-lettered
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, attempts["drop"])
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "permanent", dead[0].Event)
+	assert.Zero(t, q.Stats(ctx).Delayed)
+}
+
+func TestWebhookQueue_RedisRecoversJobClaimedByCrashedWorker(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	store := NewRedisWebhookStore(client)
+	ctx := context.Background()
+
+	// A worker claims the job and dies before acknowledging it
+	require.NoError(t, store.Push(ctx, &WebhookJob{ID: "whd_crash", Event: "poll.closed", CreatedAt: time.Now().Unix()}))
+	claimed, err := store.Pop(ctx, time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	require.NoError(t, client.HSet(ctx, WebhookClaimedHashName, claimed.ID, time.Now().Add(-time.Minute).Unix()).Err())
+
+	pending, processing, _, _ := store.Lengths(ctx)
+	assert.Zero(t, pending)
+	assert.Equal(t, int64(1), processing, "a claimed job stays in the processing list until acknowledged")
+
+	delivered := make(chan *WebhookJob, 1)
+	runCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	q := NewWebhookQueue(store, func(ctx context.Context, job *WebhookJob) error {
+		delivered <- job
+		return nil
+	}, WebhookQueueOptions{
+		Workers:      1,
+		MaxAttempts:  3,
+		BaseDelay:    10 * time.Millisecond,
+		MaxDelay:     20 * time.Millisecond,
+		PollEvery:    10 * time.Millisecond,
+		ClaimTimeout: 20 * time.Millisecond,
+	})
+	q.Run(runCtx)
+
+	select {
+	case job := <-delivered:
+		assert.Equal(t, "whd_crash", job.ID)
+		// The timed-out claim counts as one attempt
+		assert.Equal(t, 2, job.Attempts)
+		assert.Equal(t, "处理超时", job.LastError)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job claimed by a crashed worker was never redelivered")
+	}
+
+	require.Eventually(t, func() bool {
+		stats := q.Stats(ctx)
+		return stats.Pending == 0 && stats.Processing == 0 && stats.Delayed == 0
+	}, time.Second, 10*time.Millisecond)
+	claims, err := client.HLen(ctx, WebhookClaimedHashName).Result()
+	require.NoError(t, err)
+	assert.Zero(t, claims)
+}
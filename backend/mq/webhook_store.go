@@ -0,0 +1,322 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Webhook投递队列的Redis键
+const (
+	WebhookQueueName       = "webhook_queue"       // 待投递
+	WebhookProcessingName  = "webhook_processing"  // 已取出、尚未确认
+	WebhookClaimedHashName = "webhook_claimed_at"  // 任务ID -> 取出时间
+	WebhookDelayedSetName  = "webhook_delayed"     // 等待重试，分数为到期时间（Unix毫秒）
+	WebhookDeadLetterName  = "webhook_dead_letter" // 重试耗尽
+)
+
+// 死信列表最多保留的任务数，超过时丢弃最早的
+const webhookDeadLetterLimit = 1000
+
+// WebhookStore webhook投递任务的存储
+type WebhookStore interface {
+	// Push 加入待投递队列
+	Push(ctx context.Context, job *WebhookJob) error
+	// Pop 取出一个待投递任务，timeout内没有任务时返回nil
+	// 取出的任务在Ack、Schedule或Bury之前一直算作处理中
+	Pop(ctx context.Context, timeout time.Duration) (*WebhookJob, error)
+	// Ack 任务已投递或已丢弃，不再需要处理
+	Ack(ctx context.Context, job *WebhookJob) error
+	// Stale 列出取出后超过timeout仍未确认的任务，例如处理中的实例崩溃
+	Stale(ctx context.Context, timeout time.Duration) ([]*WebhookJob, error)
+	// Schedule 在due时刻重新投递
+	Schedule(ctx context.Context, job *WebhookJob, due time.Time) error
+	// PromoteDue 将到期的重试任务移回待投递队列，返回移动的数量
+	PromoteDue(ctx context.Context, now time.Time) (int, error)
+	// Bury 加入死信列表
+	Bury(ctx context.Context, job *WebhookJob) error
+	// DeadLetters 列出死信，最新的在前
+	DeadLetters(ctx context.Context) ([]*WebhookJob, error)
+	// TakeDeadLetter 从死信列表中取出指定任务，不存在时返回nil
+	TakeDeadLetter(ctx context.Context, id string) (*WebhookJob, error)
+	// Lengths 返回待投递、处理中、等待重试和死信的任务数
+	Lengths(ctx context.Context) (pending, processing, delayed, dead int64)
+}
+
+// redisWebhookStore 基于与RedisMQ相同的可靠列表，多个实例共享同一个队列，实例崩溃时任务不会丢失
+type redisWebhookStore struct {
+	client *redis.Client
+	list   *reliableList
+}
+
+// NewRedisWebhookStore 创建Redis存储
+func NewRedisWebhookStore(client *redis.Client) WebhookStore {
+	return &redisWebhookStore{
+		client: client,
+		list: &reliableList{
+			client:     client,
+			ready:      WebhookQueueName,
+			processing: WebhookProcessingName,
+			claimed:    WebhookClaimedHashName,
+			delayed:    WebhookDelayedSetName,
+			dead:       WebhookDeadLetterName,
+			deadLimit:  webhookDeadLetterLimit,
+		},
+	}
+}
+
+func (s *redisWebhookStore) Push(ctx context.Context, job *WebhookJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("序列化webhook任务失败: %v", err)
+	}
+	return s.client.LPush(ctx, WebhookQueueName, data).Err()
+}
+
+func (s *redisWebhookStore) Pop(ctx context.Context, timeout time.Duration) (*WebhookJob, error) {
+	item, err := s.list.claim(ctx, timeout)
+	if err != nil || item == "" {
+		return nil, err
+	}
+	job, err := decodeWebhookJob(item)
+	if err != nil {
+		// 无法解析的任务不会再成功，直接移入死信
+		s.list.bury(ctx, item, "", item)
+		return nil, err
+	}
+	s.list.markClaimed(ctx, job.ID)
+	return job, nil
+}
+
+func (s *redisWebhookStore) Ack(ctx context.Context, job *WebhookJob) error {
+	return s.list.ack(ctx, job.raw, job.ID, nil)
+}
+
+func (s *redisWebhookStore) Stale(ctx context.Context, timeout time.Duration) ([]*WebhookJob, error) {
+	stale, err := s.list.staleClaims(ctx, timeout, time.Now(), func(item string) (string, int64, bool) {
+		job, err := decodeWebhookJob(item)
+		if err != nil {
+			return "", 0, false
+		}
+		return job.ID, job.CreatedAt, true
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*WebhookJob, 0, len(stale))
+	for _, claim := range stale {
+		job, _ := decodeWebhookJob(claim.item)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *redisWebhookStore) Schedule(ctx context.Context, job *WebhookJob, due time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("序列化webhook任务失败: %v", err)
+	}
+	return s.list.retryAt(ctx, job.raw, job.ID, string(data), due, nil)
+}
+
+func (s *redisWebhookStore) PromoteDue(ctx context.Context, now time.Time) (int, error) {
+	return s.list.promote(ctx, now)
+}
+
+func (s *redisWebhookStore) Bury(ctx context.Context, job *WebhookJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("序列化webhook任务失败: %v", err)
+	}
+	return s.list.bury(ctx, job.raw, job.ID, string(data))
+}
+
+func (s *redisWebhookStore) DeadLetters(ctx context.Context) ([]*WebhookJob, error) {
+	items, err := s.client.LRange(ctx, WebhookDeadLetterName, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*WebhookJob, 0, len(items))
+	for _, item := range items {
+		if job, err := decodeWebhookJob(item); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *redisWebhookStore) TakeDeadLetter(ctx context.Context, id string) (*WebhookJob, error) {
+	items, err := s.client.LRange(ctx, WebhookDeadLetterName, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		job, err := decodeWebhookJob(item)
+		if err != nil || job.ID != id {
+			continue
+		}
+		// 其他实例已经取走时LREM返回0
+		removed, err := s.client.LRem(ctx, WebhookDeadLetterName, 1, item).Result()
+		if err != nil {
+			return nil, err
+		}
+		if removed == 0 {
+			return nil, nil
+		}
+		return job, nil
+	}
+	return nil, nil
+}
+
+func (s *redisWebhookStore) Lengths(ctx context.Context) (pending, processing, delayed, dead int64) {
+	pending, _ = s.client.LLen(ctx, WebhookQueueName).Result()
+	processing, _ = s.client.LLen(ctx, WebhookProcessingName).Result()
+	delayed, _ = s.client.ZCard(ctx, WebhookDelayedSetName).Result()
+	dead, _ = s.client.LLen(ctx, WebhookDeadLetterName).Result()
+	return pending, processing, delayed, dead
+}
+
+// decodeWebhookJob 解析任务并记下原始内容，之后按原始内容从处理中列表移除
+func decodeWebhookJob(data string) (*WebhookJob, error) {
+	var job WebhookJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, fmt.Errorf("解析webhook任务失败: %v", err)
+	}
+	job.raw = data
+	return &job, nil
+}
+
+// memoryWebhookStore Redis不可用时使用的进程内存储，重启后未投递的任务会丢失
+// 任务只在本进程内处理，进程退出时处理中的任务随之丢失，因此不需要确认
+type memoryWebhookStore struct {
+	mu      sync.Mutex
+	ready   []*WebhookJob
+	delayed []delayedWebhookJob
+	dead    []*WebhookJob // 最新的在前
+	notify  chan struct{}
+}
+
+type delayedWebhookJob struct {
+	job *WebhookJob
+	due time.Time
+}
+
+// NewMemoryWebhookStore 创建进程内存储
+func NewMemoryWebhookStore() WebhookStore {
+	return &memoryWebhookStore{notify: make(chan struct{}, 1)}
+}
+
+func (s *memoryWebhookStore) Push(ctx context.Context, job *WebhookJob) error {
+	s.mu.Lock()
+	s.ready = append(s.ready, job)
+	s.mu.Unlock()
+	s.wake()
+	return nil
+}
+
+func (s *memoryWebhookStore) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memoryWebhookStore) Pop(ctx context.Context, timeout time.Duration) (*WebhookJob, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if len(s.ready) > 0 {
+			job := s.ready[0]
+			s.ready = s.ready[1:]
+			more := len(s.ready) > 0
+			s.mu.Unlock()
+			if more {
+				// 唤醒其他等待的消费者
+				s.wake()
+			}
+			return job, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *memoryWebhookStore) Ack(ctx context.Context, job *WebhookJob) error {
+	return nil
+}
+
+func (s *memoryWebhookStore) Stale(ctx context.Context, timeout time.Duration) ([]*WebhookJob, error) {
+	return nil, nil
+}
+
+func (s *memoryWebhookStore) Schedule(ctx context.Context, job *WebhookJob, due time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delayed = append(s.delayed, delayedWebhookJob{job: job, due: due})
+	return nil
+}
+
+func (s *memoryWebhookStore) PromoteDue(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	sort.SliceStable(s.delayed, func(i, j int) bool { return s.delayed[i].due.Before(s.delayed[j].due) })
+	n := 0
+	for n < len(s.delayed) && !s.delayed[n].due.After(now) {
+		s.ready = append(s.ready, s.delayed[n].job)
+		n++
+	}
+	s.delayed = s.delayed[n:]
+	s.mu.Unlock()
+
+	if n > 0 {
+		s.wake()
+	}
+	return n, nil
+}
+
+func (s *memoryWebhookStore) Bury(ctx context.Context, job *WebhookJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append([]*WebhookJob{job}, s.dead...)
+	if len(s.dead) > webhookDeadLetterLimit {
+		s.dead = s.dead[:webhookDeadLetterLimit]
+	}
+	return nil
+}
+
+func (s *memoryWebhookStore) DeadLetters(ctx context.Context) ([]*WebhookJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*WebhookJob(nil), s.dead...), nil
+}
+
+func (s *memoryWebhookStore) TakeDeadLetter(ctx context.Context, id string) (*WebhookJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.dead {
+		if job.ID == id {
+			s.dead = append(s.dead[:i], s.dead[i+1:]...)
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryWebhookStore) Lengths(ctx context.Context) (pending, processing, delayed, dead int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.ready)), 0, int64(len(s.delayed)), int64(len(s.dead))
+}
@@ -1,15 +1,19 @@
 package routes
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"realtime-voting-backend/handlers"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 )
 
 // Server 是HTTP服务器的封装
@@ -22,6 +26,16 @@ func SetupRouter() *gin.Engine {
 	// 创建Gin路由器
 	router := gin.Default()
 
+	// 配置可信代理：只有来自这些地址的请求，才会根据X-Forwarded-For等头部推导客户端IP
+	// 未配置时不信任任何代理，直接使用连接的对端地址
+	trustedProxies := trustedProxiesFromEnv()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Printf("配置可信代理失败: %v，将不信任任何代理", err)
+		router.SetTrustedProxies(nil)
+	} else {
+		log.Printf("可信代理: %v", trustedProxies)
+	}
+
 	// 配置CORS中间件
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // 生产环境中应限制为前端域名
@@ -57,24 +71,88 @@ func SetupRouter() *gin.Engine {
 			polls.GET("/:id", handlers.GetPoll)
 			polls.PUT("/:id", handlers.UpdatePoll)
 			polls.DELETE("/:id", handlers.DeletePoll)
-			polls.POST("/:id/vote", handlers.SubmitVote)
+			polls.POST("/:id/vote", handlers.IPFilterMiddleware(), handlers.SubmitVote)
+
+			// 防机器人工作量证明挑战
+			polls.GET("/:id/challenge", handlers.IPFilterMiddleware(), handlers.GetPollChallenge)
 
 			// 增强版投票端点 - 使用幂等性控制等高级特性
-			polls.POST("/:id/vote/enhanced", handlers.SubmitEnhancedVote)
+			polls.POST("/:id/vote/enhanced", handlers.IPFilterMiddleware(), handlers.SubmitEnhancedVote)
 
 			// 重置投票计数
 			polls.POST("/:id/reset", handlers.ResetPollVotes)
 
+			// 可验证计票：公布结果、收据包含性证明、选票导出
+			polls.GET("/:id/tally", handlers.GetPollTally)
+			polls.GET("/:id/tally/proof", handlers.GetBallotProof)
+			polls.GET("/:id/tally/export", handlers.ExportPollBallots)
+
 			// 实时更新端点（WebSocket和SSE）
-			polls.GET("/:id/ws", handlers.HandleWebSocket) // WebSocket方式
-			polls.GET("/:id/live", handlers.HandleSSE)     // SSE方式
+			polls.GET("/:id/ws", handlers.HandleWebSocket)  // WebSocket方式
+			polls.GET("/:id/live", handlers.HandleSSE)      // SSE方式
+			polls.GET("/:id/poll", handlers.HandleLongPoll) // 长轮询，WebSocket和SSE都不可用时使用
+
+			// 当前和峰值在线人数
+			polls.GET("/:id/presence", handlers.GetPollPresence)
+
+			// 评论和表情互动
+			polls.GET("/:id/comments", handlers.GetPollComments)
+			polls.POST("/:id/comments", handlers.IPFilterMiddleware(), handlers.CreateComment)
+			polls.GET("/:id/reactions", handlers.GetPollReactions)
+			polls.POST("/:id/reactions", handlers.IPFilterMiddleware(), handlers.AddReaction)
 		}
 
+		// 实时连接（WebSocket、SSE）的访问令牌
+		api.POST("/stream-token", handlers.IssueStreamToken)
+
+		// 多路WebSocket：一个连接通过SUBSCRIBE/UNSUBSCRIBE订阅多个投票
+		api.GET("/ws", handlers.HandleMultiplexWebSocket)
+
 		// 管理员相关API
 		admin := api.Group("/admin")
 		{
 			admin.POST("/polls/:id/reset", handlers.ResetPollVotes)
 			admin.POST("/cache/clean", handlers.CleanupRedisCache)
+
+			// 审计日志查询与哈希链校验
+			admin.GET("/audit", handlers.GetAuditLogs)
+			admin.GET("/audit/verify", handlers.VerifyAuditLog)
+
+			// 异常投票隔离审核
+			admin.GET("/quarantine", handlers.GetQuarantinedVotes)
+			admin.POST("/quarantine/:id/approve", handlers.ApproveQuarantinedVote)
+			admin.POST("/quarantine/:id/discard", handlers.DiscardQuarantinedVote)
+
+			// IP/CIDR黑白名单
+			admin.GET("/ip-rules", handlers.GetIPRules)
+			admin.POST("/ip-rules", handlers.CreateIPRule)
+			admin.DELETE("/ip-rules/:id", handlers.DeleteIPRule)
+			admin.GET("/ip-rules/check", handlers.CheckIPRule)
+
+			// 评论审核
+			admin.GET("/comments", handlers.GetComments)
+			admin.POST("/comments/:id/approve", handlers.ApproveComment)
+			admin.DELETE("/comments/:id", handlers.DeleteComment)
+
+			// 管理员告警通道（WebSocket）
+			admin.GET("/ws", handlers.HandleAdminWebSocket)
+
+			// WebSocket连接的发送积压
+			admin.GET("/ws/clients", handlers.GetWebSocketClients)
+
+			// webhook订阅和投递死信
+			admin.GET("/webhooks", handlers.GetWebhooks)
+			admin.POST("/webhooks", handlers.CreateWebhook)
+			admin.PUT("/webhooks/:id", handlers.UpdateWebhook)
+			admin.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+			admin.GET("/webhooks/dead-letters", handlers.GetWebhookDeadLetters)
+			admin.POST("/webhooks/dead-letters/:id/retry", handlers.RetryWebhookDeadLetter)
+			admin.DELETE("/webhooks/dead-letters/:id", handlers.DeleteWebhookDeadLetter)
+
+			// 投票消息队列：统计、未确认消息和死信
+			admin.GET("/queue", handlers.GetVoteQueue)
+			admin.GET("/queue/pending", handlers.GetVoteQueuePending)
+			admin.POST("/queue/dead-letters/retry", handlers.RetryVoteQueueDeadLetters)
 		}
 
 		// 高并发处理示例路由
@@ -126,6 +204,59 @@ func StartServer(router *gin.Engine) *Server {
 	return srv
 }
 
+// StartGRPCServer 在单独的端口启动gRPC服务器
+func StartGRPCServer() *grpc.Server {
+	// 从环境变量获取端口，默认为9090
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "9090" // 默认端口
+	}
+
+	addr := ":" + port
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("gRPC服务器启动失败: %v", err)
+	}
+
+	srv := handlers.NewGRPCServer()
+
+	// 在单独的goroutine中启动服务器
+	go func() {
+		log.Printf("gRPC服务器启动在 %s", addr)
+		if err := srv.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+			log.Fatalf("gRPC服务器启动失败: %v", err)
+		}
+	}()
+
+	return srv
+}
+
+// ShutdownGRPCServer 优雅关闭gRPC服务器，WatchPoll等长连接在ctx到期后被强制断开
+func ShutdownGRPCServer(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// trustedProxiesFromEnv 从环境变量TRUSTED_PROXIES读取逗号分隔的可信代理IP或CIDR
+func trustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // startPollExpirationChecker 检查并关闭过期的投票
 func startPollExpirationChecker() {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -0,0 +1,81 @@
+package streamauth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginPolicy 允许建立实时连接的页面来源
+//
+// 配置为逗号分隔的来源列表，例如 "https://vote.example.com,https://*.example.com"：
+//   - "*" 允许所有来源
+//   - "https://*.example.com" 允许该域名的所有子域名（不含example.com本身）
+//   - 未配置时只允许与服务同域的页面
+//
+// 没有Origin请求头的连接（非浏览器客户端）总是允许，由访问令牌控制
+type OriginPolicy struct {
+	any      bool
+	exact    map[string]bool
+	wildcard []string // "https://.example.com" 形式，匹配协议和域名后缀
+}
+
+// ParseOrigins 解析来源列表
+func ParseOrigins(list string) *OriginPolicy {
+	p := &OriginPolicy{exact: make(map[string]bool)}
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch {
+		case origin == "":
+		case origin == "*":
+			p.any = true
+		case strings.Contains(origin, "://*."):
+			p.wildcard = append(p.wildcard, strings.Replace(origin, "://*.", "://.", 1))
+		default:
+			p.exact[origin] = true
+		}
+	}
+	return p
+}
+
+// Configured 是否配置了来源列表
+func (p *OriginPolicy) Configured() bool {
+	return p.any || len(p.exact) > 0 || len(p.wildcard) > 0
+}
+
+// Allowed 判断请求的来源是否允许
+func (p *OriginPolicy) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if p.any {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if !p.Configured() {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+
+	normalized := strings.ToLower(u.Scheme + "://" + u.Host)
+	if p.exact[normalized] {
+		return true
+	}
+
+	for _, pattern := range p.wildcard {
+		scheme, suffix, _ := strings.Cut(pattern, "://")
+		// 模式不带端口时匹配任意端口
+		host := strings.ToLower(u.Hostname())
+		if strings.Contains(suffix, ":") {
+			host = strings.ToLower(u.Host)
+		}
+		if strings.EqualFold(u.Scheme, scheme) && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
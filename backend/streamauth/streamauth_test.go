@@ -0,0 +1,81 @@
+package streamauth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner_RoundTrip(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	now := time.Unix(1700000000, 0)
+
+	token, err := signer.Sign(Claims{Subject: "kiosk-1", PollIDs: []uint{3, 5}, ExpiresAt: now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	claims, err := signer.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "kiosk-1", claims.Subject)
+	assert.True(t, claims.CanView(5))
+	assert.False(t, claims.CanView(4))
+	assert.Equal(t, now.Add(time.Minute), claims.Expiry())
+
+	_, err = signer.Verify(token, now.Add(time.Minute))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	// Tokens signed with another secret or altered claims are rejected
+	_, err = NewSigner([]byte("other")).Verify(token, now)
+	assert.ErrorIs(t, err, ErrSignature)
+	forged, err := NewSigner([]byte("other")).Sign(Claims{ExpiresAt: now.Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+	_, err = signer.Verify(payload+"."+signature, now)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	for _, bad := range []string{"abc", "abc.!!!", "bm90LWpzb24." + signature} {
+		_, err = signer.Verify(bad, now)
+		assert.Error(t, err, bad)
+	}
+	_, err = signer.Verify("", now)
+	assert.ErrorIs(t, err, ErrMissing)
+}
+
+func TestClaims_AllPolls(t *testing.T) {
+	claims := Claims{ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	assert.True(t, claims.CanView(42))
+}
+
+func TestOriginPolicy(t *testing.T) {
+
+	check := func(p *OriginPolicy, host, origin string) bool {
+		r := httptest.NewRequest("GET", "http://"+host+"/api/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return p.Allowed(r)
+	}
+
+	// Without configuration only same-host pages and non-browser clients are allowed
+	same := ParseOrigins("")
+	assert.False(t, same.Configured())
+	assert.True(t, check(same, "vote.example.com", ""))
+	assert.True(t, check(same, "vote.example.com", "https://vote.example.com"))
+	assert.False(t, check(same, "vote.example.com", "https://evil.example.net"))
+
+	p := ParseOrigins(" https://Vote.Example.com/ , https://*.example.org,http://*.local.test:8080")
+	assert.True(t, check(p, "api.internal", "https://vote.example.com"))
+	assert.False(t, check(p, "api.internal", "http://vote.example.com"))
+	assert.True(t, check(p, "api.internal", "https://a.b.example.org:8443"))
+	assert.False(t, check(p, "api.internal", "https://example.org"))
+	assert.False(t, check(p, "api.internal", "https://badexample.org"))
+	assert.True(t, check(p, "api.internal", "http://kiosk.local.test:8080"))
+	assert.False(t, check(p, "api.internal", "http://kiosk.local.test:9090"))
+	assert.False(t, check(p, "api.internal", "null"))
+
+	assert.True(t, check(ParseOrigins("*"), "api.internal", "https://anything.example"))
+}
@@ -0,0 +1,115 @@
+package tally
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 收据格式版本，写入哈希输入以便将来升级
+const receiptVersion = "ballot-v1"
+
+// NewSalt 生成选票的随机盐，防止通过枚举选项反推收据
+func NewSalt() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Receipt 计算选票收据：sha256("ballot-v1|投票ID|升序选项ID|盐")
+func Receipt(pollID uint, optionIDs []uint, salt string) string {
+	canonical := strings.Join([]string{
+		receiptVersion,
+		strconv.FormatUint(uint64(pollID), 10),
+		CanonicalOptions(optionIDs),
+		salt,
+	}, "|")
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalOptions 将选项ID升序排列为逗号分隔的字符串
+func CanonicalOptions(optionIDs []uint) string {
+	sorted := append([]uint(nil), optionIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ExportedBallot 导出文件中的一张选票
+type ExportedBallot struct {
+	Receipt   string `json:"receipt"`
+	OptionIDs []uint `json:"option_ids"`
+	Salt      string `json:"salt"`
+}
+
+// Export 选票导出文件，包含公布的树根和票数
+type Export struct {
+	PollID      uint             `json:"poll_id"`
+	MerkleRoot  string           `json:"merkle_root"`
+	Counts      map[uint]int64   `json:"counts"` // 选项ID -> 票数
+	BallotCount int              `json:"ballot_count"`
+	PublishedAt time.Time        `json:"published_at"`
+	Ballots     []ExportedBallot `json:"ballots"`
+}
+
+// Count 根据选票统计每个选项的票数
+func Count(ballots []ExportedBallot) map[uint]int64 {
+	counts := make(map[uint]int64)
+	for _, ballot := range ballots {
+		for _, optionID := range ballot.OptionIDs {
+			counts[optionID]++
+		}
+	}
+	return counts
+}
+
+// VerifyExport 重新计算导出文件中的收据、树根和票数，返回发现的问题
+func VerifyExport(export *Export) []string {
+	problems := []string{}
+
+	receipts := make([]string, 0, len(export.Ballots))
+	for i, ballot := range export.Ballots {
+		expected := Receipt(export.PollID, ballot.OptionIDs, ballot.Salt)
+		if expected != ballot.Receipt {
+			problems = append(problems, fmt.Sprintf("第 %d 张选票的收据与内容不符: %s", i+1, ballot.Receipt))
+		}
+		receipts = append(receipts, ballot.Receipt)
+	}
+
+	if export.BallotCount != len(export.Ballots) {
+		problems = append(problems, fmt.Sprintf("公布的选票数 %d 与导出的选票数 %d 不一致", export.BallotCount, len(export.Ballots)))
+	}
+
+	tree, err := BuildTree(receipts)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("构建Merkle树失败: %v", err))
+	} else if tree.Root() != export.MerkleRoot {
+		problems = append(problems, fmt.Sprintf("重新计算的树根 %s 与公布的树根 %s 不一致", tree.Root(), export.MerkleRoot))
+	}
+
+	counts := Count(export.Ballots)
+	for optionID, announced := range export.Counts {
+		if counts[optionID] != announced {
+			problems = append(problems, fmt.Sprintf("选项 %d 公布 %d 票，选票统计为 %d 票", optionID, announced, counts[optionID]))
+		}
+	}
+	for optionID, counted := range counts {
+		if _, ok := export.Counts[optionID]; !ok {
+			problems = append(problems, fmt.Sprintf("选项 %d 有 %d 张选票但未公布票数", optionID, counted))
+		}
+	}
+
+	return problems
+}
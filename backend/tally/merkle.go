@@ -0,0 +1,155 @@
+// Package tally 实现可验证计票：为每张选票生成收据哈希，
+// 投票结束时对全部收据构建Merkle树并公布树根和最终票数。
+//
+// Merkle树的构造：
+//   - 叶子按收据哈希（十六进制字符串）升序排列
+//   - 叶子哈希 = sha256(0x00 || 收据字节)
+//   - 内部节点 = sha256(0x01 || 左子节点 || 右子节点)
+//   - 某一层节点数为奇数时，最后一个节点直接提升到上一层
+//   - 空树的根为 sha256("")
+//
+// 前缀区分叶子和内部节点，防止把内部节点伪装成叶子的第二原像攻击。
+package tally
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// 证明步骤中兄弟节点的位置
+const (
+	SideLeft  = "left"
+	SideRight = "right"
+)
+
+// ProofStep 包含性证明的一步：与兄弟节点合并
+type ProofStep struct {
+	Hash string `json:"hash"`
+	Side string `json:"side"` // 兄弟节点在左侧还是右侧
+}
+
+// Tree Merkle树，levels[0]为叶子层，最后一层为树根
+type Tree struct {
+	receipts []string
+	levels   [][][]byte
+}
+
+// leafHash 计算叶子哈希
+func leafHash(receipt []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, receipt...))
+	return sum[:]
+}
+
+// nodeHash 计算内部节点哈希
+func nodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, 0x01)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+// BuildTree 对收据构建Merkle树，收据会被复制并排序
+func BuildTree(receipts []string) (*Tree, error) {
+	sorted := append([]string(nil), receipts...)
+	sort.Strings(sorted)
+
+	leaves := make([][]byte, len(sorted))
+	for i, receipt := range sorted {
+		raw, err := hex.DecodeString(receipt)
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("无效的收据: %s", receipt)
+		}
+		if i > 0 && sorted[i-1] == receipt {
+			return nil, fmt.Errorf("重复的收据: %s", receipt)
+		}
+		leaves[i] = leafHash(raw)
+	}
+
+	tree := &Tree{receipts: sorted, levels: [][][]byte{leaves}}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, nodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+
+	return tree, nil
+}
+
+// Root 返回树根的十六进制表示
+func (t *Tree) Root() string {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:])
+	}
+	return hex.EncodeToString(top[0])
+}
+
+// Size 叶子数量
+func (t *Tree) Size() int {
+	return len(t.receipts)
+}
+
+// Proof 生成收据的包含性证明，返回叶子序号和证明路径
+func (t *Tree) Proof(receipt string) (int, []ProofStep, error) {
+	index := sort.SearchStrings(t.receipts, receipt)
+	if index >= len(t.receipts) || t.receipts[index] != receipt {
+		return 0, nil, fmt.Errorf("收据不在树中")
+	}
+
+	steps := []ProofStep{}
+	position := index
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if position%2 == 1 {
+			steps = append(steps, ProofStep{Hash: hex.EncodeToString(level[position-1]), Side: SideLeft})
+		} else if position+1 < len(level) {
+			steps = append(steps, ProofStep{Hash: hex.EncodeToString(level[position+1]), Side: SideRight})
+		}
+		// 没有兄弟节点时该节点直接提升，不产生证明步骤
+		position /= 2
+	}
+
+	return index, steps, nil
+}
+
+// VerifyProof 校验收据能否通过证明路径还原出树根
+func VerifyProof(receipt string, steps []ProofStep, root string) bool {
+	raw, err := hex.DecodeString(receipt)
+	if err != nil || len(raw) != sha256.Size {
+		return false
+	}
+	expected, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+
+	current := leafHash(raw)
+	for _, step := range steps {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		switch step.Side {
+		case SideLeft:
+			current = nodeHash(sibling, current)
+		case SideRight:
+			current = nodeHash(current, sibling)
+		default:
+			return false
+		}
+	}
+
+	return bytes.Equal(current, expected)
+}
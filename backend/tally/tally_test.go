@@ -0,0 +1,105 @@
+package tally
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleBallots(n int) []ExportedBallot {
+	ballots := make([]ExportedBallot, n)
+	for i := range ballots {
+		salt := fmt.Sprintf("%032x", i)
+		options := []uint{uint(i%3 + 1)}
+		ballots[i] = ExportedBallot{
+			Receipt:   Receipt(9, options, salt),
+			OptionIDs: options,
+			Salt:      salt,
+		}
+	}
+	return ballots
+}
+
+func receiptsOf(ballots []ExportedBallot) []string {
+	receipts := make([]string, len(ballots))
+	for i, ballot := range ballots {
+		receipts[i] = ballot.Receipt
+	}
+	return receipts
+}
+
+func TestReceipt_IgnoresOptionOrder(t *testing.T) {
+	assert.Equal(t, Receipt(1, []uint{3, 1}, "aa"), Receipt(1, []uint{1, 3}, "aa"))
+	assert.NotEqual(t, Receipt(1, []uint{1}, "aa"), Receipt(1, []uint{1}, "ab"))
+	assert.NotEqual(t, Receipt(1, []uint{1}, "aa"), Receipt(2, []uint{1}, "aa"))
+}
+
+func TestProof_AllLeavesVerify(t *testing.T) {
+	// Odd sizes exercise the promoted-node path
+	for _, n := range []int{1, 2, 3, 7, 16, 33} {
+		receipts := receiptsOf(sampleBallots(n))
+		tree, err := BuildTree(receipts)
+		require.NoError(t, err)
+
+		for _, receipt := range receipts {
+			_, proof, err := tree.Proof(receipt)
+			require.NoError(t, err)
+			assert.True(t, VerifyProof(receipt, proof, tree.Root()), "n=%d", n)
+		}
+	}
+}
+
+func TestProof_RejectsWrongRootOrReceipt(t *testing.T) {
+	receipts := receiptsOf(sampleBallots(5))
+	tree, err := BuildTree(receipts)
+	require.NoError(t, err)
+
+	_, proof, err := tree.Proof(receipts[0])
+	require.NoError(t, err)
+	assert.False(t, VerifyProof(receipts[1], proof, tree.Root()))
+
+	other, err := BuildTree(receipts[:4])
+	require.NoError(t, err)
+	assert.False(t, VerifyProof(receipts[0], proof, other.Root()))
+
+	_, _, err = tree.Proof(Receipt(9, []uint{1}, "missing"))
+	assert.Error(t, err)
+}
+
+func TestBuildTree_OrderIndependentAndRejectsDuplicates(t *testing.T) {
+	receipts := receiptsOf(sampleBallots(4))
+	a, err := BuildTree(receipts)
+	require.NoError(t, err)
+	b, err := BuildTree([]string{receipts[3], receipts[1], receipts[0], receipts[2]})
+	require.NoError(t, err)
+	assert.Equal(t, a.Root(), b.Root())
+
+	_, err = BuildTree(append(receipts, receipts[0]))
+	assert.Error(t, err)
+}
+
+func TestVerifyExport(t *testing.T) {
+	ballots := sampleBallots(6)
+	tree, err := BuildTree(receiptsOf(ballots))
+	require.NoError(t, err)
+
+	export := &Export{
+		PollID:      9,
+		MerkleRoot:  tree.Root(),
+		Counts:      Count(ballots),
+		BallotCount: len(ballots),
+		Ballots:     ballots,
+	}
+	assert.Empty(t, VerifyExport(export))
+
+	// Inflated announced count
+	export.Counts[1]++
+	assert.Len(t, VerifyExport(export), 1)
+	export.Counts[1]--
+
+	// Ballot content changed after publication
+	export.Ballots[0].OptionIDs = []uint{3}
+	assert.NotEmpty(t, VerifyExport(export))
+}
@@ -0,0 +1,4 @@
+// Package votingpb gRPC接口的消息和服务定义，由voting.proto生成，修改proto后重新生成
+package votingpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative voting.proto
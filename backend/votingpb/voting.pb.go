@@ -0,0 +1,1023 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: voting.proto
+
+package votingpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PollType int32
+
+const (
+	PollType_POLL_TYPE_SINGLE_CHOICE   PollType = 0
+	PollType_POLL_TYPE_MULTIPLE_CHOICE PollType = 1
+)
+
+// Enum value maps for PollType.
+var (
+	PollType_name = map[int32]string{
+		0: "POLL_TYPE_SINGLE_CHOICE",
+		1: "POLL_TYPE_MULTIPLE_CHOICE",
+	}
+	PollType_value = map[string]int32{
+		"POLL_TYPE_SINGLE_CHOICE":   0,
+		"POLL_TYPE_MULTIPLE_CHOICE": 1,
+	}
+)
+
+func (x PollType) Enum() *PollType {
+	p := new(PollType)
+	*p = x
+	return p
+}
+
+func (x PollType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PollType) Descriptor() protoreflect.EnumDescriptor {
+	return file_voting_proto_enumTypes[0].Descriptor()
+}
+
+func (PollType) Type() protoreflect.EnumType {
+	return &file_voting_proto_enumTypes[0]
+}
+
+func (x PollType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PollType.Descriptor instead.
+func (PollType) EnumDescriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{0}
+}
+
+type Option struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Votes         int64                  `protobuf:"varint,3,opt,name=votes,proto3" json:"votes,omitempty"`
+	Percentage    float64                `protobuf:"fixed64,4,opt,name=percentage,proto3" json:"percentage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Option) Reset() {
+	*x = Option{}
+	mi := &file_voting_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Option) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Option) ProtoMessage() {}
+
+func (x *Option) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Option.ProtoReflect.Descriptor instead.
+func (*Option) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Option) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Option) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Option) GetVotes() int64 {
+	if x != nil {
+		return x.Votes
+	}
+	return 0
+}
+
+func (x *Option) GetPercentage() float64 {
+	if x != nil {
+		return x.Percentage
+	}
+	return 0
+}
+
+type Poll struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Question      string                 `protobuf:"bytes,2,opt,name=question,proto3" json:"question,omitempty"`
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	PollType      PollType               `protobuf:"varint,4,opt,name=poll_type,json=pollType,proto3,enum=voting.v1.PollType" json:"poll_type,omitempty"`
+	IsActive      bool                   `protobuf:"varint,5,opt,name=is_active,json=isActive,proto3" json:"is_active,omitempty"`
+	Options       []*Option              `protobuf:"bytes,6,rep,name=options,proto3" json:"options,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Poll) Reset() {
+	*x = Poll{}
+	mi := &file_voting_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Poll) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Poll) ProtoMessage() {}
+
+func (x *Poll) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Poll.ProtoReflect.Descriptor instead.
+func (*Poll) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Poll) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Poll) GetQuestion() string {
+	if x != nil {
+		return x.Question
+	}
+	return ""
+}
+
+func (x *Poll) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Poll) GetPollType() PollType {
+	if x != nil {
+		return x.PollType
+	}
+	return PollType_POLL_TYPE_SINGLE_CHOICE
+}
+
+func (x *Poll) GetIsActive() bool {
+	if x != nil {
+		return x.IsActive
+	}
+	return false
+}
+
+func (x *Poll) GetOptions() []*Option {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *Poll) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *Poll) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Poll) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type CreatePollRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Question    string                 `protobuf:"bytes,1,opt,name=question,proto3" json:"question,omitempty"`
+	Description string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	PollType    PollType               `protobuf:"varint,3,opt,name=poll_type,json=pollType,proto3,enum=voting.v1.PollType" json:"poll_type,omitempty"`
+	// 选项文本，至少两个
+	Options        []string               `protobuf:"bytes,4,rep,name=options,proto3" json:"options,omitempty"`
+	EndTime        *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	AntiBotEnabled bool                   `protobuf:"varint,6,opt,name=anti_bot_enabled,json=antiBotEnabled,proto3" json:"anti_bot_enabled,omitempty"`
+	Verifiable     bool                   `protobuf:"varint,7,opt,name=verifiable,proto3" json:"verifiable,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CreatePollRequest) Reset() {
+	*x = CreatePollRequest{}
+	mi := &file_voting_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePollRequest) ProtoMessage() {}
+
+func (x *CreatePollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePollRequest.ProtoReflect.Descriptor instead.
+func (*CreatePollRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CreatePollRequest) GetQuestion() string {
+	if x != nil {
+		return x.Question
+	}
+	return ""
+}
+
+func (x *CreatePollRequest) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *CreatePollRequest) GetPollType() PollType {
+	if x != nil {
+		return x.PollType
+	}
+	return PollType_POLL_TYPE_SINGLE_CHOICE
+}
+
+func (x *CreatePollRequest) GetOptions() []string {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *CreatePollRequest) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *CreatePollRequest) GetAntiBotEnabled() bool {
+	if x != nil {
+		return x.AntiBotEnabled
+	}
+	return false
+}
+
+func (x *CreatePollRequest) GetVerifiable() bool {
+	if x != nil {
+		return x.Verifiable
+	}
+	return false
+}
+
+type GetPollRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PollId        uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPollRequest) Reset() {
+	*x = GetPollRequest{}
+	mi := &file_voting_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPollRequest) ProtoMessage() {}
+
+func (x *GetPollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPollRequest.ProtoReflect.Descriptor instead.
+func (*GetPollRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetPollRequest) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+type ListPollsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPollsRequest) Reset() {
+	*x = ListPollsRequest{}
+	mi := &file_voting_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPollsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPollsRequest) ProtoMessage() {}
+
+func (x *ListPollsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPollsRequest.ProtoReflect.Descriptor instead.
+func (*ListPollsRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{4}
+}
+
+type ListPollsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Polls         []*Poll                `protobuf:"bytes,1,rep,name=polls,proto3" json:"polls,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPollsResponse) Reset() {
+	*x = ListPollsResponse{}
+	mi := &file_voting_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPollsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPollsResponse) ProtoMessage() {}
+
+func (x *ListPollsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPollsResponse.ProtoReflect.Descriptor instead.
+func (*ListPollsResponse) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListPollsResponse) GetPolls() []*Poll {
+	if x != nil {
+		return x.Polls
+	}
+	return nil
+}
+
+type SubmitVoteRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	PollId    uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	OptionIds []uint32               `protobuf:"varint,2,rep,packed,name=option_ids,json=optionIds,proto3" json:"option_ids,omitempty"`
+	MessageId string                 `protobuf:"bytes,3,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// 启用防机器人模式的投票需要提供工作量证明
+	PowNonce      string `protobuf:"bytes,4,opt,name=pow_nonce,json=powNonce,proto3" json:"pow_nonce,omitempty"`
+	PowSolution   string `protobuf:"bytes,5,opt,name=pow_solution,json=powSolution,proto3" json:"pow_solution,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitVoteRequest) Reset() {
+	*x = SubmitVoteRequest{}
+	mi := &file_voting_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitVoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitVoteRequest) ProtoMessage() {}
+
+func (x *SubmitVoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitVoteRequest.ProtoReflect.Descriptor instead.
+func (*SubmitVoteRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SubmitVoteRequest) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+func (x *SubmitVoteRequest) GetOptionIds() []uint32 {
+	if x != nil {
+		return x.OptionIds
+	}
+	return nil
+}
+
+func (x *SubmitVoteRequest) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *SubmitVoteRequest) GetPowNonce() string {
+	if x != nil {
+		return x.PowNonce
+	}
+	return ""
+}
+
+func (x *SubmitVoteRequest) GetPowSolution() string {
+	if x != nil {
+		return x.PowSolution
+	}
+	return ""
+}
+
+type SubmitVoteResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Results []*Option              `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	// 可疑投票进入隔离区，审核通过前不计票
+	Quarantined  bool   `protobuf:"varint,3,opt,name=quarantined,proto3" json:"quarantined,omitempty"`
+	QuarantineId uint32 `protobuf:"varint,4,opt,name=quarantine_id,json=quarantineId,proto3" json:"quarantine_id,omitempty"`
+	// 可验证投票的选票回执
+	Receipt       string `protobuf:"bytes,5,opt,name=receipt,proto3" json:"receipt,omitempty"`
+	ReceiptSalt   string `protobuf:"bytes,6,opt,name=receipt_salt,json=receiptSalt,proto3" json:"receipt_salt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitVoteResponse) Reset() {
+	*x = SubmitVoteResponse{}
+	mi := &file_voting_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitVoteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitVoteResponse) ProtoMessage() {}
+
+func (x *SubmitVoteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitVoteResponse.ProtoReflect.Descriptor instead.
+func (*SubmitVoteResponse) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SubmitVoteResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *SubmitVoteResponse) GetResults() []*Option {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *SubmitVoteResponse) GetQuarantined() bool {
+	if x != nil {
+		return x.Quarantined
+	}
+	return false
+}
+
+func (x *SubmitVoteResponse) GetQuarantineId() uint32 {
+	if x != nil {
+		return x.QuarantineId
+	}
+	return 0
+}
+
+func (x *SubmitVoteResponse) GetReceipt() string {
+	if x != nil {
+		return x.Receipt
+	}
+	return ""
+}
+
+func (x *SubmitVoteResponse) GetReceiptSalt() string {
+	if x != nil {
+		return x.ReceiptSalt
+	}
+	return ""
+}
+
+type ResetPollRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PollId        uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetPollRequest) Reset() {
+	*x = ResetPollRequest{}
+	mi := &file_voting_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetPollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetPollRequest) ProtoMessage() {}
+
+func (x *ResetPollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetPollRequest.ProtoReflect.Descriptor instead.
+func (*ResetPollRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ResetPollRequest) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+type ResetPollResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PollId        uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	Results       []*Option              `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetPollResponse) Reset() {
+	*x = ResetPollResponse{}
+	mi := &file_voting_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetPollResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetPollResponse) ProtoMessage() {}
+
+func (x *ResetPollResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetPollResponse.ProtoReflect.Descriptor instead.
+func (*ResetPollResponse) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ResetPollResponse) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+func (x *ResetPollResponse) GetResults() []*Option {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type WatchPollRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	PollId uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	// 已收到的最大序号；不设置时先推送当前结果快照
+	Since         *uint64 `protobuf:"varint,2,opt,name=since,proto3,oneof" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchPollRequest) Reset() {
+	*x = WatchPollRequest{}
+	mi := &file_voting_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchPollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchPollRequest) ProtoMessage() {}
+
+func (x *WatchPollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchPollRequest.ProtoReflect.Descriptor instead.
+func (*WatchPollRequest) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchPollRequest) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+func (x *WatchPollRequest) GetSince() uint64 {
+	if x != nil && x.Since != nil {
+		return *x.Since
+	}
+	return 0
+}
+
+type PollUpdate struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	PollId uint32                 `protobuf:"varint,1,opt,name=poll_id,json=pollId,proto3" json:"poll_id,omitempty"`
+	// 与WebSocket消息相同的投票内序号
+	Seq uint64 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	// 为true时是完整快照，客户端应丢弃之前的状态
+	Snapshot      bool                   `protobuf:"varint,3,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Options       []*Option              `protobuf:"bytes,4,rep,name=options,proto3" json:"options,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PollUpdate) Reset() {
+	*x = PollUpdate{}
+	mi := &file_voting_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PollUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PollUpdate) ProtoMessage() {}
+
+func (x *PollUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_voting_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PollUpdate.ProtoReflect.Descriptor instead.
+func (*PollUpdate) Descriptor() ([]byte, []int) {
+	return file_voting_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PollUpdate) GetPollId() uint32 {
+	if x != nil {
+		return x.PollId
+	}
+	return 0
+}
+
+func (x *PollUpdate) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *PollUpdate) GetSnapshot() bool {
+	if x != nil {
+		return x.Snapshot
+	}
+	return false
+}
+
+func (x *PollUpdate) GetOptions() []*Option {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *PollUpdate) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+var File_voting_proto protoreflect.FileDescriptor
+
+const file_voting_proto_rawDesc = "" +
+	"\n" +
+	"\fvoting.proto\x12\tvoting.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"b\n" +
+	"\x06Option\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12\x14\n" +
+	"\x05votes\x18\x03 \x01(\x03R\x05votes\x12\x1e\n" +
+	"\n" +
+	"percentage\x18\x04 \x01(\x01R\n" +
+	"percentage\"\xfd\x02\n" +
+	"\x04Poll\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x1a\n" +
+	"\bquestion\x18\x02 \x01(\tR\bquestion\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x120\n" +
+	"\tpoll_type\x18\x04 \x01(\x0e2\x13.voting.v1.PollTypeR\bpollType\x12\x1b\n" +
+	"\tis_active\x18\x05 \x01(\bR\bisActive\x12+\n" +
+	"\aoptions\x18\x06 \x03(\v2\x11.voting.v1.OptionR\aoptions\x125\n" +
+	"\bend_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\x9e\x02\n" +
+	"\x11CreatePollRequest\x12\x1a\n" +
+	"\bquestion\x18\x01 \x01(\tR\bquestion\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x120\n" +
+	"\tpoll_type\x18\x03 \x01(\x0e2\x13.voting.v1.PollTypeR\bpollType\x12\x18\n" +
+	"\aoptions\x18\x04 \x03(\tR\aoptions\x125\n" +
+	"\bend_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12(\n" +
+	"\x10anti_bot_enabled\x18\x06 \x01(\bR\x0eantiBotEnabled\x12\x1e\n" +
+	"\n" +
+	"verifiable\x18\a \x01(\bR\n" +
+	"verifiable\")\n" +
+	"\x0eGetPollRequest\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\"\x12\n" +
+	"\x10ListPollsRequest\":\n" +
+	"\x11ListPollsResponse\x12%\n" +
+	"\x05polls\x18\x01 \x03(\v2\x0f.voting.v1.PollR\x05polls\"\xaa\x01\n" +
+	"\x11SubmitVoteRequest\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\x12\x1d\n" +
+	"\n" +
+	"option_ids\x18\x02 \x03(\rR\toptionIds\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x03 \x01(\tR\tmessageId\x12\x1b\n" +
+	"\tpow_nonce\x18\x04 \x01(\tR\bpowNonce\x12!\n" +
+	"\fpow_solution\x18\x05 \x01(\tR\vpowSolution\"\xdf\x01\n" +
+	"\x12SubmitVoteResponse\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12+\n" +
+	"\aresults\x18\x02 \x03(\v2\x11.voting.v1.OptionR\aresults\x12 \n" +
+	"\vquarantined\x18\x03 \x01(\bR\vquarantined\x12#\n" +
+	"\rquarantine_id\x18\x04 \x01(\rR\fquarantineId\x12\x18\n" +
+	"\areceipt\x18\x05 \x01(\tR\areceipt\x12!\n" +
+	"\freceipt_salt\x18\x06 \x01(\tR\vreceiptSalt\"+\n" +
+	"\x10ResetPollRequest\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\"Y\n" +
+	"\x11ResetPollResponse\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\x12+\n" +
+	"\aresults\x18\x02 \x03(\v2\x11.voting.v1.OptionR\aresults\"P\n" +
+	"\x10WatchPollRequest\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\x12\x19\n" +
+	"\x05since\x18\x02 \x01(\x04H\x00R\x05since\x88\x01\x01B\b\n" +
+	"\x06_since\"\xba\x01\n" +
+	"\n" +
+	"PollUpdate\x12\x17\n" +
+	"\apoll_id\x18\x01 \x01(\rR\x06pollId\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x04R\x03seq\x12\x1a\n" +
+	"\bsnapshot\x18\x03 \x01(\bR\bsnapshot\x12+\n" +
+	"\aoptions\x18\x04 \x03(\v2\x11.voting.v1.OptionR\aoptions\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp*F\n" +
+	"\bPollType\x12\x1b\n" +
+	"\x17POLL_TYPE_SINGLE_CHOICE\x10\x00\x12\x1d\n" +
+	"\x19POLL_TYPE_MULTIPLE_CHOICE\x10\x012\xa1\x03\n" +
+	"\rVotingService\x12;\n" +
+	"\n" +
+	"CreatePoll\x12\x1c.voting.v1.CreatePollRequest\x1a\x0f.voting.v1.Poll\x125\n" +
+	"\aGetPoll\x12\x19.voting.v1.GetPollRequest\x1a\x0f.voting.v1.Poll\x12F\n" +
+	"\tListPolls\x12\x1b.voting.v1.ListPollsRequest\x1a\x1c.voting.v1.ListPollsResponse\x12I\n" +
+	"\n" +
+	"SubmitVote\x12\x1c.voting.v1.SubmitVoteRequest\x1a\x1d.voting.v1.SubmitVoteResponse\x12F\n" +
+	"\tResetPoll\x12\x1b.voting.v1.ResetPollRequest\x1a\x1c.voting.v1.ResetPollResponse\x12A\n" +
+	"\tWatchPoll\x12\x1b.voting.v1.WatchPollRequest\x1a\x15.voting.v1.PollUpdate0\x01B\"Z realtime-voting-backend/votingpbb\x06proto3"
+
+var (
+	file_voting_proto_rawDescOnce sync.Once
+	file_voting_proto_rawDescData []byte
+)
+
+func file_voting_proto_rawDescGZIP() []byte {
+	file_voting_proto_rawDescOnce.Do(func() {
+		file_voting_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_voting_proto_rawDesc), len(file_voting_proto_rawDesc)))
+	})
+	return file_voting_proto_rawDescData
+}
+
+var file_voting_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_voting_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_voting_proto_goTypes = []any{
+	(PollType)(0),                 // 0: voting.v1.PollType
+	(*Option)(nil),                // 1: voting.v1.Option
+	(*Poll)(nil),                  // 2: voting.v1.Poll
+	(*CreatePollRequest)(nil),     // 3: voting.v1.CreatePollRequest
+	(*GetPollRequest)(nil),        // 4: voting.v1.GetPollRequest
+	(*ListPollsRequest)(nil),      // 5: voting.v1.ListPollsRequest
+	(*ListPollsResponse)(nil),     // 6: voting.v1.ListPollsResponse
+	(*SubmitVoteRequest)(nil),     // 7: voting.v1.SubmitVoteRequest
+	(*SubmitVoteResponse)(nil),    // 8: voting.v1.SubmitVoteResponse
+	(*ResetPollRequest)(nil),      // 9: voting.v1.ResetPollRequest
+	(*ResetPollResponse)(nil),     // 10: voting.v1.ResetPollResponse
+	(*WatchPollRequest)(nil),      // 11: voting.v1.WatchPollRequest
+	(*PollUpdate)(nil),            // 12: voting.v1.PollUpdate
+	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+}
+var file_voting_proto_depIdxs = []int32{
+	0,  // 0: voting.v1.Poll.poll_type:type_name -> voting.v1.PollType
+	1,  // 1: voting.v1.Poll.options:type_name -> voting.v1.Option
+	13, // 2: voting.v1.Poll.end_time:type_name -> google.protobuf.Timestamp
+	13, // 3: voting.v1.Poll.created_at:type_name -> google.protobuf.Timestamp
+	13, // 4: voting.v1.Poll.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 5: voting.v1.CreatePollRequest.poll_type:type_name -> voting.v1.PollType
+	13, // 6: voting.v1.CreatePollRequest.end_time:type_name -> google.protobuf.Timestamp
+	2,  // 7: voting.v1.ListPollsResponse.polls:type_name -> voting.v1.Poll
+	1,  // 8: voting.v1.SubmitVoteResponse.results:type_name -> voting.v1.Option
+	1,  // 9: voting.v1.ResetPollResponse.results:type_name -> voting.v1.Option
+	1,  // 10: voting.v1.PollUpdate.options:type_name -> voting.v1.Option
+	13, // 11: voting.v1.PollUpdate.timestamp:type_name -> google.protobuf.Timestamp
+	3,  // 12: voting.v1.VotingService.CreatePoll:input_type -> voting.v1.CreatePollRequest
+	4,  // 13: voting.v1.VotingService.GetPoll:input_type -> voting.v1.GetPollRequest
+	5,  // 14: voting.v1.VotingService.ListPolls:input_type -> voting.v1.ListPollsRequest
+	7,  // 15: voting.v1.VotingService.SubmitVote:input_type -> voting.v1.SubmitVoteRequest
+	9,  // 16: voting.v1.VotingService.ResetPoll:input_type -> voting.v1.ResetPollRequest
+	11, // 17: voting.v1.VotingService.WatchPoll:input_type -> voting.v1.WatchPollRequest
+	2,  // 18: voting.v1.VotingService.CreatePoll:output_type -> voting.v1.Poll
+	2,  // 19: voting.v1.VotingService.GetPoll:output_type -> voting.v1.Poll
+	6,  // 20: voting.v1.VotingService.ListPolls:output_type -> voting.v1.ListPollsResponse
+	8,  // 21: voting.v1.VotingService.SubmitVote:output_type -> voting.v1.SubmitVoteResponse
+	10, // 22: voting.v1.VotingService.ResetPoll:output_type -> voting.v1.ResetPollResponse
+	12, // 23: voting.v1.VotingService.WatchPoll:output_type -> voting.v1.PollUpdate
+	18, // [18:24] is the sub-list for method output_type
+	12, // [12:18] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_voting_proto_init() }
+func file_voting_proto_init() {
+	if File_voting_proto != nil {
+		return
+	}
+	file_voting_proto_msgTypes[10].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_voting_proto_rawDesc), len(file_voting_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_voting_proto_goTypes,
+		DependencyIndexes: file_voting_proto_depIdxs,
+		EnumInfos:         file_voting_proto_enumTypes,
+		MessageInfos:      file_voting_proto_msgTypes,
+	}.Build()
+	File_voting_proto = out.File
+	file_voting_proto_goTypes = nil
+	file_voting_proto_depIdxs = nil
+}
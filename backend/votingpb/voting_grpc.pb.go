@@ -0,0 +1,337 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: voting.proto
+
+package votingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	VotingService_CreatePoll_FullMethodName = "/voting.v1.VotingService/CreatePoll"
+	VotingService_GetPoll_FullMethodName    = "/voting.v1.VotingService/GetPoll"
+	VotingService_ListPolls_FullMethodName  = "/voting.v1.VotingService/ListPolls"
+	VotingService_SubmitVote_FullMethodName = "/voting.v1.VotingService/SubmitVote"
+	VotingService_ResetPoll_FullMethodName  = "/voting.v1.VotingService/ResetPoll"
+	VotingService_WatchPoll_FullMethodName  = "/voting.v1.VotingService/WatchPoll"
+)
+
+// VotingServiceClient is the client API for VotingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// # VotingService 与HTTP接口共用校验和业务逻辑的gRPC服务
+//
+// 管理操作（ResetPoll）需要在metadata中携带 x-admin-key，
+// 启用实时连接访问令牌时，WatchPoll需要携带 authorization: Bearer <令牌>。
+type VotingServiceClient interface {
+	// CreatePoll 创建投票
+	CreatePoll(ctx context.Context, in *CreatePollRequest, opts ...grpc.CallOption) (*Poll, error)
+	// GetPoll 获取投票详情和当前结果
+	GetPoll(ctx context.Context, in *GetPollRequest, opts ...grpc.CallOption) (*Poll, error)
+	// ListPolls 获取全部投票，最新的在前
+	ListPolls(ctx context.Context, in *ListPollsRequest, opts ...grpc.CallOption) (*ListPollsResponse, error)
+	// SubmitVote 提交投票，规则与增强版投票接口相同
+	SubmitVote(ctx context.Context, in *SubmitVoteRequest, opts ...grpc.CallOption) (*SubmitVoteResponse, error)
+	// ResetPoll 将投票的所有选项票数清零
+	ResetPoll(ctx context.Context, in *ResetPollRequest, opts ...grpc.CallOption) (*ResetPollResponse, error)
+	// WatchPoll 订阅投票结果，数据来源与WebSocket推送相同
+	WatchPoll(ctx context.Context, in *WatchPollRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PollUpdate], error)
+}
+
+type votingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVotingServiceClient(cc grpc.ClientConnInterface) VotingServiceClient {
+	return &votingServiceClient{cc}
+}
+
+func (c *votingServiceClient) CreatePoll(ctx context.Context, in *CreatePollRequest, opts ...grpc.CallOption) (*Poll, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Poll)
+	err := c.cc.Invoke(ctx, VotingService_CreatePoll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *votingServiceClient) GetPoll(ctx context.Context, in *GetPollRequest, opts ...grpc.CallOption) (*Poll, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Poll)
+	err := c.cc.Invoke(ctx, VotingService_GetPoll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *votingServiceClient) ListPolls(ctx context.Context, in *ListPollsRequest, opts ...grpc.CallOption) (*ListPollsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPollsResponse)
+	err := c.cc.Invoke(ctx, VotingService_ListPolls_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *votingServiceClient) SubmitVote(ctx context.Context, in *SubmitVoteRequest, opts ...grpc.CallOption) (*SubmitVoteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitVoteResponse)
+	err := c.cc.Invoke(ctx, VotingService_SubmitVote_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *votingServiceClient) ResetPoll(ctx context.Context, in *ResetPollRequest, opts ...grpc.CallOption) (*ResetPollResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResetPollResponse)
+	err := c.cc.Invoke(ctx, VotingService_ResetPoll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *votingServiceClient) WatchPoll(ctx context.Context, in *WatchPollRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PollUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VotingService_ServiceDesc.Streams[0], VotingService_WatchPoll_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchPollRequest, PollUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VotingService_WatchPollClient = grpc.ServerStreamingClient[PollUpdate]
+
+// VotingServiceServer is the server API for VotingService service.
+// All implementations must embed UnimplementedVotingServiceServer
+// for forward compatibility.
+//
+// # VotingService 与HTTP接口共用校验和业务逻辑的gRPC服务
+//
+// 管理操作（ResetPoll）需要在metadata中携带 x-admin-key，
+// 启用实时连接访问令牌时，WatchPoll需要携带 authorization: Bearer <令牌>。
+type VotingServiceServer interface {
+	// CreatePoll 创建投票
+	CreatePoll(context.Context, *CreatePollRequest) (*Poll, error)
+	// GetPoll 获取投票详情和当前结果
+	GetPoll(context.Context, *GetPollRequest) (*Poll, error)
+	// ListPolls 获取全部投票，最新的在前
+	ListPolls(context.Context, *ListPollsRequest) (*ListPollsResponse, error)
+	// SubmitVote 提交投票，规则与增强版投票接口相同
+	SubmitVote(context.Context, *SubmitVoteRequest) (*SubmitVoteResponse, error)
+	// ResetPoll 将投票的所有选项票数清零
+	ResetPoll(context.Context, *ResetPollRequest) (*ResetPollResponse, error)
+	// WatchPoll 订阅投票结果，数据来源与WebSocket推送相同
+	WatchPoll(*WatchPollRequest, grpc.ServerStreamingServer[PollUpdate]) error
+	mustEmbedUnimplementedVotingServiceServer()
+}
+
+// UnimplementedVotingServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVotingServiceServer struct{}
+
+func (UnimplementedVotingServiceServer) CreatePoll(context.Context, *CreatePollRequest) (*Poll, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreatePoll not implemented")
+}
+func (UnimplementedVotingServiceServer) GetPoll(context.Context, *GetPollRequest) (*Poll, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPoll not implemented")
+}
+func (UnimplementedVotingServiceServer) ListPolls(context.Context, *ListPollsRequest) (*ListPollsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPolls not implemented")
+}
+func (UnimplementedVotingServiceServer) SubmitVote(context.Context, *SubmitVoteRequest) (*SubmitVoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitVote not implemented")
+}
+func (UnimplementedVotingServiceServer) ResetPoll(context.Context, *ResetPollRequest) (*ResetPollResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetPoll not implemented")
+}
+func (UnimplementedVotingServiceServer) WatchPoll(*WatchPollRequest, grpc.ServerStreamingServer[PollUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPoll not implemented")
+}
+func (UnimplementedVotingServiceServer) mustEmbedUnimplementedVotingServiceServer() {}
+func (UnimplementedVotingServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeVotingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VotingServiceServer will
+// result in compilation errors.
+type UnsafeVotingServiceServer interface {
+	mustEmbedUnimplementedVotingServiceServer()
+}
+
+func RegisterVotingServiceServer(s grpc.ServiceRegistrar, srv VotingServiceServer) {
+	// If the following call pancis, it indicates UnimplementedVotingServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VotingService_ServiceDesc, srv)
+}
+
+func _VotingService_CreatePoll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePollRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VotingServiceServer).CreatePoll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VotingService_CreatePoll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VotingServiceServer).CreatePoll(ctx, req.(*CreatePollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VotingService_GetPoll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPollRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VotingServiceServer).GetPoll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VotingService_GetPoll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VotingServiceServer).GetPoll(ctx, req.(*GetPollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VotingService_ListPolls_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPollsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VotingServiceServer).ListPolls(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VotingService_ListPolls_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VotingServiceServer).ListPolls(ctx, req.(*ListPollsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VotingService_SubmitVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitVoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VotingServiceServer).SubmitVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VotingService_SubmitVote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VotingServiceServer).SubmitVote(ctx, req.(*SubmitVoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VotingService_ResetPoll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetPollRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VotingServiceServer).ResetPoll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VotingService_ResetPoll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VotingServiceServer).ResetPoll(ctx, req.(*ResetPollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VotingService_WatchPoll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPollRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VotingServiceServer).WatchPoll(m, &grpc.GenericServerStream[WatchPollRequest, PollUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VotingService_WatchPollServer = grpc.ServerStreamingServer[PollUpdate]
+
+// VotingService_ServiceDesc is the grpc.ServiceDesc for VotingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VotingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "voting.v1.VotingService",
+	HandlerType: (*VotingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreatePoll",
+			Handler:    _VotingService_CreatePoll_Handler,
+		},
+		{
+			MethodName: "GetPoll",
+			Handler:    _VotingService_GetPoll_Handler,
+		},
+		{
+			MethodName: "ListPolls",
+			Handler:    _VotingService_ListPolls_Handler,
+		},
+		{
+			MethodName: "SubmitVote",
+			Handler:    _VotingService_SubmitVote_Handler,
+		},
+		{
+			MethodName: "ResetPoll",
+			Handler:    _VotingService_ResetPoll_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPoll",
+			Handler:       _VotingService_WatchPoll_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "voting.proto",
+}
@@ -0,0 +1,182 @@
+// Package webhook 投票生命周期和投票事件的外发通知
+//
+// 每次投递的请求体为JSON事件，签名为 HMAC-SHA256(密钥, 时间戳 + "." + 请求体) 的十六进制，
+// 接收方用订阅密钥重新计算并比较 X-Webhook-Signature，同时检查时间戳防止重放。
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 事件类型
+const (
+	EventPollCreated   = "poll.created"
+	EventPollOpened    = "poll.opened"
+	EventPollClosed    = "poll.closed"
+	EventPollReset     = "poll.reset"
+	EventVoteThreshold = "poll.vote_threshold"
+)
+
+// Events 所有可订阅的事件
+var Events = []string{EventPollCreated, EventPollOpened, EventPollClosed, EventPollReset, EventVoteThreshold}
+
+// 投递请求头
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// 签名前缀，便于以后更换算法
+const signaturePrefix = "sha256="
+
+var (
+	ErrInvalidURL   = errors.New("webhook地址必须是http或https URL")
+	ErrNoEvents     = errors.New("至少需要订阅一个事件")
+	ErrUnknownEvent = errors.New("未知的事件类型")
+)
+
+// Event 一次事件通知的请求体
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"event"`
+	PollID    uint        `json:"poll_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// NewEvent 创建事件，ID随机生成，接收方可用于去重
+func NewEvent(eventType string, pollID uint, data interface{}) Event {
+	return Event{
+		ID:        "evt_" + randomHex(12),
+		Type:      eventType,
+		PollID:    pollID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// Sign 计算请求体签名
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验签名，接收方使用；tolerance为0时不检查时间戳
+func Verify(secret string, timestamp int64, body []byte, signature string, tolerance time.Duration, now time.Time) bool {
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return false
+		}
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret 生成订阅密钥
+func NewSecret() string {
+	return "whsec_" + randomHex(24)
+}
+
+// ValidateURL 检查投递地址
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// NormalizeEvents 校验并去重事件列表，返回按字母排序的逗号分隔字符串
+func NormalizeEvents(events []string) (string, error) {
+	seen := make(map[string]bool)
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		if !knownEvent(event) {
+			return "", fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+		}
+		seen[event] = true
+	}
+	if len(seen) == 0 {
+		return "", ErrNoEvents
+	}
+
+	normalized := make([]string, 0, len(seen))
+	for event := range seen {
+		normalized = append(normalized, event)
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ","), nil
+}
+
+// Subscribed 判断逗号分隔的订阅事件列表是否包含事件
+func Subscribed(events string, event string) bool {
+	for _, e := range strings.Split(events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseThresholds 解析逗号分隔的票数阈值，忽略无效值，返回升序结果
+func ParseThresholds(list string) []int64 {
+	var thresholds []int64
+	seen := make(map[int64]bool)
+	for _, part := range strings.Split(list, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || n <= 0 || seen[n] {
+			continue
+		}
+		seen[n] = true
+		thresholds = append(thresholds, n)
+	}
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+	return thresholds
+}
+
+// Reached 返回总票数已达到的阈值，调用方需要自行去重已通知过的阈值
+func Reached(thresholds []int64, total int64) []int64 {
+	var reached []int64
+	for _, t := range thresholds {
+		if total < t {
+			break
+		}
+		reached = append(reached, t)
+	}
+	return reached
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
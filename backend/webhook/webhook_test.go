@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"poll.closed"}`)
+	now := time.Unix(1700000000, 0)
+
+	signature := Sign("secret", now.Unix(), body)
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+
+	assert.True(t, Verify("secret", now.Unix(), body, signature, 5*time.Minute, now))
+	assert.False(t, Verify("other", now.Unix(), body, signature, 5*time.Minute, now))
+	assert.False(t, Verify("secret", now.Unix(), []byte(`{"event":"poll.opened"}`), signature, 5*time.Minute, now))
+	// The timestamp is part of the signed content, so it cannot be swapped for a fresh one
+	assert.False(t, Verify("secret", now.Unix()+1, body, signature, 0, now))
+	assert.False(t, Verify("secret", now.Unix(), body, signature, 5*time.Minute, now.Add(10*time.Minute)))
+}
+
+func TestNormalizeEvents(t *testing.T) {
+	events, err := NormalizeEvents([]string{"poll.closed", " poll.created", "poll.closed"})
+	require.NoError(t, err)
+	assert.Equal(t, "poll.closed,poll.created", events)
+	assert.True(t, Subscribed(events, EventPollClosed))
+	assert.False(t, Subscribed(events, EventPollReset))
+
+	_, err = NormalizeEvents([]string{"poll.deleted"})
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	_, err = NormalizeEvents([]string{" "})
+	assert.ErrorIs(t, err, ErrNoEvents)
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://hooks.example.com/voting"))
+	assert.NoError(t, ValidateURL("http://127.0.0.1:8080/hook"))
+	assert.ErrorIs(t, ValidateURL("ftp://example.com"), ErrInvalidURL)
+	assert.ErrorIs(t, ValidateURL("/relative"), ErrInvalidURL)
+}
+
+func TestThresholds(t *testing.T) {
+	thresholds := ParseThresholds("1000, 100,abc,-5,100,10")
+	assert.Equal(t, []int64{10, 100, 1000}, thresholds)
+
+	assert.Empty(t, Reached(thresholds, 9))
+	assert.Equal(t, []int64{10, 100}, Reached(thresholds, 100))
+}
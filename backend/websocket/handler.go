@@ -3,9 +3,12 @@ package websocket
 import (
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
+	"realtime-voting-backend/streamauth"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -24,13 +27,34 @@ const (
 	maxMessageSize = 512
 )
 
+var (
+	// 允许建立连接的页面来源，与handlers包共用STREAM_ALLOWED_ORIGINS
+	allowedOrigins = streamauth.ParseOrigins(os.Getenv("STREAM_ALLOWED_ORIGINS"))
+
+	// 访问令牌校验器，只有STREAM_AUTH_DISABLED=true时不校验令牌
+	tokenSigner = newTokenSigner()
+)
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	// 允许所有跨域请求，生产环境应限制
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	// 只允许允许列表中的来源，未配置时只允许同域页面
+	CheckOrigin: allowedOrigins.Allowed,
+}
+
+func newTokenSigner() *streamauth.Signer {
+	if os.Getenv("STREAM_AUTH_DISABLED") == "true" {
+		return nil
+	}
+	if secret := os.Getenv("STREAM_TOKEN_SECRET"); secret != "" {
+		return streamauth.NewSigner([]byte(secret))
+	}
+	// 未配置密钥时使用随机密钥，拒绝所有外部签发的令牌
+	signer, err := streamauth.NewRandomSigner()
+	if err != nil {
+		log.Fatalf("生成实时连接访问令牌密钥失败: %v", err)
+	}
+	return signer
 }
 
 // Handler WebSocket处理器
@@ -58,6 +82,20 @@ func (h *Handler) HandleWebSocketConnection(c *gin.Context) {
 		return
 	}
 
+	// 校验访问令牌
+	var claims *streamauth.Claims
+	if tokenSigner != nil {
+		claims, err = tokenSigner.Verify(c.Query("token"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if !claims.CanView(uint(pollID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token does not grant access to this poll"})
+			return
+		}
+	}
+
 	// 升级HTTP连接为WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -75,6 +113,16 @@ func (h *Handler) HandleWebSocketConnection(c *gin.Context) {
 	// 注册客户端
 	h.hub.RegisterClient(client)
 
+	// 令牌过期时关闭连接，客户端需使用新令牌重连
+	if claims != nil {
+		expiry := time.AfterFunc(time.Until(claims.Expiry()), func() {
+			message := websocket.FormatCloseMessage(streamauth.CloseTokenExpired, "token expired")
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+			conn.Close()
+		})
+		client.expiry = expiry
+	}
+
 	// 启动客户端goroutine
 	go h.writePump(client)
 	go h.readPump(client)
@@ -85,6 +133,9 @@ func (h *Handler) HandleWebSocketConnection(c *gin.Context) {
 // readPump 从WebSocket连接读取消息
 func (h *Handler) readPump(client *Client) {
 	defer func() {
+		if client.expiry != nil {
+			client.expiry.Stop()
+		}
 		h.hub.UnregisterClient(client)
 		client.conn.Close()
 	}()
@@ -3,6 +3,7 @@ package websocket
 import (
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -19,6 +20,9 @@ type Client struct {
 
 	// 消息发送通道
 	send chan []byte
+
+	// 访问令牌过期计时，未启用令牌校验时为nil
+	expiry *time.Timer
 }
 
 // Hub 维护活跃的客户端集合并向客户端广播消息
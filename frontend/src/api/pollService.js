@@ -1,4 +1,5 @@
 import axios from 'axios';
+import { getStreamToken, withStreamToken } from '../services/streamTokenService';
 
 // API基础URL
 const API_BASE_URL = 'http://localhost:8090/api';
@@ -99,8 +100,8 @@ const pollService = {
     }
   },
 
-  // 创建WebSocket连接
-  createWebSocketConnection: (pollId) => {
+  // 创建WebSocket连接，先获取访问令牌并通过token参数携带
+  createWebSocketConnection: async (pollId) => {
     // 检查环境和参数
     if (!pollId) {
       console.error('创建WebSocket连接失败: 缺少投票ID');
@@ -117,8 +118,11 @@ const pollService = {
       const wsUrl = `${protocol}//${host}:${port}/api/polls/${pollId}/ws?keepalive=true`;
       console.log('WebSocket连接地址:', wsUrl);
       
+      // 浏览器的WebSocket不能设置请求头，令牌通过查询参数携带
+      const token = await getStreamToken(Number(pollId));
+      
       // 创建WebSocket实例并返回
-      const ws = new WebSocket(wsUrl);
+      const ws = new WebSocket(withStreamToken(wsUrl, token));
       
       // 设置一个ping定时器，保持连接活跃 
       const pingInterval = setInterval(() => {
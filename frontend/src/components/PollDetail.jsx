@@ -4,6 +4,7 @@ import { Card, Typography, Radio, Checkbox, Button, Spin, notification, Progress
 import { BarChartOutlined, ArrowLeftOutlined, EditOutlined, DeleteOutlined, PieChartOutlined, LineChartOutlined, ReloadOutlined } from '@ant-design/icons';
 import { PieChart, Pie, BarChart, Bar, XAxis, YAxis, CartesianGrid, Tooltip, Legend, ResponsiveContainer, Cell } from 'recharts';
 import pollService from '../api/pollService';
+import { clearStreamToken, STREAM_TOKEN_EXPIRED_CODE } from '../services/streamTokenService';
 import './PollDetail.css';
 import dayjs from 'dayjs';
 
@@ -529,12 +530,21 @@ const PollDetail = () => {
     let reconnectAttempts = 0;
     const MAX_RECONNECT_ATTEMPTS = 5;
     let reconnectTimeout = null;
+    let cancelled = false;
 
     // 创建WebSocket连接的函数
-    const createWebSocketConnection = () => {
+    const createWebSocketConnection = async () => {
       try {
         console.log(`尝试为投票ID ${pollId} 创建WebSocket连接 (尝试#${reconnectAttempts+1})`);
-        const ws = pollService.createWebSocketConnection(pollId);
+        const ws = await pollService.createWebSocketConnection(pollId);
+        
+        // 等待令牌期间组件已卸载或poll已改变
+        if (cancelled) {
+          if (ws) {
+            ws.close(1000, 'Component unmounted');
+          }
+          return;
+        }
         
         if (ws) {
           webSocketRef.current = ws;
@@ -574,15 +584,27 @@ const PollDetail = () => {
             console.log('WebSocket连接已关闭, 代码:', event.code, '原因:', event.reason);
             setWsConnected(false);
             
+            // 访问令牌过期，重新获取令牌后立即重连，不计入重试次数
+            if (event.code === STREAM_TOKEN_EXPIRED_CODE) {
+              clearStreamToken(Number(pollId));
+              if (!cancelled && webSocketRef.current === ws) {
+                webSocketRef.current = null;
+                createWebSocketConnection();
+              }
+              return;
+            }
+            
             // 如果连接异常关闭，尝试重连
             if (event.code !== 1000 && event.code !== 1001) { // 非正常关闭
+              // 连接可能因令牌被拒绝而失败，重连时重新获取令牌
+              clearStreamToken(Number(pollId));
               if (reconnectAttempts < MAX_RECONNECT_ATTEMPTS) {
                 reconnectAttempts++;
                 const delay = Math.min(1000 * Math.pow(2, reconnectAttempts), 30000); // 指数退避，最长30秒
                 console.log(`将在 ${delay}ms 后尝试重连 (尝试 ${reconnectAttempts}/${MAX_RECONNECT_ATTEMPTS})`);
                 
                 reconnectTimeout = setTimeout(() => {
-                  if (webSocketRef.current === ws) {
+                  if (!cancelled && webSocketRef.current === ws) {
                     webSocketRef.current = null;
                     createWebSocketConnection(); // 重连
                   }
@@ -629,7 +651,9 @@ const PollDetail = () => {
           console.log(`连接失败，将在 ${delay}ms 后尝试重连 (尝试 ${reconnectAttempts}/${MAX_RECONNECT_ATTEMPTS})`);
           
           reconnectTimeout = setTimeout(() => {
-            createWebSocketConnection();
+            if (!cancelled) {
+              createWebSocketConnection();
+            }
           }, delay);
         }
       }
@@ -640,6 +664,7 @@ const PollDetail = () => {
 
     // 当组件卸载或poll改变时，清理资源
     return () => {
+      cancelled = true;
       if (reconnectTimeout) {
         clearTimeout(reconnectTimeout);
       }
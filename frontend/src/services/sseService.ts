@@ -1,5 +1,6 @@
 import { PollOptionResult } from '../types';
 import { API_BASE_URL } from '../config';
+import { clearStreamToken, getStreamToken, withStreamToken } from './streamTokenService';
 
 interface SSECallbacks {
   onMessage: (data: any) => void;
@@ -29,9 +30,8 @@ class SSEService {
     this.retryCount = 0;
     
     try {
-      // 尝试连接投票实时更新的端点
-      console.log(`[SSEService] 正在连接SSE: /api/polls/${pollId}/live-results`);
-      this.createEventSource(`${API_BASE_URL}/api/polls/${pollId}/live-results`);
+      console.log(`[SSEService] 正在连接SSE: /api/polls/${pollId}/live`);
+      this.openStream(pollId);
     } catch (error) {
       console.error('[SSEService] 连接SSE时发生错误:', error);
       if (this.callbacks) {
@@ -40,6 +40,18 @@ class SSEService {
     }
   }
 
+  /**
+   * 获取访问令牌后连接SSE，EventSource不能设置请求头，令牌通过查询参数携带
+   */
+  private async openStream(pollId: number) {
+    const token = await getStreamToken(pollId);
+    // 等待令牌期间已断开或切换到其他投票
+    if (this.pollId !== pollId) {
+      return;
+    }
+    this.createEventSource(withStreamToken(`${API_BASE_URL}/api/polls/${pollId}/live`, token));
+  }
+
   private createEventSource(url: string) {
     try {
       console.log(`[SSEService] 创建EventSource: ${url}`);
@@ -53,7 +65,7 @@ class SSEService {
         }
       };
       
-      this.eventSource.onmessage = (event) => {
+      const handleMessage = (event: MessageEvent) => {
         try {
           console.log(`[SSEService] 收到SSE消息: ${event.data.substring(0, 100)}...`);
           const data = JSON.parse(event.data);
@@ -65,6 +77,18 @@ class SSEService {
           console.error('[SSEService] 原始消息:', event.data);
         }
       };
+
+      // 服务端按类型发送事件：results为投票结果，closed为投票关闭，status和heartbeat仅用于连接维护
+      this.eventSource.onmessage = handleMessage;
+      this.eventSource.addEventListener('results', handleMessage as EventListener);
+      this.eventSource.addEventListener('closed', (event) => {
+        handleMessage(event as MessageEvent);
+        // 投票已关闭，结果不会再变化
+        this.disconnect();
+      });
+      this.eventSource.addEventListener('status', (event) => {
+        console.log(`[SSEService] 连接状态: ${(event as MessageEvent).data}`);
+      });
       
       this.eventSource.onerror = (event) => {
         console.error('[SSEService] SSE连接错误:', event);
@@ -72,6 +96,10 @@ class SSEService {
         if (this.eventSource) {
           if (this.eventSource.readyState === EventSource.CLOSED) {
             console.log('[SSEService] SSE连接已关闭');
+            // 令牌过期或被拒绝时浏览器不会自动重连，重新获取令牌后再连接
+            if (this.pollId !== null) {
+              clearStreamToken(this.pollId);
+            }
             // 尝试重新连接
             this.retryConnection();
           } else if (this.eventSource.readyState === EventSource.CONNECTING) {
@@ -98,23 +126,9 @@ class SSEService {
       setTimeout(() => {
         this.retryCount++;
         
-        // 优先尝试live-results端点
-        try {
-          console.log(`[SSEService] 重试连接: /api/polls/${this.pollId}/live-results`);
-          this.createEventSource(`${API_BASE_URL}/api/polls/${this.pollId}/live-results`);
-        } catch (error) {
-          console.error('[SSEService] 重试连接live-results端点时出错:', error);
-          
-          // 如果live-results失败，尝试live端点
-          try {
-            console.log(`[SSEService] 尝试备用连接: /api/polls/${this.pollId}/live`);
-            this.createEventSource(`${API_BASE_URL}/api/polls/${this.pollId}/live`);
-          } catch (fallbackError) {
-            console.error('[SSEService] 备用连接也失败:', fallbackError);
-            if (this.callbacks) {
-              this.callbacks.onError('所有SSE连接尝试均失败');
-            }
-          }
+        if (this.pollId !== null) {
+          console.log(`[SSEService] 重试连接: /api/polls/${this.pollId}/live`);
+          this.openStream(this.pollId);
         }
       }, this.retryInterval);
     } else if (this.callbacks) {
@@ -0,0 +1,56 @@
+import axios from 'axios';
+import { API_BASE_URL } from '../config';
+
+// 令牌过期时服务端关闭WebSocket使用的代码，收到后需要重新获取令牌再连接
+export const STREAM_TOKEN_EXPIRED_CODE = 4001;
+
+// 距离过期不足该时间的令牌视为已过期，避免连接刚建立就被关闭
+const REFRESH_MARGIN_MS = 60 * 1000;
+
+interface CachedStreamToken {
+  token: string;
+  expiresAt: number;
+}
+
+const tokens = new Map<number, CachedStreamToken>();
+
+/**
+ * 获取观看投票实时更新（WebSocket/SSE）的访问令牌
+ * 服务端关闭令牌校验（STREAM_AUTH_DISABLED=true）或签发失败时返回null，按无令牌连接
+ * @param pollId 投票ID
+ */
+export async function getStreamToken(pollId: number): Promise<string | null> {
+  const cached = tokens.get(pollId);
+  if (cached && cached.expiresAt - REFRESH_MARGIN_MS > Date.now()) {
+    return cached.token;
+  }
+
+  try {
+    const response = await axios.post(`${API_BASE_URL}/api/stream-token`, { poll_ids: [pollId] }, { timeout: 10000 });
+    const { token, expires_at: expiresAt } = response.data;
+    tokens.set(pollId, { token, expiresAt: Date.parse(expiresAt) });
+    return token;
+  } catch (error: any) {
+    console.warn('[StreamToken] 获取实时连接令牌失败，将不带令牌连接:', error.response?.data || error.message);
+    return null;
+  }
+}
+
+/**
+ * 丢弃缓存的令牌，下次连接时重新获取
+ * @param pollId 投票ID
+ */
+export function clearStreamToken(pollId: number): void {
+  tokens.delete(pollId);
+}
+
+/**
+ * 在实时连接地址后附加令牌参数
+ */
+export function withStreamToken(url: string, token: string | null): string {
+  if (!token) {
+    return url;
+  }
+  const separator = url.includes('?') ? '&' : '?';
+  return `${url}${separator}token=${encodeURIComponent(token)}`;
+}